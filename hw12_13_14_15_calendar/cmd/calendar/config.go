@@ -1,20 +1,293 @@
 package main
 
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
 // При желании конфигурацию можно вынести в internal/config.
 // Организация конфига в main принуждает нас сужать API компонентов, использовать
 // при их конструировании только необходимые параметры, а также уменьшает вероятность циклической зависимости.
 type Config struct {
-	Logger LoggerConf
-	// TODO
+	Logger   LoggerConf   `config:"logger"`
+	Storage  StorageConf  `config:"storage"`
+	HTTP     ServerConf   `config:"http"`
+	GRPC     ServerConf   `config:"grpc"`
+	Calendar CalendarConf `config:"calendar"`
+	Shutdown ShutdownConf `config:"shutdown"`
+	Tracing  TracingConf  `config:"tracing"`
+	Limits   LimitsConf   `config:"limits"`
 }
 
 type LoggerConf struct {
-	Level string
-	// TODO
+	Level  string `config:"level"`
+	Format string `config:"format"`
+	// File is a path to the log file, logs go to stderr when it is empty.
+	File string `config:"file"`
+}
+
+func (c LoggerConf) Options() logger.Options {
+	return logger.Options{Level: c.Level, Format: c.Format, File: c.File}
+}
+
+type StorageConf struct {
+	Type    string `config:"type,required"`
+	DSN     string `config:"dsn"`
+	Migrate bool   `config:"migrate"`
+}
+
+func (c StorageConf) Options() setup.StorageOptions {
+	return setup.StorageOptions{Type: c.Type, DSN: c.DSN, Migrate: c.Migrate}
+}
+
+type ServerConf struct {
+	Host string `config:"host"`
+	Port int    `config:"port,required"`
+}
+
+func (c ServerConf) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+type ShutdownConf struct {
+	// DrainDelay is how long the service reports it is not ready before
+	// the servers stop, so load balancers have time to notice.
+	DrainDelay time.Duration `config:"drain_delay"`
+	// Timeout limits waiting for active requests to finish.
+	Timeout time.Duration `config:"timeout"`
+}
+
+// CalendarConf holds the settings of users who have not saved their own,
+// the limits of the change feed and the event quota.
+type CalendarConf struct {
+	TimeZone  string `config:"time_zone"`
+	WeekStart string `config:"week_start"`
+	// ChangeBuffer is the number of changes kept for resuming event streams.
+	ChangeBuffer int `config:"change_buffer"`
+	// SubscriberBuffer is the number of changes a stream may lag behind.
+	SubscriberBuffer int `config:"subscriber_buffer"`
+	// MaxEventsPerUser caps the events a user owns, see app.Options.MaxEvents.
+	MaxEventsPerUser int `config:"max_events_per_user"`
+}
+
+// Options returns the app options, the config must be valid.
+func (c CalendarConf) Options() app.Options {
+	weekStart, _ := storage.ParseWeekday(c.WeekStart)
+	return app.Options{
+		TimeZone:         c.TimeZone,
+		WeekStart:        weekStart,
+		ChangeBuffer:     c.ChangeBuffer,
+		SubscriberBuffer: c.SubscriberBuffer,
+		MaxEvents:        c.MaxEventsPerUser,
+	}
+}
+
+// TracingConf selects where spans are exported, see tracing.Options.
+type TracingConf struct {
+	// Exporter is "none", "otlp", "stdout" or "file".
+	Exporter    string  `config:"exporter"`
+	Endpoint    string  `config:"endpoint"`
+	Insecure    bool    `config:"insecure"`
+	File        string  `config:"file"`
+	SampleRatio float64 `config:"sample_ratio"`
 }
 
-func NewConfig() Config {
-	return Config{}
+func (c TracingConf) Options() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Exporter,
+		Endpoint:    c.Endpoint,
+		Insecure:    c.Insecure,
+		File:        c.File,
+		SampleRatio: c.SampleRatio,
+	}
 }
 
-// TODO
+// LimitsConf protects the HTTP and gRPC APIs from clients sending too much.
+// Rates are requests a second refilling buckets of burst requests, a zero
+// rate or body size turns the limit off.
+type LimitsConf struct {
+	UserRate     float64 `config:"user_rate"`
+	UserBurst    int     `config:"user_burst"`
+	IPRate       float64 `config:"ip_rate"`
+	IPBurst      int     `config:"ip_burst"`
+	MaxBodyBytes int64   `config:"max_body_bytes"`
+	// TrustedProxies is a comma separated list of addresses and networks
+	// of proxies whose X-Forwarded-For is believed when limiting by IP.
+	TrustedProxies string `config:"trusted_proxies"`
+}
+
+// Proxies returns the trusted proxies, the config must be valid.
+func (c LimitsConf) Proxies() ratelimit.Proxies {
+	proxies, _ := ratelimit.ParseProxies(c.TrustedProxies)
+	return proxies
+}
+
+// envPrefix is prepended to environment variables overriding config keys,
+// e.g. CALENDAR_STORAGE_DSN overrides storage.dsn.
+const envPrefix = "CALENDAR"
+
+func NewConfig(path string) (Config, error) {
+	cfg := Config{
+		Logger:   LoggerConf{Level: "INFO", Format: string(logger.FormatText)},
+		Storage:  StorageConf{Type: setup.StorageMemory},
+		Calendar: CalendarConf{TimeZone: "UTC", WeekStart: "monday", ChangeBuffer: 1024, SubscriberBuffer: 64},
+		Shutdown: ShutdownConf{Timeout: 3 * time.Second},
+		Tracing:  TracingConf{Exporter: tracing.ExporterNone, SampleRatio: 1},
+		Limits:   LimitsConf{UserRate: 10, UserBurst: 20, IPRate: 50, IPBurst: 100, MaxBodyBytes: 1 << 20},
+	}
+
+	if err := config.Load(path, envPrefix, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c Config) Validate() error {
+	var errs config.Errors
+
+	if _, err := logger.ParseLevel(c.Logger.Level); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.level", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+	if _, err := logger.ParseFormat(c.Logger.Format); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.format", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	switch c.Storage.Type {
+	case setup.StorageMemory:
+	case setup.StorageSQL:
+		if c.Storage.DSN == "" {
+			errs = append(errs, config.KeyError{
+				Key: "storage.dsn",
+				Err: fmt.Errorf("%w for storage type %q", config.ErrMissingKey, setup.StorageSQL),
+			})
+		}
+	default:
+		errs = append(errs, config.KeyError{
+			Key: "storage.type",
+			Err: fmt.Errorf("%w: %q, expected %q or %q", config.ErrInvalidValue, c.Storage.Type, setup.StorageMemory, setup.StorageSQL),
+		})
+	}
+
+	if _, err := storage.LoadLocation(c.Calendar.TimeZone); err != nil {
+		errs = append(errs, config.KeyError{
+			Key: "calendar.time_zone",
+			Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err),
+		})
+	}
+	if _, err := storage.ParseWeekday(c.Calendar.WeekStart); err != nil {
+		errs = append(errs, config.KeyError{
+			Key: "calendar.week_start",
+			Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err),
+		})
+	}
+
+	buffers := []struct {
+		key  string
+		size int
+	}{
+		{"calendar.change_buffer", c.Calendar.ChangeBuffer},
+		{"calendar.subscriber_buffer", c.Calendar.SubscriberBuffer},
+	}
+	for _, b := range buffers {
+		if b.size < 1 {
+			errs = append(errs, config.KeyError{
+				Key: b.key,
+				Err: fmt.Errorf("%w: buffer size must be positive", config.ErrInvalidValue),
+			})
+		}
+	}
+
+	if c.Calendar.MaxEventsPerUser < 0 {
+		errs = append(errs, config.KeyError{
+			Key: "calendar.max_events_per_user",
+			Err: fmt.Errorf("%w: quota must not be negative", config.ErrInvalidValue),
+		})
+	}
+
+	if c.Shutdown.DrainDelay < 0 {
+		errs = append(errs, config.KeyError{
+			Key: "shutdown.drain_delay",
+			Err: fmt.Errorf("%w: delay must not be negative", config.ErrInvalidValue),
+		})
+	}
+	if c.Shutdown.Timeout <= 0 {
+		errs = append(errs, config.KeyError{
+			Key: "shutdown.timeout",
+			Err: fmt.Errorf("%w: timeout must be positive", config.ErrInvalidValue),
+		})
+	}
+
+	ports := []struct {
+		key  string
+		port int
+	}{
+		{"http.port", c.HTTP.Port},
+		{"grpc.port", c.GRPC.Port},
+	}
+	for _, p := range ports {
+		if p.port < 1 || p.port > 65535 {
+			errs = append(errs, config.KeyError{
+				Key: p.key,
+				Err: fmt.Errorf("%w: port %d is out of range", config.ErrInvalidValue, p.port),
+			})
+		}
+	}
+
+	rates := []struct {
+		prefix string
+		rate   float64
+		burst  int
+	}{
+		{"limits.user", c.Limits.UserRate, c.Limits.UserBurst},
+		{"limits.ip", c.Limits.IPRate, c.Limits.IPBurst},
+	}
+	for _, r := range rates {
+		if r.rate < 0 {
+			errs = append(errs, config.KeyError{
+				Key: r.prefix + "_rate",
+				Err: fmt.Errorf("%w: rate must not be negative", config.ErrInvalidValue),
+			})
+		}
+		if r.rate > 0 && r.burst < 1 {
+			errs = append(errs, config.KeyError{
+				Key: r.prefix + "_burst",
+				Err: fmt.Errorf("%w: burst must be positive", config.ErrInvalidValue),
+			})
+		}
+	}
+	if c.Limits.MaxBodyBytes < 0 {
+		errs = append(errs, config.KeyError{
+			Key: "limits.max_body_bytes",
+			Err: fmt.Errorf("%w: size must not be negative", config.ErrInvalidValue),
+		})
+	}
+	if _, err := ratelimit.ParseProxies(c.Limits.TrustedProxies); err != nil {
+		errs = append(errs, config.KeyError{
+			Key: "limits.trusted_proxies",
+			Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err),
+		})
+	}
+
+	if err := c.Tracing.Options().Validate(); err != nil {
+		errs = append(errs, config.KeyError{Key: "tracing", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfig(t *testing.T) {
+	t.Run("sample config", func(t *testing.T) {
+		cfg, err := NewConfig(filepath.Join("..", "..", "configs", "config.toml"))
+		require.NoError(t, err)
+		require.Equal(t, setup.StorageMemory, cfg.Storage.Type)
+		require.Equal(t, "0.0.0.0:8888", cfg.HTTP.Addr())
+		require.Equal(t, app.Options{
+			TimeZone: "UTC", WeekStart: time.Monday, ChangeBuffer: 1024, SubscriberBuffer: 64, MaxEvents: 10000,
+		}, cfg.Calendar.Options())
+		require.Equal(t, ShutdownConf{DrainDelay: 5 * time.Second, Timeout: 3 * time.Second}, cfg.Shutdown)
+		require.Equal(t, tracing.Options{
+			Exporter: tracing.ExporterNone, Endpoint: "localhost:4317", Insecure: true, SampleRatio: 1,
+		}, cfg.Tracing.Options())
+		require.Equal(t, LimitsConf{
+			UserRate: 10, UserBurst: 20, IPRate: 50, IPBurst: 100, MaxBodyBytes: 1 << 20,
+		}, cfg.Limits)
+	})
+
+	t.Run("invalid keys are named", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+[storage]
+type = "sql"
+
+[http]
+port = 70000
+
+[grpc]
+port = 50051
+
+[calendar]
+time_zone = "Mars/Olympus"
+week_start = "someday"
+subscriber_buffer = 0
+max_events_per_user = -1
+
+[shutdown]
+drain_delay = "-1s"
+
+[tracing]
+exporter = "jaeger"
+
+[limits]
+ip_rate = -1.0
+user_burst = 0
+max_body_bytes = -1
+trusted_proxies = "10.0.0.0/8, proxy.local"
+`), 0o600))
+
+		_, err := NewConfig(path)
+		require.ErrorIs(t, err, config.ErrMissingKey)
+		require.ErrorIs(t, err, config.ErrInvalidValue)
+		require.Contains(t, err.Error(), "storage.dsn")
+		require.Contains(t, err.Error(), "http.port")
+		require.Contains(t, err.Error(), "calendar.time_zone")
+		require.Contains(t, err.Error(), "calendar.week_start")
+		require.Contains(t, err.Error(), "calendar.subscriber_buffer")
+		require.Contains(t, err.Error(), "calendar.max_events_per_user")
+		require.Contains(t, err.Error(), "shutdown.drain_delay")
+		require.Contains(t, err.Error(), "limits.ip_rate")
+		require.Contains(t, err.Error(), "limits.user_burst")
+		require.Contains(t, err.Error(), "limits.max_body_bytes")
+		require.Contains(t, err.Error(), "limits.trusted_proxies")
+		require.Contains(t, err.Error(), "tracing")
+	})
+}
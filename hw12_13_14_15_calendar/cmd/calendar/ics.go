@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ics"
+)
+
+var errMissingUserID = errors.New("user ID is required")
+
+// runExport handles "calendar export USER_ID [FILE]", the calendar is
+// written to stdout when FILE is omitted or "-".
+func runExport(ctx context.Context, calendar *app.App, userID, path string) error {
+	if userID == "" {
+		return errMissingUserID
+	}
+	events, err := calendar.ExportEvents(app.WithUser(ctx, userID))
+	if err != nil {
+		return err
+	}
+
+	if path == "" || path == "-" {
+		return ics.NewEncoder(os.Stdout).Encode(events)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := ics.NewEncoder(f).Encode(events); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runImport handles "calendar import USER_ID [FILE]", the calendar is read
+// from stdin when FILE is omitted or "-". Events which were not imported are
+// listed on stdout.
+func runImport(ctx context.Context, calendar *app.App, userID, path string, out io.Writer) error {
+	if userID == "" {
+		return errMissingUserID
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	events, err := ics.NewDecoder(in).Decode()
+	if err != nil {
+		return err
+	}
+
+	res, err := calendar.ImportEvents(app.WithUser(ctx, userID), events)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "imported %d of %d events\n", len(res.Created), len(events))
+	if len(res.Failed) == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "UID\tRECURRENCE ID\tERROR")
+	for _, f := range res.Failed {
+		recurrenceID := "-"
+		if !f.RecurrenceID.IsZero() {
+			recurrenceID = f.RecurrenceID.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\n", f.ID, recurrenceID, f.Err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%d events were not imported", len(res.Failed))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	calendar := app.New(logger.New(logger.LevelError, logger.FormatText, io.Discard), memorystorage.New(), app.Options{})
+	start := time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+	_, err := calendar.CreateEvent(app.WithUser(ctx, "alice"), storage.Event{
+		Title:   "standup",
+		StartAt: start,
+		EndAt:   start.Add(15 * time.Minute),
+		RRule:   "FREQ=DAILY;COUNT=3",
+	})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "alice.ics")
+	require.NoError(t, runExport(ctx, calendar, "alice", path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "SUMMARY:standup\r\n")
+
+	var out bytes.Buffer
+	require.NoError(t, runImport(ctx, calendar, "bob", path, &out))
+	require.Equal(t, "imported 1 of 1 events\n", out.String())
+
+	events, err := calendar.ExportEvents(app.WithUser(ctx, "bob"))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, "FREQ=DAILY;COUNT=3", events[0].RRule)
+
+	out.Reset()
+	require.Error(t, runImport(ctx, calendar, "bob", path, &out))
+	require.Contains(t, out.String(), "imported 0 of 1 events\n")
+	require.Contains(t, out.String(), "date is already busy")
+
+	require.ErrorIs(t, runExport(ctx, calendar, "", path), errMissingUserID)
+	require.ErrorIs(t, runImport(ctx, calendar, "", path, &out), errMissingUserID)
+	require.Error(t, runImport(ctx, calendar, "bob", filepath.Join(t.TempDir(), "missing.ics"), &out))
+}
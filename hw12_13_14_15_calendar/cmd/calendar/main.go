@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"flag"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
 	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	internalgrpc "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc"
 	internalhttp "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/http"
-	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
 )
 
 var configFile string
@@ -28,34 +34,129 @@ func main() {
 		return
 	}
 
-	config := NewConfig()
-	logg := logger.New(config.Logger.Level)
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	storage := memorystorage.New()
-	calendar := app.New(logg, storage)
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), config.Storage.DSN, flag.Arg(1)); err != nil {
+			log.Fatalln("migrate: " + err.Error())
+		}
+		return
+	}
 
-	server := internalhttp.NewServer(logg, calendar)
+	logg, logFile, err := logger.Open(config.Logger.Options())
+	if err != nil {
+		log.Fatalln("logger: " + err.Error())
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	stopReopen := logger.ReopenOnSIGHUP(logFile, logg)
+	defer stopReopen()
 
 	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx, "calendar", config.Tracing.Options())
+	if err != nil {
+		logg.Error("failed to init tracing", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	storage, closeStorage, err := setup.NewStorage(ctx, config.Storage.Options())
+	if err != nil {
+		logg.Error("failed to init storage", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		if err := closeStorage(context.Background()); err != nil {
+			logg.Error("failed to close storage", "error", err)
+		}
+	}()
+
+	m := metrics.New()
+	h := health.New(buildVersion())
+	addStorageCheck(h, storage)
+	calendar := app.New(logg, m.Storage(tracing.NewStorage(storage)), config.Calendar.Options())
+
+	if command := flag.Arg(0); command == "export" || command == "import" {
+		if command == "export" {
+			err = runExport(ctx, calendar, flag.Arg(1), flag.Arg(2))
+		} else {
+			err = runImport(ctx, calendar, flag.Arg(1), flag.Arg(2), os.Stdout)
+		}
+		if err != nil {
+			logg.Error(command+" failed", "error", err)
+			cancel()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Both APIs share the buckets, so switching between them does not
+	// double what a client may send.
+	userLimiter := ratelimit.New(config.Limits.UserRate, config.Limits.UserBurst)
+	ipLimiter := ratelimit.New(config.Limits.IPRate, config.Limits.IPBurst)
+	proxies := config.Limits.Proxies()
+	server := internalhttp.NewServer(logg, calendar, m, h, internalhttp.Limits{
+		User: userLimiter, IP: ipLimiter, TrustedProxies: proxies, MaxBodyBytes: config.Limits.MaxBodyBytes,
+	}, config.HTTP.Addr())
+	grpcServer := internalgrpc.NewServer(logg, calendar, m, h, internalgrpc.Limits{
+		User: userLimiter, IP: ipLimiter, TrustedProxies: proxies, MaxBodyBytes: config.Limits.MaxBodyBytes,
+	}, config.GRPC.Addr())
+
 	go func() {
 		<-ctx.Done()
 
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		// Requests keep being served while load balancers see the failing
+		// readiness probes and take the instance out.
+		h.Shutdown()
+		logg.Info("draining before shutdown", "delay", config.Shutdown.DrainDelay.String())
+		time.Sleep(config.Shutdown.DrainDelay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), config.Shutdown.Timeout)
 		defer cancel()
 
+		if err := grpcServer.Stop(ctx); err != nil {
+			logg.Error("failed to stop grpc server", "error", err)
+		}
 		if err := server.Stop(ctx); err != nil {
-			logg.Error("failed to stop http server: " + err.Error())
+			logg.Error("failed to stop http server", "error", err)
+		}
+	}()
+
+	grpcErr := make(chan error, 1)
+	go func() {
+		err := grpcServer.Start(ctx)
+		if err != nil {
+			logg.Error("failed to start grpc server", "error", err)
+			cancel()
 		}
+		grpcErr <- err
 	}()
 
 	logg.Info("calendar is running...")
 
 	if err := server.Start(ctx); err != nil {
-		logg.Error("failed to start http server: " + err.Error())
+		logg.Error("failed to start http server", "error", err)
 		cancel()
 		os.Exit(1) //nolint:gocritic
 	}
+	// The HTTP server returns after the shutdown, the gRPC server is stopped
+	// by then.
+	if err := <-grpcErr; err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+)
+
+// runMigrate handles "calendar migrate up|down|status".
+func runMigrate(ctx context.Context, dsn, command string) error {
+	s := sqlstorage.New(dsn)
+	if err := s.Connect(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		_ = s.Close(ctx)
+	}()
+
+	var err error
+	switch command {
+	case "up":
+		err = s.MigrateUp(ctx)
+	case "down":
+		err = s.MigrateDown(ctx)
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	statuses, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, st := range statuses {
+		appliedAt := "pending"
+		if st.Applied() {
+			appliedAt = st.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
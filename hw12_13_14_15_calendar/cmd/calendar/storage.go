@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+)
+
+// addStorageCheck makes readiness depend on the SQL storage, the memory
+// storage is always ready.
+func addStorageCheck(h *health.Health, s app.Storage) {
+	if c, ok := s.(interface {
+		CheckReady(ctx context.Context) error
+	}); ok {
+		h.AddCheck("storage", c.CheckReady)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+type Config struct {
+	Logger    LoggerConf    `config:"logger"`
+	Storage   StorageConf   `config:"storage"`
+	Queue     QueueConf     `config:"queue"`
+	Scheduler SchedulerConf `config:"scheduler"`
+	Metrics   MetricsConf   `config:"metrics"`
+	Tracing   TracingConf   `config:"tracing"`
+}
+
+type LoggerConf struct {
+	Level  string `config:"level"`
+	Format string `config:"format"`
+	// File is a path to the log file, logs go to stderr when it is empty.
+	File string `config:"file"`
+}
+
+func (c LoggerConf) Options() logger.Options {
+	return logger.Options{Level: c.Level, Format: c.Format, File: c.File}
+}
+
+type StorageConf struct {
+	Type string `config:"type,required"`
+	DSN  string `config:"dsn"`
+}
+
+func (c StorageConf) Options() setup.StorageOptions {
+	return setup.StorageOptions{Type: c.Type, DSN: c.DSN}
+}
+
+type QueueConf struct {
+	Type string `config:"type,required"`
+	URL  string `config:"url"`
+	// Name is the queue notifications are published to.
+	Name string `config:"name"`
+}
+
+func (c QueueConf) Options() setup.QueueOptions {
+	return setup.QueueOptions{Type: c.Type, URL: c.URL, Name: c.Name}
+}
+
+type SchedulerConf struct {
+	// Interval is the period of polling the storage for due events.
+	Interval time.Duration `config:"interval"`
+}
+
+// MetricsConf is the address metrics and health probes are served at,
+// they are not served when Port is zero.
+type MetricsConf struct {
+	Host string `config:"host"`
+	Port int    `config:"port"`
+}
+
+func (c MetricsConf) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// TracingConf selects where spans are exported, see tracing.Options.
+type TracingConf struct {
+	// Exporter is "none", "otlp", "stdout" or "file".
+	Exporter    string  `config:"exporter"`
+	Endpoint    string  `config:"endpoint"`
+	Insecure    bool    `config:"insecure"`
+	File        string  `config:"file"`
+	SampleRatio float64 `config:"sample_ratio"`
+}
+
+func (c TracingConf) Options() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Exporter,
+		Endpoint:    c.Endpoint,
+		Insecure:    c.Insecure,
+		File:        c.File,
+		SampleRatio: c.SampleRatio,
+	}
+}
+
+// envPrefix is prepended to environment variables overriding config keys,
+// e.g. SCHEDULER_STORAGE_DSN overrides storage.dsn.
+const envPrefix = "SCHEDULER"
+
+func NewConfig(path string) (Config, error) {
+	cfg := Config{
+		Logger:    LoggerConf{Level: "INFO", Format: string(logger.FormatText)},
+		Storage:   StorageConf{Type: setup.StorageSQL},
+		Queue:     QueueConf{Type: setup.QueueAMQP, Name: "notifications"},
+		Scheduler: SchedulerConf{Interval: time.Minute},
+		Tracing:   TracingConf{Exporter: tracing.ExporterNone, SampleRatio: 1},
+	}
+
+	if err := config.Load(path, envPrefix, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c Config) Validate() error {
+	var errs config.Errors
+
+	if _, err := logger.ParseLevel(c.Logger.Level); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.level", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+	if _, err := logger.ParseFormat(c.Logger.Format); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.format", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	// The memory storage and queue live inside one process, the scheduler
+	// would poll a store nobody writes to and publish to a queue nobody reads.
+	switch c.Storage.Type {
+	case setup.StorageMemory:
+		errs = append(errs, config.KeyError{
+			Key: "storage.type",
+			Err: fmt.Errorf("%w: %q is not shared with the calendar service, use %q",
+				config.ErrInvalidValue, setup.StorageMemory, setup.StorageSQL),
+		})
+	case setup.StorageSQL:
+		if c.Storage.DSN == "" {
+			errs = append(errs, config.KeyError{
+				Key: "storage.dsn",
+				Err: fmt.Errorf("%w for storage type %q", config.ErrMissingKey, setup.StorageSQL),
+			})
+		}
+	default:
+		errs = append(errs, config.KeyError{
+			Key: "storage.type",
+			Err: fmt.Errorf("%w: %q, expected %q", config.ErrInvalidValue, c.Storage.Type, setup.StorageSQL),
+		})
+	}
+
+	switch c.Queue.Type {
+	case setup.QueueMemory:
+		errs = append(errs, config.KeyError{
+			Key: "queue.type",
+			Err: fmt.Errorf("%w: %q is not shared with the sender, use %q", config.ErrInvalidValue, setup.QueueMemory, setup.QueueAMQP),
+		})
+	case setup.QueueAMQP:
+		if c.Queue.URL == "" {
+			errs = append(errs, config.KeyError{
+				Key: "queue.url",
+				Err: fmt.Errorf("%w for queue type %q", config.ErrMissingKey, setup.QueueAMQP),
+			})
+		}
+	default:
+		errs = append(errs, config.KeyError{
+			Key: "queue.type",
+			Err: fmt.Errorf("%w: %q, expected %q", config.ErrInvalidValue, c.Queue.Type, setup.QueueAMQP),
+		})
+	}
+	if c.Queue.Name == "" {
+		errs = append(errs, config.KeyError{Key: "queue.name", Err: config.ErrMissingKey})
+	}
+
+	if c.Scheduler.Interval <= 0 {
+		errs = append(errs, config.KeyError{
+			Key: "scheduler.interval",
+			Err: fmt.Errorf("%w: interval must be positive", config.ErrInvalidValue),
+		})
+	}
+
+	if c.Metrics.Port < 0 || c.Metrics.Port > 65535 {
+		errs = append(errs, config.KeyError{
+			Key: "metrics.port",
+			Err: fmt.Errorf("%w: %d is not a port", config.ErrInvalidValue, c.Metrics.Port),
+		})
+	}
+
+	if err := c.Tracing.Options().Validate(); err != nil {
+		errs = append(errs, config.KeyError{Key: "tracing", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
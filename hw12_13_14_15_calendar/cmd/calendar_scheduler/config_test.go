@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfig(t *testing.T) {
+	t.Run("sample config", func(t *testing.T) {
+		cfg, err := NewConfig(filepath.Join("..", "..", "configs", "scheduler_config.toml"))
+		require.NoError(t, err)
+		require.Equal(t, setup.StorageSQL, cfg.Storage.Type)
+		require.Equal(t, setup.QueueAMQP, cfg.Queue.Type)
+		require.Equal(t, time.Minute, cfg.Scheduler.Interval)
+		require.Equal(t, "0.0.0.0:9101", cfg.Metrics.Addr())
+	})
+
+	t.Run("invalid keys are named", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+[storage]
+type = "sql"
+
+[queue]
+type = "kafka"
+
+[scheduler]
+interval = "-1s"
+
+[metrics]
+port = 70000
+`), 0o600))
+
+		_, err := NewConfig(path)
+		require.ErrorIs(t, err, config.ErrMissingKey)
+		require.ErrorIs(t, err, config.ErrInvalidValue)
+		require.Contains(t, err.Error(), "storage.dsn")
+		require.Contains(t, err.Error(), "queue.type")
+		require.Contains(t, err.Error(), "scheduler.interval")
+		require.Contains(t, err.Error(), "metrics.port")
+	})
+
+	t.Run("memory storage and queue are rejected", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+[storage]
+type = "memory"
+
+[queue]
+type = "memory"
+`), 0o600))
+
+		_, err := NewConfig(path)
+		require.ErrorIs(t, err, config.ErrInvalidValue)
+		require.Contains(t, err.Error(), "storage.type")
+		require.Contains(t, err.Error(), "queue.type")
+	})
+}
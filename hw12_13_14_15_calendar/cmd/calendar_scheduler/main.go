@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+var configFile string
+
+func init() {
+	flag.StringVar(&configFile, "config", "/etc/calendar/scheduler_config.toml", "Path to configuration file")
+}
+
+func main() {
+	flag.Parse()
+
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	logg, logFile, err := logger.Open(config.Logger.Options())
+	if err != nil {
+		log.Fatalln("logger: " + err.Error())
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	stopReopen := logger.ReopenOnSIGHUP(logFile, logg)
+	defer stopReopen()
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, "calendar_scheduler", config.Tracing.Options())
+	if err != nil {
+		logg.Error("failed to init tracing", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	storage, closeStorage, err := setup.NewStorage(ctx, config.Storage.Options())
+	if err != nil {
+		logg.Error("failed to init storage", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		if err := closeStorage(context.Background()); err != nil {
+			logg.Error("failed to close storage", "error", err)
+		}
+	}()
+
+	publisher, closePublisher, err := setup.NewPublisher(config.Queue.Options(), logg)
+	if err != nil {
+		logg.Error("failed to init queue", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		if err := closePublisher(); err != nil {
+			logg.Error("failed to close queue", "error", err)
+		}
+	}()
+
+	m := metrics.New()
+	if config.Metrics.Port != 0 {
+		h := health.New(health.Version{})
+		addChecks(h, storage, publisher)
+		go serveMetrics(ctx, config.Metrics.Addr(), m, h, logg)
+	}
+
+	s := scheduler.New(logg, m.Storage(tracing.NewStorage(storage)),
+		m.Publisher(tracing.NewPublisher(publisher, config.Queue.Name)), m, config.Scheduler.Interval)
+
+	logg.Info("scheduler is running...", "interval", config.Scheduler.Interval.String())
+
+	if err := s.Run(ctx); err != nil {
+		logg.Error("scheduler failed", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+}
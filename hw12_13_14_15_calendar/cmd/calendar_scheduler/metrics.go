@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// serveMetrics serves /metrics and the health probes at addr until ctx is done.
+func serveMetrics(ctx context.Context, addr string, m *metrics.Metrics, h *health.Health, logg *logger.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	mux.Handle("/healthz", h.LiveHandler())
+	mux.Handle("/readyz", h.ReadyHandler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		h.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	logg.Info("metrics are served", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logg.Error("failed to serve metrics", "error", err)
+	}
+}
+
+// addChecks makes readiness depend on the SQL storage and the AMQP queue,
+// the memory ones are always ready.
+func addChecks(h *health.Health, s storage.Storage, p queue.Publisher) {
+	if c, ok := s.(interface {
+		CheckReady(ctx context.Context) error
+	}); ok {
+		h.AddCheck("storage", c.CheckReady)
+	}
+	if c, ok := p.(interface {
+		Check(ctx context.Context) error
+	}); ok {
+		h.AddCheck("queue", c.Check)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+type Config struct {
+	Logger  LoggerConf  `config:"logger"`
+	Queue   QueueConf   `config:"queue"`
+	Sender  SenderConf  `config:"sender"`
+	Tracing TracingConf `config:"tracing"`
+}
+
+type LoggerConf struct {
+	Level  string `config:"level"`
+	Format string `config:"format"`
+	// File is a path to the log file, logs go to stderr when it is empty.
+	File string `config:"file"`
+}
+
+func (c LoggerConf) Options() logger.Options {
+	return logger.Options{Level: c.Level, Format: c.Format, File: c.File}
+}
+
+type QueueConf struct {
+	Type string `config:"type,required"`
+	URL  string `config:"url"`
+	// Name is the queue notifications are consumed from.
+	Name string `config:"name"`
+	// DeadLetter is the queue notifications go to when delivery fails.
+	DeadLetter string `config:"dead_letter"`
+}
+
+// Options are the options of the queue notifications are consumed from.
+func (c QueueConf) Options() setup.QueueOptions {
+	return setup.QueueOptions{Type: c.Type, URL: c.URL, Name: c.Name}
+}
+
+// DeadLetterOptions are the options of the dead-letter queue.
+func (c QueueConf) DeadLetterOptions() setup.QueueOptions {
+	return setup.QueueOptions{Type: c.Type, URL: c.URL, Name: c.DeadLetter}
+}
+
+const (
+	senderStdout  = "stdout"
+	senderFile    = "file"
+	senderWebhook = "webhook"
+)
+
+type SenderConf struct {
+	Type string `config:"type,required"`
+	// File is the path notifications are appended to by the file sender.
+	File string `config:"file"`
+	// URL receives notifications posted by the webhook sender.
+	URL     string        `config:"url"`
+	Timeout time.Duration `config:"timeout"`
+	// Attempts is the number of deliveries tried before a notification
+	// is moved to the dead-letter queue.
+	Attempts   int           `config:"attempts"`
+	RetryDelay time.Duration `config:"retry_delay"`
+}
+
+// TracingConf selects where spans are exported, see tracing.Options.
+type TracingConf struct {
+	// Exporter is "none", "otlp", "stdout" or "file".
+	Exporter    string  `config:"exporter"`
+	Endpoint    string  `config:"endpoint"`
+	Insecure    bool    `config:"insecure"`
+	File        string  `config:"file"`
+	SampleRatio float64 `config:"sample_ratio"`
+}
+
+func (c TracingConf) Options() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Exporter,
+		Endpoint:    c.Endpoint,
+		Insecure:    c.Insecure,
+		File:        c.File,
+		SampleRatio: c.SampleRatio,
+	}
+}
+
+// envPrefix is prepended to environment variables overriding config keys,
+// e.g. SENDER_SENDER_URL overrides sender.url.
+const envPrefix = "SENDER"
+
+func NewConfig(path string) (Config, error) {
+	cfg := Config{
+		Logger: LoggerConf{Level: "INFO", Format: string(logger.FormatText)},
+		Queue:  QueueConf{Type: setup.QueueAMQP, Name: "notifications", DeadLetter: "notifications.dead"},
+		Sender: SenderConf{
+			Type:       senderStdout,
+			Timeout:    5 * time.Second,
+			Attempts:   3,
+			RetryDelay: time.Second,
+		},
+		Tracing: TracingConf{Exporter: tracing.ExporterNone, SampleRatio: 1},
+	}
+
+	if err := config.Load(path, envPrefix, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c Config) Validate() error {
+	var errs config.Errors
+
+	if _, err := logger.ParseLevel(c.Logger.Level); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.level", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+	if _, err := logger.ParseFormat(c.Logger.Format); err != nil {
+		errs = append(errs, config.KeyError{Key: "logger.format", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	// The memory queue lives inside one process, the sender would wait for
+	// notifications nobody publishes.
+	switch c.Queue.Type {
+	case setup.QueueMemory:
+		errs = append(errs, config.KeyError{
+			Key: "queue.type",
+			Err: fmt.Errorf("%w: %q is not shared with the scheduler, use %q", config.ErrInvalidValue, setup.QueueMemory, setup.QueueAMQP),
+		})
+	case setup.QueueAMQP:
+		if c.Queue.URL == "" {
+			errs = append(errs, config.KeyError{
+				Key: "queue.url",
+				Err: fmt.Errorf("%w for queue type %q", config.ErrMissingKey, setup.QueueAMQP),
+			})
+		}
+	default:
+		errs = append(errs, config.KeyError{
+			Key: "queue.type",
+			Err: fmt.Errorf("%w: %q, expected %q", config.ErrInvalidValue, c.Queue.Type, setup.QueueAMQP),
+		})
+	}
+	if c.Queue.Name == "" {
+		errs = append(errs, config.KeyError{Key: "queue.name", Err: config.ErrMissingKey})
+	}
+	if c.Queue.DeadLetter == "" || c.Queue.DeadLetter == c.Queue.Name {
+		errs = append(errs, config.KeyError{
+			Key: "queue.dead_letter",
+			Err: fmt.Errorf("%w: must be set and differ from queue.name", config.ErrInvalidValue),
+		})
+	}
+
+	switch c.Sender.Type {
+	case senderStdout:
+	case senderFile:
+		if c.Sender.File == "" {
+			errs = append(errs, config.KeyError{
+				Key: "sender.file",
+				Err: fmt.Errorf("%w for sender type %q", config.ErrMissingKey, senderFile),
+			})
+		}
+	case senderWebhook:
+		if c.Sender.URL == "" {
+			errs = append(errs, config.KeyError{
+				Key: "sender.url",
+				Err: fmt.Errorf("%w for sender type %q", config.ErrMissingKey, senderWebhook),
+			})
+		}
+	default:
+		errs = append(errs, config.KeyError{
+			Key: "sender.type",
+			Err: fmt.Errorf("%w: %q, expected %q, %q or %q",
+				config.ErrInvalidValue, c.Sender.Type, senderStdout, senderFile, senderWebhook),
+		})
+	}
+
+	if c.Sender.Attempts < 1 {
+		errs = append(errs, config.KeyError{
+			Key: "sender.attempts",
+			Err: fmt.Errorf("%w: at least one attempt is required", config.ErrInvalidValue),
+		})
+	}
+
+	if err := c.Tracing.Options().Validate(); err != nil {
+		errs = append(errs, config.KeyError{Key: "tracing", Err: fmt.Errorf("%w: %v", config.ErrInvalidValue, err)})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/config"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfig(t *testing.T) {
+	t.Run("sample config", func(t *testing.T) {
+		cfg, err := NewConfig(filepath.Join("..", "..", "configs", "sender_config.toml"))
+		require.NoError(t, err)
+		require.Equal(t, setup.QueueAMQP, cfg.Queue.Type)
+		require.Equal(t, senderStdout, cfg.Sender.Type)
+		require.Equal(t, 3, cfg.Sender.Attempts)
+	})
+
+	t.Run("invalid keys are named", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+[queue]
+type = "memory"
+
+[sender]
+type = "webhook"
+attempts = 0
+`), 0o600))
+
+		_, err := NewConfig(path)
+		require.ErrorIs(t, err, config.ErrMissingKey)
+		require.ErrorIs(t, err, config.ErrInvalidValue)
+		require.Contains(t, err.Error(), "sender.url")
+		require.Contains(t, err.Error(), "sender.attempts")
+		require.Contains(t, err.Error(), "queue.type")
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/logger"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/sender"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/setup"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+)
+
+var configFile string
+
+func init() {
+	flag.StringVar(&configFile, "config", "/etc/calendar/sender_config.toml", "Path to configuration file")
+}
+
+func main() {
+	flag.Parse()
+
+	config, err := NewConfig(configFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	logg, logFile, err := logger.Open(config.Logger.Options())
+	if err != nil {
+		log.Fatalln("logger: " + err.Error())
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+	stopReopen := logger.ReopenOnSIGHUP(logFile, logg)
+	defer stopReopen()
+
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	shutdownTracing, err := tracing.Setup(ctx, "calendar_sender", config.Tracing.Options())
+	if err != nil {
+		logg.Error("failed to init tracing", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logg.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	notifier, closeNotifier, err := newSender(config.Sender)
+	if err != nil {
+		logg.Error("failed to init sender", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		if err := closeNotifier(); err != nil {
+			logg.Error("failed to close sender", "error", err)
+		}
+	}()
+
+	consumer, err := setup.NewConsumer(config.Queue.Options(), logg)
+	if err != nil {
+		logg.Error("failed to init queue", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	deadLetter, closeDeadLetter, err := setup.NewPublisher(config.Queue.DeadLetterOptions(), logg)
+	if err != nil {
+		logg.Error("failed to init queue", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+	defer func() {
+		if err := closeDeadLetter(); err != nil {
+			logg.Error("failed to close queue", "error", err)
+		}
+	}()
+
+	s := sender.New(logg,
+		tracing.NewConsumer(consumer, config.Queue.Name), notifier,
+		tracing.NewPublisher(deadLetter, config.Queue.DeadLetter),
+		config.Sender.Attempts, config.Sender.RetryDelay)
+
+	logg.Info("sender is running...", "type", config.Sender.Type)
+
+	if err := s.Run(ctx); err != nil {
+		logg.Error("sender failed", "error", err)
+		cancel()
+		os.Exit(1) //nolint:gocritic
+	}
+}
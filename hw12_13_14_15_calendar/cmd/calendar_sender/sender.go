@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/sender"
+)
+
+// newSender builds the sender selected by sender.type and returns
+// a function releasing its resources.
+func newSender(conf SenderConf) (sender.Sender, func() error, error) {
+	nop := func() error { return nil }
+
+	switch conf.Type {
+	case senderStdout:
+		return sender.NewWriterSender(os.Stdout), nop, nil
+	case senderFile:
+		f, err := os.OpenFile(conf.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sender.NewWriterSender(f), f.Close, nil
+	case senderWebhook:
+		return sender.NewWebhookSender(conf.URL, &http.Client{Timeout: conf.Timeout}), nop, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown sender type %q", conf.Type)
+	}
+}
@@ -1,3 +1,24 @@
 module github.com/fixme_my_friend/hw12_13_14_15_calendar
 
 go 1.16
+
+require (
+	github.com/BurntSushi/toml v1.0.0
+	github.com/DATA-DOG/go-sqlmock v1.5.0
+	github.com/google/uuid v1.3.0
+	github.com/gorilla/mux v1.8.0
+	github.com/jackc/pgconn v1.10.0
+	github.com/jackc/pgtype v1.8.1
+	github.com/jackc/pgx/v4 v4.13.0
+	github.com/prometheus/client_golang v1.11.0
+	github.com/rabbitmq/amqp091-go v1.2.0
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.1.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.1.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.1.0
+	go.opentelemetry.io/otel/sdk v1.1.0
+	go.opentelemetry.io/otel/trace v1.1.0
+	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -2,25 +2,460 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/google/uuid"
 )
 
-type App struct { // TODO
+// App serves the user which ctx carries from WithUser, its methods fail
+// with ErrNoUser when there is none.
+type App struct {
+	logger  Logger
+	storage Storage
+	opts    Options
+	changes *changeFeed
+	quota   userLocks
+}
+
+// Options hold the calendar settings of users who have not saved their own,
+// the limits of the change feed and the quotas of users. Sizes of requests
+// are a transport concern, the HTTP and gRPC servers cap them.
+type Options struct {
+	// TimeZone is an IANA zone name, UTC when empty.
+	TimeZone  string
+	WeekStart time.Weekday
+
+	// ChangeBuffer is the number of last changes kept for subscribers
+	// resuming after a reconnect, 1024 when zero.
+	ChangeBuffer int
+	// SubscriberBuffer is the number of changes a subscriber may lag behind
+	// before it is dropped, 64 when zero.
+	SubscriberBuffer int
+
+	// MaxEvents limits the number of events a user owns, edited occurrences
+	// included, there is no limit when it is zero. The count and the write
+	// are serialized per user within the App only, so instances sharing a
+	// storage may together exceed it by a few events.
+	MaxEvents int
+}
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type Storage interface {
+	storage.Storage
+}
+
+func New(logger Logger, storage Storage, opts Options) *App {
+	return &App{
+		logger:  logger,
+		storage: storage,
+		opts:    opts,
+		changes: newChangeFeed(opts.ChangeBuffer, opts.SubscriberBuffer),
+	}
+}
+
+// UserSettings returns the saved settings of the user or the defaults from Options.
+func (a *App) UserSettings(ctx context.Context) (storage.User, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.User{}, err
+	}
+	return a.userSettings(ctx, userID)
+}
+
+func (a *App) userSettings(ctx context.Context, userID string) (storage.User, error) {
+	u, err := a.storage.GetUser(ctx, userID)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return storage.User{ID: userID, TimeZone: a.opts.TimeZone, WeekStart: a.opts.WeekStart}, nil
+	}
+	return u, err
 }
 
-type Logger interface { // TODO
+// UpdateUserSettings saves the settings of the user. Existing events keep their zones.
+func (a *App) UpdateUserSettings(ctx context.Context, u storage.User) (storage.User, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.User{}, err
+	}
+	u.ID = userID
+	if err := a.storage.SaveUser(ctx, u); err != nil {
+		return storage.User{}, err
+	}
+	a.logger.Debug("user settings updated", "user", userID, "time_zone", u.TimeZone)
+
+	return u, nil
 }
 
-type Storage interface { // TODO
+// CreateEvent stores a new event owned by the user and returns it with the generated ID.
+// An event without a time zone gets the zone of the user. Attendees are
+// invited with no response. It fails with ErrQuotaExceeded when the user
+// owns Options.MaxEvents events already.
+func (a *App) CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	e.ID = uuid.NewString()
+	e.UserID = userID
+	e.SeriesID = ""
+	e.RecurrenceID = time.Time{}
+	e.Attendees = invite(e.Attendees)
+	if e.TimeZone == "" {
+		u, err := a.userSettings(ctx, userID)
+		if err != nil {
+			return storage.Event{}, err
+		}
+		e.TimeZone = u.TimeZone
+	}
+
+	unlock := a.lockQuota(userID)
+	defer unlock()
+	if err := a.checkQuota(ctx, userID); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.storage.Create(ctx, e); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.Debug("event created", "id", e.ID, "user", userID)
+
+	return a.publish(ctx, userID, ChangeCreated, e.ID)
 }
 
-func New(logger Logger, storage Storage) *App {
-	return &App{}
+// UpdateEvent replaces the event if it is owned by the user. Cancelled and
+// edited occurrences of a recurring event stay as they are, so does the
+// time zone when e has none. Attendees who stay invited keep their responses.
+// Unless version is storage.AnyVersion the update fails with
+// storage.ErrVersionConflict if the event has been changed since that version.
+func (a *App) UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	old, err := a.ownEvent(ctx, userID, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	e.ID = id
+	e.UserID = userID
+	e.Attendees = invite(e.Attendees)
+	if e.TimeZone == "" {
+		e.TimeZone = old.TimeZone
+	}
+	if err := a.storage.Update(ctx, id, e, version); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.Debug("event updated", "id", id, "user", userID)
+
+	return a.publish(ctx, userID, ChangeUpdated, id, old)
 }
 
-func (a *App) CreateEvent(ctx context.Context, id, title string) error {
-	// TODO
+// UpdateOccurrence replaces a single occurrence of the recurring event owned
+// by the user and returns the event standing in for it. Without a time zone
+// the occurrence gets the zone of the series, without attendees it gets the
+// attendees of the series with their responses. Editing an occurrence for
+// the first time adds an event, it fails with ErrQuotaExceeded like CreateEvent.
+func (a *App) UpdateOccurrence(
+	ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	series, err := a.ownEvent(ctx, userID, seriesID)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	e.UserID = userID
+	if e.TimeZone == "" {
+		e.TimeZone = series.TimeZone
+	}
+	if e.Attendees == nil {
+		e.Attendees = series.Attendees
+	}
+	e.Attendees = invite(e.Attendees)
+	id := storage.OccurrenceID(seriesID, recurrenceID)
+	unlock := a.lockQuota(userID)
+	defer unlock()
+	if _, err := a.storage.Get(ctx, userID, id); errors.Is(err, storage.ErrEventNotFound) {
+		if err := a.checkQuota(ctx, userID); err != nil {
+			return storage.Event{}, err
+		}
+	} else if err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.storage.UpdateOccurrence(ctx, seriesID, recurrenceID, e); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.Debug("occurrence updated", "id", id, "user", userID)
+
+	// The series gets an exception date when the occurrence is edited first.
+	typ := ChangeUpdated
+	if updated, err := a.storage.Get(ctx, userID, seriesID); err == nil && updated.Version != series.Version {
+		a.changes.publish(ChangeUpdated, updated, series)
+		typ = ChangeCreated
+	}
+	return a.publish(ctx, userID, typ, id, series)
+}
+
+// CancelOccurrence removes a single occurrence of the recurring event owned
+// by the user, an edited occurrence is deleted and may be restored.
+func (a *App) CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	if _, err := a.ownEvent(ctx, userID, seriesID); err != nil {
+		return err
+	}
+	edited, editedErr := a.storage.Get(ctx, userID, storage.OccurrenceID(seriesID, recurrenceID))
+
+	if err := a.storage.CancelOccurrence(ctx, seriesID, recurrenceID); err != nil {
+		return err
+	}
+	a.logger.Debug("occurrence cancelled", "series", seriesID, "recurrence_id", recurrenceID, "user", userID)
+
+	// An edited occurrence is removed, otherwise the series gets an exception date.
+	if editedErr == nil {
+		a.changes.publish(ChangeDeleted, edited)
+		return nil
+	}
+	_, err = a.publish(ctx, userID, ChangeUpdated, seriesID)
+	return err
+}
+
+// DeleteEvent deletes the event if it is owned by the user, version is checked
+// like in UpdateEvent. Deleted events are kept with their history until the
+// yearly purge and may be restored with RestoreEvent.
+func (a *App) DeleteEvent(ctx context.Context, id string, version int64) error {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	e, err := a.ownEvent(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if err := a.storage.Delete(ctx, userID, id, version); err != nil {
+		return err
+	}
+	a.logger.Debug("event deleted", "id", id, "user", userID)
+	a.changes.publish(ChangeDeleted, e)
+
 	return nil
-	// return a.storage.CreateEvent(storage.Event{ID: id, Title: title})
 }
 
-// TODO
+// RestoreEvent brings back the deleted event owned by the user with the edited
+// occurrences deleted along with it. It fails with storage.ErrNotDeleted if
+// the event is not deleted, with storage.ErrDateBusy if its time has been
+// taken since and with ErrQuotaExceeded if the user has too many events to
+// take it back.
+func (a *App) RestoreEvent(ctx context.Context, id string) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	ctx = storage.WithActor(ctx, userID)
+	e, err := a.storage.GetDeleted(ctx, id)
+	if errors.Is(err, storage.ErrEventNotFound) {
+		if _, err := a.ownEvent(ctx, userID, id); err == nil {
+			return storage.Event{}, storage.ErrNotDeleted
+		}
+	}
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if e.UserID != userID {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+
+	unlock := a.lockQuota(userID)
+	defer unlock()
+	if err := a.checkQuota(ctx, userID); err != nil {
+		return storage.Event{}, err
+	}
+	if err := a.storage.Restore(ctx, id); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.Debug("event restored", "id", id, "user", userID)
+
+	return a.publish(ctx, userID, ChangeCreated, id)
+}
+
+// EventHistory returns the revisions of the event ordered by version if
+// the user owns or is invited to it, deleted events included.
+func (a *App) EventHistory(ctx context.Context, id string) ([]storage.Revision, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.storage.Get(ctx, userID, id); errors.Is(err, storage.ErrEventNotFound) {
+		e, err := a.storage.GetDeleted(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !e.VisibleTo(userID) {
+			return nil, storage.ErrEventNotFound
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return a.storage.History(ctx, id)
+}
+
+// GetEvent returns the event if the user owns it or is invited to it. Other
+// events are reported as not found.
+func (a *App) GetEvent(ctx context.Context, id string) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return a.storage.Get(ctx, userID, id)
+}
+
+// RespondEvent records the response of the user to the invitation to the
+// event. Responses to a recurring event do not change its edited
+// occurrences, they are responded to by their own IDs.
+func (a *App) RespondEvent(ctx context.Context, id string, status storage.AttendeeStatus) (storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if status == storage.NeedsAction || !status.Valid() {
+		return storage.Event{}, fmt.Errorf("%w: %q is not a response", storage.ErrInvalidAttendeeStatus, status)
+	}
+	ctx = storage.WithActor(ctx, userID)
+	old, err := a.GetEvent(ctx, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+
+	if err := a.storage.SetAttendeeStatus(ctx, id, userID, status); err != nil {
+		return storage.Event{}, err
+	}
+	a.logger.Debug("invitation answered", "id", id, "user", userID, "status", status)
+
+	return a.publish(ctx, userID, ChangeUpdated, id, old)
+}
+
+// Subscribe returns a subscription to changes of events the user owns or is
+// invited to made through the App after the change with the ID after, zero
+// subscribes for new changes only. Deleting a recurring event deletes its
+// edited occurrences without separate changes, events removed by the yearly
+// purge are not reported. The subscription ends when ctx is done.
+func (a *App) Subscribe(ctx context.Context, after uint64) (*Subscription, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.changes.subscribe(ctx, userID, after)
+}
+
+// publish reads the changed event as userID and records the change, old
+// holds the event before it.
+func (a *App) publish(
+	ctx context.Context, userID string, typ ChangeType, id string, old ...storage.Event,
+) (storage.Event, error) {
+	e, err := a.storage.Get(ctx, userID, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	a.changes.publish(typ, e, old...)
+	return e, nil
+}
+
+// ownEvent returns the event if it is owned by userID, only owners change events.
+func (a *App) ownEvent(ctx context.Context, userID, id string) (storage.Event, error) {
+	e, err := a.storage.Get(ctx, userID, id)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if e.UserID != userID {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+
+	return e, nil
+}
+
+// ListDay returns events the user owns or is invited to overlapping the day. Only the calendar
+// date of date matters, the bounds of the day are taken in the zone of the user.
+func (a *App) ListDay(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	day, _, err := a.localDate(ctx, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	from, to := storage.DayRange(day)
+	return a.storage.ListVisibleRange(ctx, userID, from, to)
+}
+
+// ListWeek returns events visible to the user overlapping the week containing the
+// date, the week starts on the day set in the user settings.
+func (a *App) ListWeek(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	day, u, err := a.localDate(ctx, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	from, to := storage.WeekRange(storage.StartOfWeek(day, u.WeekStart))
+	return a.storage.ListVisibleRange(ctx, userID, from, to)
+}
+
+// ListMonth returns events visible to the user overlapping the calendar month containing the date.
+func (a *App) ListMonth(ctx context.Context, date time.Time) ([]storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	day, _, err := a.localDate(ctx, userID, date)
+	if err != nil {
+		return nil, err
+	}
+	from, to := storage.MonthRange(storage.StartOfMonth(day))
+	return a.storage.ListVisibleRange(ctx, userID, from, to)
+}
+
+// localDate returns the midnight of the calendar date of date in the zone of the user.
+func (a *App) localDate(ctx context.Context, userID string, date time.Time) (time.Time, storage.User, error) {
+	u, err := a.userSettings(ctx, userID)
+	if err != nil {
+		return time.Time{}, storage.User{}, err
+	}
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, u.Location()), u, nil
+}
+
+// invite returns attendees with no response, storage keeps the responses
+// of attendees who were invited before.
+func invite(attendees []storage.Attendee) []storage.Attendee {
+	if len(attendees) == 0 {
+		return nil
+	}
+	res := make([]storage.Attendee, 0, len(attendees))
+	for _, a := range attendees {
+		res = append(res, storage.Attendee{UserID: a.UserID, Status: storage.NeedsAction})
+	}
+	return res
+}
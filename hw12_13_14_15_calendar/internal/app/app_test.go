@@ -0,0 +1,335 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newEvent(title string, start time.Time) storage.Event {
+	return storage.Event{Title: title, StartAt: start, EndAt: start.Add(time.Hour)}
+}
+
+func TestApp(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	created, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime))
+	require.NoError(t, err)
+	require.NotEmpty(t, created.ID)
+	require.Equal(t, "alice", created.UserID)
+	require.Equal(t, int64(1), created.Version)
+
+	_, err = a.CreateEvent(WithUser(ctx, "bob"), newEvent("standup", baseTime))
+	require.NoError(t, err)
+
+	t.Run("user required", func(t *testing.T) {
+		_, err := a.CreateEvent(ctx, newEvent("standup", baseTime))
+		require.ErrorIs(t, err, ErrNoUser)
+		_, err = a.ListDay(ctx, baseTime)
+		require.ErrorIs(t, err, ErrNoUser)
+	})
+
+	t.Run("owner only", func(t *testing.T) {
+		_, err := a.GetEvent(WithUser(ctx, "bob"), created.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		_, err = a.UpdateEvent(WithUser(ctx, "bob"), created.ID, newEvent("hijacked", baseTime), storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		require.ErrorIs(t, a.DeleteEvent(WithUser(ctx, "bob"), created.ID, storage.AnyVersion), storage.ErrEventNotFound)
+
+		got, err := a.GetEvent(WithUser(ctx, "alice"), created.ID)
+		require.NoError(t, err)
+		require.Equal(t, "standup", got.Title)
+	})
+
+	t.Run("lists are filtered by owner", func(t *testing.T) {
+		day, err := a.ListDay(WithUser(ctx, "alice"), baseTime)
+		require.NoError(t, err)
+		require.Len(t, day, 1)
+		require.Equal(t, created.ID, day[0].ID)
+
+		week, err := a.ListWeek(WithUser(ctx, "carol"), baseTime)
+		require.NoError(t, err)
+		require.Empty(t, week)
+	})
+
+	t.Run("update keeps id and owner", func(t *testing.T) {
+		e := newEvent("retro", baseTime.Add(time.Hour))
+		e.UserID = "mallory"
+		updated, err := a.UpdateEvent(WithUser(ctx, "alice"), created.ID, e, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, created.ID, updated.ID)
+		require.Equal(t, "alice", updated.UserID)
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		current, err := a.GetEvent(WithUser(ctx, "alice"), created.ID)
+		require.NoError(t, err)
+
+		updated, err := a.UpdateEvent(WithUser(ctx, "alice"), created.ID, newEvent("planning", baseTime), current.Version)
+		require.NoError(t, err)
+		require.Equal(t, current.Version+1, updated.Version)
+
+		_, err = a.UpdateEvent(WithUser(ctx, "alice"), created.ID, newEvent("stale", baseTime), current.Version)
+		require.ErrorIs(t, err, storage.ErrVersionConflict)
+		require.ErrorIs(t, a.DeleteEvent(WithUser(ctx, "alice"), created.ID, current.Version), storage.ErrVersionConflict)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, a.DeleteEvent(WithUser(ctx, "alice"), created.ID, storage.AnyVersion))
+		_, err := a.GetEvent(WithUser(ctx, "alice"), created.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+	})
+}
+
+func TestAppRestoreAndHistory(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	e := newEvent("standup", baseTime)
+	e.Attendees = []storage.Attendee{{UserID: "bob"}}
+	created, err := a.CreateEvent(WithUser(ctx, "alice"), e)
+	require.NoError(t, err)
+	_, err = a.RespondEvent(WithUser(ctx, "bob"), created.ID, storage.Accepted)
+	require.NoError(t, err)
+
+	_, err = a.RestoreEvent(WithUser(ctx, "alice"), created.ID)
+	require.ErrorIs(t, err, storage.ErrNotDeleted)
+	require.NoError(t, a.DeleteEvent(WithUser(ctx, "alice"), created.ID, storage.AnyVersion))
+
+	_, err = a.RestoreEvent(WithUser(ctx, "bob"), created.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound, "only the owner restores")
+	restored, err := a.RestoreEvent(WithUser(ctx, "alice"), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), restored.Version)
+	require.Equal(t, storage.Accepted, restored.Attendees[0].Status)
+
+	require.NoError(t, a.DeleteEvent(WithUser(ctx, "alice"), created.ID, storage.AnyVersion))
+	history, err := a.EventHistory(WithUser(ctx, "bob"), created.ID)
+	require.NoError(t, err, "attendees see the history of deleted events")
+	require.Len(t, history, 5)
+	authors := make([]string, 0, len(history))
+	for _, r := range history {
+		authors = append(authors, r.UserID)
+	}
+	require.Equal(t, []string{"alice", "bob", "alice", "alice", "alice"}, authors)
+
+	_, err = a.EventHistory(WithUser(ctx, "carol"), created.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = a.EventHistory(WithUser(ctx, "alice"), "missing")
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func TestAppOccurrences(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	e := newEvent("standup", baseTime)
+	e.RRule = "FREQ=DAILY;COUNT=5"
+	series, err := a.CreateEvent(WithUser(ctx, "alice"), e)
+	require.NoError(t, err)
+
+	second := baseTime.AddDate(0, 0, 1)
+	third := baseTime.AddDate(0, 0, 2)
+
+	t.Run("owner only", func(t *testing.T) {
+		_, err := a.UpdateOccurrence(WithUser(ctx, "bob"), series.ID, second, newEvent("hijacked", second))
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		require.ErrorIs(t, a.CancelOccurrence(WithUser(ctx, "bob"), series.ID, second), storage.ErrEventNotFound)
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		edited, err := a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, second, newEvent("planning", second.Add(time.Hour)))
+		require.NoError(t, err)
+		require.Equal(t, storage.OccurrenceID(series.ID, second), edited.ID)
+		require.Equal(t, series.ID, edited.SeriesID)
+		require.Equal(t, second, edited.RecurrenceID)
+		require.Equal(t, "alice", edited.UserID)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, a.CancelOccurrence(WithUser(ctx, "alice"), series.ID, third))
+
+		week, err := a.ListWeek(WithUser(ctx, "alice"), baseTime)
+		require.NoError(t, err)
+		titles := make([]string, 0, len(week))
+		for _, occ := range week {
+			titles = append(titles, occ.Title)
+		}
+		require.Equal(t, []string{"standup", "planning", "standup", "standup"}, titles)
+	})
+
+	t.Run("update keeps exceptions", func(t *testing.T) {
+		e := newEvent("daily", baseTime)
+		e.RRule = series.RRule
+		updated, err := a.UpdateEvent(WithUser(ctx, "alice"), series.ID, e, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{second, third}, updated.ExDates)
+	})
+}
+
+func TestAppTimeZones(t *testing.T) {
+	ctx := context.Background()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	a := New(nopLogger{}, memorystorage.New(), Options{TimeZone: "Europe/Berlin", WeekStart: time.Monday})
+
+	t.Run("defaults", func(t *testing.T) {
+		u, err := a.UserSettings(WithUser(ctx, "alice"))
+		require.NoError(t, err)
+		require.Equal(t, storage.User{ID: "alice", TimeZone: "Europe/Berlin", WeekStart: time.Monday}, u)
+	})
+
+	// A daily standup at 9:00 Berlin time across the spring-forward night.
+	e := newEvent("standup", time.Date(2021, time.March, 26, 9, 0, 0, 0, berlin))
+	e.RRule = "FREQ=DAILY;COUNT=5"
+	series, err := a.CreateEvent(WithUser(ctx, "alice"), e)
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Berlin", series.TimeZone)
+	require.Equal(t, time.UTC, series.StartAt.Location())
+
+	t.Run("day bounds follow DST", func(t *testing.T) {
+		late, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("late", time.Date(2021, time.March, 28, 23, 0, 0, 0, berlin)))
+		require.NoError(t, err)
+		defer a.DeleteEvent(WithUser(ctx, "alice"), late.ID, storage.AnyVersion)
+
+		// The date is taken as a calendar date in the zone of the user.
+		day, err := a.ListDay(WithUser(ctx, "alice"), time.Date(2021, time.March, 28, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, day, 2)
+		require.Equal(t, time.Date(2021, time.March, 28, 7, 0, 0, 0, time.UTC), day[0].StartAt)
+		require.Equal(t, late.ID, day[1].ID)
+	})
+
+	t.Run("week start", func(t *testing.T) {
+		week, err := a.ListWeek(WithUser(ctx, "alice"), time.Date(2021, time.March, 28, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, week, 3, "Monday 22 to Sunday 28")
+		for _, occ := range week {
+			require.Equal(t, 9, occ.StartAt.In(berlin).Hour())
+		}
+
+		_, err = a.UpdateUserSettings(WithUser(ctx, "alice"), storage.User{TimeZone: "Europe/Berlin", WeekStart: time.Sunday})
+		require.NoError(t, err)
+		week, err = a.ListWeek(WithUser(ctx, "alice"), time.Date(2021, time.March, 28, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, week, 3, "Sunday 28 to Saturday 3")
+	})
+
+	t.Run("month", func(t *testing.T) {
+		month, err := a.ListMonth(WithUser(ctx, "alice"), time.Date(2021, time.April, 15, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Empty(t, month)
+
+		month, err = a.ListMonth(WithUser(ctx, "alice"), time.Date(2021, time.March, 15, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, month, 5)
+	})
+
+	t.Run("fall back", func(t *testing.T) {
+		_, err := a.UpdateUserSettings(WithUser(ctx, "bob"), storage.User{TimeZone: "America/New_York"})
+		require.NoError(t, err)
+		newYork, err := time.LoadLocation("America/New_York")
+		require.NoError(t, err)
+
+		night, err := a.CreateEvent(WithUser(ctx, "bob"), newEvent("night", time.Date(2021, time.November, 7, 23, 0, 0, 0, newYork)))
+		require.NoError(t, err)
+		require.Equal(t, "America/New_York", night.TimeZone)
+
+		// 7 November 2021 lasts 25 hours in New York, from 04:00 to 05:00 UTC next day.
+		day, err := a.ListDay(WithUser(ctx, "bob"), time.Date(2021, time.November, 7, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Len(t, day, 1)
+		day, err = a.ListDay(WithUser(ctx, "bob"), time.Date(2021, time.November, 8, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		require.Empty(t, day)
+	})
+
+	t.Run("updates keep the zone", func(t *testing.T) {
+		second := series.StartAt.AddDate(0, 0, 1)
+		edited, err := a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, second, newEvent("moved", second.Add(time.Hour)))
+		require.NoError(t, err)
+		require.Equal(t, series.TimeZone, edited.TimeZone)
+
+		e := newEvent("standup", series.StartAt)
+		e.RRule = series.RRule
+		updated, err := a.UpdateEvent(WithUser(ctx, "alice"), series.ID, e, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, series.TimeZone, updated.TimeZone)
+
+		e.TimeZone = "Mars/Olympus"
+		_, err = a.UpdateEvent(WithUser(ctx, "alice"), series.ID, e, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrInvalidEvent)
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		_, err := a.UpdateUserSettings(WithUser(ctx, "alice"), storage.User{TimeZone: "Mars/Olympus"})
+		require.ErrorIs(t, err, storage.ErrInvalidUser)
+	})
+}
+
+func TestAppImportExport(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	second := baseTime.AddDate(0, 0, 1)
+	series := newEvent("standup", baseTime)
+	series.ID = "standup@example.com"
+	series.RRule = "FREQ=DAILY;COUNT=3"
+	series.ExDates = []time.Time{second, baseTime.AddDate(0, 0, 2)}
+	edited := newEvent("moved standup", second.Add(2*time.Hour))
+	edited.SeriesID = series.ID
+	edited.RecurrenceID = second
+	orphan := newEvent("orphan", baseTime.AddDate(0, 0, 5))
+	orphan.SeriesID = "unknown@example.com"
+	orphan.RecurrenceID = baseTime.AddDate(0, 0, 5)
+	invalid := newEvent("", baseTime.AddDate(0, 0, 6))
+	invalid.ID = "invalid@example.com"
+
+	// Edited occurrences may come before their series.
+	res, err := a.ImportEvents(WithUser(ctx, "alice"), []storage.Event{edited, series, orphan, invalid})
+	require.NoError(t, err)
+	require.Len(t, res.Created, 2)
+	require.NotEqual(t, series.ID, res.Created[0].ID)
+	require.Equal(t, "alice", res.Created[0].UserID)
+	require.Equal(t, res.Created[0].ID, res.Created[1].SeriesID)
+
+	require.Len(t, res.Failed, 2)
+	require.Equal(t, "invalid@example.com", res.Failed[0].ID)
+	require.ErrorIs(t, res.Failed[0].Err, storage.ErrEmptyTitle)
+	require.Equal(t, "unknown@example.com", res.Failed[1].ID)
+	require.Equal(t, orphan.RecurrenceID, res.Failed[1].RecurrenceID)
+	require.ErrorIs(t, res.Failed[1].Err, storage.ErrEventNotFound)
+
+	week, err := a.ListWeek(WithUser(ctx, "alice"), baseTime)
+	require.NoError(t, err)
+	require.Len(t, week, 2)
+	require.Equal(t, "moved standup", week[1].Title)
+
+	exported, err := a.ExportEvents(WithUser(ctx, "alice"))
+	require.NoError(t, err)
+	require.Len(t, exported, 2)
+	require.ElementsMatch(t, series.ExDates, exported[0].ExDates)
+
+	empty, err := a.ExportEvents(WithUser(ctx, "bob"))
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = a.ImportEvents(WithUser(cancelled, "bob"), []storage.Event{series})
+	require.ErrorIs(t, err, context.Canceled)
+}
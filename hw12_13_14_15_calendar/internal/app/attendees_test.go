@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppAttendees(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	e := newEvent("planning", baseTime)
+	e.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.Accepted}, {UserID: "carol"}}
+	created, err := a.CreateEvent(WithUser(ctx, "alice"), e)
+	require.NoError(t, err)
+	require.Equal(t, storage.Responses{NeedsAction: 2}, created.Responses(), "invited without responses")
+
+	t.Run("invitees see the event", func(t *testing.T) {
+		for _, user := range []string{"bob", "carol"} {
+			day, err := a.ListDay(WithUser(ctx, user), baseTime)
+			require.NoError(t, err)
+			require.Len(t, day, 1)
+			require.Equal(t, created.ID, day[0].ID)
+
+			_, err = a.GetEvent(WithUser(ctx, user), created.ID)
+			require.NoError(t, err)
+		}
+
+		week, err := a.ListWeek(WithUser(ctx, "dave"), baseTime)
+		require.NoError(t, err)
+		require.Empty(t, week)
+		_, err = a.GetEvent(WithUser(ctx, "dave"), created.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+	})
+
+	t.Run("only the owner changes the event", func(t *testing.T) {
+		_, err := a.UpdateEvent(WithUser(ctx, "bob"), created.ID, newEvent("hijacked", baseTime), storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		require.ErrorIs(t, a.DeleteEvent(WithUser(ctx, "bob"), created.ID, storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("respond", func(t *testing.T) {
+		got, err := a.RespondEvent(WithUser(ctx, "bob"), created.ID, storage.Accepted)
+		require.NoError(t, err)
+		require.Equal(t, storage.Responses{NeedsAction: 1, Accepted: 1}, got.Responses())
+		got, err = a.RespondEvent(WithUser(ctx, "carol"), created.ID, storage.Declined)
+		require.NoError(t, err)
+		require.Equal(t, storage.Responses{Accepted: 1, Declined: 1}, got.Responses())
+
+		_, err = a.RespondEvent(WithUser(ctx, "dave"), created.ID, storage.Accepted)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		_, err = a.RespondEvent(WithUser(ctx, "alice"), created.ID, storage.Accepted)
+		require.ErrorIs(t, err, storage.ErrAttendeeNotFound)
+		_, err = a.RespondEvent(WithUser(ctx, "bob"), created.ID, storage.NeedsAction)
+		require.ErrorIs(t, err, storage.ErrInvalidAttendeeStatus)
+	})
+
+	t.Run("accepted events are busy time", func(t *testing.T) {
+		fb, err := a.FreeBusy(WithUser(ctx, "alice"), FreeBusyQuery{
+			UserIDs: []string{"bob", "carol"},
+			From:    baseTime.Add(-time.Hour),
+			To:      baseTime.Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Interval{{Start: baseTime, End: baseTime.Add(time.Hour)}}, fb.Users[0].Busy)
+		require.Empty(t, fb.Users[1].Busy, "declined")
+	})
+
+	t.Run("update keeps responses", func(t *testing.T) {
+		e := newEvent("planning", baseTime.Add(30*time.Minute))
+		e.Attendees = []storage.Attendee{{UserID: "bob"}, {UserID: "dave"}}
+		updated, err := a.UpdateEvent(WithUser(ctx, "alice"), created.ID, e, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, []storage.Attendee{
+			{UserID: "bob", Status: storage.Accepted},
+			{UserID: "dave", Status: storage.NeedsAction},
+		}, updated.Attendees)
+
+		day, err := a.ListDay(WithUser(ctx, "carol"), baseTime)
+		require.NoError(t, err)
+		require.Empty(t, day, "no longer invited")
+	})
+
+	t.Run("occurrences inherit attendees", func(t *testing.T) {
+		series := newEvent("weekly", baseTime.AddDate(0, 0, 1))
+		series.RRule = "FREQ=WEEKLY;COUNT=3"
+		series.Attendees = []storage.Attendee{{UserID: "bob"}}
+		created, err := a.CreateEvent(WithUser(ctx, "alice"), series)
+		require.NoError(t, err)
+		_, err = a.RespondEvent(WithUser(ctx, "bob"), created.ID, storage.Tentative)
+		require.NoError(t, err)
+
+		recurrenceID := created.StartAt.AddDate(0, 0, 7)
+		moved, err := a.UpdateOccurrence(WithUser(ctx, "alice"), created.ID, recurrenceID,
+			newEvent("weekly", recurrenceID.Add(time.Hour)))
+		require.NoError(t, err)
+		require.Equal(t, []storage.Attendee{{UserID: "bob", Status: storage.Tentative}}, moved.Attendees)
+
+		week, err := a.ListWeek(WithUser(ctx, "bob"), recurrenceID)
+		require.NoError(t, err)
+		require.Len(t, week, 1)
+		require.Equal(t, moved.ID, week[0].ID)
+	})
+}
@@ -0,0 +1,201 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// ChangeType tells what happened to an event.
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+const (
+	defaultChangeBuffer     = 1024
+	defaultSubscriberBuffer = 64
+)
+
+var (
+	// ErrChangesExpired is returned when changes after the requested ID are
+	// no longer buffered, e.g. after a restart. The subscriber should reload
+	// the events and subscribe for new changes only.
+	ErrChangesExpired = errors.New("changes after the given id are no longer available")
+	// ErrSlowSubscriber ends a subscription which does not keep up with
+	// changes. It may subscribe again after the last change it has received.
+	ErrSlowSubscriber = errors.New("subscriber does not keep up with changes")
+)
+
+// Change is a created, updated or deleted event. IDs of changes grow by one
+// and are only meaningful within the running process. Concurrent changes of
+// the same event may come in any order, Event.Version tells the latest.
+type Change struct {
+	ID   uint64
+	Type ChangeType
+	// Event is the event after the change, a deleted event as it was.
+	Event storage.Event
+
+	// users are the owner and the attendees before and after the change, so
+	// uninvited attendees learn about it too.
+	users []string
+}
+
+func (c Change) visibleTo(userID string) bool {
+	for _, u := range c.users {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription delivers changes visible to a user until it is closed.
+type Subscription struct {
+	feed    *changeFeed
+	changes chan Change
+	done    chan struct{}
+	err     error
+}
+
+// Changes returns the channel of changes, it is closed when the subscription ends.
+func (s *Subscription) Changes() <-chan Change {
+	return s.changes
+}
+
+// Err tells why Changes has been closed: ErrSlowSubscriber, the error of
+// the subscription context or nil after Close.
+func (s *Subscription) Err() error {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.feed.remove(s, nil)
+}
+
+// changeFeed fans changes out to subscribers and keeps the last of them
+// in a ring buffer for subscribers resuming after a reconnect. Publishing
+// never blocks: a subscriber whose queue is full is dropped.
+type changeFeed struct {
+	mu               sync.Mutex
+	last             uint64
+	ring             []Change
+	start, n         int
+	subscriberBuffer int
+	subs             map[*Subscription]string
+}
+
+func newChangeFeed(buffer, subscriberBuffer int) *changeFeed {
+	if buffer <= 0 {
+		buffer = defaultChangeBuffer
+	}
+	if subscriberBuffer <= 0 {
+		subscriberBuffer = defaultSubscriberBuffer
+	}
+	return &changeFeed{
+		ring:             make([]Change, buffer),
+		subscriberBuffer: subscriberBuffer,
+		subs:             make(map[*Subscription]string),
+	}
+}
+
+// publish records the change of e, old holds the event before it when there was one.
+func (f *changeFeed) publish(typ ChangeType, e storage.Event, old ...storage.Event) {
+	users := []string{e.UserID}
+	seen := map[string]bool{e.UserID: true}
+	for _, ev := range append([]storage.Event{e}, old...) {
+		for _, a := range ev.Attendees {
+			if !seen[a.UserID] {
+				seen[a.UserID] = true
+				users = append(users, a.UserID)
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.last++
+	c := Change{ID: f.last, Type: typ, Event: e, users: users}
+	f.ring[(f.start+f.n)%len(f.ring)] = c
+	if f.n < len(f.ring) {
+		f.n++
+	} else {
+		f.start = (f.start + 1) % len(f.ring)
+	}
+
+	for sub, userID := range f.subs {
+		if !c.visibleTo(userID) {
+			continue
+		}
+		select {
+		case sub.changes <- c:
+		default:
+			f.removeLocked(sub, ErrSlowSubscriber)
+		}
+	}
+}
+
+// subscribe returns a subscription to changes visible to userID made after
+// the change with the ID after, zero means only new changes. It ends when
+// ctx is done.
+func (f *changeFeed) subscribe(ctx context.Context, userID string, after uint64) (*Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var replay []Change
+	if after > 0 {
+		if after > f.last || after+uint64(f.n) < f.last {
+			return nil, ErrChangesExpired
+		}
+		for i := 0; i < f.n; i++ {
+			c := f.ring[(f.start+i)%len(f.ring)]
+			if c.ID > after && c.visibleTo(userID) {
+				replay = append(replay, c)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		feed:    f,
+		changes: make(chan Change, f.subscriberBuffer+len(replay)),
+		done:    make(chan struct{}),
+	}
+	for _, c := range replay {
+		sub.changes <- c
+	}
+	f.subs[sub] = userID
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.remove(sub, ctx.Err())
+		case <-sub.done:
+		}
+	}()
+
+	return sub, nil
+}
+
+func (f *changeFeed) remove(sub *Subscription, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removeLocked(sub, err)
+}
+
+func (f *changeFeed) removeLocked(sub *Subscription, err error) {
+	if _, ok := f.subs[sub]; !ok {
+		return
+	}
+	delete(f.subs, sub)
+	sub.err = err
+	close(sub.changes)
+	close(sub.done)
+}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+// receive reads the next change or fails if none comes soon.
+func receive(t *testing.T, sub *Subscription) Change {
+	t.Helper()
+
+	select {
+	case c, ok := <-sub.Changes():
+		require.True(t, ok, "subscription closed: %v", sub.Err())
+		return c
+	case <-time.After(time.Second):
+		require.FailNow(t, "no change received")
+		return Change{}
+	}
+}
+
+func requireNoChange(t *testing.T, sub *Subscription) {
+	t.Helper()
+
+	select {
+	case c := <-sub.Changes():
+		require.FailNow(t, "unexpected change", "%+v", c)
+	default:
+	}
+}
+
+func TestAppChanges(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	alice, err := a.Subscribe(WithUser(ctx, "alice"), 0)
+	require.NoError(t, err)
+	defer alice.Close()
+	bob, err := a.Subscribe(WithUser(ctx, "bob"), 0)
+	require.NoError(t, err)
+	defer bob.Close()
+
+	created, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime))
+	require.NoError(t, err)
+	c := receive(t, alice)
+	require.Equal(t, uint64(1), c.ID)
+	require.Equal(t, ChangeCreated, c.Type)
+	require.Equal(t, created, c.Event)
+	requireNoChange(t, bob)
+
+	e := newEvent("planning", baseTime)
+	e.Attendees = []storage.Attendee{{UserID: "bob"}}
+	_, err = a.UpdateEvent(WithUser(ctx, "alice"), created.ID, e, storage.AnyVersion)
+	require.NoError(t, err)
+	require.Equal(t, ChangeUpdated, receive(t, alice).Type)
+	require.Equal(t, "planning", receive(t, bob).Event.Title, "invited attendees see updates")
+
+	_, err = a.RespondEvent(WithUser(ctx, "bob"), created.ID, storage.Accepted)
+	require.NoError(t, err)
+	require.Equal(t, storage.Responses{Accepted: 1}, receive(t, alice).Event.Responses())
+	receive(t, bob)
+
+	e.Attendees = nil
+	_, err = a.UpdateEvent(WithUser(ctx, "alice"), created.ID, e, storage.AnyVersion)
+	require.NoError(t, err)
+	receive(t, alice)
+	c = receive(t, bob)
+	require.Empty(t, c.Event.Attendees, "uninvited attendees learn they are removed")
+
+	require.NoError(t, a.DeleteEvent(WithUser(ctx, "alice"), created.ID, storage.AnyVersion))
+	c = receive(t, alice)
+	require.Equal(t, ChangeDeleted, c.Type)
+	require.Equal(t, created.ID, c.Event.ID)
+	require.Equal(t, uint64(5), c.ID)
+	requireNoChange(t, bob)
+
+	t.Run("occurrences", func(t *testing.T) {
+		e := newEvent("daily", baseTime.AddDate(0, 0, 1))
+		e.RRule = "FREQ=DAILY;COUNT=5"
+		series, err := a.CreateEvent(WithUser(ctx, "alice"), e)
+		require.NoError(t, err)
+		receive(t, alice)
+
+		recurrenceID := series.StartAt.AddDate(0, 0, 1)
+		moved := newEvent("moved", recurrenceID.Add(time.Hour))
+		_, err = a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, recurrenceID, moved)
+		require.NoError(t, err)
+		require.Equal(t, series.ID, receive(t, alice).Event.ID, "the series gets an exception date")
+		c := receive(t, alice)
+		require.Equal(t, ChangeCreated, c.Type)
+		require.Equal(t, series.ID, c.Event.SeriesID)
+
+		_, err = a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, recurrenceID, moved)
+		require.NoError(t, err)
+		require.Equal(t, ChangeUpdated, receive(t, alice).Type)
+		requireNoChange(t, alice)
+
+		require.NoError(t, a.CancelOccurrence(WithUser(ctx, "alice"), series.ID, recurrenceID))
+		c = receive(t, alice)
+		require.Equal(t, ChangeDeleted, c.Type)
+		require.Equal(t, series.ID, c.Event.SeriesID)
+
+		require.NoError(t, a.CancelOccurrence(WithUser(ctx, "alice"), series.ID, recurrenceID.AddDate(0, 0, 1)))
+		c = receive(t, alice)
+		require.Equal(t, ChangeUpdated, c.Type)
+		require.Equal(t, series.ID, c.Event.ID)
+		require.Len(t, c.Event.ExDates, 2)
+	})
+}
+
+func TestAppChangesResume(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{ChangeBuffer: 3})
+
+	for i := 0; i < 4; i++ {
+		_, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime.AddDate(0, 0, i)))
+		require.NoError(t, err)
+	}
+	_, err := a.CreateEvent(WithUser(ctx, "bob"), newEvent("standup", baseTime))
+	require.NoError(t, err)
+
+	sub, err := a.Subscribe(WithUser(ctx, "alice"), 2)
+	require.NoError(t, err)
+	defer sub.Close()
+	require.Equal(t, uint64(3), receive(t, sub).ID)
+	require.Equal(t, uint64(4), receive(t, sub).ID)
+	requireNoChange(t, sub)
+
+	_, err = a.Subscribe(WithUser(ctx, "alice"), 1)
+	require.ErrorIs(t, err, ErrChangesExpired, "change 2 is out of the buffer")
+	_, err = a.Subscribe(WithUser(ctx, "alice"), 6)
+	require.ErrorIs(t, err, ErrChangesExpired, "change 6 has not happened")
+
+	latest, err := a.Subscribe(WithUser(ctx, "alice"), 5)
+	require.NoError(t, err)
+	defer latest.Close()
+	requireNoChange(t, latest)
+}
+
+func TestAppChangesSlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{SubscriberBuffer: 2})
+
+	slow, err := a.Subscribe(WithUser(ctx, "alice"), 0)
+	require.NoError(t, err)
+	defer slow.Close()
+	fast, err := a.Subscribe(WithUser(ctx, "alice"), 0)
+	require.NoError(t, err)
+	defer fast.Close()
+
+	done := make(chan struct{})
+	received := make(chan uint64, 10)
+	go func() {
+		defer close(done)
+		for c := range fast.Changes() {
+			received <- c.ID
+		}
+	}()
+
+	// Writes must not wait for the slow subscriber.
+	for i := 0; i < 5; i++ {
+		_, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime.AddDate(0, 0, i)))
+		require.NoError(t, err)
+		require.Equal(t, uint64(i+1), <-received)
+	}
+
+	require.Equal(t, uint64(1), receive(t, slow).ID)
+	require.Equal(t, uint64(2), receive(t, slow).ID)
+	_, ok := <-slow.Changes()
+	require.False(t, ok, "the slow subscriber is dropped")
+	require.ErrorIs(t, slow.Err(), ErrSlowSubscriber)
+
+	resumed, err := a.Subscribe(WithUser(ctx, "alice"), 2)
+	require.NoError(t, err)
+	defer resumed.Close()
+	for id := uint64(3); id <= 5; id++ {
+		require.Equal(t, id, receive(t, resumed).ID, "missed changes are replayed")
+	}
+
+	fast.Close()
+	<-done
+	require.NoError(t, fast.Err())
+}
+
+func TestAppChangesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	sub, err := a.Subscribe(WithUser(ctx, "alice"), 0)
+	require.NoError(t, err)
+	cancel()
+
+	select {
+	case _, ok := <-sub.Changes():
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		require.FailNow(t, "subscription is not closed")
+	}
+	require.ErrorIs(t, sub.Err(), context.Canceled)
+	sub.Close()
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var ErrInvalidFreeBusy = errors.New("invalid free/busy query")
+
+const (
+	// MaxFreeBusyUsers limits the number of users of a single query.
+	MaxFreeBusyUsers = 50
+	// MaxFreeBusyRange limits the period of a single query, recurring events
+	// are expanded over all of it.
+	MaxFreeBusyRange = 92 * 24 * time.Hour
+)
+
+// Interval is the time from Start up to End, End excluded.
+type Interval struct {
+	Start, End time.Time
+}
+
+// FreeBusyQuery asks when all users are free together between From and To.
+type FreeBusyQuery struct {
+	UserIDs  []string
+	From, To time.Time
+	// Duration is the minimal length of a free slot, any free time fits when zero.
+	Duration time.Duration
+	// WorkStart and WorkEnd are times of day since midnight. Free slots lie
+	// within them in the time zone of every user, e.g. 10:00 to 18:00 in
+	// Berlin for one user and in New York for another. Zero values mean the
+	// whole day.
+	WorkStart, WorkEnd time.Duration
+}
+
+// FreeBusy is the answer to FreeBusyQuery.
+type FreeBusy struct {
+	// Users hold the merged busy intervals of every queried user in the order of the query.
+	Users []UserBusy
+	// Free holds the slots of at least Duration when all users are free
+	// within their working hours, ordered by start.
+	Free []Interval
+}
+
+// UserBusy is the time the user is busy with events. Event details are not
+// disclosed, so any user may query it.
+type UserBusy struct {
+	UserID   string
+	TimeZone string
+	Busy     []Interval
+}
+
+// FreeBusy merges the events of the queried users to busy intervals and
+// returns the free slots common to all of them. Any user may ask about others,
+// only busy intervals are disclosed.
+func (a *App) FreeBusy(ctx context.Context, q FreeBusyQuery) (FreeBusy, error) {
+	if _, err := contextUser(ctx); err != nil {
+		return FreeBusy{}, err
+	}
+	q.UserIDs = uniqueIDs(q.UserIDs)
+	if err := q.validate(); err != nil {
+		return FreeBusy{}, err
+	}
+	q.From, q.To = q.From.UTC(), q.To.UTC()
+
+	res := FreeBusy{Users: make([]UserBusy, 0, len(q.UserIDs))}
+	free := []Interval{{Start: q.From, End: q.To}}
+	for _, userID := range q.UserIDs {
+		u, err := a.userSettings(ctx, userID)
+		if err != nil {
+			return FreeBusy{}, err
+		}
+		events, err := a.storage.ListUserRange(ctx, userID, q.From, q.To)
+		if err != nil {
+			return FreeBusy{}, err
+		}
+
+		busy := busyIntervals(events, q.From, q.To)
+		res.Users = append(res.Users, UserBusy{UserID: userID, TimeZone: u.TimeZone, Busy: busy})
+		free = intersectIntervals(free, subtractIntervals(q.workingHours(u.Location()), busy))
+	}
+
+	res.Free = make([]Interval, 0, len(free))
+	for _, slot := range free {
+		if slot.End.Sub(slot.Start) >= q.Duration {
+			res.Free = append(res.Free, slot)
+		}
+	}
+	return res, nil
+}
+
+func (q FreeBusyQuery) validate() error {
+	switch {
+	case len(q.UserIDs) == 0:
+		return fmt.Errorf("%w: no users", ErrInvalidFreeBusy)
+	case len(q.UserIDs) > MaxFreeBusyUsers:
+		return fmt.Errorf("%w: more than %d users", ErrInvalidFreeBusy, MaxFreeBusyUsers)
+	case !q.From.Before(q.To):
+		return fmt.Errorf("%w: period ends before it starts", ErrInvalidFreeBusy)
+	case q.To.Sub(q.From) > MaxFreeBusyRange:
+		return fmt.Errorf("%w: period is longer than %s", ErrInvalidFreeBusy, MaxFreeBusyRange)
+	case q.Duration < 0:
+		return fmt.Errorf("%w: negative duration", ErrInvalidFreeBusy)
+	case q.WorkStart == 0 && q.WorkEnd == 0:
+		return nil
+	case q.WorkStart < 0 || q.WorkEnd > 24*time.Hour || q.WorkStart >= q.WorkEnd:
+		return fmt.Errorf("%w: working hours must lie within a day and end after they start", ErrInvalidFreeBusy)
+	default:
+		return nil
+	}
+}
+
+// workingHours returns the working hours of every day in loc within the period.
+func (q FreeBusyQuery) workingHours(loc *time.Location) []Interval {
+	if q.WorkStart == 0 && q.WorkEnd == 0 {
+		return []Interval{{Start: q.From, End: q.To}}
+	}
+
+	var res []Interval
+	y, m, d := q.From.In(loc).Date()
+	for ; time.Date(y, m, d, 0, 0, 0, 0, loc).Before(q.To); d++ {
+		// Wall clock times keep the hours right on days with DST transitions.
+		hours := Interval{Start: atClock(y, m, d, q.WorkStart, loc), End: atClock(y, m, d, q.WorkEnd, loc)}
+		if slot, ok := clip(hours, q.From, q.To); ok {
+			res = append(res, slot)
+		}
+	}
+	return res
+}
+
+// atClock returns the time the clock shows clock after midnight of the date in loc.
+func atClock(y int, m time.Month, d int, clock time.Duration, loc *time.Location) time.Time {
+	h, minutes, sec := clock/time.Hour, clock%time.Hour/time.Minute, clock%time.Minute/time.Second
+	return time.Date(y, m, d, int(h), int(minutes), int(sec), 0, loc)
+}
+
+// busyIntervals merges occurrences of events clipped to [from, to).
+func busyIntervals(events []storage.Event, from, to time.Time) []Interval {
+	intervals := make([]Interval, 0, len(events))
+	for _, e := range events {
+		if in, ok := clip(Interval{Start: e.StartAt, End: e.EndAt}, from, to); ok {
+			intervals = append(intervals, in)
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	res := make([]Interval, 0, len(intervals))
+	for _, in := range intervals {
+		if last := len(res) - 1; last >= 0 && !in.Start.After(res[last].End) {
+			if in.End.After(res[last].End) {
+				res[last].End = in.End
+			}
+			continue
+		}
+		res = append(res, in)
+	}
+	return res
+}
+
+// subtractIntervals returns parts of a not covered by b. Both hold sorted
+// disjoint intervals, so does the result.
+func subtractIntervals(a, b []Interval) []Interval {
+	res := make([]Interval, 0, len(a))
+	j := 0
+	for _, in := range a {
+		for j < len(b) && !b[j].End.After(in.Start) {
+			j++
+		}
+		start := in.Start
+		for k := j; k < len(b) && b[k].Start.Before(in.End); k++ {
+			if b[k].Start.After(start) {
+				res = append(res, Interval{Start: start, End: b[k].Start})
+			}
+			if b[k].End.After(start) {
+				start = b[k].End
+			}
+		}
+		if start.Before(in.End) {
+			res = append(res, Interval{Start: start, End: in.End})
+		}
+	}
+	return res
+}
+
+// intersectIntervals returns parts covered by both a and b holding sorted disjoint intervals.
+func intersectIntervals(a, b []Interval) []Interval {
+	res := make([]Interval, 0)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if start.Before(end) {
+			res = append(res, Interval{Start: start, End: end})
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return res
+}
+
+func clip(in Interval, from, to time.Time) (Interval, bool) {
+	if in.Start.Before(from) {
+		in.Start = from
+	}
+	if in.End.After(to) {
+		in.End = to
+	}
+	return Interval{Start: in.Start.UTC(), End: in.End.UTC()}, in.Start.Before(in.End)
+}
+
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func utc(month time.Month, day, hour, min int) time.Time {
+	return time.Date(2021, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestAppFreeBusy(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{TimeZone: "Europe/Berlin", WeekStart: time.Monday})
+	_, err := a.UpdateUserSettings(WithUser(ctx, "bob"), storage.User{TimeZone: "America/New_York"})
+	require.NoError(t, err)
+
+	// 16:30 in Berlin, 14:30 UTC after the spring-forward.
+	daily := newEvent("daily", utc(time.March, 29, 14, 30))
+	daily.EndAt = daily.StartAt.Add(30 * time.Minute)
+	daily.RRule = "FREQ=DAILY"
+	_, err = a.CreateEvent(WithUser(ctx, "alice"), daily)
+	require.NoError(t, err)
+	// 11:00 in New York, 15:00 UTC.
+	call := newEvent("call", utc(time.March, 30, 15, 0))
+	_, err = a.CreateEvent(WithUser(ctx, "bob"), call)
+	require.NoError(t, err)
+	// Overlapping events merge to one busy interval.
+	review := newEvent("review", utc(time.March, 30, 15, 30))
+	_, err = a.CreateEvent(WithUser(storage.WithOverlap(ctx), "bob"), review)
+	require.NoError(t, err)
+
+	// Any user may query the time of others.
+	asCarol := WithUser(ctx, "carol")
+
+	t.Run("no user", func(t *testing.T) {
+		_, err := a.FreeBusy(ctx, FreeBusyQuery{
+			UserIDs: []string{"alice"}, From: utc(time.March, 30, 0, 0), To: utc(time.March, 31, 0, 0),
+		})
+		require.ErrorIs(t, err, ErrNoUser)
+	})
+
+	t.Run("common slots", func(t *testing.T) {
+		// 10:00 to 18:00 is 8:00 to 16:00 UTC in Berlin and 14:00 to 22:00 UTC in New York.
+		res, err := a.FreeBusy(asCarol, FreeBusyQuery{
+			UserIDs:   []string{"alice", "bob", "alice"},
+			From:      utc(time.March, 29, 0, 0),
+			To:        utc(time.March, 31, 0, 0),
+			Duration:  45 * time.Minute,
+			WorkStart: 10 * time.Hour,
+			WorkEnd:   18 * time.Hour,
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, []UserBusy{
+			{UserID: "alice", TimeZone: "Europe/Berlin", Busy: []Interval{
+				{Start: utc(time.March, 29, 14, 30), End: utc(time.March, 29, 15, 0)},
+				{Start: utc(time.March, 30, 14, 30), End: utc(time.March, 30, 15, 0)},
+			}},
+			{UserID: "bob", TimeZone: "America/New_York", Busy: []Interval{
+				{Start: utc(time.March, 30, 15, 0), End: utc(time.March, 30, 16, 30)},
+			}},
+		}, res.Users)
+		// 14:00 to 14:30 is too short, Tuesday has no common free time after the daily.
+		require.Equal(t, []Interval{
+			{Start: utc(time.March, 29, 15, 0), End: utc(time.March, 29, 16, 0)},
+		}, res.Free)
+	})
+
+	t.Run("without working hours", func(t *testing.T) {
+		res, err := a.FreeBusy(asCarol, FreeBusyQuery{
+			UserIDs: []string{"alice", "bob"},
+			From:    utc(time.March, 30, 14, 0),
+			To:      utc(time.March, 30, 17, 0),
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Interval{
+			{Start: utc(time.March, 30, 14, 0), End: utc(time.March, 30, 14, 30)},
+			{Start: utc(time.March, 30, 16, 30), End: utc(time.March, 30, 17, 0)},
+		}, res.Free)
+	})
+
+	t.Run("working hours follow DST", func(t *testing.T) {
+		res, err := a.FreeBusy(asCarol, FreeBusyQuery{
+			UserIDs:   []string{"carol"},
+			From:      utc(time.March, 27, 0, 0),
+			To:        utc(time.March, 29, 0, 0),
+			WorkStart: 10 * time.Hour,
+			WorkEnd:   18 * time.Hour,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Interval{
+			{Start: utc(time.March, 27, 9, 0), End: utc(time.March, 27, 17, 0)},
+			{Start: utc(time.March, 28, 8, 0), End: utc(time.March, 28, 16, 0)},
+		}, res.Free)
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		valid := FreeBusyQuery{UserIDs: []string{"alice"}, From: utc(time.March, 29, 0, 0), To: utc(time.April, 5, 0, 0)}
+		tests := []struct {
+			name   string
+			modify func(q *FreeBusyQuery)
+		}{
+			{name: "no users", modify: func(q *FreeBusyQuery) { q.UserIDs = []string{""} }},
+			{name: "too many users", modify: func(q *FreeBusyQuery) {
+				q.UserIDs = nil
+				for i := 0; i <= MaxFreeBusyUsers; i++ {
+					q.UserIDs = append(q.UserIDs, string(rune('a'+i)))
+				}
+			}},
+			{name: "empty period", modify: func(q *FreeBusyQuery) { q.To = q.From }},
+			{name: "long period", modify: func(q *FreeBusyQuery) { q.To = q.From.Add(MaxFreeBusyRange + time.Hour) }},
+			{name: "negative duration", modify: func(q *FreeBusyQuery) { q.Duration = -time.Minute }},
+			{name: "working hours end first", modify: func(q *FreeBusyQuery) {
+				q.WorkStart, q.WorkEnd = 18*time.Hour, 10*time.Hour
+			}},
+			{name: "working hours past midnight", modify: func(q *FreeBusyQuery) {
+				q.WorkStart, q.WorkEnd = 20*time.Hour, 26*time.Hour
+			}},
+		}
+		for _, tc := range tests {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				q := valid
+				tc.modify(&q)
+				_, err := a.FreeBusy(asCarol, q)
+				require.ErrorIs(t, err, ErrInvalidFreeBusy)
+			})
+		}
+	})
+}
+
+func TestSubtractIntervals(t *testing.T) {
+	in := func(from, to int) Interval {
+		return Interval{Start: utc(time.March, 1, from, 0), End: utc(time.March, 1, to, 0)}
+	}
+
+	tests := []struct {
+		name     string
+		a, b     []Interval
+		expected []Interval
+	}{
+		{name: "nothing busy", a: []Interval{in(9, 17)}, expected: []Interval{in(9, 17)}},
+		{name: "inside", a: []Interval{in(9, 17)}, b: []Interval{in(10, 11), in(12, 13)},
+			expected: []Interval{in(9, 10), in(11, 12), in(13, 17)}},
+		{name: "across bounds", a: []Interval{in(9, 12), in(14, 17)}, b: []Interval{in(8, 10), in(11, 15)},
+			expected: []Interval{in(10, 11), in(15, 17)}},
+		{name: "covered", a: []Interval{in(9, 12)}, b: []Interval{in(8, 20)}, expected: []Interval{}},
+		{name: "touching", a: []Interval{in(9, 12)}, b: []Interval{in(8, 9), in(12, 13)}, expected: []Interval{in(9, 12)}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, subtractIntervals(tc.a, tc.b))
+			if len(tc.b) > 0 {
+				// Subtracting b is intersecting with the time b leaves free.
+				free := subtractIntervals(tc.a, tc.b)
+				require.Equal(t, free, intersectIntervals(tc.a, subtractIntervals([]Interval{in(0, 24)}, tc.b)))
+			}
+		})
+	}
+}
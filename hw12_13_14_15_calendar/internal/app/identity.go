@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoUser is returned by methods of App called with a context which
+// carries no user, servers reject such requests before.
+var ErrNoUser = errors.New("no user in context")
+
+type userKey struct{}
+
+// WithUser returns ctx carrying the ID of the user on whose behalf the
+// request is made. Servers set it once per request after reading it from
+// the transport, handlers take it with UserFromContext.
+func WithUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFromContext returns the user set by WithUser, ok is false when ctx
+// carries no user.
+func UserFromContext(ctx context.Context) (userID string, ok bool) {
+	userID, _ = ctx.Value(userKey{}).(string)
+	return userID, userID != ""
+}
+
+func contextUser(ctx context.Context) (string, error) {
+	userID, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrNoUser
+	}
+	return userID, nil
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// ImportResult describes the outcome of ImportEvents.
+type ImportResult struct {
+	// Created holds the stored events with their new IDs.
+	Created []storage.Event
+	// Failed holds events which could not be stored.
+	Failed []ImportFailure
+}
+
+// ImportFailure is an event rejected by ImportEvents. RecurrenceID is set
+// for edited occurrences of a recurring event.
+type ImportFailure struct {
+	ID           string
+	RecurrenceID time.Time
+	Err          error
+}
+
+// ExportEvents returns all events owned by the user with recurring events not expanded.
+func (a *App) ExportEvents(ctx context.Context) ([]storage.Event, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.ListByUser(ctx, userID)
+}
+
+// ImportEvents stores events, e.g. decoded from another calendar, for the user.
+// The events get new IDs, edited occurrences are matched to their series
+// by SeriesID. A failed event does not stop the import, its failure is
+// reported in the result. Only a done ctx aborts the import.
+func (a *App) ImportEvents(ctx context.Context, events []storage.Event) (ImportResult, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	edited := make(map[string][]time.Time)
+	for _, e := range events {
+		if e.SeriesID != "" {
+			edited[e.SeriesID] = append(edited[e.SeriesID], e.RecurrenceID)
+		}
+	}
+
+	var res ImportResult
+	ids := make(map[string]string)
+	for _, e := range events {
+		if e.SeriesID != "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		oldID := e.ID
+		// UpdateOccurrence adds exception dates for edited occurrences itself.
+		e.ExDates = withoutTimes(e.ExDates, edited[oldID])
+		created, err := a.CreateEvent(ctx, e)
+		if err != nil {
+			res.Failed = append(res.Failed, ImportFailure{ID: oldID, Err: err})
+			continue
+		}
+		ids[oldID] = created.ID
+		res.Created = append(res.Created, created)
+	}
+
+	for _, e := range events {
+		if e.SeriesID == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		failure := ImportFailure{ID: e.SeriesID, RecurrenceID: e.RecurrenceID}
+		seriesID, ok := ids[e.SeriesID]
+		if !ok {
+			failure.Err = storage.ErrEventNotFound
+			res.Failed = append(res.Failed, failure)
+			continue
+		}
+		created, err := a.UpdateOccurrence(ctx, seriesID, e.RecurrenceID, e)
+		if err != nil {
+			failure.Err = err
+			res.Failed = append(res.Failed, failure)
+			continue
+		}
+		res.Created = append(res.Created, created)
+	}
+
+	a.logger.Info("events imported", "user", userID, "created", len(res.Created), "failed", len(res.Failed))
+	return res, nil
+}
+
+func withoutTimes(times, exclude []time.Time) []time.Time {
+	if len(exclude) == 0 {
+		return times
+	}
+
+	res := make([]time.Time, 0, len(times))
+	for _, t := range times {
+		excluded := false
+		for _, ex := range exclude {
+			if ex.Equal(t) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			res = append(res, t)
+		}
+	}
+	return res
+}
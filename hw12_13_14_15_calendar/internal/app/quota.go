@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQuotaExceeded is returned when the user owns Options.MaxEvents events already.
+var ErrQuotaExceeded = errors.New("event quota exceeded")
+
+// userLocks serializes the writes adding events of the same user, so the
+// count of a check stays right until the write is done.
+type userLocks struct {
+	mu    sync.Mutex
+	users map[string]*userLock
+}
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the user and returns the function unlocking them.
+func (l *userLocks) lock(userID string) func() {
+	l.mu.Lock()
+	if l.users == nil {
+		l.users = make(map[string]*userLock)
+	}
+	u, ok := l.users[userID]
+	if !ok {
+		u = &userLock{}
+		l.users[userID] = u
+	}
+	u.refs++
+	l.mu.Unlock()
+
+	u.Lock()
+	return func() {
+		u.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if u.refs--; u.refs == 0 {
+			delete(l.users, userID)
+		}
+	}
+}
+
+// lockQuota locks the user for checkQuota and the write adding an event,
+// it does nothing when there is no quota.
+func (a *App) lockQuota(userID string) func() {
+	if a.opts.MaxEvents <= 0 {
+		return func() {}
+	}
+	return a.quota.lock(userID)
+}
+
+// checkQuota fails with ErrQuotaExceeded when the user owns MaxEvents
+// events already, the user must be locked with lockQuota.
+func (a *App) checkQuota(ctx context.Context, userID string) error {
+	if a.opts.MaxEvents <= 0 {
+		return nil
+	}
+	n, err := a.storage.CountEvents(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if n >= a.opts.MaxEvents {
+		return fmt.Errorf("%w: %d events at most", ErrQuotaExceeded, a.opts.MaxEvents)
+	}
+	return nil
+}
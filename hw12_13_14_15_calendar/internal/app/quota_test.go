@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppEventQuota(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{MaxEvents: 3})
+
+	weekly := newEvent("weekly", baseTime)
+	weekly.RRule = "FREQ=WEEKLY"
+	series, err := a.CreateEvent(WithUser(ctx, "alice"), weekly)
+	require.NoError(t, err)
+	standup, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime.Add(2*time.Hour)))
+	require.NoError(t, err)
+
+	// Edited occurrences are stored as events of their own.
+	nextWeek := baseTime.AddDate(0, 0, 7)
+	_, err = a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, nextWeek, newEvent("weekly", nextWeek.Add(time.Hour)))
+	require.NoError(t, err)
+	_, err = a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, nextWeek, newEvent("weekly", nextWeek.Add(2*time.Hour)))
+	require.NoError(t, err, "editing it again adds nothing")
+	inTwoWeeks := baseTime.AddDate(0, 0, 14)
+	_, err = a.UpdateOccurrence(WithUser(ctx, "alice"), series.ID, inTwoWeeks, newEvent("weekly", inTwoWeeks.Add(time.Hour)))
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = a.CreateEvent(WithUser(ctx, "alice"), newEvent("retro", baseTime.Add(4*time.Hour)))
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// Other users have quotas of their own.
+	_, err = a.CreateEvent(WithUser(ctx, "bob"), newEvent("retro", baseTime))
+	require.NoError(t, err)
+
+	require.NoError(t, a.DeleteEvent(WithUser(ctx, "alice"), standup.ID, standup.Version))
+	_, err = a.CreateEvent(WithUser(ctx, "alice"), newEvent("retro", baseTime.Add(4*time.Hour)))
+	require.NoError(t, err)
+	_, err = a.RestoreEvent(WithUser(ctx, "alice"), standup.ID)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	res, err := a.ImportEvents(WithUser(ctx, "alice"), []storage.Event{newEvent("planning", baseTime.Add(6*time.Hour))})
+	require.NoError(t, err)
+	require.Len(t, res.Failed, 1)
+	require.ErrorIs(t, res.Failed[0].Err, ErrQuotaExceeded)
+}
+
+func TestAppEventQuotaConcurrency(t *testing.T) {
+	ctx := WithUser(context.Background(), "alice")
+	a := New(nopLogger{}, memorystorage.New(), Options{MaxEvents: 3})
+
+	// Concurrent creations of the same user cannot exceed the quota.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var created, exceeded int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := a.CreateEvent(ctx, newEvent("standup", baseTime.Add(time.Duration(i)*time.Hour)))
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, ErrQuotaExceeded) {
+				exceeded++
+				return
+			}
+			require.NoError(t, err)
+			created++
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 3, created)
+	require.Equal(t, 7, exceeded)
+	require.Empty(t, a.quota.users, "locks of idle users are released")
+}
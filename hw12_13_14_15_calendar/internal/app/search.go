@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+const (
+	// DefaultSearchLimit is the page size of searches which do not set one.
+	DefaultSearchLimit = 50
+	// MaxSearchLimit limits the page size of a single search.
+	MaxSearchLimit = 200
+)
+
+// SearchResult is a page of found events.
+type SearchResult struct {
+	Events []storage.Event
+	// NextPageToken continues the search, it is empty on the last page.
+	NextPageToken string
+}
+
+// SearchEvents returns a page of the events the user owns or is invited to
+// which match the query. The page continues the one which returned
+// pageToken, the first page is returned when it is empty. The query must
+// not change between pages, except for the filters.
+func (a *App) SearchEvents(ctx context.Context, q storage.SearchQuery, pageToken string) (SearchResult, error) {
+	userID, err := contextUser(ctx)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	q.UserID = userID
+	if q.Sort == "" {
+		q.Sort = storage.SortByStart
+	}
+	switch {
+	case q.Limit < 0:
+		return SearchResult{}, fmt.Errorf("%w: negative limit", storage.ErrInvalidSearch)
+	case q.Limit == 0:
+		q.Limit = DefaultSearchLimit
+	case q.Limit > MaxSearchLimit:
+		q.Limit = MaxSearchLimit
+	}
+	if pageToken != "" {
+		cursor, err := storage.ParseCursor(pageToken)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		q.After = &cursor
+	}
+
+	page, err := a.storage.Search(ctx, q)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	res := SearchResult{Events: page.Events}
+	if page.Next != nil {
+		res.NextPageToken = page.Next.Token()
+	}
+	return res, nil
+}
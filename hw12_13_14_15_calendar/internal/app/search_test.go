@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppSearchEvents(t *testing.T) {
+	ctx := context.Background()
+	a := New(nopLogger{}, memorystorage.New(), Options{})
+
+	ids := make([]string, 0, MaxSearchLimit+1)
+	for i := 0; i <= MaxSearchLimit; i++ {
+		e, err := a.CreateEvent(WithUser(ctx, "alice"), newEvent("standup", baseTime.Add(time.Duration(i)*time.Hour)))
+		require.NoError(t, err)
+		ids = append(ids, e.ID)
+	}
+	_, err := a.CreateEvent(WithUser(ctx, "bob"), newEvent("standup", baseTime))
+	require.NoError(t, err)
+
+	res, err := a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{Text: "standup"}, "")
+	require.NoError(t, err)
+	require.Len(t, res.Events, DefaultSearchLimit)
+	require.Equal(t, ids[0], res.Events[0].ID)
+	require.NotEmpty(t, res.NextPageToken)
+
+	res, err = a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{Limit: 1000}, res.NextPageToken)
+	require.NoError(t, err)
+	require.Len(t, res.Events, MaxSearchLimit+1-DefaultSearchLimit)
+	require.Equal(t, ids[DefaultSearchLimit], res.Events[0].ID)
+	require.Empty(t, res.NextPageToken)
+
+	_, err = a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{Limit: -1}, "")
+	require.ErrorIs(t, err, storage.ErrInvalidSearch)
+	_, err = a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{}, "garbage")
+	require.ErrorIs(t, err, storage.ErrInvalidPageToken)
+
+	res, err = a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{Limit: 1}, "")
+	require.NoError(t, err)
+	_, err = a.SearchEvents(WithUser(ctx, "alice"), storage.SearchQuery{Sort: storage.SortByTitle}, res.NextPageToken)
+	require.ErrorIs(t, err, storage.ErrInvalidSearch)
+}
@@ -0,0 +1,248 @@
+// Package config fills typed configuration structs from TOML or YAML files
+// and environment variables.
+//
+// Fields are bound to keys with the `config:"name[,required]"` tag. Nested
+// structs form sections, so the field tagged "dsn" inside the section tagged
+// "storage" has the key "storage.dsn" and is overridden by the environment
+// variable <PREFIX>_STORAGE_DSN.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported config format")
+	ErrUnknownKey        = errors.New("unknown key")
+	ErrMissingKey        = errors.New("missing required key")
+	ErrInvalidValue      = errors.New("invalid value")
+)
+
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e KeyError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Key, e.Err)
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+type Errors []KeyError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// Is allows errors.Is(errs, ErrMissingKey) to match any of the collected errors.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the file at path into cfg, which must be a pointer to a struct,
+// then applies environment overrides with the given prefix. Values already
+// set in cfg act as defaults.
+func Load(path, prefix string, cfg interface{}) error {
+	values, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(cfg)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config target must be a pointer to struct, got %T", cfg)
+	}
+
+	l := loader{prefix: prefix, seen: make(map[string]struct{})}
+	l.fill(target.Elem(), "", values)
+	l.checkUnknown("", values)
+
+	if len(l.errs) > 0 {
+		sort.Slice(l.errs, func(i, j int) bool {
+			return l.errs[i].Key < l.errs[j].Key
+		})
+		return l.errs
+	}
+
+	return nil
+}
+
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+type loader struct {
+	prefix string
+	seen   map[string]struct{}
+	errs   Errors
+}
+
+func (l *loader) fill(v reflect.Value, section string, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, required := parseTag(field.Tag.Get("config"))
+		if name == "" || name == "-" {
+			continue
+		}
+		key := joinKey(section, name)
+		l.seen[key] = struct{}{}
+
+		raw, inFile := values[name]
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct && fv.Type() != reflect.TypeOf(time.Time{}) {
+			nested, ok := raw.(map[string]interface{})
+			if inFile && !ok {
+				l.errs = append(l.errs, KeyError{Key: key, Err: fmt.Errorf("%w: expected a section", ErrInvalidValue)})
+				continue
+			}
+			l.fill(fv, key, nested)
+			continue
+		}
+
+		if inFile {
+			if err := setValue(fv, fmt.Sprint(raw)); err != nil {
+				l.errs = append(l.errs, KeyError{Key: key, Err: err})
+				continue
+			}
+		}
+
+		envName := l.envName(key)
+		envValue, inEnv := os.LookupEnv(envName)
+		if inEnv {
+			if err := setValue(fv, envValue); err != nil {
+				l.errs = append(l.errs, KeyError{Key: key, Err: fmt.Errorf("%w (from %s)", err, envName)})
+				continue
+			}
+		}
+
+		if required && fv.IsZero() {
+			l.errs = append(l.errs, KeyError{Key: key, Err: ErrMissingKey})
+		}
+	}
+}
+
+func (l *loader) checkUnknown(section string, values map[string]interface{}) {
+	for name, raw := range values {
+		key := joinKey(section, name)
+		if _, ok := l.seen[key]; !ok {
+			l.errs = append(l.errs, KeyError{Key: key, Err: ErrUnknownKey})
+			continue
+		}
+		if nested, ok := raw.(map[string]interface{}); ok {
+			l.checkUnknown(key, nested)
+		}
+	}
+}
+
+func (l *loader) envName(key string) string {
+	name := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if l.prefix == "" {
+		return name
+	}
+	return l.prefix + "_" + name
+}
+
+func parseTag(tag string) (string, bool) {
+	parts := strings.Split(tag, ",")
+	required := false
+	for _, opt := range parts[1:] {
+		if opt == "required" {
+			required = true
+		}
+	}
+	return parts[0], required
+}
+
+func joinKey(section, name string) string {
+	if section == "" {
+		return name
+	}
+	return section + "." + name
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a duration", ErrInvalidValue, s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a boolean", ErrInvalidValue, s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an integer", ErrInvalidValue, s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%w: %q is not an unsigned integer", ErrInvalidValue, s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a number", ErrInvalidValue, s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("%w: unsupported field type %s", ErrInvalidValue, v.Type())
+	}
+
+	return nil
+}
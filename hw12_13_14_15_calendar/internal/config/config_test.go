@@ -0,0 +1,218 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Name    string        `config:"name,required"`
+	Server  serverSection `config:"server"`
+	Ignored string
+}
+
+type serverSection struct {
+	Host    string        `config:"host"`
+	Port    int           `config:"port,required"`
+	Debug   bool          `config:"debug"`
+	Timeout time.Duration `config:"timeout"`
+	Ratio   float64       `config:"ratio"`
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	prev, ok := os.LookupEnv(key)
+	require.NoError(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	expected := testConfig{
+		Name: "calendar",
+		Server: serverSection{
+			Host:    "localhost",
+			Port:    8080,
+			Debug:   true,
+			Timeout: 5 * time.Second,
+			Ratio:   0.5,
+		},
+	}
+
+	t.Run("toml", func(t *testing.T) {
+		path := writeFile(t, "config.toml", `
+name = "calendar"
+
+[server]
+host = "localhost"
+port = 8080
+debug = true
+timeout = "5s"
+ratio = 0.5
+`)
+		var cfg testConfig
+		require.NoError(t, Load(path, "TEST", &cfg))
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		path := writeFile(t, "config.yaml", `
+name: calendar
+server:
+  host: localhost
+  port: 8080
+  debug: true
+  timeout: 5s
+  ratio: 0.5
+`)
+		var cfg testConfig
+		require.NoError(t, Load(path, "TEST", &cfg))
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("defaults are kept", func(t *testing.T) {
+		path := writeFile(t, "config.toml", `
+name = "calendar"
+[server]
+port = 8080
+`)
+		cfg := testConfig{Server: serverSection{Host: "0.0.0.0", Timeout: time.Second}}
+		require.NoError(t, Load(path, "TEST", &cfg))
+		require.Equal(t, "0.0.0.0", cfg.Server.Host)
+		require.Equal(t, time.Second, cfg.Server.Timeout)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		path := writeFile(t, "config.toml", `
+name = "calendar"
+[server]
+port = 8080
+`)
+		setenv(t, "TEST_NAME", "from-env")
+		setenv(t, "TEST_SERVER_PORT", "9090")
+		setenv(t, "TEST_SERVER_TIMEOUT", "1m")
+
+		var cfg testConfig
+		require.NoError(t, Load(path, "TEST", &cfg))
+		require.Equal(t, "from-env", cfg.Name)
+		require.Equal(t, 9090, cfg.Server.Port)
+		require.Equal(t, time.Minute, cfg.Server.Timeout)
+	})
+
+	t.Run("env satisfies required keys", func(t *testing.T) {
+		path := writeFile(t, "config.toml", `name = "calendar"`)
+		setenv(t, "TEST_SERVER_PORT", "9090")
+
+		var cfg testConfig
+		require.NoError(t, Load(path, "TEST", &cfg))
+		require.Equal(t, 9090, cfg.Server.Port)
+	})
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		env     map[string]string
+		err     error
+		keys    []string
+	}{
+		{
+			name:    "missing required keys",
+			file:    "config.toml",
+			content: `[server]`,
+			err:     ErrMissingKey,
+			keys:    []string{"name", "server.port"},
+		},
+		{
+			name:    "unknown keys",
+			file:    "config.toml",
+			content: "name = \"calendar\"\nverbose = true\n[server]\nport = 1\nhots = \"localhost\"",
+			err:     ErrUnknownKey,
+			keys:    []string{"server.hots", "verbose"},
+		},
+		{
+			name:    "invalid value in file",
+			file:    "config.yaml",
+			content: "name: calendar\nserver:\n  port: eighty\n",
+			err:     ErrInvalidValue,
+			keys:    []string{"server.port"},
+		},
+		{
+			name:    "invalid value in env",
+			file:    "config.yaml",
+			content: "name: calendar\nserver:\n  port: 80\n",
+			env:     map[string]string{"TEST_SERVER_DEBUG": "sure"},
+			err:     ErrInvalidValue,
+			keys:    []string{"server.debug"},
+		},
+		{
+			name:    "scalar instead of section",
+			file:    "config.yaml",
+			content: "name: calendar\nserver: localhost\n",
+			err:     ErrInvalidValue,
+			keys:    []string{"server"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				setenv(t, k, v)
+			}
+			path := writeFile(t, tc.file, tc.content)
+
+			var cfg testConfig
+			err := Load(path, "TEST", &cfg)
+			require.ErrorIs(t, err, tc.err)
+
+			var errs Errors
+			require.True(t, errors.As(err, &errs))
+			keys := make([]string, 0, len(errs))
+			for _, e := range errs {
+				keys = append(keys, e.Key)
+				require.Contains(t, err.Error(), e.Key)
+			}
+			require.Subset(t, keys, tc.keys)
+		})
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		path := writeFile(t, "config.ini", "name=calendar")
+		var cfg testConfig
+		require.ErrorIs(t, Load(path, "TEST", &cfg), ErrUnsupportedFormat)
+	})
+
+	t.Run("file does not exist", func(t *testing.T) {
+		var cfg testConfig
+		err := Load(filepath.Join(t.TempDir(), "missing.toml"), "TEST", &cfg)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("broken syntax", func(t *testing.T) {
+		path := writeFile(t, "config.toml", "name = ")
+		var cfg testConfig
+		require.Error(t, Load(path, "TEST", &cfg))
+	})
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds a readiness probe, so a hanging dependency fails it
+// instead of piling up probes.
+const checkTimeout = 2 * time.Second
+
+const (
+	StatusOK           = "ok"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check returns an error when a dependency of the process can not be used.
+type Check func(ctx context.Context) error
+
+// Version is the build of the running binary.
+type Version struct {
+	Release   string
+	BuildDate string
+	GitHash   string
+}
+
+// Report is the result of a readiness probe. Checks maps the names of
+// the checks to "ok" or the errors they failed with.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Health answers liveness, readiness and version probes.
+type Health struct {
+	version Version
+
+	mu           sync.Mutex
+	checks       []namedCheck
+	shuttingDown bool
+}
+
+func New(version Version) *Health {
+	return &Health{version: version}
+}
+
+// AddCheck makes readiness depend on check.
+func (h *Health) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes the process not ready for good, so load balancers stop
+// sending requests before the servers are stopped.
+func (h *Health) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.shuttingDown = true
+}
+
+func (h *Health) Version() Version {
+	return h.version
+}
+
+// Ready runs the checks one after another.
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.Lock()
+	checks, shuttingDown := h.checks, h.shuttingDown
+	h.mu.Unlock()
+
+	if shuttingDown {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]string, len(checks))}
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			report.Status = StatusUnavailable
+			report.Checks[c.name] = err.Error()
+			continue
+		}
+		report.Checks[c.name] = StatusOK
+	}
+	return report
+}
+
+// LiveHandler answers 200 while the process is able to serve HTTP at all.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadyHandler answers 200 when all checks pass and 503 otherwise.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Ready(r.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// VersionHandler answers with the JSON the version command prints.
+func (h *Health) VersionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, h.version)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
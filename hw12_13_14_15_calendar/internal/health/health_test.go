@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthReady(t *testing.T) {
+	ctx := context.Background()
+	h := New(Version{Release: "v1.0.0"})
+	require.Equal(t, Report{Status: StatusOK, Checks: map[string]string{}}, h.Ready(ctx))
+
+	var storageErr error
+	h.AddCheck("storage", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		require.True(t, ok)
+		return storageErr
+	})
+	h.AddCheck("queue", func(context.Context) error { return nil })
+
+	report := h.Ready(ctx)
+	require.True(t, report.Ready())
+	require.Equal(t, map[string]string{"storage": StatusOK, "queue": StatusOK}, report.Checks)
+
+	storageErr = errors.New("connection refused")
+	report = h.Ready(ctx)
+	require.False(t, report.Ready())
+	require.Equal(t, StatusUnavailable, report.Status)
+	require.Equal(t, map[string]string{"storage": "connection refused", "queue": StatusOK}, report.Checks)
+
+	storageErr = nil
+	h.Shutdown()
+	report = h.Ready(ctx)
+	require.False(t, report.Ready())
+	require.Equal(t, Report{Status: StatusShuttingDown}, report)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	version := Version{Release: "v1.0.0", BuildDate: "2021-06-14", GitHash: "abc123"}
+	h := New(version)
+	var storageErr error
+	h.AddCheck("storage", func(context.Context) error { return storageErr })
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		return rec
+	}
+
+	rec := serve(h.LiveHandler())
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+
+	rec = serve(h.VersionHandler())
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"Release":"v1.0.0","BuildDate":"2021-06-14","GitHash":"abc123"}`, rec.Body.String())
+
+	rec = serve(h.ReadyHandler())
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"status":"ok","checks":{"storage":"ok"}}`, rec.Body.String())
+
+	storageErr = errors.New("connection refused")
+	rec = serve(h.ReadyHandler())
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var report Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Equal(t, Report{Status: StatusUnavailable, Checks: map[string]string{"storage": "connection refused"}}, report)
+
+	h.Shutdown()
+	rec = serve(h.ReadyHandler())
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.JSONEq(t, `{"status":"shutting_down"}`, rec.Body.String())
+
+	// The process is still alive while it drains.
+	require.Equal(t, http.StatusOK, serve(h.LiveHandler()).Code)
+}
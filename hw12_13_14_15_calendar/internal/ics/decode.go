@@ -0,0 +1,382 @@
+package ics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Decoder reads events from VCALENDAR objects.
+type Decoder struct {
+	r     *bufio.Reader
+	lines int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads all VEVENT components until EOF. Events keep their UID as ID,
+// edited occurrences get SeriesID set to the UID and the ID built by
+// storage.OccurrenceID. Other components like VTODO or VTIMEZONE are
+// skipped, times with a TZID are resolved with the time zone database and
+// the TZID of DTSTART becomes the zone of the event.
+//
+// Decode checks the syntax only, events may still fail storage.Event.Validate.
+func (dec *Decoder) Decode() ([]storage.Event, error) {
+	events := make([]storage.Event, 0)
+
+	var (
+		stack   []string
+		current *eventBuilder
+		seen    bool
+	)
+	for {
+		p, n, err := dec.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidCalendar, n, fmt.Sprintf(format, args...))
+		}
+
+		switch p.name {
+		case "BEGIN":
+			component := strings.ToUpper(p.value)
+			if len(stack) == 0 && component != "VCALENDAR" {
+				return nil, fail("expected BEGIN:VCALENDAR, got BEGIN:%s", p.value)
+			}
+			if component == "VEVENT" && len(stack) == 1 {
+				current = &eventBuilder{}
+			}
+			if component == "VALARM" && current != nil && len(stack) == 2 {
+				current.alarms = append(current.alarms, alarm{})
+			}
+			stack = append(stack, component)
+			seen = true
+			continue
+		case "END":
+			component := strings.ToUpper(p.value)
+			if len(stack) == 0 || stack[len(stack)-1] != component {
+				return nil, fail("unexpected END:%s", p.value)
+			}
+			stack = stack[:len(stack)-1]
+			if component == "VEVENT" && len(stack) == 1 {
+				e, err := current.build()
+				if err != nil {
+					return nil, fail("%v", err)
+				}
+				events = append(events, e)
+				current = nil
+			}
+			continue
+		}
+
+		if len(stack) == 0 {
+			return nil, fail("property %s outside of VCALENDAR", p.name)
+		}
+		if current == nil {
+			continue
+		}
+
+		var perr error
+		switch stack[len(stack)-1] {
+		case "VEVENT":
+			perr = current.set(p)
+		case "VALARM":
+			if len(stack) == 3 {
+				perr = current.alarms[len(current.alarms)-1].set(p)
+			}
+		}
+		if perr != nil {
+			return nil, fail("%s: %v", p.name, perr)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%w: missing END:%s", ErrInvalidCalendar, stack[len(stack)-1])
+	}
+	if !seen {
+		return nil, fmt.Errorf("%w: no VCALENDAR found", ErrInvalidCalendar)
+	}
+	return events, nil
+}
+
+// Unmarshal decodes events from iCalendar data.
+func Unmarshal(data []byte) ([]storage.Event, error) {
+	return NewDecoder(bytes.NewReader(data)).Decode()
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// next returns the next unfolded content line and its line number.
+func (dec *Decoder) next() (property, int, error) {
+	for {
+		line, n, err := dec.unfold()
+		if err != nil {
+			return property{}, 0, err
+		}
+		if line == "" {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return property{}, 0, fmt.Errorf("%w: line %d: %v", ErrInvalidCalendar, n, err)
+		}
+		return p, n, nil
+	}
+}
+
+// unfold returns the next line with folded continuation lines joined and
+// the number of its first physical line.
+func (dec *Decoder) unfold() (string, int, error) {
+	line, err := dec.readLine()
+	if err != nil {
+		return "", 0, err
+	}
+	n := dec.lines
+	for {
+		peek, err := dec.r.Peek(1)
+		if err != nil || (peek[0] != ' ' && peek[0] != '\t') {
+			return line, n, nil
+		}
+		cont, err := dec.readLine()
+		if err != nil {
+			return "", 0, err
+		}
+		line += cont[1:]
+	}
+}
+
+func (dec *Decoder) readLine() (string, error) {
+	line, err := dec.r.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	dec.lines++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// parseProperty parses "NAME;PARAM=value;PARAM="quoted":value".
+func parseProperty(line string) (property, error) {
+	p := property{params: make(map[string]string)}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return property{}, fmt.Errorf("malformed content line %q", line)
+	}
+	p.name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return property{}, fmt.Errorf("malformed parameter in %q", line)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		var end int
+		if strings.HasPrefix(rest, `"`) {
+			q := strings.IndexByte(rest[1:], '"')
+			if q < 0 {
+				return property{}, fmt.Errorf("unterminated quote in %q", line)
+			}
+			value = rest[1 : q+1]
+			end = q + 2
+		} else {
+			end = strings.IndexAny(rest, ";:")
+			if end < 0 {
+				return property{}, fmt.Errorf("malformed content line %q", line)
+			}
+			value = rest[:end]
+		}
+		p.params[name] = value
+
+		i = len(line) - len(rest) + end
+		if i >= len(line) {
+			return property{}, fmt.Errorf("malformed content line %q", line)
+		}
+	}
+	p.value = line[i+1:]
+
+	return p, nil
+}
+
+// parseTimes parses the comma separated DATE or DATE-TIME values of the property.
+// isDate reports whether the values are dates without time.
+func parseTimes(p property) (times []time.Time, isDate bool, err error) {
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			return nil, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+
+	for _, v := range strings.Split(p.value, ",") {
+		var t time.Time
+		switch {
+		case strings.EqualFold(p.params["VALUE"], "DATE") || len(v) == len(dateLayout):
+			isDate = true
+			t, err = time.ParseInLocation(dateLayout, v, time.UTC)
+		case strings.HasSuffix(v, "Z"):
+			t, err = time.Parse(dateTimeLayout, v)
+		default:
+			// Floating times without TZID are taken as UTC.
+			t, err = time.ParseInLocation(localTimeLayout, v, loc)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid time %q", v)
+		}
+		times = append(times, t)
+	}
+	return times, isDate, nil
+}
+
+func parseTime(p property) (time.Time, bool, error) {
+	times, isDate, err := parseTimes(p)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(times) != 1 {
+		return time.Time{}, false, fmt.Errorf("expected a single time, got %q", p.value)
+	}
+	return times[0], isDate, nil
+}
+
+type eventBuilder struct {
+	uid          string
+	start, end   time.Time
+	timeZone     string
+	allDay       bool
+	duration     time.Duration
+	hasDuration  bool
+	summary      string
+	description  string
+	rrule        string
+	exdates      []time.Time
+	recurrenceID time.Time
+	alarms       []alarm
+}
+
+func (b *eventBuilder) set(p property) error {
+	var err error
+	switch p.name {
+	case "UID":
+		b.uid = p.value
+	case "DTSTART":
+		b.start, b.allDay, err = parseTime(p)
+		b.timeZone = p.params["TZID"]
+	case "DTEND":
+		b.end, _, err = parseTime(p)
+	case "DURATION":
+		b.duration, err = parseDuration(p.value)
+		b.hasDuration = true
+	case "SUMMARY":
+		b.summary = unescapeText(p.value)
+	case "DESCRIPTION":
+		b.description = unescapeText(p.value)
+	case "RRULE":
+		b.rrule = p.value
+	case "EXDATE":
+		var times []time.Time
+		times, _, err = parseTimes(p)
+		b.exdates = append(b.exdates, times...)
+	case "RECURRENCE-ID":
+		b.recurrenceID, _, err = parseTime(p)
+	}
+	return err
+}
+
+func (b *eventBuilder) build() (storage.Event, error) {
+	if b.uid == "" {
+		return storage.Event{}, errors.New("VEVENT without UID")
+	}
+	if b.start.IsZero() {
+		return storage.Event{}, fmt.Errorf("VEVENT %s without DTSTART", b.uid)
+	}
+
+	e := storage.Event{
+		ID:          b.uid,
+		Title:       b.summary,
+		StartAt:     b.start,
+		EndAt:       b.end,
+		Description: b.description,
+		TimeZone:    b.timeZone,
+		RRule:       b.rrule,
+		ExDates:     b.exdates,
+	}
+	switch {
+	case !e.EndAt.IsZero():
+	case b.hasDuration:
+		e.EndAt = e.StartAt.Add(b.duration)
+	case b.allDay:
+		e.EndAt = e.StartAt.AddDate(0, 0, 1)
+	default:
+		e.EndAt = e.StartAt
+	}
+	if !b.recurrenceID.IsZero() {
+		e.ID = storage.OccurrenceID(b.uid, b.recurrenceID)
+		e.SeriesID = b.uid
+		e.RecurrenceID = b.recurrenceID
+	}
+	for _, a := range b.alarms {
+		if before := a.before(e.Duration()); before > e.NotifyBefore {
+			e.NotifyBefore = before
+		}
+	}
+
+	return e, nil
+}
+
+type alarm struct {
+	trigger    time.Duration
+	relative   bool
+	relatedEnd bool
+}
+
+func (a *alarm) set(p property) error {
+	if p.name != "TRIGGER" || strings.EqualFold(p.params["VALUE"], "DATE-TIME") {
+		// Alarms at absolute times cannot be expressed with NotifyBefore.
+		return nil
+	}
+	d, err := parseDuration(p.value)
+	if err != nil {
+		return err
+	}
+	a.trigger = d
+	a.relative = true
+	a.relatedEnd = strings.EqualFold(p.params["RELATED"], triggerRelatedEnd)
+	return nil
+}
+
+// before returns how long before the start of an event lasting d the alarm
+// goes off, alarms going off after the start give zero.
+func (a alarm) before(d time.Duration) time.Duration {
+	if !a.relative {
+		return 0
+	}
+	offset := a.trigger
+	if a.relatedEnd {
+		offset += d
+	}
+	if offset > 0 {
+		return 0
+	}
+	return -offset
+}
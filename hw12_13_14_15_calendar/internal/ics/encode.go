@@ -0,0 +1,159 @@
+package ics
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Encoder writes events as a VCALENDAR object.
+type Encoder struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, now: time.Now}
+}
+
+// Encode writes a calendar holding the events. Events with a SeriesID are
+// written as edited occurrences of their series, their recurrence IDs are not
+// repeated in the EXDATE of the series. Times of events in a zone other than
+// UTC are written as local times with a TZID naming the IANA zone, no
+// VTIMEZONE components are written for them.
+func (enc *Encoder) Encode(events []storage.Event) error {
+	edited := make(map[string]map[int64]bool)
+	for _, e := range events {
+		if e.SeriesID == "" {
+			continue
+		}
+		if edited[e.SeriesID] == nil {
+			edited[e.SeriesID] = make(map[int64]bool)
+		}
+		edited[e.SeriesID][e.RecurrenceID.UnixNano()] = true
+	}
+
+	w := &lineWriter{w: bufio.NewWriter(enc.w)}
+	stamp := formatTime(enc.now())
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", prodID)
+	w.line("CALSCALE", "GREGORIAN")
+	for _, e := range events {
+		w.line("BEGIN", "VEVENT")
+		tzid, loc := zoneOf(e)
+		if e.SeriesID != "" {
+			w.line("UID", e.SeriesID)
+			w.line("RECURRENCE-ID"+tzid, formatTimeIn(e.RecurrenceID, loc))
+		} else {
+			w.line("UID", e.ID)
+		}
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART"+tzid, formatTimeIn(e.StartAt, loc))
+		w.line("DTEND"+tzid, formatTimeIn(e.EndAt, loc))
+		w.line("SUMMARY", escapeText(e.Title))
+		if e.Description != "" {
+			w.line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.Recurring() {
+			w.line("RRULE", e.RRule)
+			exdates := make([]string, 0, len(e.ExDates))
+			for _, ex := range e.ExDates {
+				if !edited[e.ID][ex.UnixNano()] {
+					exdates = append(exdates, formatTimeIn(ex, loc))
+				}
+			}
+			if len(exdates) > 0 {
+				w.line("EXDATE"+tzid, strings.Join(exdates, ","))
+			}
+		}
+		if e.NotifyBefore > 0 {
+			w.line("BEGIN", "VALARM")
+			w.line("ACTION", "DISPLAY")
+			w.line("DESCRIPTION", alarmDescription)
+			w.line("TRIGGER", formatDuration(-e.NotifyBefore))
+			w.line("END", "VALARM")
+		}
+		w.line("END", "VEVENT")
+	}
+	w.line("END", "VCALENDAR")
+
+	return w.flush()
+}
+
+// Marshal returns the calendar holding the events.
+func Marshal(events []storage.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(events); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
+
+// zoneOf returns the TZID parameter for times of the event and their
+// location, nil for UTC.
+func zoneOf(e storage.Event) (string, *time.Location) {
+	loc := e.Location()
+	if loc == time.UTC {
+		return "", nil
+	}
+	return ";TZID=" + e.TimeZone, loc
+}
+
+// formatTimeIn formats t as a local time in loc or in UTC when loc is nil.
+func formatTimeIn(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return formatTime(t)
+	}
+	return t.In(loc).Format(localTimeLayout)
+}
+
+// lineWriter writes CRLF terminated content lines folded at 75 octets
+// and keeps the first error.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *lineWriter) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+
+	line := name + ":" + value
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.write(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of a continuation line counts too.
+		limit = maxLineOctets - 1
+	}
+	w.write(line + "\r\n")
+}
+
+func (w *lineWriter) write(s string) {
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+func (w *lineWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,225 @@
+package ics
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+var stamp = time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+func utc(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2021, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+// exportEvents are the events stored in testdata/export.ics.
+var exportEvents = []storage.Event{
+	{
+		ID:           "1b4e28ba-2fa1-11d2-883f-0016d3cca427",
+		Title:        "Sprint review",
+		StartAt:      utc(time.June, 14, 10, 0),
+		EndAt:        utc(time.June, 14, 11, 0),
+		Description:  "Demo; then retro, notes:\nhttps://wiki.example.com/sprints/42",
+		NotifyBefore: 15 * time.Minute,
+	},
+	{
+		ID:           "standup",
+		Title:        "Стендап команды календаря",
+		StartAt:      utc(time.June, 14, 7, 0),
+		EndAt:        utc(time.June, 14, 7, 30),
+		Description:  "Каждый рассказывает, что сделал вчера, что планирует сегодня и что мешает работе.",
+		NotifyBefore: 5 * time.Minute,
+		RRule:        "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+		ExDates:      []time.Time{utc(time.June, 16, 7, 0)},
+	},
+	{
+		ID:           storage.OccurrenceID("standup", utc(time.June, 17, 7, 0)),
+		Title:        "Стендап с заказчиком",
+		StartAt:      utc(time.June, 17, 8, 0),
+		EndAt:        utc(time.June, 17, 9, 0),
+		NotifyBefore: 26 * time.Hour,
+		SeriesID:     "standup",
+		RecurrenceID: utc(time.June, 17, 7, 0),
+	},
+	{
+		ID:       "planning",
+		Title:    "Planning with the New York office",
+		StartAt:  utc(time.June, 15, 13, 0),
+		EndAt:    utc(time.June, 15, 14, 0),
+		TimeZone: "America/New_York",
+		RRule:    "FREQ=WEEKLY;COUNT=4",
+		ExDates:  []time.Time{utc(time.June, 22, 13, 0)},
+	},
+}
+
+func encode(t *testing.T, events []storage.Event) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.now = func() time.Time { return stamp }
+	require.NoError(t, enc.Encode(events))
+	return buf.Bytes()
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return data
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	fixture := readFixture(t, "export.ics")
+
+	require.Equal(t, string(fixture), string(encode(t, exportEvents)))
+
+	events, err := Unmarshal(fixture)
+	require.NoError(t, err)
+	for i := range events {
+		events[i] = events[i].UTC()
+	}
+	require.Equal(t, exportEvents, events)
+
+	require.Equal(t, string(fixture), string(encode(t, events)))
+}
+
+func TestExportEditedOccurrence(t *testing.T) {
+	series := exportEvents[1]
+	series.ExDates = append([]time.Time{exportEvents[2].RecurrenceID}, series.ExDates...)
+
+	data := encode(t, []storage.Event{series, exportEvents[2]})
+	require.Contains(t, string(data), "EXDATE:20210616T070000Z\r\n")
+	require.NotContains(t, string(data), "20210617T070000Z,")
+}
+
+func TestImportFixture(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	local := func(day, hour, minute int) time.Time {
+		return time.Date(2021, time.June, day, hour, minute, 0, 0, berlin)
+	}
+
+	events, err := Unmarshal(readFixture(t, "import.ics"))
+	require.NoError(t, err)
+
+	require.Equal(t, []storage.Event{
+		{
+			ID:           "weekly-sync@google.com",
+			Title:        "Weekly sync",
+			StartAt:      local(14, 9, 30),
+			EndAt:        local(14, 9, 45),
+			Description:  "Agenda: https://docs.example.com/document/d/1a2b3c4d5e6f7g8h9i0j/edit, notes go\nto the doc.",
+			NotifyBefore: 24 * time.Hour,
+			TimeZone:     "Europe/Berlin",
+			RRule:        "FREQ=WEEKLY;WKST=MO;BYDAY=MO,WE",
+			ExDates:      []time.Time{local(16, 9, 30), local(21, 9, 30), local(23, 9, 30)},
+		},
+		{
+			ID:           storage.OccurrenceID("weekly-sync@google.com", local(30, 9, 30)),
+			Title:        "Weekly sync (moved)",
+			StartAt:      local(30, 14, 0),
+			EndAt:        local(30, 15, 0),
+			TimeZone:     "Europe/Berlin",
+			SeriesID:     "weekly-sync@google.com",
+			RecurrenceID: local(30, 9, 30),
+		},
+		{
+			ID:      "vacation@google.com",
+			Title:   "Vacation",
+			StartAt: utc(time.July, 5, 0, 0),
+			EndAt:   utc(time.July, 10, 0, 0),
+		},
+		{
+			ID:           "lunch@google.com",
+			Title:        `Lunch with "the team"`,
+			StartAt:      utc(time.July, 1, 12, 0),
+			EndAt:        utc(time.July, 1, 12, 45),
+			NotifyBefore: 15 * time.Minute,
+		},
+	}, events)
+
+	for _, e := range events {
+		e.UserID = "user"
+		require.NoError(t, e.Validate(), e.ID)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	event := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	}
+
+	tests := map[string]string{
+		"empty":              "",
+		"not a calendar":     "BEGIN:VCARD\r\nEND:VCARD\r\n",
+		"unterminated":       "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n",
+		"mismatched end":     "BEGIN:VCALENDAR\r\nEND:VEVENT\r\n",
+		"property outside":   "SUMMARY:a\r\n",
+		"malformed line":     event("UID:a", "DTSTART:20210614T100000Z", "garbage"),
+		"unterminated quote": event("UID:a", `DTSTART;TZID="Europe/Berlin:20210614T100000`),
+		"missing uid":        event("DTSTART:20210614T100000Z"),
+		"missing start":      event("UID:a"),
+		"bad time":           event("UID:a", "DTSTART:2021-06-14T10:00:00Z"),
+		"unknown zone":       event("UID:a", "DTSTART;TZID=Mars/Olympus:20210614T100000"),
+		"bad duration":       event("UID:a", "DTSTART:20210614T100000Z", "DURATION:1h"),
+		"bad trigger":        event("UID:a", "DTSTART:20210614T100000Z", "BEGIN:VALARM", "TRIGGER:soon", "END:VALARM"),
+	}
+	for name, data := range tests {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			_, err := Unmarshal([]byte(data))
+			require.True(t, errors.Is(err, ErrInvalidCalendar), "got %v", err)
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		text string
+	}{
+		{0, "PT0S"},
+		{-15 * time.Minute, "-PT15M"},
+		{90 * time.Second, "PT1M30S"},
+		{24 * time.Hour, "P1D"},
+		{-(26*time.Hour + 5*time.Second), "-P1DT2H5S"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.text, formatDuration(tc.d))
+		d, err := parseDuration(tc.text)
+		require.NoError(t, err)
+		require.Equal(t, tc.d, d)
+	}
+
+	d, err := parseDuration("-P2W")
+	require.NoError(t, err)
+	require.Equal(t, -14*24*time.Hour, d)
+
+	for _, s := range []string{"", "P", "PT", "15M", "P1H", "PT1D"} {
+		_, err := parseDuration(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestFolding(t *testing.T) {
+	long := strings.Repeat("длинное описание ", 20)
+	data := encode(t, []storage.Event{{
+		ID: "a", Title: "a", StartAt: stamp, EndAt: stamp.Add(time.Hour), Description: long,
+	}})
+
+	for _, line := range strings.Split(string(data), "\r\n") {
+		require.LessOrEqual(t, len(line), maxLineOctets)
+	}
+	events, err := Unmarshal(data)
+	require.NoError(t, err)
+	require.Equal(t, long, events[0].Description)
+}
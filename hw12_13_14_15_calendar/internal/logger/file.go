@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"os"
+	"sync"
+)
+
+// File is a log file which can be reopened by path, e.g. on SIGHUP after
+// logrotate has moved it away.
+type File struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func OpenFile(path string) (*File, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, f: f}, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.f.Write(p)
+}
+
+func (f *File) Reopen() error {
+	next, err := openFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev := f.f
+	f.f = next
+	return prev.Close()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.f.Close()
+}
+
+func openFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
@@ -1,20 +1,220 @@
 package logger
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
-type Logger struct { // TODO
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+var (
+	ErrUnknownLevel  = errors.New("unknown log level")
+	ErrUnknownFormat = errors.New("unknown log format")
+)
+
+// badKey is used for a trailing value which has no pair.
+const badKey = "!BADKEY"
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownLevel, s)
+	}
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatText, FormatJSON:
+		return f, nil
+	case "":
+		return FormatText, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+}
+
+// Logger writes leveled messages with key-value fields. Fields are passed
+// as alternating keys and values: logg.Info("event created", "id", id).
+type Logger struct {
+	level  Level
+	format Format
+	out    io.Writer
+	mu     *sync.Mutex
+	fields []interface{}
+	now    func() time.Time
+}
+
+func New(level Level, format Format, out io.Writer) *Logger {
+	return &Logger{
+		level:  level,
+		format: format,
+		out:    out,
+		mu:     &sync.Mutex{},
+		now:    time.Now,
+	}
+}
+
+// With returns a logger which adds the given fields to every message.
+func (l *Logger) With(args ...interface{}) *Logger {
+	child := *l
+	child.fields = make([]interface{}, 0, len(l.fields)+len(args))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, args...)
+	return &child
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
 }
 
-func New(level string) *Logger {
-	return &Logger{}
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.log(LevelDebug, msg, args)
 }
 
-func (l Logger) Info(msg string) {
-	fmt.Println(msg)
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.log(LevelInfo, msg, args)
 }
 
-func (l Logger) Error(msg string) {
-	// TODO
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.log(LevelWarn, msg, args)
 }
 
-// TODO
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.log(LevelError, msg, args)
+}
+
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := args
+	if len(l.fields) > 0 {
+		fields = make([]interface{}, 0, len(l.fields)+len(args))
+		fields = append(fields, l.fields...)
+		fields = append(fields, args...)
+	}
+
+	var buf bytes.Buffer
+	ts := l.now().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	if l.format == FormatJSON {
+		encodeJSON(&buf, ts, level, msg, fields)
+	} else {
+		encodeText(&buf, ts, level, msg, fields)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.out.Write(buf.Bytes())
+}
+
+func encodeText(buf *bytes.Buffer, ts string, level Level, msg string, fields []interface{}) {
+	buf.WriteString(ts)
+	buf.WriteByte(' ')
+	buf.WriteString(level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+
+	eachField(fields, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	})
+	buf.WriteByte('\n')
+}
+
+func encodeJSON(buf *bytes.Buffer, ts string, level Level, msg string, fields []interface{}) {
+	writeKV := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.WriteByte(',')
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteString(`{"time":`)
+	buf.WriteString(strconv.Quote(ts))
+	writeKV("level", level.String())
+	writeKV("msg", msg)
+	eachField(fields, writeKV)
+	buf.WriteString("}\n")
+}
+
+// eachField walks key-value pairs converting values which serialize poorly
+// (errors, durations, stringers) to strings.
+func eachField(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fn(badKey, normalize(fields[i]))
+			return
+		}
+		fn(fmt.Sprint(fields[i]), normalize(fields[i+1]))
+	}
+}
+
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -1,7 +1,231 @@
 package logger
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var fixedTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newTestLogger(level Level, format Format) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := New(level, format, buf)
+	l.now = func() time.Time { return fixedTime }
+	return l, buf
+}
 
 func TestLogger(t *testing.T) {
-	// TODO
+	t.Run("level filtering", func(t *testing.T) {
+		l, buf := newTestLogger(LevelWarn, FormatText)
+
+		l.Debug("debug")
+		l.Info("info")
+		l.Warn("warn")
+		l.Error("error")
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Equal(t, []string{
+			"2021-06-14T10:00:00.000Z WARN warn",
+			"2021-06-14T10:00:00.000Z ERROR error",
+		}, lines)
+	})
+
+	t.Run("text fields", func(t *testing.T) {
+		l, buf := newTestLogger(LevelDebug, FormatText)
+
+		l.Info("event created", "id", 42, "title", "daily standup", "err", errors.New("boom"), "took", time.Second)
+
+		require.Equal(t,
+			`2021-06-14T10:00:00.000Z INFO event created id=42 title="daily standup" err=boom took=1s`+"\n",
+			buf.String())
+	})
+
+	t.Run("json fields", func(t *testing.T) {
+		l, buf := newTestLogger(LevelDebug, FormatJSON)
+
+		l.Debug("event created", "id", "abc", "count", 3, "err", errors.New("boom"), "dangling")
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		require.Equal(t, map[string]interface{}{
+			"time":    "2021-06-14T10:00:00.000Z",
+			"level":   "DEBUG",
+			"msg":     "event created",
+			"id":      "abc",
+			"count":   float64(3),
+			"err":     "boom",
+			"!BADKEY": "dangling",
+		}, record)
+	})
+
+	t.Run("with", func(t *testing.T) {
+		l, buf := newTestLogger(LevelInfo, FormatText)
+
+		child := l.With("component", "http")
+		child.Info("started", "addr", ":8080")
+		l.Info("plain")
+
+		require.Equal(t,
+			"2021-06-14T10:00:00.000Z INFO started component=http addr=:8080\n"+
+				"2021-06-14T10:00:00.000Z INFO plain\n",
+			buf.String())
+	})
+
+	t.Run("concurrent writes are not interleaved", func(t *testing.T) {
+		l, buf := newTestLogger(LevelInfo, FormatJSON)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				l.With("worker", i).Info("message", "payload", strings.Repeat("x", 512))
+			}(i)
+		}
+		wg.Wait()
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 20)
+		for _, line := range lines {
+			require.True(t, json.Valid([]byte(line)), line)
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	for s, expected := range map[string]Level{
+		"debug": LevelDebug, "INFO": LevelInfo, "": LevelInfo, "Warning": LevelWarn, "error": LevelError,
+	} {
+		level, err := ParseLevel(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, level)
+	}
+	_, err := ParseLevel("trace")
+	require.ErrorIs(t, err, ErrUnknownLevel)
+
+	format, err := ParseFormat("JSON")
+	require.NoError(t, err)
+	require.Equal(t, FormatJSON, format)
+	_, err = ParseFormat("xml")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "calendar.log")
+	rotated := filepath.Join(dir, "calendar.log.1")
+
+	f, err := OpenFile(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	l := New(LevelInfo, FormatText, f)
+	l.Info("before rotation")
+
+	// logrotate moves the file away and then signals the process.
+	require.NoError(t, os.Rename(path, rotated))
+	l.Info("still old file")
+	require.NoError(t, f.Reopen())
+	l.Info("after rotation")
+
+	old, err := os.ReadFile(rotated)
+	require.NoError(t, err)
+	require.Contains(t, string(old), "before rotation")
+	require.Contains(t, string(old), "still old file")
+	require.NotContains(t, string(old), "after rotation")
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(current), "after rotation")
+	require.NotContains(t, string(current), "before rotation")
+}
+
+func TestOpen(t *testing.T) {
+	l, f, err := Open(Options{Level: "info", Format: "text"})
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	require.Nil(t, f, "stderr is not a file to reopen")
+
+	path := filepath.Join(t.TempDir(), "calendar.log")
+	l, f, err = Open(Options{Level: "warn", Format: "json", File: path})
+	require.NoError(t, err)
+	defer f.Close()
+	l.Info("filtered")
+	l.Warn("written")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"msg":"written"`)
+	require.NotContains(t, string(data), "filtered")
+
+	_, _, err = Open(Options{Level: "trace"})
+	require.ErrorIs(t, err, ErrUnknownLevel)
+	_, _, err = Open(Options{Format: "xml"})
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestReopenOnSIGHUP(t *testing.T) {
+	hup := func() {
+		t.Helper()
+		p, err := os.FindProcess(os.Getpid())
+		require.NoError(t, err)
+		require.NoError(t, p.Signal(syscall.SIGHUP))
+	}
+
+	t.Run("reopens the file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "calendar.log")
+		l, f, err := Open(Options{File: path})
+		require.NoError(t, err)
+		defer f.Close()
+		stop := ReopenOnSIGHUP(f, l)
+		defer stop()
+
+		require.NoError(t, os.Rename(path, filepath.Join(dir, "calendar.log.1")))
+		hup()
+		require.Eventually(t, func() bool {
+			data, err := os.ReadFile(path)
+			return err == nil && strings.Contains(string(data), "log file reopened")
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("ignored without a file", func(t *testing.T) {
+		buf := &syncBuffer{}
+		l := New(LevelInfo, FormatText, buf)
+		stop := ReopenOnSIGHUP(nil, l)
+		defer stop()
+
+		// The test process would die of the default action if the signal
+		// were not caught.
+		hup()
+		require.Eventually(t, func() bool {
+			return strings.Contains(buf.String(), "SIGHUP ignored")
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
 }
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Options are the logger settings of the commands.
+type Options struct {
+	Level  string
+	Format string
+	// File is a path to the log file, logs go to stderr when it is empty.
+	File string
+}
+
+// Open builds a logger writing to stderr or to the file of opts. The
+// returned file is nil when logging to stderr.
+func Open(opts Options) (*Logger, *File, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	format, err := ParseFormat(opts.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.Writer = os.Stderr
+	var file *File
+	if opts.File != "" {
+		file, err = OpenFile(opts.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = file
+	}
+
+	return New(level, format, out), file, nil
+}
+
+// ReopenOnSIGHUP reopens the log file every time the process gets SIGHUP,
+// which is what logrotate sends after moving the file away. With a nil file
+// SIGHUP is ignored rather than killing the process. The returned function
+// stops it.
+func ReopenOnSIGHUP(file *File, logg *Logger) func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if file == nil {
+				logg.Info("SIGHUP ignored, there is no log file to reopen")
+				continue
+			}
+			if err := file.Reopen(); err != nil {
+				logg.Error("failed to reopen log file", "error", err)
+				continue
+			}
+			logg.Info("log file reopened")
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		close(hup)
+	}
+}
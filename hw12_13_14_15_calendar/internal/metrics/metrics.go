@@ -0,0 +1,164 @@
+// Package metrics collects Prometheus metrics of the calendar services and
+// exposes them for scraping.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "calendar"
+
+// Metrics holds the metrics of a process. Every process has its own
+// registry, so tests may create as many as they need.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	grpcRequests    *prometheus.CounterVec
+	grpcDuration    *prometheus.HistogramVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	notificationLag prometheus.Histogram
+	publishFailures prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "requests_total",
+			Help:      "gRPC calls by full method name and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of gRPC calls by full method name, streams last until they end.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of storage operations, failed ones included.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "errors_total",
+			Help:      "Failed storage operations by error type, e.g. not_found or date_busy.",
+		}, []string{"operation", "error"}),
+		notificationLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "scheduler",
+			Name:      "notification_lag_seconds",
+			Help:      "Time from when a notification was due to when it was published.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+		}),
+		publishFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "queue",
+			Name:      "publish_failures_total",
+			Help:      "Messages the queue did not take.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration,
+		m.grpcRequests, m.grpcDuration,
+		m.storageDuration, m.storageErrors,
+		m.notificationLag, m.publishFailures,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTPRequest records a served request. Route is the template of
+// the matched route, e.g. /events/{id}, so IDs do not make new series.
+func (m *Metrics) ObserveHTTPRequest(route, method string, status int, d time.Duration) {
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// ObserveGRPCCall records a finished call, code is the name of its status code.
+func (m *Metrics) ObserveGRPCCall(method, code string, d time.Duration) {
+	m.grpcRequests.WithLabelValues(method, code).Inc()
+	m.grpcDuration.WithLabelValues(method).Observe(d.Seconds())
+}
+
+// ObserveNotificationLag records how late a notification was published.
+func (m *Metrics) ObserveNotificationLag(d time.Duration) {
+	m.notificationLag.Observe(d.Seconds())
+}
+
+func (m *Metrics) observeStorage(operation string, start time.Time, err error) {
+	m.storageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(operation, errorType(err)).Inc()
+	}
+}
+
+// errorType names the business error of a failed operation, other errors
+// are internal.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, storage.ErrEventNotFound):
+		return "not_found"
+	case errors.Is(err, storage.ErrUserNotFound):
+		return "user_not_found"
+	case errors.Is(err, storage.ErrAttendeeNotFound):
+		return "attendee_not_found"
+	case errors.Is(err, storage.ErrDateBusy):
+		return "date_busy"
+	case errors.Is(err, storage.ErrEventExists):
+		return "exists"
+	case errors.Is(err, storage.ErrVersionConflict):
+		return "version_conflict"
+	case errors.Is(err, storage.ErrNotDeleted):
+		return "not_deleted"
+	case errors.Is(err, storage.ErrInvalidEvent):
+		return "invalid_event"
+	case errors.Is(err, storage.ErrInvalidUser):
+		return "invalid_user"
+	case errors.Is(err, storage.ErrInvalidSearch):
+		return "invalid_search"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+// scrape returns the metrics as Prometheus would read them.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	ts := httptest.NewServer(m.Handler())
+	defer ts.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, queue.Message) error {
+	return errors.New("queue is down")
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	s := m.Storage(memorystorage.New())
+	e := storage.Event{ID: "1", Title: "standup", StartAt: baseTime, EndAt: baseTime.Add(time.Hour), UserID: "alice"}
+	require.NoError(t, s.Create(ctx, e))
+	busy := e
+	busy.ID = "2"
+	require.ErrorIs(t, s.Create(ctx, busy), storage.ErrDateBusy)
+	_, err := s.Get(ctx, "alice", "missing")
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.Get(ctx, e.UserID, e.ID)
+	require.NoError(t, err)
+
+	require.Error(t, m.Publisher(failingPublisher{}).Publish(ctx, queue.Message{}))
+	require.NoError(t, m.Publisher(memoryqueue.New()).Publish(ctx, queue.Message{}))
+
+	m.ObserveNotificationLag(90 * time.Second)
+	m.ObserveHTTPRequest("/events/{id}", http.MethodGet, http.StatusNotFound, 20*time.Millisecond)
+	m.ObserveGRPCCall("/event.EventService/Create", "OK", time.Millisecond)
+
+	body := scrape(t, m)
+	for _, line := range []string{
+		`calendar_storage_operation_duration_seconds_count{operation="create"} 2`,
+		`calendar_storage_operation_duration_seconds_count{operation="get"} 2`,
+		`calendar_storage_errors_total{error="date_busy",operation="create"} 1`,
+		`calendar_storage_errors_total{error="not_found",operation="get"} 1`,
+		`calendar_queue_publish_failures_total 1`,
+		`calendar_scheduler_notification_lag_seconds_bucket{le="60"} 0`,
+		`calendar_scheduler_notification_lag_seconds_bucket{le="120"} 1`,
+		`calendar_http_requests_total{code="404",method="GET",route="/events/{id}"} 1`,
+		`calendar_http_request_duration_seconds_count{method="GET",route="/events/{id}"} 1`,
+		`calendar_grpc_requests_total{code="OK",method="/event.EventService/Create"} 1`,
+		`calendar_grpc_request_duration_seconds_count{method="/event.EventService/Create"} 1`,
+		`go_goroutines`,
+	} {
+		require.Contains(t, body, line)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("lock: %w", context.Canceled), "canceled"},
+		{context.DeadlineExceeded, "deadline_exceeded"},
+		{storage.ErrEventNotFound, "not_found"},
+		{storage.ErrUserNotFound, "user_not_found"},
+		{storage.ErrAttendeeNotFound, "attendee_not_found"},
+		{fmt.Errorf("%w: overlaps standup", storage.ErrDateBusy), "date_busy"},
+		{storage.ErrEventExists, "exists"},
+		{storage.ErrVersionConflict, "version_conflict"},
+		{storage.ErrNotDeleted, "not_deleted"},
+		{storage.ErrEmptyTitle, "invalid_event"},
+		{storage.ErrEmptyUserSettingsID, "invalid_user"},
+		{storage.ErrInvalidPageToken, "invalid_search"},
+		{errors.New("connection refused"), "internal"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, errorType(tc.err), tc.err.Error())
+	}
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+)
+
+// Publisher counts the messages the wrapped publisher fails to publish.
+type Publisher struct {
+	publisher queue.Publisher
+	metrics   *Metrics
+}
+
+func (m *Metrics) Publisher(p queue.Publisher) *Publisher {
+	return &Publisher{publisher: p, metrics: m}
+}
+
+func (p *Publisher) Publish(ctx context.Context, msg queue.Message) error {
+	err := p.publisher.Publish(ctx, msg)
+	if err != nil {
+		p.metrics.publishFailures.Inc()
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// Storage records the latency and the errors of every operation of the
+// wrapped storage.
+type Storage struct {
+	storage storage.Storage
+	metrics *Metrics
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func (m *Metrics) Storage(s storage.Storage) *Storage {
+	return &Storage{storage: s, metrics: m}
+}
+
+func (s *Storage) observe(operation string, start time.Time, err *error) {
+	s.metrics.observeStorage(operation, start, *err)
+}
+
+func (s *Storage) Create(ctx context.Context, e storage.Event) (err error) {
+	defer s.observe("create", time.Now(), &err)
+	return s.storage.Create(ctx, e)
+}
+
+func (s *Storage) Update(ctx context.Context, id string, e storage.Event, version int64) (err error) {
+	defer s.observe("update", time.Now(), &err)
+	return s.storage.Update(ctx, id, e, version)
+}
+
+func (s *Storage) Delete(ctx context.Context, userID, id string, version int64) (err error) {
+	defer s.observe("delete", time.Now(), &err)
+	return s.storage.Delete(ctx, userID, id, version)
+}
+
+func (s *Storage) Get(ctx context.Context, userID, id string) (_ storage.Event, err error) {
+	defer s.observe("get", time.Now(), &err)
+	return s.storage.Get(ctx, userID, id)
+}
+
+func (s *Storage) GetDeleted(ctx context.Context, id string) (_ storage.Event, err error) {
+	defer s.observe("get_deleted", time.Now(), &err)
+	return s.storage.GetDeleted(ctx, id)
+}
+
+func (s *Storage) Restore(ctx context.Context, id string) (err error) {
+	defer s.observe("restore", time.Now(), &err)
+	return s.storage.Restore(ctx, id)
+}
+
+func (s *Storage) History(ctx context.Context, id string) (_ []storage.Revision, err error) {
+	defer s.observe("history", time.Now(), &err)
+	return s.storage.History(ctx, id)
+}
+
+func (s *Storage) ListDay(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_day", time.Now(), &err)
+	return s.storage.ListDay(ctx, userID, date)
+}
+
+func (s *Storage) ListWeek(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_week", time.Now(), &err)
+	return s.storage.ListWeek(ctx, userID, date)
+}
+
+func (s *Storage) ListMonth(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_month", time.Now(), &err)
+	return s.storage.ListMonth(ctx, userID, date)
+}
+
+func (s *Storage) CountEvents(ctx context.Context, userID string) (_ int, err error) {
+	defer s.observe("count_events", time.Now(), &err)
+	return s.storage.CountEvents(ctx, userID)
+}
+
+func (s *Storage) ListByUser(ctx context.Context, userID string) (_ []storage.Event, err error) {
+	defer s.observe("list_by_user", time.Now(), &err)
+	return s.storage.ListByUser(ctx, userID)
+}
+
+func (s *Storage) ListUserRange(ctx context.Context, userID string, from, to time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_user_range", time.Now(), &err)
+	return s.storage.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListVisibleRange(ctx context.Context, userID string, from, to time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_visible_range", time.Now(), &err)
+	return s.storage.ListVisibleRange(ctx, userID, from, to)
+}
+
+func (s *Storage) Search(ctx context.Context, q storage.SearchQuery) (_ storage.SearchPage, err error) {
+	defer s.observe("search", time.Now(), &err)
+	return s.storage.Search(ctx, q)
+}
+
+func (s *Storage) UpdateOccurrence(
+	ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+) (err error) {
+	defer s.observe("update_occurrence", time.Now(), &err)
+	return s.storage.UpdateOccurrence(ctx, seriesID, recurrenceID, e)
+}
+
+func (s *Storage) CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) (err error) {
+	defer s.observe("cancel_occurrence", time.Now(), &err)
+	return s.storage.CancelOccurrence(ctx, seriesID, recurrenceID)
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, id, userID string, status storage.AttendeeStatus) (err error) {
+	defer s.observe("set_attendee_status", time.Now(), &err)
+	return s.storage.SetAttendeeStatus(ctx, id, userID, status)
+}
+
+func (s *Storage) ListToNotify(ctx context.Context, now time.Time) (_ []storage.Event, err error) {
+	defer s.observe("list_to_notify", time.Now(), &err)
+	return s.storage.ListToNotify(ctx, now)
+}
+
+func (s *Storage) MarkNotified(ctx context.Context, id string, until time.Time) (err error) {
+	defer s.observe("mark_notified", time.Now(), &err)
+	return s.storage.MarkNotified(ctx, id, until)
+}
+
+func (s *Storage) DeleteEndedBefore(ctx context.Context, t time.Time) (_ int64, err error) {
+	defer s.observe("delete_ended_before", time.Now(), &err)
+	return s.storage.DeleteEndedBefore(ctx, t)
+}
+
+func (s *Storage) GetUser(ctx context.Context, id string) (_ storage.User, err error) {
+	defer s.observe("get_user", time.Now(), &err)
+	return s.storage.GetUser(ctx, id)
+}
+
+func (s *Storage) SaveUser(ctx context.Context, u storage.User) (err error) {
+	defer s.observe("save_user", time.Now(), &err)
+	return s.storage.SaveUser(ctx, u)
+}
@@ -0,0 +1,157 @@
+package amqpqueue
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Options tune reconnection and consumption, zero values are replaced by defaults.
+type Options struct {
+	// ReconnectMin is the delay before the first reconnection attempt,
+	// it doubles after every failed attempt up to ReconnectMax.
+	ReconnectMin time.Duration
+	ReconnectMax time.Duration
+	// Prefetch limits the number of unacknowledged deliveries per consumer.
+	Prefetch int
+	// RedeliveryMin is the delay before a message rejected by the handler
+	// is returned to the queue, it doubles with every consecutive rejection
+	// up to RedeliveryMax.
+	RedeliveryMin time.Duration
+	RedeliveryMax time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.ReconnectMin <= 0 {
+		o.ReconnectMin = 100 * time.Millisecond
+	}
+	if o.ReconnectMax < o.ReconnectMin {
+		o.ReconnectMax = 30 * time.Second
+		if o.ReconnectMax < o.ReconnectMin {
+			o.ReconnectMax = o.ReconnectMin
+		}
+	}
+	if o.Prefetch <= 0 {
+		o.Prefetch = 1
+	}
+	if o.RedeliveryMin <= 0 {
+		o.RedeliveryMin = time.Second
+	}
+	if o.RedeliveryMax < o.RedeliveryMin {
+		o.RedeliveryMax = time.Minute
+		if o.RedeliveryMax < o.RedeliveryMin {
+			o.RedeliveryMax = o.RedeliveryMin
+		}
+	}
+	return o
+}
+
+const heartbeat = 10 * time.Second
+
+type connector struct {
+	logger  Logger
+	url     string
+	queue   string
+	opts    Options
+	backoff queue.Backoff
+}
+
+func newConnector(logger Logger, url, queueName string, opts Options) connector {
+	opts = opts.withDefaults()
+	return connector{
+		logger:  logger,
+		url:     url,
+		queue:   queueName,
+		opts:    opts,
+		backoff: queue.Backoff{Min: opts.ReconnectMin, Max: opts.ReconnectMax},
+	}
+}
+
+// dial connects to the broker, opens a channel and declares the queue.
+func (c *connector) dial(ctx context.Context) (*amqp.Connection, *amqp.Channel, error) {
+	var dialer net.Dialer
+	conn, err := amqp.DialConfig(c.url, amqp.Config{
+		Heartbeat: heartbeat,
+		Locale:    "en_US",
+		Dial: func(network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("open channel: %w", err)
+	}
+	if _, err := declare(ch, c.queue); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("declare queue %q: %w", c.queue, err)
+	}
+
+	return conn, ch, nil
+}
+
+// wait sleeps before the next reconnection attempt.
+func (c *connector) wait(ctx context.Context, cause error) error {
+	d := c.backoff.Next()
+	c.logger.Warn("amqp connection failed, reconnecting", "queue", c.queue, "error", cause, "delay", d.String())
+	return sleep(ctx, d)
+}
+
+// declare makes sure the durable queue exists, publishers and consumers
+// both declare it so they can be started in any order.
+func declare(ch *amqp.Channel, name string) (amqp.Queue, error) {
+	return ch.QueueDeclare(name, true, false, false, false, nil)
+}
+
+func toTable(headers map[string]string) amqp.Table {
+	if len(headers) == 0 {
+		return nil
+	}
+	table := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		table[k] = v
+	}
+	return table
+}
+
+func fromTable(table amqp.Table) map[string]string {
+	if len(table) == 0 {
+		return nil
+	}
+	headers := make(map[string]string, len(table))
+	for k, v := range table {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+			continue
+		}
+		headers[k] = fmt.Sprint(v)
+	}
+	return headers
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
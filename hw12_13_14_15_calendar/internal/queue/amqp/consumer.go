@@ -0,0 +1,87 @@
+package amqpqueue
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+)
+
+var _ queue.Consumer = (*Consumer)(nil)
+
+var errDeliveriesClosed = errors.New("delivery channel closed")
+
+// Consumer reads a durable queue with manual acknowledgements and
+// reconnects with backoff when the connection breaks. A message rejected
+// by the handler is held for a growing delay before it is returned to the
+// queue, so a failing handler does not spin on it.
+type Consumer struct {
+	connector
+	redelivery queue.Backoff
+}
+
+func NewConsumer(logger Logger, url, queueName string, opts Options) *Consumer {
+	c := &Consumer{connector: newConnector(logger, url, queueName, opts)}
+	c.redelivery = queue.Backoff{Min: c.opts.RedeliveryMin, Max: c.opts.RedeliveryMax}
+	return c
+}
+
+func (c *Consumer) Consume(ctx context.Context, handler queue.Handler) error {
+	for {
+		err := c.consume(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := c.wait(ctx, err); err != nil {
+			return nil
+		}
+	}
+}
+
+func (c *Consumer) consume(ctx context.Context, handler queue.Handler) error {
+	conn, ch, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := ch.Qos(c.opts.Prefetch, 0, false); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(c.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	c.backoff.Reset()
+	c.logger.Info("amqp consumer started", "queue", c.queue)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return errDeliveriesClosed
+			}
+
+			msg := queue.Message{Body: d.Body, Headers: fromTable(d.Headers)}
+			if err := handler(ctx, msg); err != nil {
+				// The delivery stays unacknowledged while waiting, it goes
+				// back to the queue with the connection if ctx is done.
+				delay := c.redelivery.Next()
+				c.logger.Warn("message rejected, redelivering", "queue", c.queue, "error", err, "delay", delay.String())
+				if err := sleep(ctx, delay); err != nil {
+					return err
+				}
+				if err := d.Nack(false, true); err != nil {
+					return err
+				}
+				continue
+			}
+			c.redelivery.Reset()
+			if err := d.Ack(false); err != nil {
+				return err
+			}
+		}
+	}
+}
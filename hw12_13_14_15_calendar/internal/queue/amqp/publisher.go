@@ -0,0 +1,138 @@
+package amqpqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var _ queue.Publisher = (*Publisher)(nil)
+
+var (
+	ErrNacked      = errors.New("message is rejected by the broker")
+	errConfirmLost = errors.New("channel closed before the publish was confirmed")
+)
+
+// Publisher sends persistent messages to a durable queue through the default
+// exchange and waits for the broker to confirm each of them.
+type Publisher struct {
+	connector
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	// live holds conn for Check, which must not wait for a retrying Publish.
+	live atomic.Value
+}
+
+func NewPublisher(logger Logger, url, queueName string, opts Options) *Publisher {
+	return &Publisher{connector: newConnector(logger, url, queueName, opts)}
+}
+
+// Publish retries with backoff until the message is confirmed or ctx is done,
+// so a message may be delivered twice if the connection breaks after
+// the broker took it.
+func (p *Publisher) Publish(ctx context.Context, msg queue.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		err := p.publish(ctx, msg)
+		if err == nil || errors.Is(err, ErrNacked) {
+			p.backoff.Reset()
+			return err
+		}
+		p.reset()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := p.wait(ctx, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Publisher) publish(ctx context.Context, msg queue.Message) error {
+	if p.ch == nil {
+		if err := p.open(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := p.ch.Publish("", p.queue, false, false, amqp.Publishing{
+		Headers:      toTable(msg.Headers),
+		DeliveryMode: amqp.Persistent,
+		Body:         msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c, ok := <-p.confirms:
+		if !ok {
+			return errConfirmLost
+		}
+		if !c.Ack {
+			return ErrNacked
+		}
+		return nil
+	case <-ctx.Done():
+		// The pending confirmation would be taken for the next message.
+		p.reset()
+		return ctx.Err()
+	}
+}
+
+func (p *Publisher) open(ctx context.Context) error {
+	conn, ch, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	p.conn = conn
+	p.live.Store(conn)
+	p.ch = ch
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (p *Publisher) reset() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn, p.ch, p.confirms = nil, nil, nil
+	p.live.Store((*amqp.Connection)(nil))
+}
+
+// Check reports whether the broker is reachable. The publisher connects
+// on the first message, so until then and after the connection is lost
+// Check dials a connection of its own.
+func (p *Publisher) Check(ctx context.Context) error {
+	if conn, _ := p.live.Load().(*amqp.Connection); conn != nil && !conn.IsClosed() {
+		return nil
+	}
+
+	conn, _, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.reset()
+	return nil
+}
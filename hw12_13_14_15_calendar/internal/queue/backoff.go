@@ -0,0 +1,26 @@
+package queue
+
+import "time"
+
+// Backoff returns delays doubling from Min with every attempt up to Max.
+type Backoff struct {
+	Min, Max time.Duration
+	attempt  int
+}
+
+func (b *Backoff) Next() time.Duration {
+	d := b.Min
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.attempt++
+	return d
+}
+
+// Reset starts the delays from Min again.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,27 @@
+package memoryqueue
+
+import "sync"
+
+// Broker is an embedded stand-in for a message broker: queues are
+// addressed by name and created on first use, like durable queues
+// declared by both publishers and consumers.
+type Broker struct {
+	mu     sync.Mutex
+	queues map[string]*Queue
+}
+
+func NewBroker() *Broker {
+	return &Broker{queues: make(map[string]*Queue)}
+}
+
+func (b *Broker) Queue(name string) *Queue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = New()
+		b.queues[name] = q
+	}
+	return q
+}
@@ -0,0 +1,16 @@
+package memoryqueue
+
+import (
+	"testing"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/queuetest"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	queuetest.Run(t, func(_ *testing.T, name string) (queue.Publisher, queue.Consumer) {
+		q := b.Queue(name)
+		return q, q
+	})
+}
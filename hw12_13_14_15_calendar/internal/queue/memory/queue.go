@@ -0,0 +1,134 @@
+package memoryqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+)
+
+var (
+	_ queue.Publisher = (*Queue)(nil)
+	_ queue.Consumer  = (*Queue)(nil)
+)
+
+// Delays before a message rejected by the handler of Consume is put back,
+// the delay doubles with every consecutive rejection.
+const (
+	redeliveryMin = 10 * time.Millisecond
+	redeliveryMax = 5 * time.Second
+)
+
+// Queue is an unbounded in-process FIFO queue.
+type Queue struct {
+	mu       sync.Mutex
+	messages []queue.Message
+	// ready is closed and replaced when a message is published.
+	ready chan struct{}
+}
+
+func New() *Queue {
+	return &Queue{ready: make(chan struct{})}
+}
+
+func (q *Queue) Publish(ctx context.Context, msg queue.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = append(q.messages, copyMessage(msg))
+	close(q.ready)
+	q.ready = make(chan struct{})
+
+	return nil
+}
+
+// Receive removes the oldest message from the queue, waiting for one
+// to be published if the queue is empty.
+func (q *Queue) Receive(ctx context.Context) (queue.Message, error) {
+	for {
+		q.mu.Lock()
+		if len(q.messages) > 0 {
+			msg := q.messages[0]
+			q.messages[0] = queue.Message{}
+			q.messages = q.messages[1:]
+			q.mu.Unlock()
+			return msg, nil
+		}
+		ready := q.ready
+		q.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return queue.Message{}, ctx.Err()
+		}
+	}
+}
+
+// Consume receives messages until ctx is done. A message rejected by handler
+// is put back to the head of the queue after a delay growing with every
+// consecutive rejection, so a failing handler does not spin on it.
+func (q *Queue) Consume(ctx context.Context, handler queue.Handler) error {
+	redelivery := queue.Backoff{Min: redeliveryMin, Max: redeliveryMax}
+	for ctx.Err() == nil {
+		msg, err := q.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			// Other consumers go on with the next messages meanwhile.
+			wait(ctx, redelivery.Next())
+			q.requeue(msg)
+			continue
+		}
+		redelivery.Reset()
+	}
+	return nil
+}
+
+// wait sleeps for d or until ctx is done.
+func wait(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func (q *Queue) requeue(msg queue.Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = append([]queue.Message{msg}, q.messages...)
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+// copyMessage detaches the stored message from buffers owned by the publisher.
+func copyMessage(msg queue.Message) queue.Message {
+	res := queue.Message{Body: append([]byte(nil), msg.Body...)}
+	if msg.Headers != nil {
+		res.Headers = make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			res.Headers[k] = v
+		}
+	}
+	return res
+}
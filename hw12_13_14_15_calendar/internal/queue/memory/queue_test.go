@@ -0,0 +1,118 @@
+package memoryqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	q := New()
+
+	body := []byte("first")
+	require.NoError(t, q.Publish(ctx, queue.Message{Body: body, Headers: map[string]string{"k": "v"}}))
+	require.NoError(t, q.Publish(ctx, queue.Message{Body: []byte("second")}))
+	body[0] = 'F'
+	require.Equal(t, 2, q.Len())
+
+	msg, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.Equal(t, queue.Message{Body: []byte("first"), Headers: map[string]string{"k": "v"}}, msg)
+
+	msg, err = q.Receive(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(msg.Body))
+	require.Zero(t, q.Len())
+
+	t.Run("receive waits for publish", func(t *testing.T) {
+		got := make(chan queue.Message, 1)
+		go func() {
+			msg, err := q.Receive(ctx)
+			if err == nil {
+				got <- msg
+			}
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, q.Publish(ctx, queue.Message{Body: []byte("late")}))
+
+		select {
+		case msg := <-got:
+			require.Equal(t, "late", string(msg.Body))
+		case <-time.After(time.Second):
+			t.Fatal("message was not received")
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, err := q.Receive(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, q.Publish(ctx, queue.Message{}), context.DeadlineExceeded)
+	})
+}
+
+func TestQueueConsume(t *testing.T) {
+	q := New()
+	for _, body := range []string{"a", "b"} {
+		require.NoError(t, q.Publish(context.Background(), queue.Message{Body: []byte(body)}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	failed := false
+	done := make(chan error, 1)
+	go func() {
+		done <- q.Consume(ctx, func(_ context.Context, msg queue.Message) error {
+			got = append(got, string(msg.Body))
+			if string(msg.Body) == "a" && !failed {
+				failed = true
+				return errors.New("try again")
+			}
+			if len(got) == 3 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("consume did not stop")
+	}
+
+	// The rejected message is redelivered before the next one.
+	require.Equal(t, []string{"a", "a", "b"}, got)
+	require.Zero(t, q.Len())
+}
+
+func TestQueueConsumeBackoff(t *testing.T) {
+	q := New()
+	require.NoError(t, q.Publish(context.Background(), queue.Message{Body: []byte("poison")}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	require.NoError(t, q.Consume(ctx, func(context.Context, queue.Message) error {
+		calls++
+		return errors.New("try again")
+	}))
+
+	// Redeliveries wait 10, 20, 40 and 80 milliseconds.
+	require.GreaterOrEqual(t, calls, 2)
+	require.LessOrEqual(t, calls, 4)
+	// The rejected message is kept when the consumer stops while waiting.
+	require.Equal(t, 1, q.Len())
+}
@@ -0,0 +1,25 @@
+package queue
+
+import "context"
+
+// Message is a unit of data passed through a queue.
+type Message struct {
+	Body []byte
+	// Headers carry metadata which is not part of the payload.
+	Headers map[string]string
+}
+
+type Publisher interface {
+	// Publish returns once the queue has taken responsibility for the message.
+	Publish(ctx context.Context, msg Message) error
+}
+
+// Handler processes a consumed message. A nil error acknowledges the message,
+// any other error returns it to the queue for redelivery after a delay which
+// grows while the handler keeps failing.
+type Handler func(ctx context.Context, msg Message) error
+
+type Consumer interface {
+	// Consume passes messages to handler one by one until ctx is done.
+	Consume(ctx context.Context, handler Handler) error
+}
@@ -0,0 +1,173 @@
+// Package queuetest checks that queue implementations behave the same way.
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a publisher and a consumer of the queue with the given name.
+// Both must refer to the same queue when called with the same name.
+type Factory func(t *testing.T, name string) (queue.Publisher, queue.Consumer)
+
+const timeout = 5 * time.Second
+
+// Run runs the contract tests against the implementation built by newQueue.
+func Run(t *testing.T, newQueue Factory) {
+	t.Helper()
+
+	t.Run("order and headers", func(t *testing.T) {
+		pub, cons := newQueue(t, queueName())
+		for i := 0; i < 3; i++ {
+			publish(t, pub, queue.Message{
+				Body:    []byte(strconv.Itoa(i)),
+				Headers: map[string]string{"n": strconv.Itoa(i)},
+			})
+		}
+
+		got := consume(t, cons, 3, func(queue.Message) error { return nil })
+		for i, msg := range got {
+			require.Equal(t, strconv.Itoa(i), string(msg.Body))
+			require.Equal(t, strconv.Itoa(i), msg.Headers["n"])
+		}
+	})
+
+	t.Run("rejected message is redelivered", func(t *testing.T) {
+		pub, cons := newQueue(t, queueName())
+		publish(t, pub, queue.Message{Body: []byte("flaky")})
+
+		rejected := false
+		got := consume(t, cons, 2, func(queue.Message) error {
+			if !rejected {
+				rejected = true
+				return errors.New("not now")
+			}
+			return nil
+		})
+		require.Equal(t, "flaky", string(got[0].Body))
+		require.Equal(t, "flaky", string(got[1].Body))
+	})
+
+	t.Run("unacknowledged message survives consumer stop", func(t *testing.T) {
+		name := queueName()
+		pub, cons := newQueue(t, name)
+		publish(t, pub, queue.Message{Body: []byte("pending")})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		received := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- cons.Consume(ctx, func(ctx context.Context, _ queue.Message) error {
+				close(received)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		}()
+		waitFor(t, received)
+		cancel()
+		waitFor(t, done)
+
+		_, cons = newQueue(t, name)
+		got := consume(t, cons, 1, func(queue.Message) error { return nil })
+		require.Equal(t, "pending", string(got[0].Body))
+	})
+
+	t.Run("acknowledged message is gone", func(t *testing.T) {
+		name := queueName()
+		pub, cons := newQueue(t, name)
+		publish(t, pub, queue.Message{Body: []byte("first")})
+		consume(t, cons, 1, func(queue.Message) error { return nil })
+
+		publish(t, pub, queue.Message{Body: []byte("second")})
+		_, cons = newQueue(t, name)
+		got := consume(t, cons, 1, func(queue.Message) error { return nil })
+		require.Equal(t, "second", string(got[0].Body))
+	})
+
+	t.Run("queues are isolated", func(t *testing.T) {
+		pubA, _ := newQueue(t, queueName())
+		pubB, consB := newQueue(t, queueName())
+		publish(t, pubA, queue.Message{Body: []byte("a")})
+		publish(t, pubB, queue.Message{Body: []byte("b")})
+
+		got := consume(t, consB, 1, func(queue.Message) error { return nil })
+		require.Equal(t, "b", string(got[0].Body))
+	})
+}
+
+func queueName() string {
+	return "queuetest." + uuid.NewString()
+}
+
+func publish(t *testing.T, pub queue.Publisher, msg queue.Message) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	require.NoError(t, pub.Publish(ctx, msg))
+}
+
+// consume runs the consumer until handle has been called n times.
+func consume(t *testing.T, cons queue.Consumer, n int, handle func(queue.Message) error) []queue.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var got []queue.Message
+	done := make(chan error, 1)
+	go func() {
+		done <- cons.Consume(ctx, func(_ context.Context, msg queue.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(got) == n {
+				return errors.New("unexpected message")
+			}
+			got = append(got, msg)
+			err := handle(msg)
+			if len(got) == n {
+				cancel()
+			}
+			return err
+		})
+	}()
+
+	require.NoError(t, <-done)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, got, n, "not enough messages consumed before timeout")
+	return got
+}
+
+func waitFor(t *testing.T, ch interface{}) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch c := ch.(type) {
+	case chan struct{}:
+		select {
+		case <-c:
+		case <-ctx.Done():
+			t.Fatal("timed out")
+		}
+	case chan error:
+		select {
+		case err := <-c:
+			require.NoError(t, err)
+		case <-ctx.Done():
+			t.Fatal("timed out")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var ErrInvalidProxy = errors.New("invalid trusted proxy")
+
+// Proxies are the networks of reverse proxies trusted to report the client
+// address in X-Forwarded-For. Headers of other peers are ignored, since
+// clients may put anything there.
+type Proxies []*net.IPNet
+
+// ParseProxies parses a comma separated list of addresses and CIDR networks,
+// e.g. "10.0.0.0/8, 127.0.0.1".
+func ParseProxies(list string) (Proxies, error) {
+	var proxies Proxies
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidProxy, s)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// ClientIP returns the address requests of a peer are limited by. Hops of
+// forwardedFor, the values of X-Forwarded-For headers, are only followed
+// while they are added by trusted proxies: the right-most untrusted hop is
+// the client.
+func (p Proxies) ClientIP(peerAddr string, forwardedFor []string) string {
+	client, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		client = peerAddr
+	}
+	if !p.trusts(net.ParseIP(client)) {
+		return client
+	}
+
+	var hops []string
+	for _, v := range forwardedFor {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !p.trusts(ip) {
+			break
+		}
+	}
+	return client
+}
+
+func (p Proxies) trusts(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
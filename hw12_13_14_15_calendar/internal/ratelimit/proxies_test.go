@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProxies(t *testing.T) {
+	proxies, err := ParseProxies(" 10.0.0.0/8, 192.0.2.1,,2001:db8::1 ")
+	require.NoError(t, err)
+	require.Len(t, proxies, 3)
+	require.Equal(t, "10.0.0.0/8", proxies[0].String())
+	require.Equal(t, "192.0.2.1/32", proxies[1].String())
+	require.Equal(t, "2001:db8::1/128", proxies[2].String())
+
+	proxies, err = ParseProxies("")
+	require.NoError(t, err)
+	require.Empty(t, proxies)
+
+	for _, list := range []string{"proxy.local", "10.0.0.0/33"} {
+		_, err = ParseProxies(list)
+		require.ErrorIs(t, err, ErrInvalidProxy, list)
+	}
+}
+
+func TestProxiesClientIP(t *testing.T) {
+	proxies, err := ParseProxies("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		proxies      Proxies
+		peer         string
+		forwardedFor []string
+		ip           string
+	}{
+		{name: "no proxies", peer: "203.0.113.7:5000", ip: "203.0.113.7"},
+		{
+			name: "untrusted peer", proxies: proxies,
+			peer: "203.0.113.7:5000", forwardedFor: []string{"198.51.100.1"}, ip: "203.0.113.7",
+		},
+		{
+			name: "trusted peer", proxies: proxies,
+			peer: "10.0.0.1:5000", forwardedFor: []string{"198.51.100.1"}, ip: "198.51.100.1",
+		},
+		{
+			name: "forged hops before the client", proxies: proxies,
+			peer: "10.0.0.1:5000", forwardedFor: []string{"192.0.2.9, 198.51.100.1, 10.0.0.2"}, ip: "198.51.100.1",
+		},
+		{
+			name: "several headers", proxies: proxies,
+			peer: "10.0.0.1:5000", forwardedFor: []string{"192.0.2.9", "198.51.100.1"}, ip: "198.51.100.1",
+		},
+		{
+			name: "malformed hop", proxies: proxies,
+			peer: "10.0.0.1:5000", forwardedFor: []string{"198.51.100.1, unknown, 10.0.0.2"}, ip: "10.0.0.2",
+		},
+		{name: "trusted peer without header", proxies: proxies, peer: "10.0.0.1:5000", ip: "10.0.0.1"},
+		{name: "peer without port", peer: "bufconn", ip: "bufconn"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.ip, tc.proxies.ClientIP(tc.peer, tc.forwardedFor))
+		})
+	}
+}
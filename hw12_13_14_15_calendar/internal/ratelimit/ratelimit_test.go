@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *time.Time) {
+	now := baseTime
+	l := New(rate, burst)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiter(t *testing.T) {
+	l, now := newTestLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("alice")
+		require.True(t, ok, "request %d", i)
+	}
+	ok, wait := l.Allow("alice")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// Buckets are independent.
+	ok, _ = l.Allow("bob")
+	require.True(t, ok)
+
+	*now = now.Add(250 * time.Millisecond)
+	ok, wait = l.Allow("alice")
+	require.False(t, ok)
+	require.Equal(t, 250*time.Millisecond, wait)
+
+	*now = now.Add(250 * time.Millisecond)
+	ok, _ = l.Allow("alice")
+	require.True(t, ok)
+
+	// A bucket never holds more than burst tokens.
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = l.Allow("alice")
+		require.True(t, ok)
+	}
+	ok, _ = l.Allow("alice")
+	require.False(t, ok)
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, now := newTestLimiter(1, 2)
+
+	l.Allow("alice")
+	l.Allow("bob")
+	l.Allow("bob")
+	require.Len(t, l.buckets, 2)
+
+	*now = now.Add(sweepInterval)
+	l.Allow("carol")
+	require.Len(t, l.buckets, 1)
+	require.Contains(t, l.buckets, "carol")
+}
+
+func TestLimiterOff(t *testing.T) {
+	l := New(0, 0)
+	for i := 0; i < 100; i++ {
+		ok, wait := l.Allow("alice")
+		require.True(t, ok)
+		require.Zero(t, wait)
+	}
+	require.Empty(t, l.buckets)
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	l := New(0.001, 10)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.Allow("alice"); ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 10, allowed)
+}
@@ -0,0 +1,442 @@
+// Package rrule implements the subset of RFC 5545 recurrence rules used by
+// the calendar: FREQ=DAILY|WEEKLY|MONTHLY|YEARLY with INTERVAL, BYDAY,
+// COUNT, UNTIL and WKST.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+type Frequency int
+
+const (
+	Daily Frequency = iota + 1
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencies = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+var frequencyNames = [...]string{Daily: "DAILY", Weekly: "WEEKLY", Monthly: "MONTHLY", Yearly: "YEARLY"}
+
+func (f Frequency) String() string {
+	if f < Daily || f > Yearly {
+		return "Frequency(" + strconv.Itoa(int(f)) + ")"
+	}
+	return frequencyNames[f]
+}
+
+var weekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum is a BYDAY entry. N selects the N-th such weekday of the month
+// counting from the end when negative, zero selects all of them.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	if w.N == 0 {
+		return weekdays[w.Day]
+	}
+	return strconv.Itoa(w.N) + weekdays[w.Day]
+}
+
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []WeekdayNum
+	// Count limits the number of occurrences, zero means no limit.
+	Count int
+	// Until is the inclusive bound of occurrence starts, zero means no bound.
+	Until     time.Time
+	WeekStart time.Weekday
+}
+
+const (
+	untilLayout     = "20060102T150405Z"
+	untilDateLayout = "20060102"
+)
+
+// Parse parses the value of an RRULE property, e.g. "FREQ=WEEKLY;BYDAY=MO,WE".
+// WKST defaults to Monday as in RFC 5545.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1, WeekStart: time.Monday}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, fmt.Errorf("%w: empty rule", ErrInvalidRule)
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return Rule{}, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		if seen[key] {
+			return Rule{}, fmt.Errorf("%w: duplicate %s", ErrInvalidRule, key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "FREQ":
+			var ok bool
+			if r.Freq, ok = frequencies[value]; !ok {
+				err = fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = parsePositive(value)
+		case "COUNT":
+			r.Count, err = parsePositive(value)
+		case "UNTIL":
+			r.Until, err = parseUntil(value)
+		case "BYDAY":
+			r.ByDay, err = parseByDay(value)
+		case "WKST":
+			r.WeekStart, err = parseWeekday(value)
+		default:
+			err = fmt.Errorf("unsupported part %s", key)
+		}
+		if err != nil {
+			return Rule{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	}
+
+	if err := r.validate(); err != nil {
+		return Rule{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return r, nil
+}
+
+func (r Rule) validate() error {
+	if r.Freq == 0 {
+		return errors.New("FREQ is required")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return errors.New("COUNT and UNTIL must not be used together")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return fmt.Errorf("BYDAY %s: numbered weekdays are supported with FREQ=MONTHLY only", d)
+		}
+	}
+	if r.Freq == Yearly && len(r.ByDay) > 0 {
+		return errors.New("BYDAY is not supported with FREQ=YEARLY")
+	}
+	return nil
+}
+
+func parsePositive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive integer", s)
+	}
+	return n, nil
+}
+
+// parseUntil accepts a UTC date-time or a date, which includes the whole day.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse(untilLayout, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(untilDateLayout, s); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("UNTIL %q must look like 20060102T150405Z or 20060102", s)
+}
+
+func parseByDay(s string) ([]WeekdayNum, error) {
+	var res []WeekdayNum
+	for _, item := range strings.Split(s, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("malformed BYDAY %q", item)
+		}
+		day, err := parseWeekday(item[len(item)-2:])
+		if err != nil {
+			return nil, err
+		}
+
+		var n int
+		if num := item[:len(item)-2]; num != "" {
+			n, err = strconv.Atoi(num)
+			if err != nil || n == 0 || n < -5 || n > 5 {
+				return nil, fmt.Errorf("malformed BYDAY %q", item)
+			}
+		}
+		res = append(res, WeekdayNum{N: n, Day: day})
+	}
+	return res, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, name := range weekdays {
+		if name == s {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s)
+}
+
+// String formats the rule back to the RRULE value, omitting default parts.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, d := range r.ByDay {
+			days = append(days, d.String())
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdays[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns occurrence starts t with from <= t < to.
+func (r Rule) Between(dtstart, from, to time.Time) []time.Time {
+	var res []time.Time
+	it := r.Iterator(dtstart)
+	for {
+		t, ok := it.Next()
+		if !ok || !t.Before(to) {
+			return res
+		}
+		if !t.Before(from) {
+			res = append(res, t)
+		}
+	}
+}
+
+// Last returns the start of the last occurrence, ok is false when the rule
+// repeats forever.
+func (r Rule) Last(dtstart time.Time) (last time.Time, ok bool) {
+	if r.Count == 0 && r.Until.IsZero() {
+		return time.Time{}, false
+	}
+
+	it := r.Iterator(dtstart)
+	for {
+		t, ok := it.Next()
+		if !ok {
+			return last, true
+		}
+		last = t
+	}
+}
+
+// maxEmptyPeriods stops iteration over rules which can never match again,
+// e.g. FREQ=DAILY;INTERVAL=7;BYDAY=TU started on a Monday.
+const maxEmptyPeriods = 1000
+
+// Iterator yields occurrence starts in chronological order. DTSTART is
+// always the first occurrence, the others keep its time of day in its location.
+type Iterator struct {
+	rule    Rule
+	dtstart time.Time
+	period  int
+	pending []time.Time
+	emitted int
+	started bool
+	done    bool
+}
+
+func (r Rule) Iterator(dtstart time.Time) *Iterator {
+	if r.Interval < 1 {
+		r.Interval = 1
+	}
+	return &Iterator{rule: r, dtstart: dtstart}
+}
+
+func (it *Iterator) Next() (time.Time, bool) {
+	if it.done {
+		return time.Time{}, false
+	}
+
+	var t time.Time
+	if !it.started {
+		it.started = true
+		t = it.dtstart
+	} else {
+		var ok bool
+		if t, ok = it.next(); !ok {
+			it.done = true
+			return time.Time{}, false
+		}
+	}
+
+	if !it.rule.Until.IsZero() && t.After(it.rule.Until) {
+		it.done = true
+		return time.Time{}, false
+	}
+	it.emitted++
+	if it.rule.Count > 0 && it.emitted >= it.rule.Count {
+		it.done = true
+	}
+	return t, true
+}
+
+// next returns the next candidate after DTSTART.
+func (it *Iterator) next() (time.Time, bool) {
+	empty := 0
+	for len(it.pending) == 0 {
+		if empty == maxEmptyPeriods {
+			return time.Time{}, false
+		}
+		for _, t := range it.candidates(it.period) {
+			if t.After(it.dtstart) {
+				it.pending = append(it.pending, t)
+			}
+		}
+		it.period++
+		empty++
+	}
+
+	t := it.pending[0]
+	it.pending = it.pending[1:]
+	return t, true
+}
+
+// candidates returns sorted occurrence starts within the n-th period.
+func (it *Iterator) candidates(n int) []time.Time {
+	r := it.rule
+	s := it.dtstart
+	y, m, d := s.Date()
+	step := n * r.Interval
+
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, s.Hour(), s.Minute(), s.Second(), s.Nanosecond(), s.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+step)
+		if len(r.ByDay) > 0 && !hasWeekday(r.ByDay, t.Weekday()) {
+			return nil
+		}
+		return []time.Time{t}
+
+	case Weekly:
+		weekStart := d - daysSince(s.Weekday(), r.WeekStart) + 7*step
+		days := []time.Weekday{s.Weekday()}
+		if len(r.ByDay) > 0 {
+			days = days[:0]
+			for _, wd := range r.ByDay {
+				days = append(days, wd.Day)
+			}
+		}
+		offsets := make([]int, 0, len(days))
+		for _, wd := range days {
+			offsets = append(offsets, daysSince(wd, r.WeekStart))
+		}
+		sort.Ints(offsets)
+
+		res := make([]time.Time, 0, len(offsets))
+		for i, off := range offsets {
+			if i > 0 && off == offsets[i-1] {
+				continue
+			}
+			res = append(res, at(y, m, weekStart+off))
+		}
+		return res
+
+	case Monthly:
+		first := time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		my, mm := first.Year(), first.Month()
+		if len(r.ByDay) == 0 {
+			if d > daysIn(my, mm) {
+				return nil
+			}
+			return []time.Time{at(my, mm, d)}
+		}
+
+		var res []time.Time
+		for _, day := range monthDays(my, mm, r.ByDay) {
+			res = append(res, at(my, mm, day))
+		}
+		return res
+
+	case Yearly:
+		if d > daysIn(y+step, m) {
+			return nil
+		}
+		return []time.Time{at(y+step, m, d)}
+	}
+
+	return nil
+}
+
+// monthDays returns sorted days of the month matching any of byDay.
+func monthDays(y int, m time.Month, byDay []WeekdayNum) []int {
+	n := daysIn(y, m)
+	firstWeekday := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC).Weekday()
+
+	match := make([]bool, n+1)
+	for _, wd := range byDay {
+		var days []int
+		for day := 1 + daysSince(wd.Day, firstWeekday); day <= n; day += 7 {
+			days = append(days, day)
+		}
+		switch {
+		case wd.N == 0:
+			for _, day := range days {
+				match[day] = true
+			}
+		case wd.N > 0 && wd.N <= len(days):
+			match[days[wd.N-1]] = true
+		case wd.N < 0 && -wd.N <= len(days):
+			match[days[len(days)+wd.N]] = true
+		}
+	}
+
+	var res []int
+	for day := 1; day <= n; day++ {
+		if match[day] {
+			res = append(res, day)
+		}
+	}
+	return res
+}
+
+func hasWeekday(byDay []WeekdayNum, wd time.Weekday) bool {
+	for _, d := range byDay {
+		if d.Day == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// daysSince returns the number of days from the previous (or same) since weekday to wd.
+func daysSince(wd, since time.Weekday) int {
+	return (int(wd) - int(since) + 7) % 7
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,195 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		r, err := Parse("RRULE:freq=weekly;INTERVAL=2;BYDAY=MO,WE;UNTIL=20211231T235959Z;WKST=SU")
+		require.NoError(t, err)
+		require.Equal(t, Rule{
+			Freq:      Weekly,
+			Interval:  2,
+			ByDay:     []WeekdayNum{{Day: time.Monday}, {Day: time.Wednesday}},
+			Until:     time.Date(2021, time.December, 31, 23, 59, 59, 0, time.UTC),
+			WeekStart: time.Sunday,
+		}, r)
+		require.Equal(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20211231T235959Z;WKST=SU", r.String())
+
+		r, err = Parse("FREQ=MONTHLY;BYDAY=-1FR,2TU;COUNT=5")
+		require.NoError(t, err)
+		require.Equal(t, []WeekdayNum{{N: -1, Day: time.Friday}, {N: 2, Day: time.Tuesday}}, r.ByDay)
+		require.Equal(t, "FREQ=MONTHLY;BYDAY=-1FR,2TU;COUNT=5", r.String())
+
+		r, err = Parse("FREQ=DAILY;UNTIL=20210620")
+		require.NoError(t, err)
+		require.Equal(t, time.Date(2021, time.June, 20, 23, 59, 59, 0, time.UTC), r.Until)
+	})
+
+	invalid := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=-1",
+		"FREQ=DAILY;COUNT=2;UNTIL=20210620",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYDAY=6MO",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=DAILY;BYMONTH=1",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ",
+	}
+	for _, s := range invalid {
+		s := s
+		t.Run(s, func(t *testing.T) {
+			_, err := Parse(s)
+			require.ErrorIs(t, err, ErrInvalidRule)
+		})
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	// Monday.
+	start := time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+	date := func(m time.Month, d int) time.Time {
+		return time.Date(2021, m, d, 10, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		rule  string
+		start time.Time
+		want  []time.Time
+	}{
+		{
+			rule: "FREQ=DAILY;COUNT=3",
+			want: []time.Time{date(6, 14), date(6, 15), date(6, 16)},
+		},
+		{
+			rule: "FREQ=DAILY;INTERVAL=2;UNTIL=20210620T100000Z",
+			want: []time.Time{date(6, 14), date(6, 16), date(6, 18), date(6, 20)},
+		},
+		{
+			rule: "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=7",
+			want: []time.Time{date(6, 14), date(6, 15), date(6, 16), date(6, 17), date(6, 18), date(6, 21), date(6, 22)},
+		},
+		{
+			rule: "FREQ=WEEKLY;COUNT=3",
+			want: []time.Time{date(6, 14), date(6, 21), date(6, 28)},
+		},
+		{
+			rule: "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=4",
+			want: []time.Time{date(6, 14), date(6, 18), date(6, 21), date(6, 25)},
+		},
+		{
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;COUNT=5",
+			start: date(6, 15),
+			want:  []time.Time{date(6, 15), date(6, 20), date(6, 29), date(7, 4), date(7, 13)},
+		},
+		{
+			// With a Sunday week start the Sunday belongs to the next period.
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;COUNT=4;WKST=SU",
+			start: date(6, 15),
+			want:  []time.Time{date(6, 15), date(6, 27), date(6, 29), date(7, 11)},
+		},
+		{
+			rule:  "FREQ=MONTHLY;COUNT=4",
+			start: date(1, 31),
+			want:  []time.Time{date(1, 31), date(3, 31), date(5, 31), date(7, 31)},
+		},
+		{
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			start: date(6, 25),
+			want:  []time.Time{date(6, 25), date(7, 30), date(8, 27)},
+		},
+		{
+			rule:  "FREQ=MONTHLY;INTERVAL=2;BYDAY=1MO,3MO;COUNT=4",
+			start: date(6, 7),
+			want:  []time.Time{date(6, 7), date(6, 21), date(8, 2), date(8, 16)},
+		},
+		{
+			rule:  "FREQ=YEARLY;COUNT=3",
+			start: time.Date(2020, time.February, 29, 10, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2020, time.February, 29, 10, 0, 0, 0, time.UTC),
+				time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC),
+				time.Date(2028, time.February, 29, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Never matches again, iteration must stop.
+			rule: "FREQ=DAILY;INTERVAL=7;BYDAY=TU",
+			want: []time.Time{date(6, 14)},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.rule, func(t *testing.T) {
+			r, err := Parse(tc.rule)
+			require.NoError(t, err)
+			if tc.start.IsZero() {
+				tc.start = start
+			}
+
+			var got []time.Time
+			it := r.Iterator(tc.start)
+			for len(got) <= len(tc.want) {
+				next, ok := it.Next()
+				if !ok {
+					break
+				}
+				got = append(got, next)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestBetweenAndLast(t *testing.T) {
+	start := time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+	r, err := Parse("FREQ=DAILY")
+	require.NoError(t, err)
+	got := r.Between(start, start.AddDate(1, 0, 0), start.AddDate(1, 0, 2))
+	require.Equal(t, []time.Time{start.AddDate(1, 0, 0), start.AddDate(1, 0, 1)}, got)
+
+	_, ok := r.Last(start)
+	require.False(t, ok)
+
+	r, err = Parse("FREQ=WEEKLY;COUNT=10")
+	require.NoError(t, err)
+	last, ok := r.Last(start)
+	require.True(t, ok)
+	require.Equal(t, start.AddDate(0, 0, 63), last)
+}
+
+func TestOccurrencesKeepLocalTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// Clocks move forward on March 28, 2021 in Berlin.
+	start := time.Date(2021, time.March, 26, 9, 0, 0, 0, berlin)
+	r, err := Parse("FREQ=DAILY;COUNT=4")
+	require.NoError(t, err)
+
+	got := r.Between(start, start, start.AddDate(0, 0, 5))
+	require.Len(t, got, 4)
+	for _, occ := range got {
+		require.Equal(t, 9, occ.Hour())
+	}
+	require.Equal(t, 71*time.Hour, got[3].Sub(got[0]))
+
+	// Moscow has no DST, the same rule is exactly 24h apart.
+	start = time.Date(2021, time.March, 26, 9, 0, 0, 0, loc)
+	got = r.Between(start, start, start.AddDate(0, 0, 5))
+	require.Equal(t, 72*time.Hour, got[3].Sub(got[0]))
+}
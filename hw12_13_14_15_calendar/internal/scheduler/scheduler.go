@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the content type of published notifications.
+const ContentType = "application/json"
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type Storage interface {
+	ListToNotify(ctx context.Context, now time.Time) ([]storage.Event, error)
+	MarkNotified(ctx context.Context, id string, until time.Time) error
+	DeleteEndedBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// Metrics records how the scheduler keeps up with due events.
+type Metrics interface {
+	// ObserveNotificationLag records the time from when the notifications
+	// of an event were due to when they were published.
+	ObserveNotificationLag(d time.Duration)
+}
+
+type Scheduler struct {
+	logger    Logger
+	storage   Storage
+	publisher queue.Publisher
+	metrics   Metrics
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func New(
+	logger Logger, storage Storage, publisher queue.Publisher, metrics Metrics, interval time.Duration,
+) *Scheduler {
+	return &Scheduler{
+		logger:    logger,
+		storage:   storage,
+		publisher: publisher,
+		metrics:   metrics,
+		interval:  interval,
+		now:       time.Now,
+	}
+}
+
+// Run notifies and purges once and then every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	if err := s.Notify(ctx); err != nil && ctx.Err() == nil {
+		s.logger.Error("failed to send notifications", "error", err)
+	}
+	if err := s.Purge(ctx); err != nil && ctx.Err() == nil {
+		s.logger.Error("failed to purge old events", "error", err)
+	}
+}
+
+// Errors collects the failures of events in one Notify call.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d events failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Is allows errors.Is(errs, context.Canceled) to match any of the collected errors.
+func (e Errors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify publishes notifications for every due event or occurrence of a
+// recurring event, one to the owner and one to every accepted attendee, and
+// marks it notified. An event is published again if publishing to any of
+// its recipients or marking fails, so consumers should tolerate duplicates.
+// A failed event does not hold back the others, their failures are returned
+// together as Errors.
+func (s *Scheduler) Notify(ctx context.Context) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler.Notify")
+	defer func() { tracing.End(span, err) }()
+
+	events, err := s.storage.ListToNotify(ctx, s.now())
+	if err != nil {
+		return fmt.Errorf("list events: %w", err)
+	}
+
+	var errs Errors
+	published := 0
+	for _, e := range events {
+		// Later events would fail the same way.
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := s.notify(ctx, e); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		published++
+	}
+
+	if published > 0 {
+		s.logger.Info("notifications published", "count", published)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// notify publishes the notifications of a due event in a trace of its own,
+// which the sender continues, so a late notification can be followed.
+func (s *Scheduler) notify(ctx context.Context, e storage.Event) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler.notify_event",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(tracing.EventIDKey.String(e.ID)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	for _, n := range storage.Notifications(e) {
+		if err := s.publish(ctx, n); err != nil {
+			return fmt.Errorf("publish notification for event %s to %s: %w", e.ID, n.UserID, err)
+		}
+		s.logger.Debug("notification published", "event_id", e.ID, "user_id", n.UserID)
+	}
+	s.metrics.ObserveNotificationLag(s.now().Sub(e.NotifyAt()))
+
+	err = s.storage.MarkNotified(ctx, e.ID, e.StartAt)
+	if err != nil && !errors.Is(err, storage.ErrEventNotFound) {
+		return fmt.Errorf("mark event %s notified: %w", e.ID, err)
+	}
+	return nil
+}
+
+func (s *Scheduler) publish(ctx context.Context, n storage.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return s.publisher.Publish(ctx, queue.Message{
+		Body:    body,
+		Headers: map[string]string{"content-type": ContentType},
+	})
+}
+
+// Purge removes events which ended more than a year ago for good, deleted
+// events and the history of changes included. It is the only hard delete.
+func (s *Scheduler) Purge(ctx context.Context) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler.Purge")
+	defer func() { tracing.End(span, err) }()
+
+	n, err := s.storage.DeleteEndedBefore(ctx, s.now().AddDate(-1, 0, 0))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.logger.Info("old events purged", "count", n)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing/tracingtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newEvent(start time.Time, notifyBefore time.Duration) storage.Event {
+	return storage.Event{
+		ID:           uuid.NewString(),
+		Title:        "meeting",
+		StartAt:      start,
+		EndAt:        start.Add(time.Hour),
+		UserID:       "user",
+		NotifyBefore: notifyBefore,
+	}
+}
+
+// lagRecorder keeps the observed notification lags.
+type lagRecorder struct {
+	mu   sync.Mutex
+	lags []time.Duration
+}
+
+func (r *lagRecorder) ObserveNotificationLag(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lags = append(r.lags, d)
+}
+
+func newTestScheduler(st Storage, pub queue.Publisher) *Scheduler {
+	s := New(nopLogger{}, st, pub, &lagRecorder{}, time.Minute)
+	s.now = func() time.Time { return baseTime }
+	return s
+}
+
+func receiveNotification(t *testing.T, q *memoryqueue.Queue) storage.Notification {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := q.Receive(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ContentType, msg.Headers["content-type"])
+
+	var n storage.Notification
+	require.NoError(t, json.Unmarshal(msg.Body, &n))
+	return n
+}
+
+func TestSchedulerNotify(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	s := newTestScheduler(st, q)
+
+	due := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	later := newEvent(baseTime.Add(2*time.Hour), 15*time.Minute)
+	silent := newEvent(baseTime.Add(4*time.Hour), 0)
+	for _, e := range []storage.Event{due, later, silent} {
+		require.NoError(t, st.Create(ctx, e))
+	}
+
+	require.NoError(t, s.Notify(ctx))
+	require.Equal(t, 1, q.Len())
+	n := receiveNotification(t, q)
+	require.Equal(t, storage.Notification{
+		EventID: due.ID,
+		Title:   due.Title,
+		Date:    due.StartAt,
+		UserID:  due.UserID,
+	}, n)
+
+	// Marked events are not sent twice.
+	require.NoError(t, s.Notify(ctx))
+	require.Zero(t, q.Len())
+
+	s.now = func() time.Time { return later.NotifyAt() }
+	require.NoError(t, s.Notify(ctx))
+	require.Equal(t, later.ID, receiveNotification(t, q).EventID)
+	require.Zero(t, q.Len())
+
+	// The due event was published five minutes after its notification time.
+	require.Equal(t, []time.Duration{5 * time.Minute, 0}, s.metrics.(*lagRecorder).lags)
+}
+
+func TestSchedulerNotifyRecurring(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	s := newTestScheduler(st, q)
+
+	e := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	e.RRule = "FREQ=DAILY"
+	require.NoError(t, st.Create(ctx, e))
+
+	for day := 0; day < 3; day++ {
+		start := e.StartAt.AddDate(0, 0, day)
+		s.now = func() time.Time { return start.Add(-5 * time.Minute) }
+
+		require.NoError(t, s.Notify(ctx))
+		n := receiveNotification(t, q)
+		require.Equal(t, e.ID, n.EventID)
+		require.Equal(t, start, n.Date)
+
+		require.NoError(t, s.Notify(ctx))
+		require.Zero(t, q.Len())
+	}
+}
+
+func TestSchedulerNotifyAttendees(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	s := newTestScheduler(st, q)
+
+	e := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	e.Attendees = []storage.Attendee{
+		{UserID: "accepted", Status: storage.Accepted},
+		{UserID: "declined", Status: storage.Declined},
+		{UserID: "tentative", Status: storage.Tentative},
+		{UserID: "silent", Status: storage.NeedsAction},
+	}
+	require.NoError(t, st.Create(ctx, e))
+
+	require.NoError(t, s.Notify(ctx))
+	require.Equal(t, 2, q.Len())
+	for _, user := range []string{"user", "accepted"} {
+		n := receiveNotification(t, q)
+		require.Equal(t, e.ID, n.EventID)
+		require.Equal(t, user, n.UserID)
+	}
+
+	require.NoError(t, s.Notify(ctx))
+	require.Zero(t, q.Len())
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, queue.Message) error {
+	return errors.New("queue is down")
+}
+
+func TestSchedulerNotifyPublishFailure(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	e := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	require.NoError(t, st.Create(ctx, e))
+
+	require.Error(t, newTestScheduler(st, failingPublisher{}).Notify(ctx))
+
+	// The event stays pending and goes out once the queue is back.
+	q := memoryqueue.New()
+	require.NoError(t, newTestScheduler(st, q).Notify(ctx))
+	require.Equal(t, e.ID, receiveNotification(t, q).EventID)
+}
+
+// selectivePublisher fails notifications of one event and passes others on.
+type selectivePublisher struct {
+	queue.Publisher
+	failID string
+}
+
+func (p selectivePublisher) Publish(ctx context.Context, msg queue.Message) error {
+	if strings.Contains(string(msg.Body), p.failID) {
+		return errors.New("message rejected")
+	}
+	return p.Publisher.Publish(ctx, msg)
+}
+
+func TestSchedulerNotifyPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	failing := newEvent(baseTime.Add(5*time.Minute), 15*time.Minute)
+	other := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	other.UserID = "other"
+	require.NoError(t, st.Create(ctx, failing))
+	require.NoError(t, st.Create(ctx, other))
+
+	// A failed event does not hold back the others.
+	q := memoryqueue.New()
+	err := newTestScheduler(st, selectivePublisher{Publisher: q, failID: failing.ID}).Notify(ctx)
+	var errs Errors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	require.Contains(t, err.Error(), failing.ID)
+	require.Equal(t, other.ID, receiveNotification(t, q).EventID)
+	require.Zero(t, q.Len())
+
+	require.NoError(t, newTestScheduler(st, q).Notify(ctx))
+	require.Equal(t, failing.ID, receiveNotification(t, q).EventID)
+	require.Zero(t, q.Len())
+
+	// Once ctx is done the remaining events are not tried.
+	pending := newEvent(baseTime.Add(12*time.Minute), 15*time.Minute)
+	pending.UserID = "pending"
+	require.NoError(t, st.Create(ctx, pending))
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, newTestScheduler(st, q).Notify(canceled), context.Canceled)
+	require.Zero(t, q.Len())
+}
+
+func TestSchedulerPurge(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	s := newTestScheduler(st, memoryqueue.New())
+
+	old := newEvent(baseTime.AddDate(-1, 0, -1), 0)
+	recent := newEvent(baseTime.AddDate(0, -11, 0), 0)
+	require.NoError(t, st.Create(ctx, old))
+	require.NoError(t, st.Create(ctx, recent))
+
+	require.NoError(t, s.Purge(ctx))
+
+	_, err := st.Get(ctx, old.UserID, old.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = st.Get(ctx, recent.UserID, recent.ID)
+	require.NoError(t, err)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	s := newTestScheduler(st, q)
+	s.interval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	// An event created while the scheduler runs is picked up on a later tick.
+	e := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	require.NoError(t, st.Create(context.Background(), e))
+	require.Equal(t, e.ID, receiveNotification(t, q).EventID)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop")
+	}
+}
+
+func TestSchedulerNotifyTracing(t *testing.T) {
+	recorder := tracingtest.Record(t)
+	ctx := context.Background()
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	s := newTestScheduler(st, tracing.NewPublisher(q, "notifications"))
+
+	first := newEvent(baseTime.Add(10*time.Minute), 15*time.Minute)
+	second := newEvent(baseTime.Add(5*time.Minute), 15*time.Minute)
+	second.UserID = "other"
+	for _, e := range []storage.Event{first, second} {
+		require.NoError(t, st.Create(ctx, e))
+	}
+	require.NoError(t, s.Notify(ctx))
+
+	// Every event is published in a trace of its own, linked to the run.
+	run := tracingtest.Find(t, recorder, "scheduler.Notify")
+	traces := make(map[string]trace.TraceID)
+	for _, span := range recorder.Ended() {
+		if span.Name() != "scheduler.notify_event" {
+			continue
+		}
+		require.False(t, span.Parent().IsValid())
+		require.Len(t, span.Links(), 1)
+		require.Equal(t, run.SpanContext().SpanID(), span.Links()[0].SpanContext.SpanID())
+		for _, attr := range span.Attributes() {
+			if attr.Key == tracing.EventIDKey {
+				traces[attr.Value.AsString()] = span.SpanContext().TraceID()
+			}
+		}
+	}
+	require.Len(t, traces, 2)
+	require.NotEqual(t, traces[first.ID], traces[second.ID])
+
+	for i := 0; i < 2; i++ {
+		rctx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, err := q.Receive(rctx)
+		cancel()
+		require.NoError(t, err)
+		var n storage.Notification
+		require.NoError(t, json.Unmarshal(msg.Body, &n))
+		require.Contains(t, msg.Headers["traceparent"], traces[n.EventID].String())
+	}
+}
@@ -0,0 +1,121 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers set on messages moved to the dead-letter queue.
+const (
+	HeaderError    = "x-error"
+	HeaderAttempts = "x-attempts"
+)
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Sender delivers a notification to the user.
+type Sender interface {
+	Send(ctx context.Context, n storage.Notification) error
+}
+
+type Service struct {
+	logger     Logger
+	consumer   queue.Consumer
+	sender     Sender
+	deadLetter queue.Publisher
+	// attempts is the number of deliveries tried before giving up.
+	attempts   int
+	retryDelay time.Duration
+}
+
+func New(
+	logger Logger, consumer queue.Consumer, sender Sender, deadLetter queue.Publisher,
+	attempts int, retryDelay time.Duration,
+) *Service {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Service{
+		logger:     logger,
+		consumer:   consumer,
+		sender:     sender,
+		deadLetter: deadLetter,
+		attempts:   attempts,
+		retryDelay: retryDelay,
+	}
+}
+
+// Run delivers notifications until ctx is done.
+func (s *Service) Run(ctx context.Context) error {
+	return s.consumer.Consume(ctx, s.handle)
+}
+
+// handle acknowledges a message once it is delivered or moved to the
+// dead-letter queue, so a message is never lost if the process stops
+// in between.
+func (s *Service) handle(ctx context.Context, msg queue.Message) error {
+	var n storage.Notification
+	if err := json.Unmarshal(msg.Body, &n); err != nil {
+		return s.reject(ctx, msg, 0, fmt.Errorf("decode notification: %w", err))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(tracing.EventIDKey.String(n.EventID), tracing.UserIDKey.String(n.UserID))
+
+	var err error
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		if err = s.sender.Send(ctx, n); err == nil {
+			s.logger.Debug("notification sent", "event_id", n.EventID, "user_id", n.UserID)
+			return nil
+		}
+		s.logger.Warn("failed to send notification",
+			"event_id", n.EventID, "attempt", attempt, "error", err)
+
+		if attempt < s.attempts {
+			if err := sleep(ctx, s.retryDelay*time.Duration(attempt)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.reject(ctx, msg, s.attempts, err)
+}
+
+func (s *Service) reject(ctx context.Context, msg queue.Message, attempts int, cause error) error {
+	headers := make(map[string]string, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderError] = cause.Error()
+	headers[HeaderAttempts] = strconv.Itoa(attempts)
+
+	if err := s.deadLetter.Publish(ctx, queue.Message{Body: msg.Body, Headers: headers}); err != nil {
+		return fmt.Errorf("publish to dead-letter queue: %w", err)
+	}
+	s.logger.Error("notification moved to dead-letter queue", "error", cause)
+
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,225 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/scheduler"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newNotification(title string) storage.Notification {
+	return storage.Notification{
+		EventID: uuid.NewString(),
+		Title:   title,
+		Date:    baseTime,
+		UserID:  "user",
+	}
+}
+
+func publish(t *testing.T, q queue.Publisher, n storage.Notification) {
+	t.Helper()
+
+	body, err := json.Marshal(n)
+	require.NoError(t, err)
+	require.NoError(t, q.Publish(context.Background(), queue.Message{Body: body}))
+}
+
+// flakySender fails the first failures calls.
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []storage.Notification
+}
+
+func (s *flakySender) Send(_ context.Context, n storage.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("smtp is down")
+	}
+	s.sent = append(s.sent, n)
+	return nil
+}
+
+// runUntil runs the service until the queue is drained and cond holds.
+func runUntil(t *testing.T, s *Service, q *memoryqueue.Queue, cond func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return q.Len() == 0 && cond()
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestServiceEndToEnd(t *testing.T) {
+	ctx := context.Background()
+	st := memorystorage.New()
+	q := memoryqueue.New()
+	deadLetter := memoryqueue.New()
+
+	var events []storage.Event
+	for i := 0; i < 3; i++ {
+		e := storage.Event{
+			ID:           uuid.NewString(),
+			Title:        "meeting",
+			StartAt:      time.Now().Add(time.Duration(i+1) * time.Hour),
+			UserID:       "user",
+			NotifyBefore: 24 * time.Hour,
+		}
+		e.EndAt = e.StartAt.Add(30 * time.Minute)
+		require.NoError(t, st.Create(ctx, e))
+		events = append(events, e)
+	}
+	require.NoError(t, scheduler.New(nopLogger{}, st, q, metrics.New(), time.Minute).Notify(ctx))
+
+	var out syncBuffer
+	s := New(nopLogger{}, q, NewWriterSender(&out), deadLetter, 3, time.Millisecond)
+	runUntil(t, s, q, func() bool {
+		return strings.Count(out.String(), "\n") == len(events)
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, line := range lines {
+		var n storage.Notification
+		require.NoError(t, json.Unmarshal([]byte(line), &n))
+		require.Equal(t, events[i].ID, n.EventID)
+		require.True(t, events[i].StartAt.Equal(n.Date))
+	}
+	require.Zero(t, deadLetter.Len())
+}
+
+func TestServiceRetries(t *testing.T) {
+	q := memoryqueue.New()
+	deadLetter := memoryqueue.New()
+	sender := &flakySender{failures: 2}
+	n := newNotification("standup")
+	publish(t, q, n)
+
+	s := New(nopLogger{}, q, sender, deadLetter, 3, time.Millisecond)
+	runUntil(t, s, q, func() bool {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		return len(sender.sent) == 1
+	})
+
+	require.Equal(t, 3, sender.calls)
+	require.Equal(t, []storage.Notification{n}, sender.sent)
+	require.Zero(t, deadLetter.Len())
+}
+
+func TestServiceDeadLetter(t *testing.T) {
+	q := memoryqueue.New()
+	deadLetter := memoryqueue.New()
+	sender := &flakySender{failures: 100}
+
+	publish(t, q, newNotification("standup"))
+	require.NoError(t, q.Publish(context.Background(), queue.Message{
+		Body:    []byte("not json"),
+		Headers: map[string]string{"content-type": "application/json"},
+	}))
+
+	s := New(nopLogger{}, q, sender, deadLetter, 3, time.Millisecond)
+	runUntil(t, s, q, func() bool { return deadLetter.Len() == 2 })
+
+	require.Equal(t, 3, sender.calls)
+
+	ctx := context.Background()
+	failed, err := deadLetter.Receive(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "3", failed.Headers[HeaderAttempts])
+	require.Equal(t, "smtp is down", failed.Headers[HeaderError])
+
+	malformed, err := deadLetter.Receive(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "not json", string(malformed.Body))
+	require.Equal(t, "0", malformed.Headers[HeaderAttempts])
+	require.Equal(t, "application/json", malformed.Headers["content-type"])
+	require.Contains(t, malformed.Headers[HeaderError], "decode notification")
+}
+
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(context.Context, queue.Message) error {
+	return errors.New("queue is down")
+}
+
+func TestServiceDeadLetterFailure(t *testing.T) {
+	s := New(nopLogger{}, memoryqueue.New(), &flakySender{failures: 100}, failingPublisher{}, 1, 0)
+
+	// The message is not acknowledged while it cannot be parked.
+	require.Error(t, s.handle(context.Background(), queue.Message{Body: []byte("{}")}))
+}
+
+func TestWebhookSender(t *testing.T) {
+	var got storage.Notification
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := NewWebhookSender(ts.URL, ts.Client())
+	n := newNotification("standup")
+
+	require.NoError(t, s.Send(ctx, n))
+	require.Equal(t, n.EventID, got.EventID)
+
+	status = http.StatusBadGateway
+	require.ErrorIs(t, s.Send(ctx, n), ErrUnexpectedStatus)
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,56 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var _ Sender = (*WebhookSender)(nil)
+
+var ErrUnexpectedStatus = errors.New("unexpected webhook response status")
+
+// WebhookSender posts every notification as JSON to the URL. Any 2xx
+// response means the notification is delivered.
+type WebhookSender struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSender(url string, client *http.Client) *WebhookSender {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &WebhookSender{url: url, client: client}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, n storage.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return nil
+}
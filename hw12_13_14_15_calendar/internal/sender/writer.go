@@ -0,0 +1,37 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var _ Sender = (*WriterSender)(nil)
+
+// WriterSender writes every notification as a JSON line, e.g. to stdout
+// or to a file.
+type WriterSender struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewWriterSender(out io.Writer) *WriterSender {
+	return &WriterSender{out: out}
+}
+
+func (s *WriterSender) Send(_ context.Context, n storage.Notification) error {
+	line, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.out.Write(line)
+	return err
+}
@@ -0,0 +1,99 @@
+// Package accesslog formats the access log lines of the HTTP and gRPC
+// servers. Both write the layout of docs/12_README.md:
+//
+//	66.249.65.3 [25/Feb/2020:19:11:24 +0600] GET /hello?q=1 HTTP/1.1 200 30 "Mozilla/5.0"
+//
+// where 200 is the response status and 30 is the latency in milliseconds.
+package accesslog
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+const timeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// statusClientClosedRequest is the status nginx logs for requests the client
+// gave up on, net/http has no name for it.
+const statusClientClosedRequest = 499
+
+// Entry is a handled request. Calls of the gRPC server are POST requests to
+// the full method over HTTP/2.
+type Entry struct {
+	ClientIP string
+	Start    time.Time
+	Method   string
+	// Target is the path with the query.
+	Target    string
+	Proto     string
+	Status    int
+	Latency   time.Duration
+	UserAgent string
+}
+
+// Line renders the entry, empty client IP and user agent are written as "-".
+func Line(e Entry) string {
+	ip := e.ClientIP
+	if ip == "" {
+		ip = "-"
+	}
+	userAgent := e.UserAgent
+	if userAgent == "" {
+		userAgent = "-"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ip)
+	sb.WriteString(" [")
+	sb.WriteString(e.Start.Format(timeLayout))
+	sb.WriteString("] ")
+	sb.WriteString(e.Method)
+	sb.WriteByte(' ')
+	sb.WriteString(e.Target)
+	sb.WriteByte(' ')
+	sb.WriteString(e.Proto)
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.Itoa(e.Status))
+	sb.WriteByte(' ')
+	sb.WriteString(strconv.FormatInt(e.Latency.Milliseconds(), 10))
+	sb.WriteString(` "`)
+	sb.WriteString(userAgent)
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// HTTPStatus maps a gRPC code to the HTTP status written for the call, the
+// mapping is the one of grpc-gateway.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return statusClientClosedRequest
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,66 @@
+package accesslog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestLine(t *testing.T) {
+	start := time.Date(2020, time.February, 25, 19, 11, 24, 0, time.FixedZone("", 6*60*60))
+
+	for _, tc := range []struct {
+		name  string
+		entry Entry
+		line  string
+	}{
+		{
+			name: "http request",
+			entry: Entry{
+				ClientIP: "66.249.65.3", Start: start, Method: http.MethodGet, Target: "/hello?q=1",
+				Proto: "HTTP/1.1", Status: http.StatusOK, Latency: 30 * time.Millisecond, UserAgent: "Mozilla/5.0",
+			},
+			line: `66.249.65.3 [25/Feb/2020:19:11:24 +0600] GET /hello?q=1 HTTP/1.1 200 30 "Mozilla/5.0"`,
+		},
+		{
+			name: "grpc call",
+			entry: Entry{
+				ClientIP: "127.0.0.1", Start: start, Method: http.MethodPost, Target: "/event.EventService/Delete",
+				Proto: "HTTP/2", Status: HTTPStatus(codes.NotFound), Latency: 3 * time.Millisecond,
+				UserAgent: "grpc-go/1.41.0",
+			},
+			line: `127.0.0.1 [25/Feb/2020:19:11:24 +0600] POST /event.EventService/Delete HTTP/2 404 3 "grpc-go/1.41.0"`,
+		},
+		{
+			name: "unknown client",
+			entry: Entry{
+				Start: start, Method: http.MethodPost, Target: "/events", Proto: "HTTP/1.1",
+				Status: http.StatusTooManyRequests, Latency: 1500 * time.Microsecond,
+			},
+			line: `- [25/Feb/2020:19:11:24 +0600] POST /events HTTP/1.1 429 1 "-"`,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.line, Line(tc.entry))
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for code, expected := range map[codes.Code]int{
+		codes.OK:                http.StatusOK,
+		codes.Canceled:          statusClientClosedRequest,
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.Unauthenticated:   http.StatusUnauthorized,
+		codes.NotFound:          http.StatusNotFound,
+		codes.Aborted:           http.StatusConflict,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Internal:          http.StatusInternalServerError,
+	} {
+		require.Equal(t, expected, HTTPStatus(code), code.String())
+	}
+}
@@ -0,0 +1,3 @@
+package internalgrpc
+
+//go:generate protoc -I ../../../api --go_out=paths=source_relative:pb --go-grpc_out=paths=source_relative:pb EventService.proto
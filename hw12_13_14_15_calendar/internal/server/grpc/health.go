@@ -0,0 +1,95 @@
+package internalgrpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthWatchInterval is how often Watch re-runs the readiness checks.
+const healthWatchInterval = 5 * time.Second
+
+// Health reports whether the process is ready to serve.
+type Health interface {
+	Ready(ctx context.Context) health.Report
+}
+
+// healthServer implements grpc.health.v1 on top of the readiness checks,
+// the empty service name and the event service share the status.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+
+	health   Health
+	closing  <-chan struct{}
+	interval time.Duration
+}
+
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if err := checkService(req.GetService()); err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: h.status(ctx)}, nil
+}
+
+// Watch sends the status whenever it changes. The stream ends with
+// NOT_SERVING when the server stops.
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if err := checkService(req.GetService()); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	for {
+		if current := h.status(ctx); current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.closing:
+			if last != healthpb.HealthCheckResponse_NOT_SERVING {
+				return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING})
+			}
+			return nil
+		}
+	}
+}
+
+func (h *healthServer) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	select {
+	case <-h.closing:
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	default:
+	}
+	if !h.health.Ready(ctx).Ready() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+func checkService(name string) error {
+	if name != "" && name != pb.EventService_ServiceDesc.ServiceName {
+		return status.Errorf(codes.NotFound, "unknown service %q", name)
+	}
+	return nil
+}
+
+// isHealthMethod tells health probes, which are made without a user.
+func isHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,274 @@
+package internalgrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/accesslog"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// loggingInterceptor writes an access log line per call in the layout of
+// accesslog.Line, as a POST of the full method over HTTP/2:
+//
+//	127.0.0.1 [25/Feb/2020:19:11:24 +0600] POST /event.EventService/Delete HTTP/2 404 3 "grpc-go/1.41.0"
+//
+// The status is the HTTP status of the gRPC code, the code itself goes to
+// the "code" field.
+func loggingInterceptor(logger Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		logger.Info(accessLogLine(ctx, info.FullMethod, start, err), "code", status.Code(err).String())
+
+		return resp, err
+	}
+}
+
+// streamLoggingInterceptor writes the same line as loggingInterceptor when
+// a stream ends, the latency is the duration of the stream.
+func streamLoggingInterceptor(logger Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		logger.Info(accessLogLine(ss.Context(), info.FullMethod, start, err), "code", status.Code(err).String())
+
+		return err
+	}
+}
+
+// metricsInterceptor records every call with its status code.
+func metricsInterceptor(metrics Metrics) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		metrics.ObserveGRPCCall(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return resp, err
+	}
+}
+
+// streamMetricsInterceptor records a stream when it ends.
+func streamMetricsInterceptor(metrics Metrics) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		metrics.ObserveGRPCCall(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return err
+	}
+}
+
+// tracingInterceptor records a server span per call, continuing the trace
+// of the caller when the metadata carries one.
+func tracingInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer endServerSpan(span, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// streamTracingInterceptor records a span lasting as long as the stream.
+func streamTracingInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		ctx, span := startServerSpan(ss.Context(), info.FullMethod)
+		defer endServerSpan(span, &err)
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func startServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	name := strings.TrimPrefix(fullMethod, "/")
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
+	}
+	return tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+func endServerSpan(span trace.Span, err *error) {
+	code := status.Code(*err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	tracing.End(span, *err)
+}
+
+// metadataCarrier lets propagators read incoming metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// identityInterceptor puts the user of the x-user-id metadata into the call
+// context, calls without it fail with UNAUTHENTICATED. Handlers trust the
+// user and leave checking access to events to the application. Health
+// checks need no user.
+func identityInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if isHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := withCallUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamIdentityInterceptor does what identityInterceptor does for streams.
+func streamIdentityInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if isHealthMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, err := withCallUser(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextStream replaces the context of the stream, e.g. with one carrying
+// the user.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func withCallUser(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(UserIDKey); len(values) > 0 && values[0] != "" {
+		return app.WithUser(ctx, values[0]), nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing "+UserIDKey+" metadata")
+}
+
+func accessLogLine(ctx context.Context, method string, start time.Time, err error) string {
+	var userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+
+	return accesslog.Line(accesslog.Entry{
+		ClientIP:  clientIP(ctx),
+		Start:     start,
+		Method:    http.MethodPost,
+		Target:    method,
+		Proto:     "HTTP/2",
+		Status:    accesslog.HTTPStatus(status.Code(err)),
+		Latency:   time.Since(start),
+		UserAgent: userAgent,
+	})
+}
+
+// clientIP prefers the originating client from x-forwarded-for metadata and
+// falls back to the peer address. The metadata is not checked, so the
+// address is only good for logs, see Limits for rate limiting.
+func clientIP(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-forwarded-for"); len(values) > 0 {
+			first := strings.TrimSpace(strings.Split(values[0], ",")[0])
+			if ip := net.ParseIP(first); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "-"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,101 @@
+package internalgrpc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterKey is the header metadata key telling a rate limited client
+// how many seconds to wait before retrying.
+const RetryAfterKey = "retry-after"
+
+var errRateLimited = status.Error(codes.ResourceExhausted, "rate limit exceeded")
+
+// RateLimiter tells whether a call of key may be served now and, when it
+// may not, how long the client should wait.
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// Limits protect the service from clients sending too much. Zero values
+// turn the limits off.
+type Limits struct {
+	// User limits calls per user.
+	User RateLimiter
+	// IP limits calls per client address, including ones without a user.
+	IP RateLimiter
+	// TrustedProxies may report the client address in x-forwarded-for
+	// metadata, otherwise calls are limited by the peer address.
+	TrustedProxies ratelimit.Proxies
+	// MaxBodyBytes caps the size of received messages.
+	MaxBodyBytes int64
+}
+
+// rateLimitInterceptor fails calls denied by limiter with RESOURCE_EXHAUSTED
+// and the retry-after header. A nil limiter allows everything, health
+// checks are never limited.
+func rateLimitInterceptor(limiter RateLimiter, key func(context.Context) string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if limiter == nil || isHealthMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if ok, wait := limiter.Allow(key(ctx)); !ok {
+			_ = grpc.SetHeader(ctx, retryAfter(wait))
+			return nil, errRateLimited
+		}
+		return handler(ctx, req)
+	}
+}
+
+// streamRateLimitInterceptor does what rateLimitInterceptor does for streams.
+func streamRateLimitInterceptor(limiter RateLimiter, key func(context.Context) string) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if limiter == nil || isHealthMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		if ok, wait := limiter.Allow(key(ss.Context())); !ok {
+			_ = ss.SetHeader(retryAfter(wait))
+			return errRateLimited
+		}
+		return handler(srv, ss)
+	}
+}
+
+// limitedIP returns the client address calls are limited by.
+func (l Limits) limitedIP(ctx context.Context) string {
+	var peerAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return l.TrustedProxies.ClientIP(peerAddr, md.Get("x-forwarded-for"))
+}
+
+// retryAfter rounds wait up to whole seconds like the HTTP Retry-After
+// header, zero would invite an immediate retry.
+func retryAfter(wait time.Duration) metadata.MD {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return metadata.Pairs(RetryAfterKey, strconv.Itoa(seconds))
+}
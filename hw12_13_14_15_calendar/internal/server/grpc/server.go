@@ -0,0 +1,560 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserIDKey is the metadata key carrying the ID of the user on whose behalf
+// the call is made.
+const UserIDKey = "x-user-id"
+
+type Server struct {
+	pb.UnimplementedEventServiceServer
+
+	logger  Logger
+	app     Application
+	metrics Metrics
+	addr    string
+	server  *grpc.Server
+	// closing ends Watch streams, they never finish by themselves.
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Metrics records finished calls.
+type Metrics interface {
+	ObserveGRPCCall(method, code string, d time.Duration)
+}
+
+type Application interface {
+	CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (storage.Event, error)
+	DeleteEvent(ctx context.Context, id string, version int64) error
+	UpdateOccurrence(
+		ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+	) (storage.Event, error)
+	CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error
+	RespondEvent(ctx context.Context, id string, status storage.AttendeeStatus) (storage.Event, error)
+	ListDay(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListWeek(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListMonth(ctx context.Context, date time.Time) ([]storage.Event, error)
+	UserSettings(ctx context.Context) (storage.User, error)
+	UpdateUserSettings(ctx context.Context, u storage.User) (storage.User, error)
+	FreeBusy(ctx context.Context, q app.FreeBusyQuery) (app.FreeBusy, error)
+	SearchEvents(ctx context.Context, q storage.SearchQuery, pageToken string) (app.SearchResult, error)
+	Subscribe(ctx context.Context, after uint64) (*app.Subscription, error)
+}
+
+func NewServer(logger Logger, app Application, metrics Metrics, health Health, limits Limits, addr string) *Server {
+	s := &Server{
+		logger:  logger,
+		app:     app,
+		metrics: metrics,
+		addr:    addr,
+		closing: make(chan struct{}),
+	}
+	// Clients are limited by address before the user is known.
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			loggingInterceptor(logger), metricsInterceptor(metrics), tracingInterceptor(),
+			rateLimitInterceptor(limits.IP, limits.limitedIP), identityInterceptor(),
+			rateLimitInterceptor(limits.User, callUser),
+		),
+		grpc.ChainStreamInterceptor(
+			streamLoggingInterceptor(logger), streamMetricsInterceptor(metrics), streamTracingInterceptor(),
+			streamRateLimitInterceptor(limits.IP, limits.limitedIP), streamIdentityInterceptor(),
+			streamRateLimitInterceptor(limits.User, callUser),
+		),
+	}
+	if limits.MaxBodyBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(limits.MaxBodyBytes)))
+	}
+	s.server = grpc.NewServer(opts...)
+	pb.RegisterEventServiceServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, &healthServer{health: health, closing: s.closing, interval: healthWatchInterval})
+
+	return s
+}
+
+// Start serves calls until Stop is called.
+func (s *Server) Start(_ context.Context) error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(l)
+}
+
+func (s *Server) serve(l net.Listener) error {
+	s.logger.Info("grpc server is listening", "addr", l.Addr().String())
+
+	if err := s.server.Serve(l); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Stop reports NOT_SERVING to health checks, waits for active calls
+// to finish and closes connections forcibly when ctx is done first.
+func (s *Server) Stop(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) Create(ctx context.Context, req *pb.CreateRequest) (*pb.CreateResponse, error) {
+	e, err := eventFromPB(req.GetEvent())
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.app.CreateEvent(writeContext(ctx, req.GetAllowOverlap()), e)
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.CreateResponse{Event: eventToPB(created)}, nil
+}
+
+func (s *Server) Update(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	e, err := eventFromPB(req.GetEvent())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.app.UpdateEvent(
+		writeContext(ctx, req.GetAllowOverlap()), req.GetId(), e, req.GetVersion(),
+	)
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.UpdateResponse{Event: eventToPB(updated)}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.app.DeleteEvent(ctx, req.GetId(), req.GetVersion()); err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *Server) UpdateOccurrence(
+	ctx context.Context, req *pb.UpdateOccurrenceRequest,
+) (*pb.UpdateOccurrenceResponse, error) {
+	if err := req.GetRecurrenceId().CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "recurrence_id: "+err.Error())
+	}
+	e, err := eventFromPB(req.GetEvent())
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.app.UpdateOccurrence(
+		writeContext(ctx, req.GetAllowOverlap()), req.GetSeriesId(), req.GetRecurrenceId().AsTime(), e,
+	)
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.UpdateOccurrenceResponse{Event: eventToPB(updated)}, nil
+}
+
+func (s *Server) CancelOccurrence(
+	ctx context.Context, req *pb.CancelOccurrenceRequest,
+) (*pb.CancelOccurrenceResponse, error) {
+	if err := req.GetRecurrenceId().CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "recurrence_id: "+err.Error())
+	}
+
+	if err := s.app.CancelOccurrence(ctx, req.GetSeriesId(), req.GetRecurrenceId().AsTime()); err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.CancelOccurrenceResponse{}, nil
+}
+
+func (s *Server) Respond(ctx context.Context, req *pb.RespondRequest) (*pb.RespondResponse, error) {
+	e, err := s.app.RespondEvent(ctx, req.GetId(), attendeeStatusFromPB(req.GetStatus()))
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.RespondResponse{Event: eventToPB(e)}, nil
+}
+
+func (s *Server) ListDay(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	return s.list(ctx, req, s.app.ListDay)
+}
+
+func (s *Server) ListWeek(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	return s.list(ctx, req, s.app.ListWeek)
+}
+
+func (s *Server) ListMonth(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	return s.list(ctx, req, s.app.ListMonth)
+}
+
+type listFunc func(ctx context.Context, date time.Time) ([]storage.Event, error)
+
+func (s *Server) list(ctx context.Context, req *pb.ListRequest, fn listFunc) (*pb.ListResponse, error) {
+	if err := req.GetDate().CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "date: "+err.Error())
+	}
+
+	events, err := fn(ctx, req.GetDate().AsTime())
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	resp := &pb.ListResponse{Events: make([]*pb.Event, 0, len(events))}
+	for _, e := range events {
+		resp.Events = append(resp.Events, eventToPB(e))
+	}
+	return resp, nil
+}
+
+var searchSorts = map[pb.SearchSort]storage.SearchSort{
+	pb.SearchSort_SORT_START:      storage.SortByStart,
+	pb.SearchSort_SORT_START_DESC: storage.SortByStartDesc,
+	pb.SearchSort_SORT_TITLE:      storage.SortByTitle,
+}
+
+func (s *Server) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	sort, ok := searchSorts[req.GetSort()]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown sort %v", req.GetSort())
+	}
+	q := storage.SearchQuery{
+		OwnerID: req.GetOwnerId(),
+		Text:    req.GetText(),
+		Sort:    sort,
+		Limit:   int(req.GetPageSize()),
+	}
+	if req.From != nil {
+		if err := req.GetFrom().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "from: "+err.Error())
+		}
+		q.From = req.GetFrom().AsTime()
+	}
+	if req.To != nil {
+		if err := req.GetTo().CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "to: "+err.Error())
+		}
+		q.To = req.GetTo().AsTime()
+	}
+	switch req.GetNotification() {
+	case pb.NotificationFilter_NOTIFICATION_ANY:
+	case pb.NotificationFilter_NOTIFICATION_WITH, pb.NotificationFilter_NOTIFICATION_WITHOUT:
+		has := req.GetNotification() == pb.NotificationFilter_NOTIFICATION_WITH
+		q.HasNotification = &has
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown notification filter %v", req.GetNotification())
+	}
+
+	res, err := s.app.SearchEvents(ctx, q, req.GetPageToken())
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	resp := &pb.SearchResponse{Events: make([]*pb.Event, 0, len(res.Events)), NextPageToken: res.NextPageToken}
+	for _, e := range res.Events {
+		resp.Events = append(resp.Events, eventToPB(e))
+	}
+	return resp, nil
+}
+
+func (s *Server) GetSettings(ctx context.Context, _ *pb.GetSettingsRequest) (*pb.GetSettingsResponse, error) {
+	u, err := s.app.UserSettings(ctx)
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.GetSettingsResponse{Settings: settingsToPB(u)}, nil
+}
+
+func (s *Server) UpdateSettings(
+	ctx context.Context, req *pb.UpdateSettingsRequest,
+) (*pb.UpdateSettingsResponse, error) {
+	u, err := s.app.UpdateUserSettings(ctx, storage.User{
+		TimeZone:  req.GetTimeZone(),
+		WeekStart: time.Weekday(req.GetWeekStart()),
+	})
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	return &pb.UpdateSettingsResponse{Settings: settingsToPB(u)}, nil
+}
+
+func (s *Server) FreeBusy(ctx context.Context, req *pb.FreeBusyRequest) (*pb.FreeBusyResponse, error) {
+	if err := req.GetFrom().CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "from: "+err.Error())
+	}
+	if err := req.GetTo().CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "to: "+err.Error())
+	}
+	q := app.FreeBusyQuery{
+		UserIDs: req.GetUserIds(),
+		From:    req.GetFrom().AsTime(),
+		To:      req.GetTo().AsTime(),
+	}
+	var err error
+	if q.Duration, err = durationFromPB("duration", req.GetDuration()); err != nil {
+		return nil, err
+	}
+	if q.WorkStart, err = durationFromPB("work_start", req.GetWorkStart()); err != nil {
+		return nil, err
+	}
+	if q.WorkEnd, err = durationFromPB("work_end", req.GetWorkEnd()); err != nil {
+		return nil, err
+	}
+
+	fb, err := s.app.FreeBusy(ctx, q)
+	if err != nil {
+		return nil, s.appError(err)
+	}
+
+	resp := &pb.FreeBusyResponse{
+		Users: make([]*pb.UserBusy, 0, len(fb.Users)),
+		Free:  intervalsToPB(fb.Free),
+	}
+	for _, u := range fb.Users {
+		resp.Users = append(resp.Users, &pb.UserBusy{UserId: u.UserID, TimeZone: u.TimeZone, Busy: intervalsToPB(u.Busy)})
+	}
+	return resp, nil
+}
+
+// Watch sends changes until the client goes away or the server stops.
+func (s *Server) Watch(req *pb.WatchRequest, stream pb.EventService_WatchServer) error {
+	ctx := stream.Context()
+
+	sub, err := s.app.Subscribe(ctx, req.GetAfterId())
+	if err != nil {
+		return s.appError(err)
+	}
+	defer sub.Close()
+	// Headers tell the client that no change is missed from now on.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case c, ok := <-sub.Changes():
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return status.FromContextError(err).Err()
+				}
+				return s.appError(sub.Err())
+			}
+			if err := stream.Send(changeToPB(c)); err != nil {
+				return err
+			}
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "server is stopping")
+		}
+	}
+}
+
+// appError maps business errors to gRPC statuses.
+func (s *Server) appError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrInvalidEvent), errors.Is(err, storage.ErrInvalidUser),
+		errors.Is(err, app.ErrInvalidFreeBusy), errors.Is(err, storage.ErrInvalidSearch):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrEventNotFound), errors.Is(err, storage.ErrAttendeeNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrDateBusy), errors.Is(err, storage.ErrEventExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, storage.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, app.ErrNoUser):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, app.ErrChangesExpired):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, app.ErrSlowSubscriber), errors.Is(err, app.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		s.logger.Error("call failed", "error", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// callUser returns the user put into the call context by identityInterceptor.
+func callUser(ctx context.Context) string {
+	userID, _ := app.UserFromContext(ctx)
+	return userID
+}
+
+// writeContext returns ctx letting the written event overlap others if allowOverlap is set.
+func writeContext(ctx context.Context, allowOverlap bool) context.Context {
+	if allowOverlap {
+		return storage.WithOverlap(ctx)
+	}
+	return ctx
+}
+
+func eventFromPB(data *pb.EventData) (storage.Event, error) {
+	if data == nil {
+		return storage.Event{}, status.Error(codes.InvalidArgument, "event is required")
+	}
+	if err := data.GetStartAt().CheckValid(); err != nil {
+		return storage.Event{}, status.Error(codes.InvalidArgument, "start_at: "+err.Error())
+	}
+	if err := data.GetEndAt().CheckValid(); err != nil {
+		return storage.Event{}, status.Error(codes.InvalidArgument, "end_at: "+err.Error())
+	}
+
+	e := storage.Event{
+		Title:       data.GetTitle(),
+		StartAt:     data.GetStartAt().AsTime(),
+		EndAt:       data.GetEndAt().AsTime(),
+		Description: data.GetDescription(),
+		TimeZone:    data.GetTimeZone(),
+		RRule:       data.GetRrule(),
+	}
+	for _, userID := range data.GetAttendees() {
+		e.Attendees = append(e.Attendees, storage.Attendee{UserID: userID})
+	}
+	if data.GetNotifyBefore() != nil {
+		if err := data.GetNotifyBefore().CheckValid(); err != nil {
+			return storage.Event{}, status.Error(codes.InvalidArgument, "notify_before: "+err.Error())
+		}
+		e.NotifyBefore = data.GetNotifyBefore().AsDuration()
+	}
+
+	return e, nil
+}
+
+func eventToPB(e storage.Event) *pb.Event {
+	res := &pb.Event{
+		Id:          e.ID,
+		Title:       e.Title,
+		StartAt:     timestamppb.New(e.StartAt),
+		EndAt:       timestamppb.New(e.EndAt),
+		Description: e.Description,
+		UserId:      e.UserID,
+		TimeZone:    e.TimeZone,
+		Rrule:       e.RRule,
+		SeriesId:    e.SeriesID,
+		Version:     e.Version,
+	}
+	if e.NotifyBefore > 0 {
+		res.NotifyBefore = durationpb.New(e.NotifyBefore)
+	}
+	for _, ex := range e.ExDates {
+		res.Exdates = append(res.Exdates, timestamppb.New(ex))
+	}
+	if !e.RecurrenceID.IsZero() {
+		res.RecurrenceId = timestamppb.New(e.RecurrenceID)
+	}
+	if len(e.Attendees) > 0 {
+		for _, a := range e.Attendees {
+			res.Attendees = append(res.Attendees, &pb.Attendee{UserId: a.UserID, Status: attendeeStatusToPB(a.Status)})
+		}
+		r := e.Responses()
+		res.Responses = &pb.Responses{
+			NeedsAction: int32(r.NeedsAction),
+			Accepted:    int32(r.Accepted),
+			Declined:    int32(r.Declined),
+			Tentative:   int32(r.Tentative),
+		}
+	}
+	return res
+}
+
+var attendeeStatuses = map[storage.AttendeeStatus]pb.AttendeeStatus{
+	storage.NeedsAction: pb.AttendeeStatus_NEEDS_ACTION,
+	storage.Accepted:    pb.AttendeeStatus_ACCEPTED,
+	storage.Declined:    pb.AttendeeStatus_DECLINED,
+	storage.Tentative:   pb.AttendeeStatus_TENTATIVE,
+}
+
+func attendeeStatusToPB(status storage.AttendeeStatus) pb.AttendeeStatus {
+	return attendeeStatuses[status]
+}
+
+// attendeeStatusFromPB returns an invalid status for unknown values, so the app rejects them.
+func attendeeStatusFromPB(status pb.AttendeeStatus) storage.AttendeeStatus {
+	for res, value := range attendeeStatuses {
+		if value == status {
+			return res
+		}
+	}
+	return storage.AttendeeStatus(status.String())
+}
+
+func settingsToPB(u storage.User) *pb.Settings {
+	return &pb.Settings{
+		UserId:    u.ID,
+		TimeZone:  u.TimeZone,
+		WeekStart: pb.Weekday(u.WeekStart),
+	}
+}
+
+// durationFromPB returns zero for an unset duration.
+func durationFromPB(name string, d *durationpb.Duration) (time.Duration, error) {
+	if d == nil {
+		return 0, nil
+	}
+	if err := d.CheckValid(); err != nil {
+		return 0, status.Error(codes.InvalidArgument, name+": "+err.Error())
+	}
+	return d.AsDuration(), nil
+}
+
+func intervalsToPB(intervals []app.Interval) []*pb.Interval {
+	res := make([]*pb.Interval, 0, len(intervals))
+	for _, in := range intervals {
+		res = append(res, &pb.Interval{Start: timestamppb.New(in.Start), End: timestamppb.New(in.End)})
+	}
+	return res
+}
+
+var changeTypes = map[app.ChangeType]pb.ChangeType{
+	app.ChangeCreated: pb.ChangeType_CREATED,
+	app.ChangeUpdated: pb.ChangeType_UPDATED,
+	app.ChangeDeleted: pb.ChangeType_DELETED,
+}
+
+func changeToPB(c app.Change) *pb.Change {
+	return &pb.Change{Id: c.ID, Type: changeTypes[c.Type], Event: eventToPB(c.Event)}
+}
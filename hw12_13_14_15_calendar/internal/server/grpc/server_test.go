@@ -0,0 +1,837 @@
+package internalgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/grpc/pb"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing/tracingtest"
+	"github.com/stretchr/testify/require"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) add(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *testLogger) Debug(msg string, _ ...interface{}) { l.add(msg) }
+func (l *testLogger) Info(msg string, _ ...interface{})  { l.add(msg) }
+func (l *testLogger) Warn(msg string, _ ...interface{})  { l.add(msg) }
+func (l *testLogger) Error(msg string, _ ...interface{}) { l.add(msg) }
+
+func (l *testLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
+
+func newTestClient(t *testing.T) (pb.EventServiceClient, *testLogger) {
+	t.Helper()
+	return newTestClientWithMetrics(t, metrics.New())
+}
+
+func newTestClientWithMetrics(t *testing.T, m Metrics) (pb.EventServiceClient, *testLogger) {
+	t.Helper()
+
+	conn, _, logg := startTestServer(t, m, health.New(health.Version{}))
+	return pb.NewEventServiceClient(conn), logg
+}
+
+// startTestServer serves calls over an in-memory listener until the test ends.
+func startTestServer(t *testing.T, m Metrics, h Health) (*grpc.ClientConn, *Server, *testLogger) {
+	t.Helper()
+
+	logg := &testLogger{}
+	s := NewServer(logg, app.New(logg, memorystorage.New(), app.Options{}), m, h, Limits{}, "")
+	return serveTestServer(t, s), s, logg
+}
+
+// serveTestServer serves calls of s over an in-memory listener until the test ends.
+func serveTestServer(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	go func() {
+		_ = s.serve(l)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Stop(ctx)
+	})
+
+	return conn
+}
+
+func withUser(userID string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), UserIDKey, userID)
+}
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func eventData(title string, start time.Time, d time.Duration) *pb.EventData {
+	return &pb.EventData{
+		Title:        title,
+		StartAt:      timestamppb.New(start),
+		EndAt:        timestamppb.New(start.Add(d)),
+		Description:  "description",
+		NotifyBefore: durationpb.New(15 * time.Minute),
+	}
+}
+
+func TestEventService(t *testing.T) {
+	client, logg := newTestClient(t)
+	ctx := withUser("alice")
+
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.GetEvent().GetId())
+	require.Equal(t, "alice", created.GetEvent().GetUserId())
+	require.Equal(t, 15*time.Minute, created.GetEvent().GetNotifyBefore().AsDuration())
+	require.True(t, baseTime.Equal(created.GetEvent().GetStartAt().AsTime()))
+
+	updated, err := client.Update(ctx, &pb.UpdateRequest{
+		Id:    created.GetEvent().GetId(),
+		Event: eventData("retro", baseTime.Add(time.Hour), time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "retro", updated.GetEvent().GetTitle())
+
+	lists := map[string]func(context.Context, *pb.ListRequest, ...grpc.CallOption) (*pb.ListResponse, error){
+		"day":   client.ListDay,
+		"week":  client.ListWeek,
+		"month": client.ListMonth,
+	}
+	for name, list := range lists {
+		resp, err := list(ctx, &pb.ListRequest{Date: timestamppb.New(baseTime)})
+		require.NoError(t, err, name)
+		require.Len(t, resp.GetEvents(), 1, name)
+		require.Equal(t, created.GetEvent().GetId(), resp.GetEvents()[0].GetId())
+	}
+
+	resp, err := client.ListDay(withUser("bob"), &pb.ListRequest{Date: timestamppb.New(baseTime)})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetEvents())
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: created.GetEvent().GetId()})
+	require.NoError(t, err)
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: created.GetEvent().GetId()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	logLine := regexp.MustCompile(
+		`^\S+ \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] POST /event\.EventService/Delete HTTP/2 404 \d+ "grpc-go/[^"]+"$`,
+	)
+	found := false
+	for _, msg := range logg.messages() {
+		if logLine.MatchString(msg) {
+			found = true
+		}
+	}
+	require.True(t, found, "access log line not found in %v", logg.messages())
+}
+
+func TestEventServiceVersions(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), created.GetEvent().GetVersion())
+	id := created.GetEvent().GetId()
+
+	updated, err := client.Update(ctx, &pb.UpdateRequest{
+		Id: id, Event: eventData("retro", baseTime, time.Hour), Version: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), updated.GetEvent().GetVersion())
+
+	_, err = client.Update(ctx, &pb.UpdateRequest{Id: id, Event: eventData("stale", baseTime, time.Hour), Version: 1})
+	require.Equal(t, codes.Aborted, status.Code(err))
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: id, Version: 1})
+	require.Equal(t, codes.Aborted, status.Code(err))
+
+	day, err := client.ListDay(ctx, &pb.ListRequest{Date: timestamppb.New(baseTime)})
+	require.NoError(t, err)
+	require.Len(t, day.GetEvents(), 1)
+	require.Equal(t, "retro", day.GetEvents()[0].GetTitle())
+	require.Equal(t, int64(2), day.GetEvents()[0].GetVersion())
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: id, Version: 2})
+	require.NoError(t, err)
+}
+
+func TestEventServiceOccurrences(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	data := eventData("standup", baseTime, 30*time.Minute)
+	data.Rrule = "FREQ=DAILY;COUNT=5"
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: data})
+	require.NoError(t, err)
+	series := created.GetEvent()
+	require.Equal(t, data.Rrule, series.GetRrule())
+	require.Nil(t, series.GetRecurrenceId())
+
+	second := timestamppb.New(baseTime.AddDate(0, 0, 1))
+	edited, err := client.UpdateOccurrence(ctx, &pb.UpdateOccurrenceRequest{
+		SeriesId:     series.GetId(),
+		RecurrenceId: second,
+		Event:        eventData("planning", baseTime.AddDate(0, 0, 1).Add(time.Hour), time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, series.GetId(), edited.GetEvent().GetSeriesId())
+	require.True(t, second.AsTime().Equal(edited.GetEvent().GetRecurrenceId().AsTime()))
+
+	_, err = client.CancelOccurrence(ctx, &pb.CancelOccurrenceRequest{
+		SeriesId:     series.GetId(),
+		RecurrenceId: timestamppb.New(baseTime.AddDate(0, 0, 2)),
+	})
+	require.NoError(t, err)
+
+	resp, err := client.ListWeek(ctx, &pb.ListRequest{Date: timestamppb.New(baseTime)})
+	require.NoError(t, err)
+	titles := make([]string, 0, len(resp.GetEvents()))
+	for _, e := range resp.GetEvents() {
+		titles = append(titles, e.GetTitle())
+	}
+	require.Equal(t, []string{"standup", "planning", "standup", "standup"}, titles)
+	require.Len(t, resp.GetEvents()[0].GetExdates(), 2)
+
+	_, err = client.CancelOccurrence(ctx, &pb.CancelOccurrenceRequest{
+		SeriesId:     series.GetId(),
+		RecurrenceId: timestamppb.New(baseTime.AddDate(0, 0, 2)),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.CancelOccurrence(withUser("bob"), &pb.CancelOccurrenceRequest{
+		SeriesId:     series.GetId(),
+		RecurrenceId: timestamppb.New(baseTime.AddDate(0, 0, 3)),
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.UpdateOccurrence(ctx, &pb.UpdateOccurrenceRequest{
+		SeriesId: series.GetId(),
+		Event:    eventData("planning", baseTime, time.Hour),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestEventServiceOverlap(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	_, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+
+	overlapping := eventData("sync", baseTime.Add(30*time.Minute), time.Hour)
+	_, err = client.Create(ctx, &pb.CreateRequest{Event: overlapping})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: overlapping, AllowOverlap: true})
+	require.NoError(t, err)
+
+	moved := eventData("sync", baseTime, time.Hour)
+	_, err = client.Update(ctx, &pb.UpdateRequest{Id: created.GetEvent().GetId(), Event: moved})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.Update(ctx, &pb.UpdateRequest{Id: created.GetEvent().GetId(), Event: moved, AllowOverlap: true})
+	require.NoError(t, err)
+}
+
+func TestEventServiceSettings(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	got, err := client.GetSettings(ctx, &pb.GetSettingsRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "alice", got.GetSettings().GetUserId())
+	require.Equal(t, pb.Weekday_SUNDAY, got.GetSettings().GetWeekStart())
+
+	updated, err := client.UpdateSettings(ctx, &pb.UpdateSettingsRequest{
+		TimeZone:  "America/New_York",
+		WeekStart: pb.Weekday_MONDAY,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", updated.GetSettings().GetTimeZone())
+	require.Equal(t, pb.Weekday_MONDAY, updated.GetSettings().GetWeekStart())
+
+	// 23:00 on 7 November in New York is 04:00 UTC the next day, the fall-back day lasts 25 hours.
+	start := time.Date(2021, time.November, 8, 4, 0, 0, 0, time.UTC)
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("late", start, 30*time.Minute)})
+	require.NoError(t, err)
+	require.Equal(t, "America/New_York", created.GetEvent().GetTimeZone())
+
+	day := timestamppb.New(time.Date(2021, time.November, 7, 0, 0, 0, 0, time.UTC))
+	resp, err := client.ListDay(ctx, &pb.ListRequest{Date: day})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+
+	_, err = client.UpdateSettings(ctx, &pb.UpdateSettingsRequest{TimeZone: "Mars/Olympus"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateSettings(ctx, &pb.UpdateSettingsRequest{WeekStart: pb.Weekday(9)})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	data := eventData("zoned", baseTime, time.Hour)
+	data.TimeZone = "Mars/Olympus"
+	_, err = client.Create(ctx, &pb.CreateRequest{Event: data})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestEventServiceAttendees(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	data := eventData("planning", baseTime, time.Hour)
+	data.Attendees = []string{"bob", "carol"}
+	created, err := client.Create(withUser("alice"), &pb.CreateRequest{Event: data})
+	require.NoError(t, err)
+	require.Len(t, created.GetEvent().GetAttendees(), 2)
+	require.Equal(t, int32(2), created.GetEvent().GetResponses().GetNeedsAction())
+	id := created.GetEvent().GetId()
+
+	list, err := client.ListDay(withUser("bob"), &pb.ListRequest{Date: timestamppb.New(baseTime)})
+	require.NoError(t, err)
+	require.Len(t, list.GetEvents(), 1)
+
+	resp, err := client.Respond(withUser("bob"), &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus_ACCEPTED})
+	require.NoError(t, err)
+	require.Equal(t, pb.AttendeeStatus_ACCEPTED, resp.GetEvent().GetAttendees()[0].GetStatus())
+	resp, err = client.Respond(withUser("carol"), &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus_TENTATIVE})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), resp.GetEvent().GetResponses().GetAccepted())
+	require.Equal(t, int32(1), resp.GetEvent().GetResponses().GetTentative())
+
+	tests := []struct {
+		name string
+		user string
+		req  *pb.RespondRequest
+		code codes.Code
+	}{
+		{"not invited", "dave", &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus_ACCEPTED}, codes.NotFound},
+		{"no response", "bob", &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus_NEEDS_ACTION}, codes.InvalidArgument},
+		{"unknown status", "bob", &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus(9)}, codes.InvalidArgument},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.Respond(withUser(tc.user), tc.req)
+			require.Equal(t, tc.code, status.Code(err))
+		})
+	}
+
+	_, err = client.Update(withUser("bob"), &pb.UpdateRequest{Id: id, Event: eventData("mine", baseTime, time.Hour)})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestEventServiceWatch(t *testing.T) {
+	client, logg := newTestClient(t)
+	ctx, cancel := context.WithCancel(withUser("alice"))
+	defer cancel()
+
+	watch := func(afterID uint64) pb.EventService_WatchClient {
+		stream, err := client.Watch(ctx, &pb.WatchRequest{AfterId: afterID})
+		require.NoError(t, err)
+		_, err = stream.Header()
+		require.NoError(t, err)
+		return stream
+	}
+	stream := watch(0)
+
+	created, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	change, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), change.GetId())
+	require.Equal(t, pb.ChangeType_CREATED, change.GetType())
+	require.Equal(t, created.GetEvent().GetId(), change.GetEvent().GetId())
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: created.GetEvent().GetId()})
+	require.NoError(t, err)
+	change, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, pb.ChangeType_DELETED, change.GetType())
+
+	resumed := watch(1)
+	change, err = resumed.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), change.GetId())
+
+	expired, err := client.Watch(ctx, &pb.WatchRequest{AfterId: 42})
+	require.NoError(t, err)
+	_, err = expired.Recv()
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+
+	anonymous, err := client.Watch(context.Background(), &pb.WatchRequest{})
+	require.NoError(t, err)
+	_, err = anonymous.Recv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	cancel()
+	_, err = stream.Recv()
+	require.Equal(t, codes.Canceled, status.Code(err))
+
+	require.Eventually(t, func() bool {
+		for _, msg := range logg.messages() {
+			if regexp.MustCompile(`POST /event\.EventService/Watch HTTP/2 400 \d+ `).MatchString(msg) {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond, "streams are logged")
+}
+
+func TestEventServiceFreeBusy(t *testing.T) {
+	client, _ := newTestClient(t)
+	for user, zone := range map[string]string{"alice": "Europe/Berlin", "bob": "America/New_York"} {
+		_, err := client.UpdateSettings(withUser(user), &pb.UpdateSettingsRequest{TimeZone: zone})
+		require.NoError(t, err)
+	}
+	day := time.Date(2021, time.June, 14, 0, 0, 0, 0, time.UTC)
+	_, err := client.Create(withUser("alice"), &pb.CreateRequest{Event: eventData("lunch", day.Add(10*time.Hour), time.Hour)})
+	require.NoError(t, err)
+	_, err = client.Create(withUser("bob"), &pb.CreateRequest{Event: eventData("sync", day.Add(14*time.Hour), time.Hour)})
+	require.NoError(t, err)
+
+	// Working hours are 8:00 to 16:00 UTC in Berlin and 14:00 to 22:00 UTC in New York.
+	req := &pb.FreeBusyRequest{
+		UserIds:   []string{"alice", "bob"},
+		From:      timestamppb.New(day),
+		To:        timestamppb.New(day.AddDate(0, 0, 1)),
+		Duration:  durationpb.New(45 * time.Minute),
+		WorkStart: durationpb.New(10 * time.Hour),
+		WorkEnd:   durationpb.New(18 * time.Hour),
+	}
+	resp, err := client.FreeBusy(withUser("carol"), req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetUsers(), 2)
+	require.Equal(t, "Europe/Berlin", resp.GetUsers()[0].GetTimeZone())
+	require.Len(t, resp.GetUsers()[0].GetBusy(), 1)
+	require.Equal(t, day.Add(10*time.Hour), resp.GetUsers()[0].GetBusy()[0].GetStart().AsTime())
+	require.Len(t, resp.GetFree(), 1)
+	require.Equal(t, day.Add(15*time.Hour), resp.GetFree()[0].GetStart().AsTime())
+	require.Equal(t, day.Add(16*time.Hour), resp.GetFree()[0].GetEnd().AsTime())
+
+	_, err = client.FreeBusy(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.FreeBusy(withUser("carol"), &pb.FreeBusyRequest{UserIds: []string{"alice"}, From: req.GetFrom()})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.FreeBusy(withUser("carol"), &pb.FreeBusyRequest{
+		UserIds: []string{"alice"},
+		From:    req.GetTo(),
+		To:      req.GetFrom(),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestEventServiceSearch(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	ids := make([]string, 0, 3)
+	for i, title := range []string{"Daily standup", "Code review", "Standup notes"} {
+		created, err := client.Create(ctx, &pb.CreateRequest{
+			Event: eventData(title, baseTime.Add(time.Duration(i)*time.Hour), time.Hour),
+		})
+		require.NoError(t, err)
+		ids = append(ids, created.GetEvent().GetId())
+	}
+	_, err := client.Create(withUser("bob"), &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+
+	req := &pb.SearchRequest{Text: "standup", Sort: pb.SearchSort_SORT_START_DESC, PageSize: 1}
+	resp, err := client.Search(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+	require.Equal(t, ids[2], resp.GetEvents()[0].GetId())
+	require.NotEmpty(t, resp.GetNextPageToken())
+
+	req.PageToken = resp.GetNextPageToken()
+	resp, err = client.Search(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 1)
+	require.Equal(t, ids[0], resp.GetEvents()[0].GetId())
+	require.Empty(t, resp.GetNextPageToken())
+
+	resp, err = client.Search(ctx, &pb.SearchRequest{
+		From:         timestamppb.New(baseTime.Add(30 * time.Minute)),
+		To:           timestamppb.New(baseTime.Add(2 * time.Hour)),
+		Notification: pb.NotificationFilter_NOTIFICATION_WITH,
+		Sort:         pb.SearchSort_SORT_TITLE,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetEvents(), 2)
+	require.Equal(t, ids[1], resp.GetEvents()[0].GetId())
+	require.Equal(t, ids[0], resp.GetEvents()[1].GetId())
+
+	resp, err = client.Search(ctx, &pb.SearchRequest{Notification: pb.NotificationFilter_NOTIFICATION_WITHOUT})
+	require.NoError(t, err)
+	require.Empty(t, resp.GetEvents())
+
+	_, err = client.Search(context.Background(), &pb.SearchRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	for _, bad := range []*pb.SearchRequest{
+		{PageToken: "abc"},
+		{PageSize: -1},
+		{Sort: pb.SearchSort(42)},
+		{Notification: pb.NotificationFilter(42)},
+		{From: timestamppb.New(baseTime), To: timestamppb.New(baseTime)},
+		{Sort: pb.SearchSort_SORT_TITLE, PageToken: req.GetPageToken()},
+	} {
+		_, err = client.Search(ctx, bad)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), bad.String())
+	}
+}
+
+func TestEventServiceIsolation(t *testing.T) {
+	client, _ := newTestClient(t)
+	data := eventData("standup", baseTime, 30*time.Minute)
+	data.Rrule = "FREQ=DAILY"
+	data.Attendees = []string{"carol"}
+	created, err := client.Create(withUser("alice"), &pb.CreateRequest{Event: data})
+	require.NoError(t, err)
+	id := created.GetEvent().GetId()
+	occurrence := timestamppb.New(baseTime.AddDate(0, 0, 1))
+	update := eventData("hijacked", baseTime, time.Hour)
+
+	tests := []struct {
+		name   string
+		userID string
+		call   func(ctx context.Context) error
+		code   codes.Code
+	}{
+		{"update", "bob", func(ctx context.Context) error {
+			_, err := client.Update(ctx, &pb.UpdateRequest{Id: id, Event: update})
+			return err
+		}, codes.NotFound},
+		{"delete", "bob", func(ctx context.Context) error {
+			_, err := client.Delete(ctx, &pb.DeleteRequest{Id: id})
+			return err
+		}, codes.NotFound},
+		{"respond", "bob", func(ctx context.Context) error {
+			_, err := client.Respond(ctx, &pb.RespondRequest{Id: id, Status: pb.AttendeeStatus_ACCEPTED})
+			return err
+		}, codes.NotFound},
+		{"update occurrence", "bob", func(ctx context.Context) error {
+			_, err := client.UpdateOccurrence(ctx, &pb.UpdateOccurrenceRequest{
+				SeriesId: id, RecurrenceId: occurrence, Event: update,
+			})
+			return err
+		}, codes.NotFound},
+		{"cancel occurrence", "bob", func(ctx context.Context) error {
+			_, err := client.CancelOccurrence(ctx, &pb.CancelOccurrenceRequest{SeriesId: id, RecurrenceId: occurrence})
+			return err
+		}, codes.NotFound},
+		// Attendees see the event but may only respond to it.
+		{"attendee update", "carol", func(ctx context.Context) error {
+			_, err := client.Update(ctx, &pb.UpdateRequest{Id: id, Event: update})
+			return err
+		}, codes.NotFound},
+		{"attendee delete", "carol", func(ctx context.Context) error {
+			_, err := client.Delete(ctx, &pb.DeleteRequest{Id: id})
+			return err
+		}, codes.NotFound},
+		{"attendee cancel occurrence", "carol", func(ctx context.Context) error {
+			_, err := client.CancelOccurrence(ctx, &pb.CancelOccurrenceRequest{SeriesId: id, RecurrenceId: occurrence})
+			return err
+		}, codes.NotFound},
+		{"no user", "", func(ctx context.Context) error {
+			_, err := client.ListDay(ctx, &pb.ListRequest{Date: timestamppb.New(baseTime)})
+			return err
+		}, codes.Unauthenticated},
+		{"no user stream", "", func(ctx context.Context) error {
+			stream, err := client.Watch(ctx, &pb.WatchRequest{})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.Unauthenticated},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.userID != "" {
+				ctx = withUser(tc.userID)
+			}
+			require.Equal(t, tc.code, status.Code(tc.call(ctx)))
+		})
+	}
+
+	for user, visible := range map[string]bool{"alice": true, "bob": false, "carol": true} {
+		list, err := client.ListWeek(withUser(user), &pb.ListRequest{Date: timestamppb.New(baseTime)})
+		require.NoError(t, err)
+		require.Equal(t, visible, len(list.GetEvents()) > 0, user)
+		found, err := client.Search(withUser(user), &pb.SearchRequest{})
+		require.NoError(t, err)
+		require.Equal(t, visible, len(found.GetEvents()) > 0, user)
+	}
+	list, err := client.ListDay(withUser("alice"), &pb.ListRequest{Date: timestamppb.New(baseTime.AddDate(0, 0, 1))})
+	require.NoError(t, err)
+	require.Len(t, list.GetEvents(), 1)
+	require.Equal(t, "standup", list.GetEvents()[0].GetTitle())
+}
+
+func TestEventServiceMetrics(t *testing.T) {
+	m := metrics.New()
+	client, _ := newTestClientWithMetrics(t, m)
+
+	_, err := client.Create(withUser("alice"), &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	_, err = client.Delete(withUser("alice"), &pb.DeleteRequest{Id: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Delete(context.Background(), &pb.DeleteRequest{Id: "missing"})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	stream, err := client.Watch(context.Background(), &pb.WatchRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ts := httptest.NewServer(m.Handler())
+	defer ts.Close()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	body := string(data)
+	for _, line := range []string{
+		`calendar_grpc_requests_total{code="OK",method="/event.EventService/Create"} 1`,
+		`calendar_grpc_requests_total{code="NotFound",method="/event.EventService/Delete"} 1`,
+		`calendar_grpc_requests_total{code="Unauthenticated",method="/event.EventService/Delete"} 1`,
+		`calendar_grpc_requests_total{code="Unauthenticated",method="/event.EventService/Watch"} 1`,
+		`calendar_grpc_request_duration_seconds_count{method="/event.EventService/Delete"} 2`,
+	} {
+		require.Contains(t, body, line)
+	}
+}
+
+func TestEventServiceErrors(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := withUser("alice")
+
+	existing, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{"missing user", func() error {
+			_, err := client.Create(context.Background(), &pb.CreateRequest{Event: eventData("a", baseTime, time.Hour)})
+			return err
+		}, codes.Unauthenticated},
+		{"missing event", func() error {
+			_, err := client.Create(ctx, &pb.CreateRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"missing start", func() error {
+			data := eventData("a", baseTime, time.Hour)
+			data.StartAt = nil
+			_, err := client.Create(ctx, &pb.CreateRequest{Event: data})
+			return err
+		}, codes.InvalidArgument},
+		{"empty title", func() error {
+			_, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("", baseTime.Add(5*time.Hour), time.Hour)})
+			return err
+		}, codes.InvalidArgument},
+		{"date busy", func() error {
+			_, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("a", baseTime, time.Hour)})
+			return err
+		}, codes.AlreadyExists},
+		{"update foreign", func() error {
+			_, err := client.Update(withUser("bob"), &pb.UpdateRequest{
+				Id:    existing.GetEvent().GetId(),
+				Event: eventData("a", baseTime, time.Hour),
+			})
+			return err
+		}, codes.NotFound},
+		{"list without date", func() error {
+			_, err := client.ListWeek(ctx, &pb.ListRequest{})
+			return err
+		}, codes.InvalidArgument},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.code, status.Code(tc.call()))
+		})
+	}
+}
+
+func TestEventServiceTracing(t *testing.T) {
+	recorder := tracingtest.Record(t)
+	client, _ := newTestClient(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.AppendToOutgoingContext(withUser("alice"),
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	_, err := client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	_, err = client.Delete(withUser("alice"), &pb.DeleteRequest{Id: "missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	create := tracingtest.Find(t, recorder, "event.EventService/Create")
+	require.Equal(t, traceID, create.SpanContext().TraceID().String())
+	require.True(t, create.Parent().IsRemote())
+	require.Equal(t, trace.SpanKindServer, create.SpanKind())
+	require.Contains(t, create.Attributes(), semconv.RPCServiceKey.String("event.EventService"))
+	require.Contains(t, create.Attributes(), semconv.RPCMethodKey.String("Create"))
+	require.Contains(t, create.Attributes(), semconv.RPCGRPCStatusCodeOk)
+	require.Equal(t, otelcodes.Unset, create.Status().Code)
+
+	del := tracingtest.Find(t, recorder, "event.EventService/Delete")
+	require.NotEqual(t, traceID, del.SpanContext().TraceID().String())
+	require.Contains(t, del.Attributes(), semconv.RPCGRPCStatusCodeNotFound)
+	require.Equal(t, otelcodes.Error, del.Status().Code)
+}
+
+func TestHealthService(t *testing.T) {
+	h := health.New(health.Version{})
+	var storageErr error
+	var mu sync.Mutex
+	h.AddCheck("storage", func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return storageErr
+	})
+	setStorageErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		storageErr = err
+	}
+
+	conn, s, _ := startTestServer(t, metrics.New(), h)
+	client := healthpb.NewHealthClient(conn)
+	ctx := context.Background()
+
+	// Probes are made without a user.
+	for _, service := range []string{"", pb.EventService_ServiceDesc.ServiceName} {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown.Service"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	setStorageErr(errors.New("connection refused"))
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+	setStorageErr(nil)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	first, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, first.GetStatus())
+
+	// Stopping the server reports NOT_SERVING to watchers before they are closed.
+	stopped := make(chan error, 1)
+	go func() {
+		stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		stopped <- s.Stop(stopCtx)
+	}()
+	last, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, last.GetStatus())
+	_, err = stream.Recv()
+	require.ErrorIs(t, err, io.EOF)
+	require.NoError(t, <-stopped)
+}
+
+func TestEventServiceLimits(t *testing.T) {
+	logg := &testLogger{}
+	calendar := app.New(logg, memorystorage.New(), app.Options{MaxEvents: 1})
+	limits := Limits{User: ratelimit.New(0.001, 2), IP: ratelimit.New(0.001, 10), MaxBodyBytes: 1024}
+	s := NewServer(logg, calendar, metrics.New(), health.New(health.Version{}), limits, "")
+	conn := serveTestServer(t, s)
+	client := pb.NewEventServiceClient(conn)
+
+	huge := eventData(strings.Repeat("x", 2048), baseTime, time.Hour)
+	_, err := client.Create(withUser("carol"), &pb.CreateRequest{Event: huge})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	ctx := withUser("alice")
+	_, err = client.Create(ctx, &pb.CreateRequest{Event: eventData("standup", baseTime, time.Hour)})
+	require.NoError(t, err)
+	_, err = client.Create(ctx, &pb.CreateRequest{Event: eventData("retro", baseTime.Add(time.Hour), time.Hour)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), app.ErrQuotaExceeded.Error())
+
+	var header metadata.MD
+	_, err = client.ListDay(ctx, &pb.ListRequest{Date: timestamppb.New(baseTime)}, grpc.Header(&header))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, "rate limit exceeded", status.Convert(err).Message())
+	require.Equal(t, []string{"1000"}, header.Get(RetryAfterKey))
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// The address runs out too, health checks are not limited.
+	for i := 0; ; i++ {
+		_, err = client.ListDay(withUser("user"+strconv.Itoa(i)), &pb.ListRequest{Date: timestamppb.New(baseTime)})
+		if err != nil {
+			break
+		}
+		require.Less(t, i, 10)
+	}
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// x-forwarded-for of a peer which is not a trusted proxy is ignored.
+	forged := metadata.AppendToOutgoingContext(withUser("dave"), "x-forwarded-for", "198.51.100.1")
+	_, err = client.ListDay(forged, &pb.ListRequest{Date: timestamppb.New(baseTime)})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
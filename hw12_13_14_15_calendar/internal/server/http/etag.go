@@ -0,0 +1,51 @@
+package internalhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// etag is the entity tag of the event, its version in quotes like "3".
+func etag(e storage.Event) string {
+	return `"` + strconv.FormatInt(e.Version, 10) + `"`
+}
+
+// writeEvent writes the event with its version in the ETag header.
+func writeEvent(w http.ResponseWriter, status int, e storage.Event) {
+	w.Header().Set("ETag", etag(e))
+	writeJSON(w, status, newEventResponse(e))
+}
+
+// expectedVersion returns the version required by the If-Match header of a
+// write, storage.AnyVersion when there is no header or it is "*". Only a
+// single strong tag can be matched, anything else fails the precondition.
+func expectedVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return storage.AnyVersion, true
+	}
+	var version int64
+	if len(v) > 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		version, _ = strconv.ParseInt(v[1:len(v)-1], 10, 64)
+	}
+	if version < 1 {
+		writeError(w, http.StatusPreconditionFailed, "If-Match must be an ETag of the event like \"3\"")
+		return 0, false
+	}
+	return version, true
+}
+
+// noneMatch reports whether the If-None-Match header of r lists the tag,
+// weak tags match too.
+func noneMatch(r *http.Request, tag string) bool {
+	for _, v := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == tag {
+			return true
+		}
+	}
+	return false
+}
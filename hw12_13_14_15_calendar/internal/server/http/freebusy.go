@@ -0,0 +1,112 @@
+package internalhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+)
+
+const clockLayout = "15:04"
+
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type UserBusyResponse struct {
+	UserID   string     `json:"user_id"`
+	TimeZone string     `json:"time_zone"`
+	Busy     []Interval `json:"busy"`
+}
+
+type FreeBusyResponse struct {
+	Users []UserBusyResponse `json:"users"`
+	// Free holds the slots when all users are free within their working hours.
+	Free []Interval `json:"free"`
+}
+
+func newIntervals(intervals []app.Interval) []Interval {
+	res := make([]Interval, 0, len(intervals))
+	for _, in := range intervals {
+		res = append(res, Interval{Start: in.Start, End: in.End})
+	}
+	return res
+}
+
+func newFreeBusyResponse(fb app.FreeBusy) FreeBusyResponse {
+	res := FreeBusyResponse{
+		Users: make([]UserBusyResponse, 0, len(fb.Users)),
+		Free:  newIntervals(fb.Free),
+	}
+	for _, u := range fb.Users {
+		res.Users = append(res.Users, UserBusyResponse{UserID: u.UserID, TimeZone: u.TimeZone, Busy: newIntervals(u.Busy)})
+	}
+	return res
+}
+
+// freeBusy handles
+// GET /freebusy?user=a&user=b&from=...&to=...&duration=45m&work_start=10:00&work_end=18:00.
+// Users may be listed comma separated too. Working hours are taken in the
+// zone of every user, times are RFC 3339.
+func (h *handlers) freeBusy(w http.ResponseWriter, r *http.Request) {
+	q, err := parseFreeBusyQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fb, err := h.app.FreeBusy(r.Context(), q)
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newFreeBusyResponse(fb))
+}
+
+func parseFreeBusyQuery(r *http.Request) (app.FreeBusyQuery, error) {
+	query := r.URL.Query()
+	var q app.FreeBusyQuery
+	for _, users := range query["user"] {
+		q.UserIDs = append(q.UserIDs, strings.Split(users, ",")...)
+	}
+
+	var err error
+	if q.From, err = time.Parse(time.RFC3339, query.Get("from")); err != nil {
+		return q, fmt.Errorf("from must be a time like %s", time.RFC3339)
+	}
+	if q.To, err = time.Parse(time.RFC3339, query.Get("to")); err != nil {
+		return q, fmt.Errorf("to must be a time like %s", time.RFC3339)
+	}
+	if s := query.Get("duration"); s != "" {
+		if q.Duration, err = time.ParseDuration(s); err != nil {
+			return q, fmt.Errorf("duration must be like 45m: %w", err)
+		}
+	}
+	if q.WorkStart, err = parseClock(query.Get("work_start")); err != nil {
+		return q, fmt.Errorf("work_start: %w", err)
+	}
+	if q.WorkEnd, err = parseClock(query.Get("work_end")); err != nil {
+		return q, fmt.Errorf("work_end: %w", err)
+	}
+	return q, nil
+}
+
+// parseClock parses a time of day like "10:00" to the time since midnight,
+// "24:00" is the end of the day.
+func parseClock(s string) (time.Duration, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "24:00":
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, fmt.Errorf("time of day must be like %s", clockLayout)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
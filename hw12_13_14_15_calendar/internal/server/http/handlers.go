@@ -0,0 +1,435 @@
+package internalhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+const dateLayout = "2006-01-02"
+
+var errMissingUserID = errors.New("missing " + UserIDHeader + " header")
+
+type handlers struct {
+	logger Logger
+	app    Application
+	// closing is closed when the server shuts down to end event streams.
+	closing <-chan struct{}
+}
+
+// Duration is a time.Duration encoded as a string like "1h30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type EventRequest struct {
+	Title        string    `json:"title"`
+	StartAt      time.Time `json:"start_at"`
+	EndAt        time.Time `json:"end_at"`
+	Description  string    `json:"description,omitempty"`
+	NotifyBefore Duration  `json:"notify_before,omitempty"`
+	// TimeZone is an IANA zone name, the zone of the user when empty.
+	TimeZone string `json:"time_zone,omitempty"`
+	// RRule makes the event recurring, start_at and end_at describe its
+	// first occurrence. Occurrences keep their local time in TimeZone.
+	RRule string `json:"rrule,omitempty"`
+	// Attendees are IDs of invited users. Users who stay invited on update
+	// keep their responses, edited occurrences without attendees get the
+	// attendees of the series.
+	Attendees []string `json:"attendees,omitempty"`
+}
+
+func (r EventRequest) toEvent() storage.Event {
+	e := storage.Event{
+		Title:        r.Title,
+		StartAt:      r.StartAt,
+		EndAt:        r.EndAt,
+		Description:  r.Description,
+		NotifyBefore: time.Duration(r.NotifyBefore),
+		TimeZone:     r.TimeZone,
+		RRule:        r.RRule,
+	}
+	for _, userID := range r.Attendees {
+		e.Attendees = append(e.Attendees, storage.Attendee{UserID: userID})
+	}
+	return e
+}
+
+type EventResponse struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Title        string    `json:"title"`
+	StartAt      time.Time `json:"start_at"`
+	EndAt        time.Time `json:"end_at"`
+	Description  string    `json:"description,omitempty"`
+	NotifyBefore Duration  `json:"notify_before,omitempty"`
+	TimeZone     string    `json:"time_zone,omitempty"`
+
+	RRule   string      `json:"rrule,omitempty"`
+	ExDates []time.Time `json:"exdates,omitempty"`
+	// SeriesID is set on edited occurrences of a recurring event.
+	SeriesID string `json:"series_id,omitempty"`
+	// RecurrenceID is the original start of an occurrence of a recurring event.
+	RecurrenceID *time.Time `json:"recurrence_id,omitempty"`
+
+	Attendees []AttendeeResponse `json:"attendees,omitempty"`
+	// Responses counts attendees by status, it is set when anyone is invited.
+	Responses *ResponsesResponse `json:"responses,omitempty"`
+
+	// Version is increased by every change of the event, it is sent as the ETag too.
+	Version int64 `json:"version"`
+}
+
+type AttendeeResponse struct {
+	UserID string `json:"user_id"`
+	// Status is one of needs-action, accepted, declined and tentative.
+	Status string `json:"status"`
+}
+
+type ResponsesResponse struct {
+	NeedsAction int `json:"needs_action"`
+	Accepted    int `json:"accepted"`
+	Declined    int `json:"declined"`
+	Tentative   int `json:"tentative"`
+}
+
+func newEventResponse(e storage.Event) EventResponse {
+	resp := EventResponse{
+		ID:           e.ID,
+		UserID:       e.UserID,
+		Title:        e.Title,
+		StartAt:      e.StartAt,
+		EndAt:        e.EndAt,
+		Description:  e.Description,
+		NotifyBefore: Duration(e.NotifyBefore),
+		TimeZone:     e.TimeZone,
+		RRule:        e.RRule,
+		ExDates:      e.ExDates,
+		SeriesID:     e.SeriesID,
+		Version:      e.Version,
+	}
+	if !e.RecurrenceID.IsZero() {
+		resp.RecurrenceID = &e.RecurrenceID
+	}
+	if len(e.Attendees) > 0 {
+		for _, a := range e.Attendees {
+			resp.Attendees = append(resp.Attendees, AttendeeResponse{UserID: a.UserID, Status: string(a.Status)})
+		}
+		r := e.Responses()
+		resp.Responses = &ResponsesResponse{
+			NeedsAction: r.NeedsAction,
+			Accepted:    r.Accepted,
+			Declined:    r.Declined,
+			Tentative:   r.Tentative,
+		}
+	}
+	return resp
+}
+
+type EventsResponse struct {
+	Events []EventResponse `json:"events"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// RespondRequest answers an invitation with accepted, declined or tentative.
+type RespondRequest struct {
+	Status string `json:"status"`
+}
+
+// createEvent handles POST /events, ?allow_overlap=true stores the event
+// even if it overlaps other events of the user. So do PUT requests.
+func (h *handlers) createEvent(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := writeContext(w, r)
+	if !ok {
+		return
+	}
+	var req EventRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	e, err := h.app.CreateEvent(ctx, req.toEvent())
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeEvent(w, http.StatusCreated, e)
+}
+
+// updateEvent handles PUT /events/{id}, with If-Match the event is replaced
+// only if it has not been changed since the version in the ETag.
+func (h *handlers) updateEvent(w http.ResponseWriter, r *http.Request) {
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+	ctx, ok := writeContext(w, r)
+	if !ok {
+		return
+	}
+	var req EventRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	e, err := h.app.UpdateEvent(ctx, mux.Vars(r)["id"], req.toEvent(), version)
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeEvent(w, http.StatusOK, e)
+}
+
+// deleteEvent handles DELETE /events/{id}, If-Match is honoured like in updateEvent.
+func (h *handlers) deleteEvent(w http.ResponseWriter, r *http.Request) {
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.app.DeleteEvent(r.Context(), mux.Vars(r)["id"], version); err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateOccurrence handles PUT /events/{id}/occurrences/{recurrence_id}
+// where recurrence_id is the original start of the occurrence in RFC 3339.
+func (h *handlers) updateOccurrence(w http.ResponseWriter, r *http.Request) {
+	recurrenceID, ok := recurrenceID(w, r)
+	if !ok {
+		return
+	}
+	ctx, ok := writeContext(w, r)
+	if !ok {
+		return
+	}
+	var req EventRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	e, err := h.app.UpdateOccurrence(ctx, mux.Vars(r)["id"], recurrenceID, req.toEvent())
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeEvent(w, http.StatusOK, e)
+}
+
+func (h *handlers) cancelOccurrence(w http.ResponseWriter, r *http.Request) {
+	recurrenceID, ok := recurrenceID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.app.CancelOccurrence(r.Context(), mux.Vars(r)["id"], recurrenceID); err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondEvent handles PUT /events/{id}/response by an invited user.
+func (h *handlers) respondEvent(w http.ResponseWriter, r *http.Request) {
+	var req RespondRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	e, err := h.app.RespondEvent(r.Context(), mux.Vars(r)["id"], storage.AttendeeStatus(req.Status))
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeEvent(w, http.StatusOK, e)
+}
+
+// getEvent handles GET /events/{id}, it answers 304 Not Modified when
+// If-None-Match lists the current ETag of the event.
+func (h *handlers) getEvent(w http.ResponseWriter, r *http.Request) {
+	e, err := h.app.GetEvent(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+	if noneMatch(r, etag(e)) {
+		w.Header().Set("ETag", etag(e))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeEvent(w, http.StatusOK, e)
+}
+
+// listEvents handles GET /events?day=2021-06-14 (or week=, or month=).
+// The bounds of the period are taken in the time zone of the user.
+func (h *handlers) listEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var period string
+	for _, p := range []string{"day", "week", "month"} {
+		if query.Get(p) == "" {
+			continue
+		}
+		if period != "" {
+			writeError(w, http.StatusBadRequest, "only one of day, week or month must be set")
+			return
+		}
+		period = p
+	}
+	if period == "" {
+		writeError(w, http.StatusBadRequest, "one of day, week or month query parameters is required")
+		return
+	}
+
+	date, err := time.Parse(dateLayout, query.Get(period))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be a date like %s", period, dateLayout))
+		return
+	}
+
+	var events []storage.Event
+	switch period {
+	case "day":
+		events, err = h.app.ListDay(r.Context(), date)
+	case "week":
+		events, err = h.app.ListWeek(r.Context(), date)
+	case "month":
+		events, err = h.app.ListMonth(r.Context(), date)
+	}
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	resp := EventsResponse{Events: make([]EventResponse, 0, len(events))}
+	for _, e := range events {
+		resp.Events = append(resp.Events, newEventResponse(e))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// requestUser returns the user put into the request context by identityMiddleware.
+func requestUser(r *http.Request) string {
+	userID, _ := app.UserFromContext(r.Context())
+	return userID
+}
+
+// writeContext returns the request context carrying the allow_overlap query parameter.
+func writeContext(w http.ResponseWriter, r *http.Request) (context.Context, bool) {
+	v := r.URL.Query().Get("allow_overlap")
+	if v == "" {
+		return r.Context(), true
+	}
+	allow, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "allow_overlap must be true or false")
+		return nil, false
+	}
+	if !allow {
+		return r.Context(), true
+	}
+	return storage.WithOverlap(r.Context()), true
+}
+
+func recurrenceID(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, mux.Vars(r)["recurrence_id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "recurrence_id must be a time like "+time.RFC3339)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (h *handlers) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return false
+		}
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeAppError maps business errors to HTTP statuses.
+func (h *handlers) writeAppError(w http.ResponseWriter, err error) {
+	status := appErrorStatus(err)
+	writeError(w, status, h.appErrorMessage(status, err))
+}
+
+func appErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrInvalidEvent), errors.Is(err, storage.ErrInvalidUser),
+		errors.Is(err, app.ErrInvalidFreeBusy), errors.Is(err, storage.ErrInvalidSearch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, storage.ErrEventNotFound), errors.Is(err, storage.ErrAttendeeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrDateBusy), errors.Is(err, storage.ErrEventExists),
+		errors.Is(err, storage.ErrNotDeleted):
+		return http.StatusConflict
+	case errors.Is(err, storage.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, app.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, app.ErrNoUser):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// appErrorMessage hides and logs errors which are not caused by the request.
+func (h *handlers) appErrorMessage(status int, err error) string {
+	if status != http.StatusInternalServerError {
+		return err.Error()
+	}
+	h.logger.Error("request failed", "error", err)
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, ErrorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,77 @@
+package internalhttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+type RevisionResponse struct {
+	Version int64 `json:"version"`
+	// UserID is the user who made the change.
+	UserID string `json:"user_id"`
+	// Action is one of created, updated, deleted and restored.
+	Action  string                `json:"action"`
+	At      time.Time             `json:"at"`
+	Changes []FieldChangeResponse `json:"changes,omitempty"`
+}
+
+// FieldChangeResponse holds the old and the new value of an event field in
+// text form, times are in RFC 3339 and empty values mean unset.
+type FieldChangeResponse struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type HistoryResponse struct {
+	Revisions []RevisionResponse `json:"revisions"`
+}
+
+func newRevisionResponse(r storage.Revision) RevisionResponse {
+	resp := RevisionResponse{
+		Version: r.Version,
+		UserID:  r.UserID,
+		Action:  string(r.Action),
+		At:      r.At,
+	}
+	for _, c := range r.Changes {
+		resp.Changes = append(resp.Changes, FieldChangeResponse{Field: c.Field, Old: c.Old, New: c.New})
+	}
+	return resp
+}
+
+// eventHistory handles GET /events/{id}/history, deleted events keep their
+// history until they are purged.
+func (h *handlers) eventHistory(w http.ResponseWriter, r *http.Request) {
+	revisions, err := h.app.EventHistory(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	resp := HistoryResponse{Revisions: make([]RevisionResponse, 0, len(revisions))}
+	for _, rev := range revisions {
+		resp.Revisions = append(resp.Revisions, newRevisionResponse(rev))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// restoreEvent handles POST /events/{id}/restore of a deleted event, it
+// honours allow_overlap like createEvent.
+func (h *handlers) restoreEvent(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := writeContext(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := h.app.RestoreEvent(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeEvent(w, http.StatusOK, e)
+}
@@ -0,0 +1,87 @@
+package internalhttp
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ics"
+	"github.com/gorilla/mux"
+)
+
+type ImportResponse struct {
+	Events []EventResponse       `json:"events"`
+	Errors []ImportErrorResponse `json:"errors,omitempty"`
+}
+
+// ImportErrorResponse describes an event of the imported calendar which
+// was not stored. UID is the UID of the event in the calendar.
+type ImportErrorResponse struct {
+	UID          string     `json:"uid"`
+	RecurrenceID *time.Time `json:"recurrence_id,omitempty"`
+	Error        string     `json:"error"`
+}
+
+// exportCalendar handles GET /users/{id}/calendar.ics. Users can export their
+// own calendar only, other calendars are reported as not found.
+func (h *handlers) exportCalendar(w http.ResponseWriter, r *http.Request) {
+	if mux.Vars(r)["id"] != requestUser(r) {
+		writeError(w, http.StatusNotFound, "calendar not found")
+		return
+	}
+
+	events, err := h.app.ExportEvents(r.Context())
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+	data, err := ics.Marshal(events)
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// importCalendar handles POST /import with an iCalendar body. Events which
+// cannot be stored are listed in the response and do not fail the request.
+func (h *handlers) importCalendar(w http.ResponseWriter, r *http.Request) {
+	events, err := ics.NewDecoder(r.Body).Decode()
+	if err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if !errors.Is(err, ics.ErrInvalidCalendar) {
+			h.logger.Warn("failed to read calendar", "error", err)
+		}
+		writeError(w, http.StatusBadRequest, "invalid calendar: "+err.Error())
+		return
+	}
+
+	res, err := h.app.ImportEvents(r.Context(), events)
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	resp := ImportResponse{Events: make([]EventResponse, 0, len(res.Created))}
+	for _, e := range res.Created {
+		resp.Events = append(resp.Events, newEventResponse(e))
+	}
+	for _, f := range res.Failed {
+		errResp := ImportErrorResponse{
+			UID:   f.ID,
+			Error: h.appErrorMessage(appErrorStatus(f.Err), f.Err),
+		}
+		if !f.RecurrenceID.IsZero() {
+			recurrenceID := f.RecurrenceID
+			errResp.RecurrenceID = &recurrenceID
+		}
+		resp.Errors = append(resp.Errors, errResp)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
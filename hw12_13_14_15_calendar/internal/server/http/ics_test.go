@@ -0,0 +1,87 @@
+package internalhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ics"
+	"github.com/stretchr/testify/require"
+)
+
+func (c *apiClient) getCalendar(path, userID string) (int, string, []byte) {
+	c.t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, c.url+path, nil)
+	require.NoError(c.t, err)
+	req.Header.Set(UserIDHeader, userID)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+	return resp.StatusCode, resp.Header.Get("Content-Type"), body
+}
+
+func TestCalendarICS(t *testing.T) {
+	api := newTestAPI(t)
+
+	standup := eventRequest("standup", baseTime, 30*time.Minute)
+	standup.RRule = "FREQ=DAILY;COUNT=5"
+	var series EventResponse
+	require.Equal(t, http.StatusCreated, api.do(http.MethodPost, "/events", "alice", standup, &series))
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("retro", baseTime.Add(time.Hour), time.Hour), nil))
+	moved := eventRequest("planning", baseTime.AddDate(0, 0, 1).Add(2*time.Hour), time.Hour)
+	occurrence := "/events/" + series.ID + "/occurrences/" + baseTime.AddDate(0, 0, 1).Format(time.RFC3339)
+	require.Equal(t, http.StatusOK, api.do(http.MethodPut, occurrence, "alice", moved, nil))
+
+	status, contentType, data := api.getCalendar("/users/alice/calendar.ics", "alice")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, ics.ContentType, contentType)
+	events, err := ics.Unmarshal(data)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Contains(t, string(data), "RRULE:FREQ=DAILY;COUNT=5\r\n")
+	require.Contains(t, string(data), "TRIGGER:-PT15M\r\n")
+
+	status, _, _ = api.getCalendar("/users/alice/calendar.ics", "bob")
+	require.Equal(t, http.StatusNotFound, status)
+
+	var imported ImportResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodPost, "/import", "bob", string(data), &imported))
+	require.Len(t, imported.Events, 3)
+	require.Empty(t, imported.Errors)
+
+	var aliceWeek, bobWeek EventsResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events?week=2021-06-14", "alice", nil, &aliceWeek))
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events?week=2021-06-14", "bob", nil, &bobWeek))
+	require.Len(t, bobWeek.Events, len(aliceWeek.Events))
+	for i, e := range bobWeek.Events {
+		require.Equal(t, "bob", e.UserID)
+		require.Equal(t, aliceWeek.Events[i].Title, e.Title)
+		require.True(t, aliceWeek.Events[i].StartAt.Equal(e.StartAt))
+	}
+
+	// Importing the same calendar again collides with the imported events.
+	imported = ImportResponse{}
+	require.Equal(t, http.StatusOK, api.do(http.MethodPost, "/import", "bob", string(data), &imported))
+	require.Empty(t, imported.Events)
+	require.Len(t, imported.Errors, 3)
+	for _, e := range imported.Errors {
+		require.NotEmpty(t, e.UID)
+		require.NotEmpty(t, e.Error)
+	}
+	require.NotNil(t, imported.Errors[2].RecurrenceID)
+
+	var errResp ErrorResponse
+	require.Equal(t, http.StatusBadRequest,
+		api.do(http.MethodPost, "/import", "bob", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n", &errResp))
+	require.True(t, strings.HasPrefix(errResp.Error, "invalid calendar"))
+	require.Equal(t, http.StatusUnauthorized, api.do(http.MethodPost, "/import", "", string(data), &errResp))
+}
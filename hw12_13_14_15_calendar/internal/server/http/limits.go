@@ -0,0 +1,103 @@
+package internalhttp
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+)
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+// RateLimiter tells whether a request of key may be served now and, when it
+// may not, how long the client should wait.
+type RateLimiter interface {
+	Allow(key string) (bool, time.Duration)
+}
+
+// Limits protect the API from clients sending too much. Zero values turn
+// the limits off.
+type Limits struct {
+	// User limits requests per user.
+	User RateLimiter
+	// IP limits requests per client address, including ones without a user.
+	IP RateLimiter
+	// TrustedProxies may report the client address in X-Forwarded-For,
+	// otherwise requests are limited by the address of the connection.
+	TrustedProxies ratelimit.Proxies
+	// MaxBodyBytes caps the size of request bodies.
+	MaxBodyBytes int64
+}
+
+// rateLimitMiddleware answers 429 Too Many Requests with Retry-After when
+// limiter denies the key of the request. A nil limiter allows everything.
+func rateLimitMiddleware(limiter RateLimiter, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := limiter.Allow(key(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedIP returns the client address requests are limited by.
+func (l Limits) limitedIP(r *http.Request) string {
+	return l.TrustedProxies.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+}
+
+// retryAfterSeconds rounds wait up to whole seconds, Retry-After has no
+// finer resolution and zero would invite an immediate retry.
+func retryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// bodyLimitMiddleware rejects requests declaring a body above max bytes
+// and fails reads of longer bodies with errBodyTooLarge. Zero max turns
+// the limit off.
+func bodyLimitMiddleware(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				writeError(w, http.StatusRequestEntityTooLarge, errBodyTooLarge.Error())
+				return
+			}
+			r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, max), max: max}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody replaces the error of http.MaxBytesReader with errBodyTooLarge,
+// so handlers can tell it from malformed bodies.
+type limitedBody struct {
+	io.ReadCloser
+	max  int64
+	read int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && b.read >= b.max {
+		err = errBodyTooLarge
+	}
+	return n, err
+}
@@ -1,11 +1,161 @@
 package internalhttp
 
 import (
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/server/accesslog"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func loggingMiddleware(next http.Handler) http.Handler {
+// statusRecorder remembers the status code and the size of the response body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Flush lets handlers stream through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// loggingMiddleware writes an access log line per request in the layout of
+// accesslog.Line, the size of the response body goes to the "bytes" field.
+func loggingMiddleware(logger Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		logger.Info(accesslog.Line(accesslog.Entry{
+			ClientIP:  clientIP(r),
+			Start:     start,
+			Method:    r.Method,
+			Target:    r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Status:    rec.status,
+			Latency:   time.Since(start),
+			UserAgent: r.UserAgent(),
+		}), "bytes", rec.size)
+	})
+}
+
+// unmatchedRoute labels requests to unknown routes, so arbitrary paths do
+// not make new metric series.
+const unmatchedRoute = "unmatched"
+
+// metricsMiddleware records every request under the template of the route
+// of router it matches.
+func metricsMiddleware(metrics Metrics, router *mux.Router, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.ObserveHTTPRequest(routeTemplate(router, r), r.Method, rec.status, time.Since(start))
 	})
 }
+
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.MatchErr != nil || match.Route == nil {
+		return unmatchedRoute
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
+
+// tracingMiddleware records a server span per request named after the route
+// of router it matches, continuing the trace of the caller when the request
+// carries one.
+func tracingMiddleware(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeTemplate(router, r)
+		ctx, span := tracing.Tracer().Start(ctx, "HTTP "+r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("calendar", route, r)...),
+		)
+		defer span.End()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rec.status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(rec.status))
+	})
+}
+
+// identityMiddleware puts the user of the X-User-ID header into the request
+// context, requests without it are rejected. Handlers trust the user and
+// leave checking access to events to the application.
+func identityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Header.Get(UserIDHeader)
+		if userID == "" {
+			writeError(w, http.StatusUnauthorized, errMissingUserID.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(app.WithUser(r.Context(), userID)))
+	})
+}
+
+// clientIP prefers the originating client from X-Forwarded-For and falls
+// back to the remote address of the connection. The header is not checked,
+// so the address is only good for logs, see Limits for rate limiting.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first := strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		if ip := net.ParseIP(first); ip != nil {
+			return ip.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,170 @@
+package internalhttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/stretchr/testify/require"
+)
+
+type logRecord struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+type testLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *testLogger) add(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, args: args})
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.add("DEBUG", msg, args) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.add("INFO", msg, args) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.add("WARN", msg, args) }
+func (l *testLogger) Error(msg string, args ...interface{}) { l.add("ERROR", msg, args) }
+
+func (l *testLogger) last(t *testing.T) logRecord {
+	t.Helper()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	require.NotEmpty(t, l.records)
+	return l.records[len(l.records)-1]
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	timestamp := `\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		prepare func(r *http.Request)
+		line    string
+		bytes   int
+	}{
+		{
+			name: "default status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("hello world"))
+			},
+			prepare: func(r *http.Request) {
+				r.RemoteAddr = "66.249.65.3:53412"
+				r.Header.Set("User-Agent", "Mozilla/5.0")
+			},
+			line:  `^66\.249\.65\.3 ` + timestamp + ` GET /hello\?q=1 HTTP/1\.1 200 \d+ "Mozilla/5\.0"$`,
+			bytes: len("hello world"),
+		},
+		{
+			name: "explicit status without user agent",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			},
+			prepare: func(r *http.Request) {
+				r.RemoteAddr = "[::1]:53412"
+			},
+			line: `^::1 ` + timestamp + ` GET /hello\?q=1 HTTP/1\.1 418 \d+ "-"$`,
+		},
+		{
+			name: "forwarded for",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "not found", http.StatusNotFound)
+			},
+			prepare: func(r *http.Request) {
+				r.RemoteAddr = "10.0.0.1:53412"
+				r.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+				r.Header.Set("User-Agent", "curl/7.68.0")
+			},
+			line:  `^203\.0\.113\.7 ` + timestamp + ` GET /hello\?q=1 HTTP/1\.1 404 \d+ "curl/7\.68\.0"$`,
+			bytes: len("not found\n"),
+		},
+		{
+			name: "malformed forwarded for",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			prepare: func(r *http.Request) {
+				r.RemoteAddr = "10.0.0.1:53412"
+				r.Header.Set("X-Forwarded-For", "unknown")
+			},
+			line: `^10\.0\.0\.1 ` + timestamp + ` GET /hello\?q=1 HTTP/1\.1 204 \d+ "-"$`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			logg := &testLogger{}
+			handler := loggingMiddleware(logg, tc.handler)
+
+			r := httptest.NewRequest(http.MethodGet, "/hello?q=1", nil)
+			tc.prepare(r)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			record := logg.last(t)
+			require.Equal(t, "INFO", record.level)
+			require.Regexp(t, regexp.MustCompile(tc.line), record.msg)
+			require.Equal(t, []interface{}{"bytes", tc.bytes}, record.args)
+		})
+	}
+
+	t.Run("latency in milliseconds", func(t *testing.T) {
+		logg := &testLogger{}
+		handler := loggingMiddleware(logg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+		}))
+
+		r := httptest.NewRequest(http.MethodPost, "/events", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		var latency int
+		_, err := fmt.Sscanf(regexp.MustCompile(`HTTP/1\.1 200 (\d+) `).FindStringSubmatch(logg.last(t).msg)[1],
+			"%d", &latency)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, latency, 20)
+	})
+}
+
+func TestIdentityMiddleware(t *testing.T) {
+	handler := identityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := app.UserFromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(userID))
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		body   string
+	}{
+		{name: "user", header: "alice", status: http.StatusOK, body: "alice"},
+		{name: "missing", status: http.StatusUnauthorized, body: `{"error":"missing X-User-ID header"}` + "\n"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/events", nil)
+			if tc.header != "" {
+				r.Header.Set(UserIDHeader, tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.status, w.Code)
+			require.Equal(t, tc.body, w.Body.String())
+		})
+	}
+}
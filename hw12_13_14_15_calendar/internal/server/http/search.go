@@ -0,0 +1,75 @@
+package internalhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+type SearchResponse struct {
+	Events []EventResponse `json:"events"`
+	// NextPageToken is passed as page_token to get the next page, it is
+	// omitted on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// searchEvents handles
+// GET /events/search?q=standup&from=...&to=...&owner=alice&has_notification=true&sort=-start&limit=20&page_token=...
+// All parameters are optional, times are RFC 3339. Sort is start, -start or
+// title, recurring events are found by their series, not expanded.
+func (h *handlers) searchEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := h.app.SearchEvents(r.Context(), q, r.URL.Query().Get("page_token"))
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	resp := SearchResponse{Events: make([]EventResponse, 0, len(res.Events)), NextPageToken: res.NextPageToken}
+	for _, e := range res.Events {
+		resp.Events = append(resp.Events, newEventResponse(e))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseSearchQuery(r *http.Request) (storage.SearchQuery, error) {
+	query := r.URL.Query()
+	q := storage.SearchQuery{
+		OwnerID: query.Get("owner"),
+		Text:    query.Get("q"),
+		Sort:    storage.SearchSort(query.Get("sort")),
+	}
+
+	var err error
+	if s := query.Get("from"); s != "" {
+		if q.From, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("from must be a time like %s", time.RFC3339)
+		}
+	}
+	if s := query.Get("to"); s != "" {
+		if q.To, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, fmt.Errorf("to must be a time like %s", time.RFC3339)
+		}
+	}
+	if s := query.Get("has_notification"); s != "" {
+		has, err := strconv.ParseBool(s)
+		if err != nil {
+			return q, fmt.Errorf("has_notification must be true or false")
+		}
+		q.HasNotification = &has
+	}
+	if s := query.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return q, fmt.Errorf("limit must be a number")
+		}
+	}
+	return q, nil
+}
@@ -2,30 +2,174 @@ package internalhttp
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/gorilla/mux"
 )
 
-type Server struct { // TODO
+const readHeaderTimeout = 5 * time.Second
+
+// UserIDHeader carries the ID of the user on whose behalf the request is made.
+const UserIDHeader = "X-User-ID"
+
+type Server struct {
+	logger   Logger
+	app      Application
+	metrics  Metrics
+	health   Health
+	limits   Limits
+	server   *http.Server
+	stopOnce sync.Once
+	stopped  chan struct{}
+	// closing ends event streams, they never finish by themselves.
+	closeOnce sync.Once
+	closing   chan struct{}
 }
 
-type Logger interface { // TODO
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
 }
 
-type Application interface { // TODO
+// Metrics records served requests and exposes the metrics of the process at /metrics.
+type Metrics interface {
+	ObserveHTTPRequest(route, method string, status int, d time.Duration)
+	Handler() http.Handler
 }
 
-func NewServer(logger Logger, app Application) *Server {
-	return &Server{}
+// Health answers the probes of load balancers and orchestrators.
+type Health interface {
+	LiveHandler() http.Handler
+	ReadyHandler() http.Handler
+	VersionHandler() http.Handler
 }
 
-func (s *Server) Start(ctx context.Context) error {
-	// TODO
-	<-ctx.Done()
-	return nil
+type Application interface {
+	CreateEvent(ctx context.Context, e storage.Event) (storage.Event, error)
+	UpdateEvent(ctx context.Context, id string, e storage.Event, version int64) (storage.Event, error)
+	DeleteEvent(ctx context.Context, id string, version int64) error
+	RestoreEvent(ctx context.Context, id string) (storage.Event, error)
+	EventHistory(ctx context.Context, id string) ([]storage.Revision, error)
+	GetEvent(ctx context.Context, id string) (storage.Event, error)
+	RespondEvent(ctx context.Context, id string, status storage.AttendeeStatus) (storage.Event, error)
+	UpdateOccurrence(
+		ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+	) (storage.Event, error)
+	CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error
+	ExportEvents(ctx context.Context) ([]storage.Event, error)
+	ImportEvents(ctx context.Context, events []storage.Event) (app.ImportResult, error)
+	ListDay(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListWeek(ctx context.Context, date time.Time) ([]storage.Event, error)
+	ListMonth(ctx context.Context, date time.Time) ([]storage.Event, error)
+	UserSettings(ctx context.Context) (storage.User, error)
+	UpdateUserSettings(ctx context.Context, u storage.User) (storage.User, error)
+	FreeBusy(ctx context.Context, q app.FreeBusyQuery) (app.FreeBusy, error)
+	SearchEvents(ctx context.Context, q storage.SearchQuery, pageToken string) (app.SearchResult, error)
+	Subscribe(ctx context.Context, after uint64) (*app.Subscription, error)
 }
 
-func (s *Server) Stop(ctx context.Context) error {
-	// TODO
-	return nil
+func NewServer(logger Logger, app Application, metrics Metrics, health Health, limits Limits, addr string) *Server {
+	s := &Server{
+		logger:  logger,
+		app:     app,
+		metrics: metrics,
+		health:  health,
+		limits:  limits,
+		stopped: make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s
 }
 
-// TODO
+// Handler returns the API routes wrapped with middlewares.
+func (s *Server) Handler() http.Handler {
+	h := &handlers{logger: s.logger, app: s.app, closing: s.closing}
+
+	r := mux.NewRouter()
+	r.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+	r.Handle("/healthz", s.health.LiveHandler()).Methods(http.MethodGet)
+	r.Handle("/readyz", s.health.ReadyHandler()).Methods(http.MethodGet)
+	r.Handle("/version", s.health.VersionHandler()).Methods(http.MethodGet)
+
+	// API routes require a user, unknown routes are answered without one.
+	// Clients are limited by address before the user is known.
+	api := r.NewRoute().Subrouter()
+	api.Use(
+		rateLimitMiddleware(s.limits.IP, s.limits.limitedIP),
+		identityMiddleware,
+		rateLimitMiddleware(s.limits.User, requestUser),
+		bodyLimitMiddleware(s.limits.MaxBodyBytes),
+	)
+	api.HandleFunc("/events", h.createEvent).Methods(http.MethodPost)
+	api.HandleFunc("/events", h.listEvents).Methods(http.MethodGet)
+	api.HandleFunc("/events/stream", h.streamEvents).Methods(http.MethodGet)
+	api.HandleFunc("/events/search", h.searchEvents).Methods(http.MethodGet)
+	api.HandleFunc("/events/{id}", h.getEvent).Methods(http.MethodGet)
+	api.HandleFunc("/events/{id}", h.updateEvent).Methods(http.MethodPut)
+	api.HandleFunc("/events/{id}", h.deleteEvent).Methods(http.MethodDelete)
+	api.HandleFunc("/events/{id}/response", h.respondEvent).Methods(http.MethodPut)
+	api.HandleFunc("/events/{id}/restore", h.restoreEvent).Methods(http.MethodPost)
+	api.HandleFunc("/events/{id}/history", h.eventHistory).Methods(http.MethodGet)
+	api.HandleFunc("/events/{id}/occurrences/{recurrence_id}", h.updateOccurrence).Methods(http.MethodPut)
+	api.HandleFunc("/events/{id}/occurrences/{recurrence_id}", h.cancelOccurrence).Methods(http.MethodDelete)
+	api.HandleFunc("/users/{id}/calendar.ics", h.exportCalendar).Methods(http.MethodGet)
+	api.HandleFunc("/users/{id}/settings", h.getSettings).Methods(http.MethodGet)
+	api.HandleFunc("/users/{id}/settings", h.updateSettings).Methods(http.MethodPut)
+	api.HandleFunc("/import", h.importCalendar).Methods(http.MethodPost)
+	api.HandleFunc("/freebusy", h.freeBusy).Methods(http.MethodGet)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "route not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+
+	return loggingMiddleware(s.logger, metricsMiddleware(s.metrics, r, tracingMiddleware(r, r)))
+}
+
+// Start serves requests until Stop is called. It returns only after Stop
+// has drained active connections, so the caller may exit right after it.
+func (s *Server) Start(_ context.Context) error {
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(l)
+}
+
+func (s *Server) serve(l net.Listener) error {
+	s.logger.Info("http server is listening", "addr", l.Addr().String())
+
+	err := s.server.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-s.stopped
+		return nil
+	}
+	return err
+}
+
+// Stop stops accepting connections and waits for active requests to finish
+// until ctx is done.
+func (s *Server) Stop(ctx context.Context) error {
+	defer s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+	return s.server.Shutdown(ctx)
+}
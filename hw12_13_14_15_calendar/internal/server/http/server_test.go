@@ -0,0 +1,921 @@
+package internalhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/ratelimit"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing/tracingtest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type apiClient struct {
+	t   *testing.T
+	url string
+}
+
+func newTestAPI(t *testing.T) *apiClient {
+	t.Helper()
+
+	logg := &testLogger{}
+	calendar := app.New(logg, memorystorage.New(), app.Options{})
+	ts := httptest.NewServer(NewServer(logg, calendar, metrics.New(), health.New(health.Version{}), Limits{}, "").Handler())
+	t.Cleanup(ts.Close)
+
+	return &apiClient{t: t, url: ts.URL}
+}
+
+func (c *apiClient) do(method, path, userID string, body interface{}, out interface{}) int {
+	c.t.Helper()
+
+	status, _ := c.doWithHeader(method, path, userID, nil, body, out)
+	return status
+}
+
+// doWithHeader sends the request with extra headers and returns the status
+// and headers of the response.
+func (c *apiClient) doWithHeader(
+	method, path, userID string, header http.Header, body interface{}, out interface{},
+) (int, http.Header) {
+	c.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		require.NoError(c.t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, c.url+path, reader)
+	require.NoError(c.t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if userID != "" {
+		req.Header.Set(UserIDHeader, userID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+
+	if out != nil {
+		require.Equal(c.t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(c.t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode, resp.Header
+}
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func eventRequest(title string, start time.Time, d time.Duration) EventRequest {
+	return EventRequest{
+		Title:        title,
+		StartAt:      start,
+		EndAt:        start.Add(d),
+		Description:  "description",
+		NotifyBefore: Duration(15 * time.Minute),
+	}
+}
+
+func TestEventsAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var created EventResponse
+	status := api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &created)
+	require.Equal(t, http.StatusCreated, status)
+	require.NotEmpty(t, created.ID)
+	require.Equal(t, "alice", created.UserID)
+	require.Equal(t, "standup", created.Title)
+	require.Equal(t, Duration(15*time.Minute), created.NotifyBefore)
+
+	var got EventResponse
+	status = api.do(http.MethodGet, "/events/"+created.ID, "alice", nil, &got)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, created, got)
+
+	var updated EventResponse
+	req := eventRequest("retro", baseTime.Add(time.Hour), time.Hour)
+	status = api.do(http.MethodPut, "/events/"+created.ID, "alice", req, &updated)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, created.ID, updated.ID)
+	require.Equal(t, "retro", updated.Title)
+
+	for _, query := range []string{"day=2021-06-14", "week=2021-06-14", "month=2021-06-01"} {
+		var list EventsResponse
+		status = api.do(http.MethodGet, "/events?"+query, "alice", nil, &list)
+		require.Equal(t, http.StatusOK, status, query)
+		require.Len(t, list.Events, 1, query)
+		require.Equal(t, updated.ID, list.Events[0].ID)
+	}
+
+	var list EventsResponse
+	status = api.do(http.MethodGet, "/events?day=2021-06-15", "alice", nil, &list)
+	require.Equal(t, http.StatusOK, status)
+	require.Empty(t, list.Events)
+
+	status = api.do(http.MethodDelete, "/events/"+created.ID, "alice", nil, nil)
+	require.Equal(t, http.StatusNoContent, status)
+
+	var errResp ErrorResponse
+	status = api.do(http.MethodGet, "/events/"+created.ID, "alice", nil, &errResp)
+	require.Equal(t, http.StatusNotFound, status)
+	require.NotEmpty(t, errResp.Error)
+}
+
+func TestEventsAPIErrors(t *testing.T) {
+	api := newTestAPI(t)
+
+	var existing EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &existing))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID string
+		body   interface{}
+		status int
+	}{
+		{"missing user", http.MethodPost, "/events", "", eventRequest("a", baseTime, time.Hour), http.StatusUnauthorized},
+		{"date busy", http.MethodPost, "/events", "alice", eventRequest("a", baseTime, time.Hour), http.StatusConflict},
+		{"bad allow_overlap", http.MethodPost, "/events?allow_overlap=maybe", "alice", eventRequest("a", baseTime, time.Hour), http.StatusBadRequest},
+		{"overlap not allowed", http.MethodPost, "/events?allow_overlap=false", "alice", eventRequest("a", baseTime, time.Hour), http.StatusConflict},
+		{"empty title", http.MethodPost, "/events", "alice", eventRequest("", baseTime, time.Hour), http.StatusUnprocessableEntity},
+		{"invalid period", http.MethodPost, "/events", "alice", eventRequest("a", baseTime, -time.Hour), http.StatusUnprocessableEntity},
+		{"malformed json", http.MethodPost, "/events", "alice", `{"title":`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/events", "alice", `{"name":"a"}`, http.StatusBadRequest},
+		{"bad duration", http.MethodPost, "/events", "alice", `{"title":"a","notify_before":15}`, http.StatusBadRequest},
+		{"update missing", http.MethodPut, "/events/missing", "alice", eventRequest("a", baseTime, time.Hour), http.StatusNotFound},
+		{"update foreign", http.MethodPut, "/events/" + existing.ID, "bob", eventRequest("a", baseTime, time.Hour), http.StatusNotFound},
+		{"delete foreign", http.MethodDelete, "/events/" + existing.ID, "bob", nil, http.StatusNotFound},
+		{"get foreign", http.MethodGet, "/events/" + existing.ID, "bob", nil, http.StatusNotFound},
+		{"list without period", http.MethodGet, "/events", "alice", nil, http.StatusBadRequest},
+		{"list with two periods", http.MethodGet, "/events?day=2021-06-14&week=2021-06-14", "alice", nil, http.StatusBadRequest},
+		{"list bad date", http.MethodGet, "/events?day=14.06.2021", "alice", nil, http.StatusBadRequest},
+		{"unknown route", http.MethodGet, "/unknown", "alice", nil, http.StatusNotFound},
+		{"method not allowed", http.MethodPatch, "/events", "alice", nil, http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(tc.method, tc.path, tc.userID, tc.body, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+
+	t.Run("other users do not see events", func(t *testing.T) {
+		var list EventsResponse
+		require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events?day=2021-06-14", "bob", nil, &list))
+		require.Empty(t, list.Events)
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		var created EventResponse
+		req := eventRequest("sync", baseTime.Add(30*time.Minute), time.Hour)
+		require.Equal(t, http.StatusCreated, api.do(http.MethodPost, "/events?allow_overlap=true", "alice", req, &created))
+
+		req.StartAt = baseTime
+		require.Equal(t, http.StatusConflict, api.do(http.MethodPut, "/events/"+created.ID, "alice", req, nil))
+		require.Equal(t, http.StatusOK, api.do(http.MethodPut, "/events/"+created.ID+"?allow_overlap=1", "alice", req, nil))
+	})
+}
+
+func TestUserIsolationAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := eventRequest("standup", baseTime, 30*time.Minute)
+	req.RRule = "FREQ=DAILY"
+	req.Attendees = []string{"carol"}
+	var series EventResponse
+	require.Equal(t, http.StatusCreated, api.do(http.MethodPost, "/events", "alice", req, &series))
+	var deleted EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("retro", baseTime.Add(time.Hour), time.Hour), &deleted))
+	require.Equal(t, http.StatusNoContent, api.do(http.MethodDelete, "/events/"+deleted.ID, "alice", nil, nil))
+
+	event := "/events/" + series.ID
+	occurrence := event + "/occurrences/" + baseTime.AddDate(0, 0, 1).Format(time.RFC3339)
+	update := eventRequest("hijacked", baseTime, time.Hour)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID string
+		body   interface{}
+		status int
+	}{
+		{"get", http.MethodGet, event, "bob", nil, http.StatusNotFound},
+		{"update", http.MethodPut, event, "bob", update, http.StatusNotFound},
+		{"delete", http.MethodDelete, event, "bob", nil, http.StatusNotFound},
+		{"respond", http.MethodPut, event + "/response", "bob", RespondRequest{Status: "accepted"}, http.StatusNotFound},
+		{"history", http.MethodGet, event + "/history", "bob", nil, http.StatusNotFound},
+		{"history of deleted", http.MethodGet, "/events/" + deleted.ID + "/history", "bob", nil, http.StatusNotFound},
+		{"restore", http.MethodPost, "/events/" + deleted.ID + "/restore", "bob", nil, http.StatusNotFound},
+		{"update occurrence", http.MethodPut, occurrence, "bob", update, http.StatusNotFound},
+		{"cancel occurrence", http.MethodDelete, occurrence, "bob", nil, http.StatusNotFound},
+		{"export", http.MethodGet, "/users/alice/calendar.ics", "bob", nil, http.StatusNotFound},
+		{"settings", http.MethodGet, "/users/alice/settings", "bob", nil, http.StatusNotFound},
+		{"update settings", http.MethodPut, "/users/alice/settings", "bob", SettingsRequest{TimeZone: "UTC"}, http.StatusNotFound},
+		// Attendees see the event but may only respond to it.
+		{"attendee update", http.MethodPut, event, "carol", update, http.StatusNotFound},
+		{"attendee delete", http.MethodDelete, event, "carol", nil, http.StatusNotFound},
+		{"attendee cancel occurrence", http.MethodDelete, occurrence, "carol", nil, http.StatusNotFound},
+		{"attendee restore", http.MethodPost, "/events/" + deleted.ID + "/restore", "carol", nil, http.StatusNotFound},
+		{"no user", http.MethodGet, event, "", nil, http.StatusUnauthorized},
+		{"no user on unknown route", http.MethodGet, "/unknown", "", nil, http.StatusNotFound},
+		{"no user on wrong method", http.MethodPatch, event, "", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(tc.method, tc.path, tc.userID, tc.body, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+
+	lists := []string{"/events?day=2021-06-14", "/events?month=2021-06-01", "/events/search"}
+	for _, path := range lists {
+		var list SearchResponse
+		require.Equal(t, http.StatusOK, api.do(http.MethodGet, path, "bob", nil, &list), path)
+		require.Empty(t, list.Events, path)
+		require.Equal(t, http.StatusOK, api.do(http.MethodGet, path, "carol", nil, &list), path)
+		require.NotEmpty(t, list.Events, path)
+	}
+
+	var got EventResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, event, "carol", nil, &got))
+	require.Equal(t, series, got)
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, event, "alice", nil, &got))
+	require.Equal(t, series, got)
+}
+
+func TestEventVersionsAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var created EventResponse
+	status, header := api.doWithHeader(http.MethodPost, "/events", "alice", nil,
+		eventRequest("standup", baseTime, time.Hour), &created)
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, int64(1), created.Version)
+	require.Equal(t, `"1"`, header.Get("ETag"))
+	path := "/events/" + created.ID
+
+	t.Run("not modified", func(t *testing.T) {
+		status, header := api.doWithHeader(http.MethodGet, path, "alice",
+			http.Header{"If-None-Match": {`"0", W/"1"`}}, nil, nil)
+		require.Equal(t, http.StatusNotModified, status)
+		require.Equal(t, `"1"`, header.Get("ETag"))
+
+		var got EventResponse
+		status, _ = api.doWithHeader(http.MethodGet, path, "alice", http.Header{"If-None-Match": {`"2"`}}, nil, &got)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, created, got)
+	})
+
+	var updated EventResponse
+	status, header = api.doWithHeader(http.MethodPut, path, "alice", http.Header{"If-Match": {`"1"`}},
+		eventRequest("retro", baseTime, time.Hour), &updated)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, int64(2), updated.Version)
+	require.Equal(t, `"2"`, header.Get("ETag"))
+
+	tests := []struct {
+		name    string
+		method  string
+		ifMatch string
+	}{
+		{"stale update", http.MethodPut, `"1"`},
+		{"stale delete", http.MethodDelete, `"1"`},
+		{"weak tag", http.MethodPut, `W/"2"`},
+		{"unquoted tag", http.MethodDelete, `2`},
+		{"zero version", http.MethodDelete, `"0"`},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status, _ := api.doWithHeader(tc.method, path, "alice", http.Header{"If-Match": {tc.ifMatch}},
+				eventRequest("stale", baseTime, time.Hour), &errResp)
+			require.Equal(t, http.StatusPreconditionFailed, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+
+	var got EventResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, path, "alice", nil, &got))
+	require.Equal(t, "retro", got.Title)
+
+	status, _ = api.doWithHeader(http.MethodDelete, path, "alice", http.Header{"If-Match": {`"2"`}}, nil, nil)
+	require.Equal(t, http.StatusNoContent, status)
+}
+
+func TestRestoreAndHistoryAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var created EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &created))
+	path := "/events/" + created.ID
+	require.Equal(t, http.StatusOK,
+		api.do(http.MethodPut, path, "alice", eventRequest("retro", baseTime, time.Hour), nil))
+	require.Equal(t, http.StatusNoContent, api.do(http.MethodDelete, path, "alice", nil, nil))
+
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("planning", baseTime, time.Hour), nil))
+	var errResp ErrorResponse
+	require.Equal(t, http.StatusConflict, api.do(http.MethodPost, path+"/restore", "alice", nil, &errResp))
+
+	var restored EventResponse
+	status, header := api.doWithHeader(http.MethodPost, path+"/restore?allow_overlap=true", "alice", nil, nil, &restored)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "retro", restored.Title)
+	require.Equal(t, int64(4), restored.Version)
+	require.Equal(t, `"4"`, header.Get("ETag"))
+
+	var history HistoryResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, path+"/history", "alice", nil, &history))
+	require.Len(t, history.Revisions, 4)
+	actions := make([]string, 0, len(history.Revisions))
+	for i, r := range history.Revisions {
+		require.Equal(t, int64(i+1), r.Version)
+		require.Equal(t, "alice", r.UserID)
+		actions = append(actions, r.Action)
+	}
+	require.Equal(t, []string{"created", "updated", "deleted", "restored"}, actions)
+	require.Equal(t, []FieldChangeResponse{{Field: "title", Old: "standup", New: "retro"}},
+		history.Revisions[1].Changes)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID string
+		status int
+	}{
+		{"restore not deleted", http.MethodPost, path + "/restore", "alice", http.StatusConflict},
+		{"restore of another user", http.MethodPost, path + "/restore", "bob", http.StatusNotFound},
+		{"restore missing", http.MethodPost, "/events/missing/restore", "alice", http.StatusNotFound},
+		{"history of another user", http.MethodGet, path + "/history", "bob", http.StatusNotFound},
+		{"history without user", http.MethodGet, path + "/history", "", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			require.Equal(t, tc.status, api.do(tc.method, tc.path, tc.userID, nil, &errResp))
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestOccurrencesAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := eventRequest("standup", baseTime, 30*time.Minute)
+	req.RRule = "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"
+	var series EventResponse
+	require.Equal(t, http.StatusCreated, api.do(http.MethodPost, "/events", "alice", req, &series))
+	require.Equal(t, req.RRule, series.RRule)
+	require.Nil(t, series.RecurrenceID)
+
+	occurrence := func(day int) string {
+		return "/events/" + series.ID + "/occurrences/" + baseTime.AddDate(0, 0, day).Format(time.RFC3339)
+	}
+
+	var edited EventResponse
+	moved := eventRequest("planning", baseTime.AddDate(0, 0, 1).Add(time.Hour), time.Hour)
+	require.Equal(t, http.StatusOK, api.do(http.MethodPut, occurrence(1), "alice", moved, &edited))
+	require.Equal(t, series.ID, edited.SeriesID)
+	require.NotNil(t, edited.RecurrenceID)
+	require.True(t, baseTime.AddDate(0, 0, 1).Equal(*edited.RecurrenceID))
+
+	require.Equal(t, http.StatusNoContent, api.do(http.MethodDelete, occurrence(2), "alice", nil, nil))
+
+	var week EventsResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events?week=2021-06-14", "alice", nil, &week))
+	titles := make([]string, 0, len(week.Events))
+	for _, e := range week.Events {
+		titles = append(titles, e.Title)
+		require.NotNil(t, e.RecurrenceID)
+	}
+	require.Equal(t, []string{"standup", "planning", "standup", "standup"}, titles)
+
+	var got EventResponse
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events/"+series.ID, "alice", nil, &got))
+	require.Len(t, got.ExDates, 2)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID string
+		body   interface{}
+		status int
+	}{
+		{"bad recurrence id", http.MethodDelete, "/events/" + series.ID + "/occurrences/2021-06-14", "alice", nil, http.StatusBadRequest},
+		{"no occurrence", http.MethodDelete, occurrence(5), "alice", nil, http.StatusUnprocessableEntity},
+		{"already cancelled", http.MethodDelete, occurrence(2), "alice", nil, http.StatusUnprocessableEntity},
+		{"foreign series", http.MethodDelete, occurrence(3), "bob", nil, http.StatusNotFound},
+		{"nested rule", http.MethodPut, occurrence(3), "alice", req, http.StatusUnprocessableEntity},
+		{"invalid rule", http.MethodPost, "/events", "alice", EventRequest{
+			Title: "a", StartAt: baseTime.AddDate(0, 1, 0), EndAt: baseTime.AddDate(0, 1, 0).Add(time.Hour), RRule: "FREQ=SOMETIMES",
+		}, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			require.Equal(t, tc.status, api.do(tc.method, tc.path, tc.userID, tc.body, &errResp))
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestSettingsAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var settings SettingsResponse
+	status := api.do(http.MethodGet, "/users/alice/settings", "alice", nil, &settings)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, SettingsResponse{UserID: "alice", TimeZone: "", WeekStart: "sunday"}, settings)
+
+	req := SettingsRequest{TimeZone: "Europe/Berlin", WeekStart: "Monday"}
+	status = api.do(http.MethodPut, "/users/alice/settings", "alice", req, &settings)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, SettingsResponse{UserID: "alice", TimeZone: "Europe/Berlin", WeekStart: "monday"}, settings)
+
+	// 23:30 in Berlin on the spring-forward day is still 28 March there.
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	var created EventResponse
+	start := time.Date(2021, time.March, 28, 23, 30, 0, 0, berlin)
+	status = api.do(http.MethodPost, "/events", "alice", eventRequest("late", start, 15*time.Minute), &created)
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, "Europe/Berlin", created.TimeZone)
+	require.True(t, start.Equal(created.StartAt))
+
+	var list EventsResponse
+	status = api.do(http.MethodGet, "/events?day=2021-03-28", "alice", nil, &list)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, list.Events, 1)
+	status = api.do(http.MethodGet, "/events?day=2021-03-29", "alice", nil, &list)
+	require.Equal(t, http.StatusOK, status)
+	require.Empty(t, list.Events)
+
+	cases := []struct {
+		name   string
+		user   string
+		body   interface{}
+		status int
+	}{
+		{name: "foreign user", user: "bob", body: req, status: http.StatusNotFound},
+		{
+			name: "unknown zone", user: "alice",
+			body:   SettingsRequest{TimeZone: "Mars/Olympus", WeekStart: "monday"},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unknown weekday", user: "alice",
+			body:   SettingsRequest{WeekStart: "someday"},
+			status: http.StatusUnprocessableEntity,
+		},
+		{name: "unknown field", user: "alice", body: `{"zone": "UTC"}`, status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(http.MethodPut, "/users/alice/settings", tc.user, tc.body, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestAttendeesAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	req := eventRequest("planning", baseTime, time.Hour)
+	req.Attendees = []string{"bob", "carol"}
+	var created EventResponse
+	status := api.do(http.MethodPost, "/events", "alice", req, &created)
+	require.Equal(t, http.StatusCreated, status)
+	require.Equal(t, []AttendeeResponse{
+		{UserID: "bob", Status: "needs-action"},
+		{UserID: "carol", Status: "needs-action"},
+	}, created.Attendees)
+	require.Equal(t, &ResponsesResponse{NeedsAction: 2}, created.Responses)
+
+	var list EventsResponse
+	status = api.do(http.MethodGet, "/events?day=2021-06-14", "bob", nil, &list)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, list.Events, 1)
+	require.Equal(t, created.ID, list.Events[0].ID)
+
+	var answered EventResponse
+	status = api.do(http.MethodPut, "/events/"+created.ID+"/response", "bob", RespondRequest{Status: "accepted"}, &answered)
+	require.Equal(t, http.StatusOK, status)
+	status = api.do(http.MethodPut, "/events/"+created.ID+"/response", "carol", RespondRequest{Status: "declined"}, &answered)
+	require.Equal(t, http.StatusOK, status)
+
+	var got EventResponse
+	status = api.do(http.MethodGet, "/events/"+created.ID, "alice", nil, &got)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, &ResponsesResponse{Accepted: 1, Declined: 1}, got.Responses)
+
+	cases := []struct {
+		name   string
+		user   string
+		body   interface{}
+		status int
+	}{
+		{name: "not invited", user: "dave", body: RespondRequest{Status: "accepted"}, status: http.StatusNotFound},
+		{name: "owner", user: "alice", body: RespondRequest{Status: "accepted"}, status: http.StatusNotFound},
+		{name: "unknown status", user: "bob", body: RespondRequest{Status: "maybe"}, status: http.StatusUnprocessableEntity},
+		{name: "no response", user: "bob", body: RespondRequest{Status: "needs-action"},
+			status: http.StatusUnprocessableEntity},
+		{name: "unknown field", user: "bob", body: `{"answer": "yes"}`, status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(http.MethodPut, "/events/"+created.ID+"/response", tc.user, tc.body, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+
+	t.Run("invitees cannot change the event", func(t *testing.T) {
+		var errResp ErrorResponse
+		status := api.do(http.MethodPut, "/events/"+created.ID, "bob", eventRequest("mine", baseTime, time.Hour), &errResp)
+		require.Equal(t, http.StatusNotFound, status)
+		status = api.do(http.MethodDelete, "/events/"+created.ID, "bob", nil, &errResp)
+		require.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func TestFreeBusyAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	for user, zone := range map[string]string{"alice": "Europe/Berlin", "bob": "America/New_York"} {
+		status := api.do(http.MethodPut, "/users/"+user+"/settings", user, SettingsRequest{TimeZone: zone, WeekStart: "monday"}, nil)
+		require.Equal(t, http.StatusOK, status)
+	}
+	day := time.Date(2021, time.June, 14, 0, 0, 0, 0, time.UTC)
+	status := api.do(http.MethodPost, "/events", "alice", eventRequest("lunch", day.Add(10*time.Hour), time.Hour), nil)
+	require.Equal(t, http.StatusCreated, status)
+	status = api.do(http.MethodPost, "/events", "bob", eventRequest("sync", day.Add(14*time.Hour+30*time.Minute),
+		30*time.Minute), nil)
+	require.Equal(t, http.StatusCreated, status)
+
+	// 10:00 to 18:00 is 8:00 to 16:00 UTC in Berlin and 14:00 to 22:00 UTC in New York.
+	var resp FreeBusyResponse
+	status = api.do(http.MethodGet,
+		"/freebusy?user=alice,bob&from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z&duration=45m&work_start=10:00&work_end=18:00",
+		"carol", nil, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, FreeBusyResponse{
+		Users: []UserBusyResponse{
+			{UserID: "alice", TimeZone: "Europe/Berlin", Busy: []Interval{
+				{Start: day.Add(10 * time.Hour), End: day.Add(11 * time.Hour)},
+			}},
+			{UserID: "bob", TimeZone: "America/New_York", Busy: []Interval{
+				{Start: day.Add(14*time.Hour + 30*time.Minute), End: day.Add(15 * time.Hour)},
+			}},
+		},
+		Free: []Interval{{Start: day.Add(15 * time.Hour), End: day.Add(16 * time.Hour)}},
+	}, resp)
+
+	cases := []struct {
+		name   string
+		user   string
+		query  string
+		status int
+	}{
+		{name: "no user", query: "user=alice&from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z", status: http.StatusUnauthorized},
+		{name: "bad from", user: "alice", query: "user=alice&from=2021-06-14&to=2021-06-15T00:00:00Z",
+			status: http.StatusBadRequest},
+		{name: "bad duration", user: "alice", query: "user=alice&from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z&duration=1",
+			status: http.StatusBadRequest},
+		{name: "bad work start", user: "alice",
+			query:  "user=alice&from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z&work_start=10am&work_end=18:00",
+			status: http.StatusBadRequest},
+		{name: "no users", user: "alice", query: "from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z",
+			status: http.StatusUnprocessableEntity},
+		{name: "reversed period", user: "alice", query: "user=alice&from=2021-06-15T00:00:00Z&to=2021-06-14T00:00:00Z",
+			status: http.StatusUnprocessableEntity},
+		{name: "reversed working hours", user: "alice",
+			query:  "user=alice&from=2021-06-14T00:00:00Z&to=2021-06-15T00:00:00Z&work_start=18:00&work_end=10:00",
+			status: http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(http.MethodGet, "/freebusy?"+tc.query, tc.user, nil, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestSearchAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	ids := make([]string, 0, 3)
+	for i, title := range []string{"Daily standup", "Code review", "Standup notes"} {
+		var created EventResponse
+		status := api.do(http.MethodPost, "/events", "alice", eventRequest(title, baseTime.Add(time.Duration(i)*time.Hour), time.Hour), &created)
+		require.Equal(t, http.StatusCreated, status)
+		ids = append(ids, created.ID)
+	}
+	status := api.do(http.MethodPost, "/events", "bob", eventRequest("standup", baseTime, time.Hour), nil)
+	require.Equal(t, http.StatusCreated, status)
+
+	var resp SearchResponse
+	status = api.do(http.MethodGet, "/events/search?q=standup&sort=-start&limit=1", "alice", nil, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, resp.Events, 1)
+	require.Equal(t, ids[2], resp.Events[0].ID)
+	require.NotEmpty(t, resp.NextPageToken)
+
+	var next SearchResponse
+	status = api.do(http.MethodGet, "/events/search?q=standup&sort=-start&limit=1&page_token="+resp.NextPageToken,
+		"alice", nil, &next)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, next.Events, 1)
+	require.Equal(t, ids[0], next.Events[0].ID)
+	require.Empty(t, next.NextPageToken)
+
+	status = api.do(http.MethodGet, "/events/search?sort=title&from=2021-06-14T10:30:00Z&has_notification=true",
+		"alice", nil, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, []string{ids[1], ids[0], ids[2]}, []string{resp.Events[0].ID, resp.Events[1].ID, resp.Events[2].ID})
+
+	status = api.do(http.MethodGet, "/events/search?has_notification=false", "alice", nil, &resp)
+	require.Equal(t, http.StatusOK, status)
+	require.Empty(t, resp.Events)
+
+	cases := []struct {
+		name   string
+		user   string
+		query  string
+		status int
+	}{
+		{name: "no user", query: "q=standup", status: http.StatusUnauthorized},
+		{name: "bad from", user: "alice", query: "from=2021-06-14", status: http.StatusBadRequest},
+		{name: "bad notification filter", user: "alice", query: "has_notification=maybe", status: http.StatusBadRequest},
+		{name: "bad limit", user: "alice", query: "limit=ten", status: http.StatusBadRequest},
+		{name: "negative limit", user: "alice", query: "limit=-1", status: http.StatusUnprocessableEntity},
+		{name: "unknown sort", user: "alice", query: "sort=end", status: http.StatusUnprocessableEntity},
+		{name: "bad page token", user: "alice", query: "page_token=abc", status: http.StatusUnprocessableEntity},
+		{name: "reversed period", user: "alice", query: "from=2021-06-15T00:00:00Z&to=2021-06-14T00:00:00Z",
+			status: http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var errResp ErrorResponse
+			status := api.do(http.MethodGet, "/events/search?"+tc.query, tc.user, nil, &errResp)
+			require.Equal(t, tc.status, status)
+			require.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestMetricsAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	var created EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &created))
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events/"+created.ID, "alice", nil, nil))
+	require.Equal(t, http.StatusNotFound, api.do(http.MethodGet, "/events/missing", "alice", nil, nil))
+	require.Equal(t, http.StatusUnauthorized, api.do(http.MethodGet, "/events/missing", "", nil, nil))
+	require.Equal(t, http.StatusNotFound, api.do(http.MethodGet, "/unknown/"+created.ID, "alice", nil, nil))
+
+	// Metrics are served without a user.
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, api.url+"/metrics", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	body := string(data)
+	for _, line := range []string{
+		`calendar_http_requests_total{code="201",method="POST",route="/events"} 1`,
+		`calendar_http_requests_total{code="200",method="GET",route="/events/{id}"} 1`,
+		`calendar_http_requests_total{code="404",method="GET",route="/events/{id}"} 1`,
+		`calendar_http_requests_total{code="401",method="GET",route="/events/{id}"} 1`,
+		`calendar_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`calendar_http_request_duration_seconds_count{method="GET",route="/events/{id}"} 3`,
+	} {
+		require.Contains(t, body, line)
+	}
+	require.NotContains(t, body, created.ID)
+}
+
+func TestTracingAPI(t *testing.T) {
+	recorder := tracingtest.Record(t)
+	api := newTestAPI(t)
+
+	var created EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &created))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	header := http.Header{"Traceparent": {"00-" + traceID + "-00f067aa0ba902b7-01"}}
+	status, _ := api.doWithHeader(http.MethodGet, "/events/"+created.ID, "alice", header, nil, nil)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = api.doWithHeader(http.MethodGet, "/events/missing", "alice", nil, nil, nil)
+	require.Equal(t, http.StatusNotFound, status)
+
+	var get []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "HTTP GET /events/{id}" {
+			get = append(get, span)
+		}
+	}
+	require.Len(t, get, 2)
+
+	require.Equal(t, traceID, get[0].SpanContext().TraceID().String())
+	require.True(t, get[0].Parent().IsRemote())
+	require.Equal(t, trace.SpanKindServer, get[0].SpanKind())
+	require.Contains(t, get[0].Attributes(), semconv.HTTPRouteKey.String("/events/{id}"))
+	require.Contains(t, get[0].Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusOK))
+	require.Equal(t, codes.Unset, get[0].Status().Code)
+
+	require.NotEqual(t, traceID, get[1].SpanContext().TraceID().String())
+	require.Equal(t, codes.Error, get[1].Status().Code)
+
+	tracingtest.Find(t, recorder, "HTTP POST /events")
+}
+
+func TestHealthAPI(t *testing.T) {
+	logg := &testLogger{}
+	h := health.New(health.Version{Release: "v1.0.0", BuildDate: "2021-06-14", GitHash: "abc123"})
+	var storageErr error
+	h.AddCheck("storage", func(context.Context) error { return storageErr })
+	ts := httptest.NewServer(NewServer(logg, app.New(logg, memorystorage.New(), app.Options{}), metrics.New(), h, Limits{}, "").Handler())
+	defer ts.Close()
+	api := &apiClient{t: t, url: ts.URL}
+
+	// Probes are answered without a user.
+	var report health.Report
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/healthz", "", nil, &report))
+	require.Equal(t, health.StatusOK, report.Status)
+	var version health.Version
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/version", "", nil, &version))
+	require.Equal(t, h.Version(), version)
+
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/readyz", "", nil, &report))
+	require.Equal(t, map[string]string{"storage": health.StatusOK}, report.Checks)
+
+	storageErr = errors.New("connection refused")
+	report = health.Report{}
+	require.Equal(t, http.StatusServiceUnavailable, api.do(http.MethodGet, "/readyz", "", nil, &report))
+	require.Equal(t, map[string]string{"storage": "connection refused"}, report.Checks)
+
+	storageErr = nil
+	h.Shutdown()
+	report = health.Report{}
+	require.Equal(t, http.StatusServiceUnavailable, api.do(http.MethodGet, "/readyz", "", nil, &report))
+	require.Equal(t, health.StatusShuttingDown, report.Status)
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/healthz", "", nil, nil))
+
+	require.Equal(t, http.StatusMethodNotAllowed, api.do(http.MethodPost, "/readyz", "", nil, nil))
+}
+
+func TestLimitsAPI(t *testing.T) {
+	logg := &testLogger{}
+	calendar := app.New(logg, memorystorage.New(), app.Options{MaxEvents: 1})
+	limits := Limits{User: ratelimit.New(0.001, 3), IP: ratelimit.New(0.001, 8), MaxBodyBytes: 512}
+	ts := httptest.NewServer(NewServer(logg, calendar, metrics.New(), health.New(health.Version{}), limits, "").Handler())
+	defer ts.Close()
+	api := &apiClient{t: t, url: ts.URL}
+
+	status := api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), nil)
+	require.Equal(t, http.StatusCreated, status)
+	var errResp ErrorResponse
+	status = api.do(http.MethodPost, "/events", "alice", eventRequest("retro", baseTime.Add(time.Hour), time.Hour), &errResp)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.Contains(t, errResp.Error, app.ErrQuotaExceeded.Error())
+
+	// Bodies declaring their size are rejected before reading, chunked
+	// ones once they grow past the limit.
+	big := strings.Repeat("x", 1024)
+	status = api.do(http.MethodPost, "/events", "alice", EventRequest{Title: big}, nil)
+	require.Equal(t, http.StatusRequestEntityTooLarge, status)
+	for _, path := range []string{"/events", "/import"} {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, ts.URL+path,
+			io.MultiReader(strings.NewReader(`{"title":"`+big+`"}`)))
+		require.NoError(t, err)
+		req.Header.Set(UserIDHeader, "bob")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, path)
+	}
+
+	status, header := api.doWithHeader(http.MethodGet, "/events?day=2021-06-14", "alice", nil, nil, &errResp)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.Equal(t, "1000", header.Get("Retry-After"))
+	require.Equal(t, "rate limit exceeded", errResp.Error)
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/events?day=2021-06-14", "bob", nil, nil))
+
+	// The address is limited even without a user, probes are not limited.
+	require.Equal(t, http.StatusUnauthorized, api.do(http.MethodGet, "/events?day=2021-06-14", "", nil, nil))
+	status, header = api.doWithHeader(http.MethodGet, "/events?day=2021-06-14", "carol", nil, nil, nil)
+	require.Equal(t, http.StatusTooManyRequests, status)
+	require.NotEmpty(t, header.Get("Retry-After"))
+	require.Equal(t, http.StatusOK, api.do(http.MethodGet, "/healthz", "", nil, nil))
+
+	// X-Forwarded-For of a client which is not a trusted proxy is ignored.
+	forged := http.Header{"X-Forwarded-For": []string{"198.51.100.1"}}
+	status, _ = api.doWithHeader(http.MethodGet, "/events?day=2021-06-14", "dave", forged, nil, nil)
+	require.Equal(t, http.StatusTooManyRequests, status)
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	logg := &testLogger{}
+	s := NewServer(logg, app.New(logg, memorystorage.New(), app.Options{}), metrics.New(), health.New(health.Version{}), Limits{}, "")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.serve(l)
+	}()
+
+	respStatus := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+l.Addr().String(), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			respStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		respStatus <- resp.StatusCode
+	}()
+	<-started
+
+	stopErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopErr <- s.Stop(ctx)
+	}()
+
+	select {
+	case <-serveErr:
+		t.Fatal("server returned before in-flight request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	require.Equal(t, http.StatusOK, <-respStatus)
+	require.NoError(t, <-stopErr)
+	require.NoError(t, <-serveErr)
+}
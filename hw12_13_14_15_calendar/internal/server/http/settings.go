@@ -0,0 +1,79 @@
+package internalhttp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// SettingsRequest changes the calendar settings of a user.
+type SettingsRequest struct {
+	// TimeZone is an IANA zone name like "Europe/Berlin", UTC when empty.
+	TimeZone string `json:"time_zone"`
+	// WeekStart is the first day of the week like "monday".
+	WeekStart string `json:"week_start"`
+}
+
+type SettingsResponse struct {
+	UserID    string `json:"user_id"`
+	TimeZone  string `json:"time_zone"`
+	WeekStart string `json:"week_start"`
+}
+
+func newSettingsResponse(u storage.User) SettingsResponse {
+	return SettingsResponse{
+		UserID:    u.ID,
+		TimeZone:  u.TimeZone,
+		WeekStart: strings.ToLower(u.WeekStart.String()),
+	}
+}
+
+// getSettings handles GET /users/{id}/settings. Like calendars, settings of
+// other users are reported as not found.
+func (h *handlers) getSettings(w http.ResponseWriter, r *http.Request) {
+	if !h.ownUser(w, r) {
+		return
+	}
+
+	u, err := h.app.UserSettings(r.Context())
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSettingsResponse(u))
+}
+
+func (h *handlers) updateSettings(w http.ResponseWriter, r *http.Request) {
+	if !h.ownUser(w, r) {
+		return
+	}
+	var req SettingsRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	weekStart, err := storage.ParseWeekday(req.WeekStart)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "week_start: "+err.Error())
+		return
+	}
+
+	u, err := h.app.UpdateUserSettings(r.Context(), storage.User{TimeZone: req.TimeZone, WeekStart: weekStart})
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSettingsResponse(u))
+}
+
+// ownUser reports whether the requesting user matches the {id} of the route.
+func (h *handlers) ownUser(w http.ResponseWriter, r *http.Request) bool {
+	if mux.Vars(r)["id"] != requestUser(r) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package internalhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+)
+
+// streamHeartbeat keeps idle streams from being closed by proxies.
+const streamHeartbeat = 15 * time.Second
+
+// ChangeResponse is the data of a change in the event stream.
+type ChangeResponse struct {
+	// Type is one of created, updated and deleted.
+	Type  string        `json:"type"`
+	Event EventResponse `json:"event"`
+}
+
+// streamEvents handles GET /events/stream sending changes of events the
+// user owns or is invited to as Server-Sent Events:
+//
+//	id: 42
+//	event: updated
+//	data: {"type":"updated","event":{...}}
+//
+// A reconnecting client resumes after the change in the Last-Event-ID
+// header or the last_event_id query parameter. When those changes are not
+// buffered anymore the stream starts with a reset event and the client
+// should reload the events. A client which does not keep up is
+// disconnected and may resume the same way.
+func (h *handlers) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	after, ok := lastEventID(w, r)
+	if !ok {
+		return
+	}
+
+	sub, err := h.app.Subscribe(r.Context(), after)
+	reset := errors.Is(err, app.ErrChangesExpired)
+	if reset {
+		sub, err = h.app.Subscribe(r.Context(), 0)
+	}
+	if err != nil {
+		h.writeAppError(w, err)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if reset {
+		_, _ = io.WriteString(w, "event: reset\ndata: {}\n\n")
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case c, ok := <-sub.Changes():
+			if !ok {
+				if err := sub.Err(); errors.Is(err, app.ErrSlowSubscriber) {
+					h.logger.Warn("event stream dropped", "user", requestUser(r), "error", err)
+				}
+				return
+			}
+			if err := writeChange(w, c); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-h.closing:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeChange(w io.Writer, c app.Change) error {
+	data, err := json.Marshal(ChangeResponse{Type: string(c.Type), Event: newEventResponse(c.Event)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", c.ID, c.Type, data)
+	return err
+}
+
+func lastEventID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Last-Event-ID must be an id of a change")
+		return 0, false
+	}
+	return id, true
+}
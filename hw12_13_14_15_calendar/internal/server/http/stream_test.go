@@ -0,0 +1,156 @@
+package internalhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/app"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/health"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/metrics"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+type eventStream struct {
+	t      *testing.T
+	reader *bufio.Reader
+}
+
+// openStream connects to the event stream, it is closed with the test.
+func openStream(t *testing.T, baseURL, userID, lastEventID string) *eventStream {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/events/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set(UserIDHeader, userID)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return &eventStream{t: t, reader: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next message skipping comments.
+func (s *eventStream) next() sseMessage {
+	s.t.Helper()
+
+	var msg sseMessage
+	for {
+		line, err := s.reader.ReadString('\n')
+		require.NoError(s.t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && msg != sseMessage{}:
+			return msg
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func (s *eventStream) nextChange() (string, ChangeResponse) {
+	s.t.Helper()
+
+	msg := s.next()
+	var change ChangeResponse
+	require.NoError(s.t, json.Unmarshal([]byte(msg.data), &change))
+	require.Equal(s.t, msg.event, change.Type)
+	return msg.id, change
+}
+
+func TestEventStreamAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	alice := openStream(t, api.url, "alice", "")
+	bob := openStream(t, api.url, "bob", "")
+
+	var created EventResponse
+	require.Equal(t, http.StatusCreated,
+		api.do(http.MethodPost, "/events", "alice", eventRequest("standup", baseTime, time.Hour), &created))
+	id, change := alice.nextChange()
+	require.Equal(t, "1", id)
+	require.Equal(t, ChangeResponse{Type: "created", Event: created}, change)
+
+	req := eventRequest("planning", baseTime, time.Hour)
+	req.Attendees = []string{"bob"}
+	require.Equal(t, http.StatusOK, api.do(http.MethodPut, "/events/"+created.ID, "alice", req, nil))
+	id, change = bob.nextChange()
+	require.Equal(t, "2", id, "bob does not see changes made before the invitation")
+	require.Equal(t, "planning", change.Event.Title)
+
+	require.Equal(t, http.StatusNoContent, api.do(http.MethodDelete, "/events/"+created.ID, "alice", nil, nil))
+	_, change = bob.nextChange()
+	require.Equal(t, "deleted", change.Type)
+
+	t.Run("resume", func(t *testing.T) {
+		resumed := openStream(t, api.url, "alice", "1")
+		id, change := resumed.nextChange()
+		require.Equal(t, "2", id)
+		require.Equal(t, "updated", change.Type)
+		id, _ = resumed.nextChange()
+		require.Equal(t, "3", id)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		stream := openStream(t, api.url, "alice", "42")
+		require.Equal(t, "reset", stream.next().event)
+
+		require.Equal(t, http.StatusCreated,
+			api.do(http.MethodPost, "/events", "alice", eventRequest("retro", baseTime, time.Hour), nil))
+		id, _ := stream.nextChange()
+		require.Equal(t, "4", id)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var errResp ErrorResponse
+		require.Equal(t, http.StatusUnauthorized, api.do(http.MethodGet, "/events/stream", "", nil, &errResp))
+		status := api.do(http.MethodGet, "/events/stream?last_event_id=last", "alice", nil, &errResp)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestEventStreamShutdown(t *testing.T) {
+	logg := &testLogger{}
+	s := NewServer(logg, app.New(logg, memorystorage.New(), app.Options{}), metrics.New(), health.New(health.Version{}), Limits{}, "")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.serve(l)
+	}()
+
+	stream := openStream(t, "http://"+l.Addr().String(), "alice", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx), "open streams do not hold the shutdown")
+	require.NoError(t, <-serveErr)
+
+	_, err = stream.reader.ReadString('\n')
+	require.Error(t, err)
+}
@@ -0,0 +1,85 @@
+// Package setup builds the storage and the queues the commands select in
+// their configs.
+package setup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	amqpqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/amqp"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	sqlstorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/sql"
+)
+
+const (
+	StorageMemory = "memory"
+	StorageSQL    = "sql"
+
+	// QueueMemory is only usable inside one process, the commands reject it.
+	QueueMemory = "memory"
+	QueueAMQP   = "amqp"
+)
+
+type CloseFunc func(ctx context.Context) error
+
+type StorageOptions struct {
+	// Type is StorageMemory or StorageSQL.
+	Type string
+	DSN  string
+	// Migrate applies migrations of the SQL storage after connecting.
+	Migrate bool
+}
+
+// NewStorage builds the storage of opts and returns a function releasing
+// its resources.
+func NewStorage(ctx context.Context, opts StorageOptions) (storage.Storage, CloseFunc, error) {
+	switch opts.Type {
+	case StorageMemory:
+		return memorystorage.New(), func(context.Context) error { return nil }, nil
+	case StorageSQL:
+		s := sqlstorage.New(opts.DSN)
+		if err := s.Connect(ctx); err != nil {
+			return nil, nil, err
+		}
+		if opts.Migrate {
+			if err := s.MigrateUp(ctx); err != nil {
+				_ = s.Close(ctx)
+				return nil, nil, fmt.Errorf("migrate: %w", err)
+			}
+		}
+		return s, s.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage type %q", opts.Type)
+	}
+}
+
+type QueueOptions struct {
+	// Type is QueueAMQP.
+	Type string
+	URL  string
+	Name string
+}
+
+// NewPublisher builds a publisher to the queue of opts and returns a function
+// releasing its resources.
+func NewPublisher(opts QueueOptions, logger amqpqueue.Logger) (queue.Publisher, func() error, error) {
+	switch opts.Type {
+	case QueueAMQP:
+		p := amqpqueue.NewPublisher(logger, opts.URL, opts.Name, amqpqueue.Options{})
+		return p, p.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown queue type %q", opts.Type)
+	}
+}
+
+// NewConsumer builds a consumer of the queue of opts.
+func NewConsumer(opts QueueOptions, logger amqpqueue.Logger) (queue.Consumer, error) {
+	switch opts.Type {
+	case QueueAMQP:
+		return amqpqueue.NewConsumer(logger, opts.URL, opts.Name, amqpqueue.Options{}), nil
+	default:
+		return nil, fmt.Errorf("unknown queue type %q", opts.Type)
+	}
+}
@@ -0,0 +1,28 @@
+package setup
+
+import (
+	"context"
+	"testing"
+
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStorage(t *testing.T) {
+	ctx := context.Background()
+
+	s, closeStorage, err := NewStorage(ctx, StorageOptions{Type: StorageMemory})
+	require.NoError(t, err)
+	require.IsType(t, &memorystorage.Storage{}, s)
+	require.NoError(t, closeStorage(ctx))
+
+	_, _, err = NewStorage(ctx, StorageOptions{Type: "redis"})
+	require.Error(t, err)
+}
+
+func TestNewQueues(t *testing.T) {
+	_, _, err := NewPublisher(QueueOptions{Type: QueueMemory, Name: "notifications"}, nil)
+	require.Error(t, err)
+	_, err = NewConsumer(QueueOptions{Type: "kafka", Name: "notifications"}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package storage
+
+import "fmt"
+
+// AttendeeStatus is the response of an invited user, named after the RFC 5545 PARTSTAT values.
+type AttendeeStatus string
+
+const (
+	NeedsAction AttendeeStatus = "needs-action"
+	Accepted    AttendeeStatus = "accepted"
+	Declined    AttendeeStatus = "declined"
+	Tentative   AttendeeStatus = "tentative"
+)
+
+func (s AttendeeStatus) Valid() bool {
+	switch s {
+	case NeedsAction, Accepted, Declined, Tentative:
+		return true
+	default:
+		return false
+	}
+}
+
+// Attendee is a user invited to an event of another user.
+type Attendee struct {
+	UserID string         `json:"user_id"`
+	Status AttendeeStatus `json:"status"`
+}
+
+// Responses counts attendees by their status.
+type Responses struct {
+	NeedsAction int
+	Accepted    int
+	Declined    int
+	Tentative   int
+}
+
+// Responses aggregates the statuses of the attendees for the owner.
+func (e Event) Responses() Responses {
+	var r Responses
+	for _, a := range e.Attendees {
+		switch a.Status {
+		case NeedsAction:
+			r.NeedsAction++
+		case Accepted:
+			r.Accepted++
+		case Declined:
+			r.Declined++
+		case Tentative:
+			r.Tentative++
+		}
+	}
+	return r
+}
+
+// Attendee returns the attendee with the user ID.
+func (e Event) Attendee(userID string) (Attendee, bool) {
+	for _, a := range e.Attendees {
+		if a.UserID == userID {
+			return a, true
+		}
+	}
+	return Attendee{}, false
+}
+
+// VisibleTo reports whether the user owns the event or is invited to it.
+func (e Event) VisibleTo(userID string) bool {
+	if e.UserID == userID {
+		return true
+	}
+	_, ok := e.Attendee(userID)
+	return ok
+}
+
+// BusyFor reports whether the event takes the time of the user: the owner
+// always, attendees once they accept.
+func (e Event) BusyFor(userID string) bool {
+	if e.UserID == userID {
+		return true
+	}
+	a, ok := e.Attendee(userID)
+	return ok && a.Status == Accepted
+}
+
+// WithStatus returns the attendees with the status of userID changed, it
+// fails with ErrAttendeeNotFound if the user is not invited.
+func WithStatus(attendees []Attendee, userID string, status AttendeeStatus) ([]Attendee, error) {
+	if !status.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidAttendeeStatus, status)
+	}
+	res := append([]Attendee(nil), attendees...)
+	for i := range res {
+		if res[i].UserID == userID {
+			res[i].Status = status
+			return res, nil
+		}
+	}
+	return nil, ErrAttendeeNotFound
+}
+
+// KeepResponses returns the invited attendees with the statuses they have
+// in old, so updating an event does not lose responses of users who stay
+// invited.
+func KeepResponses(invited, old []Attendee) []Attendee {
+	if len(invited) == 0 {
+		return nil
+	}
+	statuses := make(map[string]AttendeeStatus, len(old))
+	for _, a := range old {
+		statuses[a.UserID] = a.Status
+	}
+	res := make([]Attendee, 0, len(invited))
+	for _, a := range invited {
+		if status, ok := statuses[a.UserID]; ok {
+			a.Status = status
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+func validateAttendees(e Event) error {
+	seen := make(map[string]bool, len(e.Attendees))
+	for _, a := range e.Attendees {
+		if a.UserID == "" || a.UserID == e.UserID || seen[a.UserID] {
+			return ErrInvalidAttendees
+		}
+		seen[a.UserID] = true
+		if !a.Status.Valid() {
+			return fmt.Errorf("%w: %q", ErrInvalidAttendeeStatus, a.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDateBusy      = errors.New("date is already busy by another event")
+	ErrEventNotFound = errors.New("event not found")
+	ErrEventExists   = errors.New("event already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	// ErrAttendeeNotFound is returned when a user responds to an event they are not invited to.
+	ErrAttendeeNotFound = errors.New("attendee not found")
+	// ErrVersionConflict is returned when the event was changed since the version the caller expects.
+	ErrVersionConflict = errors.New("event version conflict")
+	// ErrNotDeleted is returned when restoring an event which is not deleted.
+	ErrNotDeleted = errors.New("event is not deleted")
+)
+
+// ErrInvalidEvent is wrapped by every validation error.
+var ErrInvalidEvent = errors.New("invalid event")
+
+var (
+	ErrEmptyTitle            = fmt.Errorf("%w: title is empty", ErrInvalidEvent)
+	ErrEmptyUserID           = fmt.Errorf("%w: user id is empty", ErrInvalidEvent)
+	ErrInvalidPeriod         = fmt.Errorf("%w: event must end after it starts", ErrInvalidEvent)
+	ErrInvalidNotifyBefore   = fmt.Errorf("%w: notify before must not be negative", ErrInvalidEvent)
+	ErrNestedRecurrence      = fmt.Errorf("%w: an edited occurrence cannot recur", ErrInvalidEvent)
+	ErrNotRecurring          = fmt.Errorf("%w: event does not recur", ErrInvalidEvent)
+	ErrNoOccurrence          = fmt.Errorf("%w: event has no occurrence at the given time", ErrInvalidEvent)
+	ErrInvalidAttendees      = fmt.Errorf("%w: attendees must be distinct users other than the owner", ErrInvalidEvent)
+	ErrInvalidAttendeeStatus = fmt.Errorf("%w: unknown attendee status", ErrInvalidEvent)
+)
+
+// ErrInvalidUser is wrapped by every user settings validation error.
+var ErrInvalidUser = errors.New("invalid user settings")
+
+var ErrEmptyUserSettingsID = fmt.Errorf("%w: user id is empty", ErrInvalidUser)
+
+// ErrInvalidSearch is wrapped by every search query validation error.
+var ErrInvalidSearch = errors.New("invalid search query")
+
+var (
+	ErrEmptySearchUserID = fmt.Errorf("%w: user id is empty", ErrInvalidSearch)
+	ErrInvalidPageToken  = fmt.Errorf("%w: malformed page token", ErrInvalidSearch)
+)
+
+func invalidEvent(err error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+}
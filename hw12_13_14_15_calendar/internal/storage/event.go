@@ -1,7 +1,119 @@
 package storage
 
+import (
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/rrule"
+)
+
 type Event struct {
-	ID    string
-	Title string
-	// TODO
+	ID           string
+	Title        string
+	StartAt      time.Time
+	EndAt        time.Time
+	Description  string
+	UserID       string
+	NotifyBefore time.Duration
+	// TimeZone is the IANA name of the zone the event is planned in, UTC
+	// when empty. Occurrences of a recurring event keep their local time of
+	// day in it across DST changes.
+	TimeZone string
+
+	// RRule is an RFC 5545 recurrence rule like "FREQ=WEEKLY;BYDAY=MO".
+	// StartAt and EndAt describe the first occurrence of a recurring event.
+	RRule string
+	// ExDates are original starts of cancelled or edited occurrences.
+	ExDates []time.Time
+	// SeriesID links an edited occurrence to its recurring event.
+	SeriesID string
+	// RecurrenceID is the original start of an edited or expanded occurrence.
+	RecurrenceID time.Time
+
+	// Version is set by storage to 1 on create and increased by every change
+	// of the event, occurrences of a recurring event carry the version of
+	// the series.
+	Version int64
+	// DeletedAt is set by storage when the event is deleted. Deleted events
+	// are only returned by GetDeleted and History until they are purged.
+	DeletedAt time.Time
+
+	// Attendees are users invited by the owner. They see the event in their
+	// calendars and are reminded about it once they accept.
+	Attendees []Attendee
+}
+
+func (e Event) Duration() time.Duration {
+	return e.EndAt.Sub(e.StartAt)
+}
+
+// NotifyAt returns the time the owner and accepted attendees should be reminded about the event.
+// Events without NotifyBefore need no reminder.
+func (e Event) NotifyAt() time.Time {
+	return e.StartAt.Add(-e.NotifyBefore)
+}
+
+// Overlaps reports whether the event intersects the half-open interval [from, to).
+func (e Event) Overlaps(from, to time.Time) bool {
+	return e.StartAt.Before(to) && e.EndAt.After(from)
+}
+
+// Location returns the zone of the event, UTC when it is not set or unknown.
+func (e Event) Location() *time.Location {
+	loc, err := LoadLocation(e.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// UTC returns the event with all its times in UTC.
+func (e Event) UTC() Event {
+	e.StartAt = e.StartAt.UTC()
+	e.EndAt = e.EndAt.UTC()
+	if !e.RecurrenceID.IsZero() {
+		e.RecurrenceID = e.RecurrenceID.UTC()
+	}
+	if e.ExDates != nil {
+		exdates := make([]time.Time, 0, len(e.ExDates))
+		for _, ex := range e.ExDates {
+			exdates = append(exdates, ex.UTC())
+		}
+		e.ExDates = exdates
+	}
+	return e
+}
+
+func (e Event) Recurring() bool {
+	return e.RRule != ""
+}
+
+func (e Event) Validate() error {
+	if strings.TrimSpace(e.Title) == "" {
+		return ErrEmptyTitle
+	}
+	if e.UserID == "" {
+		return ErrEmptyUserID
+	}
+	if e.StartAt.IsZero() || !e.EndAt.After(e.StartAt) {
+		return ErrInvalidPeriod
+	}
+	if e.NotifyBefore < 0 {
+		return ErrInvalidNotifyBefore
+	}
+	if _, err := LoadLocation(e.TimeZone); err != nil {
+		return invalidEvent(err)
+	}
+	if err := validateAttendees(e); err != nil {
+		return err
+	}
+	if e.Recurring() {
+		if _, err := rrule.Parse(e.RRule); err != nil {
+			return invalidEvent(err)
+		}
+		if e.SeriesID != "" {
+			return ErrNestedRecurrence
+		}
+	}
+	return nil
 }
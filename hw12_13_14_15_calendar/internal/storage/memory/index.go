@@ -0,0 +1,174 @@
+package memorystorage
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+// endless is the end of the span of endless recurring events.
+var endless = time.Date(9999, time.December, 31, 23, 59, 59, 0, time.UTC)
+
+// span is the time an event may occupy: from its start to the end of its
+// last occurrence. Spans are closed, so events touching each other are
+// found too and storage.Conflict decides.
+type span struct {
+	start, end time.Time
+	id         string
+}
+
+func spanOf(e storage.Event) span {
+	end, ok := e.SeriesEnd()
+	if !ok {
+		end = endless
+	}
+	return span{start: e.StartAt, end: end, id: e.ID}
+}
+
+func (s span) less(other span) bool {
+	if !s.start.Equal(other.start) {
+		return s.start.Before(other.start)
+	}
+	return s.id < other.id
+}
+
+// spanIndex is an interval tree of the spans of one user's events. It is a
+// treap ordered by start and augmented with the latest end in every subtree,
+// so inserts and removals take O(log n) and the spans overlapping an
+// interval are found in O(log n + k) on average.
+type spanIndex struct {
+	root *spanNode
+	size int
+	rnd  *rand.Rand
+}
+
+type spanNode struct {
+	span
+	maxEnd      time.Time
+	priority    int64
+	left, right *spanNode
+}
+
+func newSpanIndex() *spanIndex {
+	return &spanIndex{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))} //nolint:gosec
+}
+
+func (idx *spanIndex) insert(s span) {
+	idx.root = idx.root.insert(&spanNode{span: s, maxEnd: s.end, priority: idx.rnd.Int63()})
+	idx.size++
+}
+
+func (idx *spanIndex) remove(s span) {
+	var removed bool
+	idx.root, removed = idx.root.remove(s)
+	if removed {
+		idx.size--
+	}
+}
+
+// overlapping calls fn with IDs of spans overlapping [from, to] in the order
+// of their starts until fn returns false.
+func (idx *spanIndex) overlapping(from, to time.Time, fn func(id string) bool) {
+	idx.root.overlapping(from, to, fn)
+}
+
+func (n *spanNode) insert(node *spanNode) *spanNode {
+	if n == nil {
+		return node
+	}
+	if node.less(n.span) {
+		n.left = n.left.insert(node)
+		if n.left.priority > n.priority {
+			n = n.rotateRight()
+		}
+	} else {
+		n.right = n.right.insert(node)
+		if n.right.priority > n.priority {
+			n = n.rotateLeft()
+		}
+	}
+	n.update()
+	return n
+}
+
+func (n *spanNode) remove(s span) (*spanNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	var removed bool
+	switch {
+	case s.less(n.span):
+		n.left, removed = n.left.remove(s)
+	case n.less(s):
+		n.right, removed = n.right.remove(s)
+	default:
+		return merge(n.left, n.right), true
+	}
+	n.update()
+	return n, removed
+}
+
+// merge joins two treaps where all spans of left precede the spans of right.
+func merge(left, right *spanNode) *spanNode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case left.priority > right.priority:
+		left.right = merge(left.right, right)
+		left.update()
+		return left
+	default:
+		right.left = merge(left, right.left)
+		right.update()
+		return right
+	}
+}
+
+func (n *spanNode) overlapping(from, to time.Time, fn func(id string) bool) bool {
+	if n == nil || n.maxEnd.Before(from) {
+		return true
+	}
+	if !n.left.overlapping(from, to, fn) {
+		return false
+	}
+	if n.start.After(to) {
+		// Spans of the right subtree start even later.
+		return true
+	}
+	if !n.end.Before(from) && !fn(n.id) {
+		return false
+	}
+	return n.right.overlapping(from, to, fn)
+}
+
+func (n *spanNode) rotateRight() *spanNode {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	n.update()
+	l.update()
+	return l
+}
+
+func (n *spanNode) rotateLeft() *spanNode {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	n.update()
+	r.update()
+	return r
+}
+
+func (n *spanNode) update() {
+	n.maxEnd = n.end
+	if n.left != nil && n.left.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.left.maxEnd
+	}
+	if n.right != nil && n.right.maxEnd.After(n.maxEnd) {
+		n.maxEnd = n.right.maxEnd
+	}
+}
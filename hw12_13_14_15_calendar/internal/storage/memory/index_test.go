@@ -0,0 +1,174 @@
+package memorystorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpanIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	idx := newSpanIndex()
+	spans := make(map[string]span)
+
+	randomSpan := func(id string) span {
+		start := baseTime.Add(time.Duration(rnd.Intn(10000)) * time.Minute)
+		return span{start: start, end: start.Add(time.Duration(rnd.Intn(300)) * time.Minute), id: id}
+	}
+	// overlappingIDs is the brute force version of spanIndex.overlapping.
+	overlappingIDs := func(from, to time.Time) []string {
+		ids := make([]string, 0)
+		for id, sp := range spans {
+			if !sp.start.After(to) && !sp.end.Before(from) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	for i := 0; i < 2000; i++ {
+		id := strconv.Itoa(rnd.Intn(500))
+		if sp, ok := spans[id]; ok && rnd.Intn(2) == 0 {
+			idx.remove(sp)
+			delete(spans, id)
+		} else {
+			if ok {
+				idx.remove(sp)
+			}
+			spans[id] = randomSpan(id)
+			idx.insert(spans[id])
+		}
+		require.Equal(t, len(spans), idx.size)
+
+		q := randomSpan("")
+		var got []string
+		idx.overlapping(q.start, q.end, func(id string) bool {
+			got = append(got, id)
+			return true
+		})
+		sort.Strings(got)
+		if got == nil {
+			got = []string{}
+		}
+		require.Equal(t, overlappingIDs(q.start, q.end), got, "step %d", i)
+	}
+
+	t.Run("stops early", func(t *testing.T) {
+		calls := 0
+		idx.overlapping(baseTime, baseTime.Add(time.Hour*1000), func(string) bool {
+			calls++
+			return false
+		})
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("remove missing", func(t *testing.T) {
+		size := idx.size
+		idx.remove(span{start: baseTime, id: "missing"})
+		require.Equal(t, size, idx.size)
+	})
+}
+
+func TestStorageOverlap(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	e := newEvent("user", baseTime, time.Hour)
+	require.NoError(t, s.Create(ctx, e))
+
+	overlapping := newEvent("user", baseTime.Add(30*time.Minute), time.Hour)
+	require.ErrorIs(t, s.Create(ctx, overlapping), storage.ErrDateBusy)
+	require.NoError(t, s.Create(storage.WithOverlap(ctx), overlapping))
+
+	// Events stored with overlaps allowed do not block others.
+	later := newEvent("user", baseTime.Add(80*time.Minute), time.Hour)
+	require.NoError(t, s.Create(ctx, later))
+
+	// Updates keeping the time are not checked and keep the exemption.
+	renamed := e
+	renamed.Title = "retro"
+	require.NoError(t, s.Update(ctx, e.ID, renamed, storage.AnyVersion))
+	renamed = overlapping
+	renamed.Title = "review"
+	require.NoError(t, s.Update(ctx, overlapping.ID, renamed, storage.AnyVersion))
+	require.NoError(t, s.Create(ctx, newEvent("user", baseTime.Add(time.Hour), 20*time.Minute)))
+
+	// Moving an event checks it again.
+	moved := overlapping
+	moved.StartAt = baseTime.Add(45 * time.Minute)
+	moved.EndAt = moved.StartAt.Add(time.Hour)
+	require.ErrorIs(t, s.Update(ctx, overlapping.ID, moved, storage.AnyVersion), storage.ErrDateBusy)
+	require.NoError(t, s.Update(storage.WithOverlap(ctx), overlapping.ID, moved, storage.AnyVersion))
+	moved = e
+	moved.StartAt = baseTime.Add(-2 * time.Hour)
+	moved.EndAt = moved.StartAt.Add(time.Hour)
+	require.NoError(t, s.Update(ctx, e.ID, moved, storage.AnyVersion))
+	moved.StartAt = baseTime.Add(90 * time.Minute)
+	moved.EndAt = moved.StartAt.Add(time.Hour)
+	require.ErrorIs(t, s.Update(ctx, e.ID, moved, storage.AnyVersion), storage.ErrDateBusy)
+
+	// Deleted and moved events free their old time.
+	require.NoError(t, s.Delete(ctx, later.UserID, later.ID, storage.AnyVersion))
+	require.NoError(t, s.Create(ctx, newEvent("user", baseTime.Add(90*time.Minute), time.Hour)))
+	require.NoError(t, s.Create(ctx, newEvent("user", baseTime, 45*time.Minute)))
+
+	series := newEvent("user", baseTime.AddDate(0, 0, 1), time.Hour)
+	series.RRule = "FREQ=DAILY"
+	require.NoError(t, s.Create(ctx, series))
+	blocked := newEvent("user", baseTime.AddDate(0, 0, 2), 30*time.Minute)
+	require.ErrorIs(t, s.UpdateOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 3), blocked), storage.ErrDateBusy)
+	require.NoError(t, s.UpdateOccurrence(storage.WithOverlap(ctx), series.ID, baseTime.AddDate(0, 0, 3), blocked))
+	blocked.Title = "retro"
+	require.NoError(t, s.UpdateOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 3), blocked))
+}
+
+// BenchmarkStorageCreate measures the busy check of a user holding n events.
+func BenchmarkStorageCreate(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range []int{1000, 10000, 100000, 1000000} {
+		s := New()
+		for i := 0; i < n; i++ {
+			e := newEvent("user", baseTime.Add(time.Duration(i)*time.Hour), 30*time.Minute)
+			e.ID = strconv.Itoa(i)
+			if err := s.Create(ctx, e); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run(fmt.Sprintf("busy/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				start := baseTime.Add(time.Duration(i%n)*time.Hour + 15*time.Minute)
+				e := newEvent("user", start, 30*time.Minute)
+				if err := s.Create(ctx, e); !errors.Is(err, storage.ErrDateBusy) {
+					b.Fatalf("expected ErrDateBusy, got %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("free/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				start := baseTime.Add(time.Duration(i%n)*time.Hour + 30*time.Minute)
+				e := newEvent("user", start, 15*time.Minute)
+				if err := s.Create(ctx, e); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if err := s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
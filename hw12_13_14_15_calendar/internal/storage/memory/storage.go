@@ -1,14 +1,631 @@
 package memorystorage
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+)
+
+var _ storage.Storage = (*Storage)(nil)
 
 type Storage struct {
-	// TODO
-	mu sync.RWMutex
+	mu     sync.RWMutex
+	events map[string]storage.Event
+	// notified holds the start of the last notified occurrence per event.
+	notified map[string]time.Time
+	users    map[string]storage.User
+	// spans indexes events per user for the busy check.
+	spans map[string]*spanIndex
+	// overlaps holds IDs of events stored with overlaps allowed, the busy
+	// check skips them.
+	overlaps map[string]struct{}
+	// invited holds IDs of events per attendee.
+	invited map[string]map[string]struct{}
+	// owned counts events per user, edited occurrences included.
+	owned map[string]int
+	// deleted holds deleted events until they are purged.
+	deleted   map[string]storage.Event
+	revisions map[string][]storage.Revision
 }
 
 func New() *Storage {
-	return &Storage{}
+	return &Storage{
+		events:    make(map[string]storage.Event),
+		notified:  make(map[string]time.Time),
+		users:     make(map[string]storage.User),
+		spans:     make(map[string]*spanIndex),
+		overlaps:  make(map[string]struct{}),
+		invited:   make(map[string]map[string]struct{}),
+		owned:     make(map[string]int),
+		deleted:   make(map[string]storage.Event),
+		revisions: make(map[string][]storage.Revision),
+	}
+}
+
+func (s *Storage) Create(ctx context.Context, e storage.Event) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e = e.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.events[e.ID]; ok {
+		return storage.ErrEventExists
+	}
+	if _, ok := s.deleted[e.ID]; ok {
+		return storage.ErrEventExists
+	}
+	overlap := storage.OverlapAllowed(ctx)
+	if !overlap && s.isBusy(e) {
+		return storage.ErrDateBusy
+	}
+	e.Version = 1
+	s.put(e)
+	s.setOverlap(e.ID, overlap)
+	s.record(storage.NewRevision(ctx, storage.RevisionCreated, storage.Event{}, e, e.Version))
+
+	return nil
+}
+
+// Update replaces the event keeping its exception dates and series link.
+func (s *Storage) Update(ctx context.Context, id string, e storage.Event, version int64) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e = e.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.events[id]
+	if !ok || old.UserID != e.UserID {
+		return storage.ErrEventNotFound
+	}
+	if err := storage.CheckVersion(old, version); err != nil {
+		return err
+	}
+	if old.SeriesID != "" && e.Recurring() {
+		return storage.ErrNestedRecurrence
+	}
+	e.ID = id
+	e.ExDates = old.ExDates
+	e.SeriesID = old.SeriesID
+	e.RecurrenceID = old.RecurrenceID
+	e.Attendees = storage.KeepResponses(e.Attendees, old.Attendees)
+	e.Version = old.Version + 1
+	overlap := storage.OverlapAllowed(ctx)
+	same := storage.SameSchedule(old, e)
+	if !overlap && !same && s.isBusy(e) {
+		return storage.ErrDateBusy
+	}
+	if !old.StartAt.Equal(e.StartAt) || old.NotifyBefore != e.NotifyBefore {
+		delete(s.notified, id)
+	}
+	s.put(e)
+	if overlap || !same {
+		s.setOverlap(id, overlap)
+	}
+	s.record(storage.NewRevision(ctx, storage.RevisionUpdated, old, e, e.Version))
+
+	return nil
+}
+
+// Delete marks the event deleted, edited occurrences of a recurring event go with it.
+func (s *Storage) Delete(ctx context.Context, userID, id string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok || e.UserID != userID {
+		return storage.ErrEventNotFound
+	}
+	if err := storage.CheckVersion(e, version); err != nil {
+		return err
+	}
+	s.softDelete(ctx, e)
+
+	return nil
+}
+
+// softDelete moves the event and its edited occurrences to the deleted
+// ones, it must be called under the lock.
+func (s *Storage) softDelete(ctx context.Context, e storage.Event) {
+	at := time.Now().UTC()
+	deleted := []storage.Event{e}
+	if e.Recurring() {
+		for _, other := range s.events {
+			if other.SeriesID == e.ID {
+				deleted = append(deleted, other)
+			}
+		}
+	}
+
+	for _, d := range deleted {
+		s.unindex(d)
+		delete(s.events, d.ID)
+		d.DeletedAt = at
+		d.Version++
+		s.deleted[d.ID] = d
+		s.record(storage.NewRevision(ctx, storage.RevisionDeleted, d, d, d.Version))
+	}
+}
+
+// delete removes the event and its edited occurrences for good, it must be
+// called under the lock.
+func (s *Storage) delete(id string) {
+	series, ok := s.events[id]
+	if !ok {
+		series, ok = s.deleted[id]
+	}
+	s.purge(id)
+	if !ok || !series.Recurring() {
+		return
+	}
+	for _, events := range []map[string]storage.Event{s.events, s.deleted} {
+		for otherID, e := range events {
+			if e.SeriesID == id {
+				s.purge(otherID)
+			}
+		}
+	}
+}
+
+// purge must be called under the lock.
+func (s *Storage) purge(id string) {
+	s.remove(id)
+	delete(s.deleted, id)
+	delete(s.revisions, id)
+}
+
+// record must be called under the lock.
+func (s *Storage) record(r storage.Revision) {
+	s.revisions[r.EventID] = append(s.revisions[r.EventID], r)
+}
+
+// put stores the event replacing the one with the same ID, it must be
+// called under the lock.
+func (s *Storage) put(e storage.Event) {
+	if old, ok := s.events[e.ID]; ok {
+		s.unindex(old)
+	}
+	s.events[e.ID] = e
+
+	idx, ok := s.spans[e.UserID]
+	if !ok {
+		idx = newSpanIndex()
+		s.spans[e.UserID] = idx
+	}
+	idx.insert(spanOf(e))
+	s.owned[e.UserID]++
+
+	for _, a := range e.Attendees {
+		ids, ok := s.invited[a.UserID]
+		if !ok {
+			ids = make(map[string]struct{})
+			s.invited[a.UserID] = ids
+		}
+		ids[e.ID] = struct{}{}
+	}
+}
+
+// remove must be called under the lock.
+func (s *Storage) remove(id string) {
+	if e, ok := s.events[id]; ok {
+		s.unindex(e)
+	}
+	delete(s.events, id)
+	delete(s.notified, id)
+	delete(s.overlaps, id)
+}
+
+// setOverlap marks the event stored with overlaps allowed or clears the
+// mark, it must be called under the lock.
+func (s *Storage) setOverlap(id string, allowed bool) {
+	if allowed {
+		s.overlaps[id] = struct{}{}
+	} else {
+		delete(s.overlaps, id)
+	}
+}
+
+func (s *Storage) unindex(e storage.Event) {
+	if idx, ok := s.spans[e.UserID]; ok {
+		idx.remove(spanOf(e))
+		if idx.size == 0 {
+			delete(s.spans, e.UserID)
+		}
+	}
+	s.owned[e.UserID]--
+	if s.owned[e.UserID] == 0 {
+		delete(s.owned, e.UserID)
+	}
+
+	for _, a := range e.Attendees {
+		delete(s.invited[a.UserID], e.ID)
+		if len(s.invited[a.UserID]) == 0 {
+			delete(s.invited, a.UserID)
+		}
+	}
+}
+
+func (s *Storage) Get(_ context.Context, userID, id string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.events[id]
+	if !ok || !e.VisibleTo(userID) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+
+	return e, nil
+}
+
+func (s *Storage) GetDeleted(_ context.Context, id string) (storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.deleted[id]
+	if !ok {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+
+	return e, nil
+}
+
+func (s *Storage) Restore(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.deleted[id]
+	if !ok {
+		if _, ok := s.events[id]; ok {
+			return storage.ErrNotDeleted
+		}
+		return storage.ErrEventNotFound
+	}
+	if _, ok := s.events[e.SeriesID]; e.SeriesID != "" && !ok {
+		return fmt.Errorf("%w: series %s is deleted", storage.ErrEventNotFound, e.SeriesID)
+	}
+	restored := []storage.Event{e}
+	for _, other := range s.deleted {
+		if other.SeriesID == id && other.DeletedAt.Equal(e.DeletedAt) {
+			restored = append(restored, other)
+		}
+	}
+	overlap := storage.OverlapAllowed(ctx)
+	if !overlap {
+		for _, r := range restored {
+			if s.isBusy(r) {
+				return storage.ErrDateBusy
+			}
+		}
+	}
+
+	for _, r := range restored {
+		delete(s.deleted, r.ID)
+		r.DeletedAt = time.Time{}
+		r.Version++
+		s.put(r)
+		if overlap {
+			s.setOverlap(r.ID, true)
+		}
+		s.record(storage.NewRevision(ctx, storage.RevisionRestored, r, r, r.Version))
+	}
+
+	return nil
 }
 
-// TODO
+func (s *Storage) History(_ context.Context, id string) ([]storage.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]storage.Revision{}, s.revisions[id]...), nil
+}
+
+func (s *Storage) UpdateOccurrence(
+	ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+) error {
+	recurrenceID = recurrenceID.UTC()
+	e.ID = storage.OccurrenceID(seriesID, recurrenceID)
+	e.SeriesID = seriesID
+	e.RecurrenceID = recurrenceID
+	e.ExDates = nil
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e = e.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, err := s.series(seriesID)
+	if err != nil {
+		return err
+	}
+	old, edited := s.events[e.ID]
+	if !edited {
+		if !series.HasOccurrence(recurrenceID) {
+			return storage.ErrNoOccurrence
+		}
+		e.Attendees = storage.KeepResponses(e.Attendees, series.Attendees)
+		e.Version = 1
+		series.ExDates = append(append([]time.Time(nil), series.ExDates...), recurrenceID)
+		series.Version++
+	} else {
+		e.Attendees = storage.KeepResponses(e.Attendees, old.Attendees)
+		e.Version = old.Version + 1
+	}
+
+	prev := s.events[seriesID]
+	s.put(series)
+	overlap := storage.OverlapAllowed(ctx)
+	same := edited && storage.SameSchedule(old, e)
+	if !overlap && !same && s.isBusy(e) {
+		s.put(prev)
+		return storage.ErrDateBusy
+	}
+	if edited && (!old.StartAt.Equal(e.StartAt) || old.NotifyBefore != e.NotifyBefore) {
+		delete(s.notified, e.ID)
+	}
+	s.put(e)
+	if overlap || !same {
+		s.setOverlap(e.ID, overlap)
+	}
+	if edited {
+		s.record(storage.NewRevision(ctx, storage.RevisionUpdated, old, e, e.Version))
+	} else {
+		s.record(storage.NewRevision(ctx, storage.RevisionUpdated, prev, series, series.Version))
+		s.record(storage.NewRevision(ctx, storage.RevisionCreated, storage.Event{}, e, e.Version))
+	}
+
+	return nil
+}
+
+// CancelOccurrence marks an edited occurrence deleted, other occurrences
+// become exception dates of the series.
+func (s *Storage) CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error {
+	recurrenceID = recurrenceID.UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series, err := s.series(seriesID)
+	if err != nil {
+		return err
+	}
+
+	id := storage.OccurrenceID(seriesID, recurrenceID)
+	if edited, ok := s.events[id]; ok {
+		s.softDelete(ctx, edited)
+		return nil
+	}
+	if !series.HasOccurrence(recurrenceID) {
+		return storage.ErrNoOccurrence
+	}
+	prev := series
+	series.ExDates = append(append([]time.Time(nil), series.ExDates...), recurrenceID)
+	series.Version++
+	s.put(series)
+	s.record(storage.NewRevision(ctx, storage.RevisionUpdated, prev, series, series.Version))
+
+	return nil
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, id, userID string, status storage.AttendeeStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return storage.ErrEventNotFound
+	}
+	attendees, err := storage.WithStatus(e.Attendees, userID, status)
+	if err != nil {
+		return err
+	}
+	old := e
+	e.Attendees = attendees
+	e.Version++
+	s.put(e)
+	s.record(storage.NewRevision(ctx, storage.RevisionUpdated, old, e, e.Version))
+
+	return nil
+}
+
+// series must be called under the lock.
+func (s *Storage) series(id string) (storage.Event, error) {
+	series, ok := s.events[id]
+	if !ok {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	if !series.Recurring() {
+		return storage.Event{}, storage.ErrNotRecurring
+	}
+	return series, nil
+}
+
+func (s *Storage) ListDay(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.DayRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListWeek(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.WeekRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListMonth(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.MonthRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) CountEvents(_ context.Context, userID string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.owned[userID], nil
+}
+
+func (s *Storage) ListByUser(_ context.Context, userID string) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	for _, e := range s.events {
+		if e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	sortByStart(events)
+
+	return events, nil
+}
+
+func (s *Storage) ListUserRange(_ context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	return s.userRange(userID, from, to, func(e storage.Event) bool { return e.BusyFor(userID) }), nil
+}
+
+func (s *Storage) ListVisibleRange(_ context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	return s.userRange(userID, from, to, func(storage.Event) bool { return true }), nil
+}
+
+// userRange expands the events of userID overlapping [from, to) and the
+// events they are invited to for which invited returns true.
+func (s *Storage) userRange(userID string, from, to time.Time, invited func(storage.Event) bool) []storage.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	if idx, ok := s.spans[userID]; ok {
+		idx.overlapping(from, to, func(id string) bool {
+			events = append(events, s.events[id])
+			return true
+		})
+	}
+	for id := range s.invited[userID] {
+		if e := s.events[id]; invited(e) {
+			events = append(events, e)
+		}
+	}
+
+	return storage.Expand(events, from, to)
+}
+
+func (s *Storage) Search(_ context.Context, q storage.SearchQuery) (storage.SearchPage, error) {
+	if err := q.Validate(); err != nil {
+		return storage.SearchPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0, len(s.events))
+	for _, e := range s.events {
+		events = append(events, e)
+	}
+
+	return q.Page(events), nil
+}
+
+func (s *Storage) ListToNotify(_ context.Context, now time.Time) ([]storage.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]storage.Event, 0)
+	for id, e := range s.events {
+		events = append(events, storage.DueOccurrences(e, now, s.notified[id])...)
+	}
+	sortByStart(events)
+
+	return events, nil
+}
+
+func (s *Storage) MarkNotified(_ context.Context, id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.events[id]; !ok {
+		return storage.ErrEventNotFound
+	}
+	if until.After(s.notified[id]) {
+		s.notified[id] = until
+	}
+
+	return nil
+}
+
+// DeleteEndedBefore never removes endless recurring events.
+func (s *Storage) DeleteEndedBefore(_ context.Context, t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, events := range []map[string]storage.Event{s.events, s.deleted} {
+		for id, e := range events {
+			if end, ok := e.SeriesEnd(); ok && end.Before(t) {
+				s.delete(id)
+				n++
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (s *Storage) GetUser(_ context.Context, id string) (storage.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (s *Storage) SaveUser(_ context.Context, u storage.User) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.ID] = u
+	return nil
+}
+
+func sortByStart(events []storage.Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].StartAt.Equal(events[j].StartAt) {
+			return events[i].StartAt.Before(events[j].StartAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+// isBusy compares e with the events of its user whose spans overlap the
+// span of e, events stored with overlaps allowed do not count. It must be
+// called under the lock.
+func (s *Storage) isBusy(e storage.Event) bool {
+	idx, ok := s.spans[e.UserID]
+	if !ok {
+		return false
+	}
+
+	busy := false
+	sp := spanOf(e)
+	idx.overlapping(sp.start, sp.end, func(id string) bool {
+		if _, exempt := s.overlaps[id]; !exempt && id != e.ID && storage.Conflict(e, s.events[id]) {
+			busy = true
+		}
+		return !busy
+	})
+	return busy
+}
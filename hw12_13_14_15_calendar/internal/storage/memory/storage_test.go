@@ -1,7 +1,970 @@
 package memorystorage
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newEvent(userID string, start time.Time, d time.Duration) storage.Event {
+	return storage.Event{
+		ID:      uuid.NewString(),
+		Title:   "meeting",
+		StartAt: start,
+		EndAt:   start.Add(d),
+		UserID:  userID,
+	}
+}
+
+func TestStorageContract(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) (storage.Storage, string) {
+		return New(), "user"
+	})
+}
 
 func TestStorage(t *testing.T) {
-	// TODO
+	ctx := context.Background()
+
+	t.Run("create and get", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		e.Description = "weekly sync"
+		e.NotifyBefore = 15 * time.Minute
+
+		require.NoError(t, s.Create(ctx, e))
+
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		e.Version = 1
+		require.Equal(t, e, got)
+	})
+
+	t.Run("create existing", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		require.NoError(t, s.Create(ctx, e))
+
+		e.StartAt = e.StartAt.Add(24 * time.Hour)
+		e.EndAt = e.EndAt.Add(24 * time.Hour)
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrEventExists)
+	})
+
+	t.Run("invalid event", func(t *testing.T) {
+		s := New()
+
+		e := newEvent("user", baseTime, time.Hour)
+		e.Title = " "
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrEmptyTitle)
+
+		e = newEvent("", baseTime, time.Hour)
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrEmptyUserID)
+
+		e = newEvent("user", baseTime, -time.Hour)
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrInvalidPeriod)
+
+		e = newEvent("user", baseTime, time.Hour)
+		e.NotifyBefore = -time.Minute
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrInvalidNotifyBefore)
+	})
+
+	t.Run("date busy", func(t *testing.T) {
+		s := New()
+		require.NoError(t, s.Create(ctx, newEvent("user", baseTime, time.Hour)))
+
+		err := s.Create(ctx, newEvent("user", baseTime.Add(30*time.Minute), time.Hour))
+		require.ErrorIs(t, err, storage.ErrDateBusy)
+
+		err = s.Create(ctx, newEvent("user", baseTime.Add(-30*time.Minute), 2*time.Hour))
+		require.ErrorIs(t, err, storage.ErrDateBusy)
+
+		// Adjacent events and events of other users do not collide.
+		require.NoError(t, s.Create(ctx, newEvent("user", baseTime.Add(time.Hour), time.Hour)))
+		require.NoError(t, s.Create(ctx, newEvent("other", baseTime, time.Hour)))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		require.NoError(t, s.Create(ctx, e))
+
+		e.Title = "retro"
+		e.EndAt = e.EndAt.Add(30 * time.Minute)
+		require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, "retro", got.Title)
+		require.Equal(t, 90*time.Minute, got.Duration())
+	})
+
+	t.Run("update busy", func(t *testing.T) {
+		s := New()
+		first := newEvent("user", baseTime, time.Hour)
+		second := newEvent("user", baseTime.Add(2*time.Hour), time.Hour)
+		require.NoError(t, s.Create(ctx, first))
+		require.NoError(t, s.Create(ctx, second))
+
+		second.StartAt = baseTime.Add(30 * time.Minute)
+		require.ErrorIs(t, s.Update(ctx, second.ID, second, storage.AnyVersion), storage.ErrDateBusy)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+
+		_, err := s.Get(ctx, e.UserID, e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		require.ErrorIs(t, s.Update(ctx, e.ID, e, storage.AnyVersion), storage.ErrEventNotFound)
+		require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		require.NoError(t, s.Create(ctx, e))
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion))
+
+		_, err := s.Get(ctx, e.UserID, e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+	})
+
+	t.Run("other users", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		e.Attendees = []storage.Attendee{{UserID: "invitee", Status: storage.NeedsAction}}
+		require.NoError(t, s.Create(ctx, e))
+
+		_, err := s.Get(ctx, "other", e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		_, err = s.Get(ctx, "invitee", e.ID)
+		require.NoError(t, err)
+
+		for _, userID := range []string{"other", "invitee"} {
+			hijacked := e
+			hijacked.UserID = userID
+			hijacked.Attendees = nil
+			require.ErrorIs(t, s.Update(ctx, e.ID, hijacked, storage.AnyVersion), storage.ErrEventNotFound)
+			require.ErrorIs(t, s.Delete(ctx, userID, e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+		}
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), got.Version)
+	})
+}
+
+func TestStorageVersions(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	e := newEvent("user", baseTime, time.Hour)
+	require.NoError(t, s.Create(ctx, e))
+
+	version := func(id string) int64 {
+		got, err := s.Get(ctx, e.UserID, id)
+		require.NoError(t, err)
+		return got.Version
+	}
+	require.Equal(t, int64(1), version(e.ID))
+
+	e.Title = "retro"
+	require.NoError(t, s.Update(ctx, e.ID, e, 1))
+	require.Equal(t, int64(2), version(e.ID))
+
+	e.Title = "stale"
+	require.ErrorIs(t, s.Update(ctx, e.ID, e, 1), storage.ErrVersionConflict)
+	require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, 1), storage.ErrVersionConflict)
+	got, err := s.Get(ctx, e.UserID, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, "retro", got.Title)
+
+	e.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.NeedsAction}}
+	require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	require.NoError(t, s.SetAttendeeStatus(ctx, e.ID, "bob", storage.Accepted))
+	require.Equal(t, int64(4), version(e.ID))
+
+	series := newEvent("user", baseTime.AddDate(0, 0, 1), time.Hour)
+	series.RRule = "FREQ=DAILY;COUNT=3"
+	require.NoError(t, s.Create(ctx, series))
+	occurrence := series.StartAt.AddDate(0, 0, 1)
+	moved := newEvent("user", occurrence.Add(2*time.Hour), time.Hour)
+	require.NoError(t, s.UpdateOccurrence(ctx, series.ID, occurrence, moved))
+	require.Equal(t, int64(2), version(series.ID))
+	require.Equal(t, int64(1), version(storage.OccurrenceID(series.ID, occurrence)))
+	require.NoError(t, s.CancelOccurrence(ctx, series.ID, series.StartAt.AddDate(0, 0, 2)))
+	require.Equal(t, int64(3), version(series.ID))
+
+	require.ErrorIs(t, s.Delete(ctx, series.UserID, series.ID, 2), storage.ErrVersionConflict)
+	require.NoError(t, s.Delete(ctx, series.UserID, series.ID, 3))
+	require.ErrorIs(t, s.Delete(ctx, series.UserID, series.ID, 3), storage.ErrEventNotFound)
+}
+
+func TestStorageList(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	dayStart := time.Date(2021, time.June, 14, 0, 0, 0, 0, time.UTC)
+	events := []storage.Event{
+		newEvent("user", dayStart.Add(-time.Hour), 30*time.Minute),             // previous day
+		newEvent("user", dayStart.Add(-30*time.Minute), time.Hour),             // crosses midnight
+		newEvent("user", dayStart.Add(10*time.Hour), time.Hour),                // same day
+		newEvent("user", dayStart.AddDate(0, 0, 3), time.Hour),                 // same week
+		newEvent("user", dayStart.AddDate(0, 0, 7), time.Hour),                 // next week
+		newEvent("user", dayStart.AddDate(0, 1, 0).Add(-time.Hour), time.Hour), // last hour of month
+		newEvent("user", dayStart.AddDate(0, 1, 0), time.Hour),                 // next month
+	}
+	for _, e := range events {
+		require.NoError(t, s.Create(ctx, e))
+	}
+
+	ids := func(list []storage.Event) []string {
+		res := make([]string, 0, len(list))
+		for _, e := range list {
+			res = append(res, e.ID)
+		}
+		return res
+	}
+
+	other := newEvent("other", dayStart, time.Hour)
+	require.NoError(t, s.Create(ctx, other))
+
+	day, err := s.ListDay(ctx, "user", dayStart.Add(15*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, ids(events[1:3]), ids(day))
+	otherDay, err := s.ListDay(ctx, "other", dayStart)
+	require.NoError(t, err)
+	require.Equal(t, []string{other.ID}, ids(otherDay))
+
+	week, err := s.ListWeek(ctx, "user", dayStart)
+	require.NoError(t, err)
+	require.Equal(t, ids(events[1:4]), ids(week))
+
+	month, err := s.ListMonth(ctx, "user", dayStart)
+	require.NoError(t, err)
+	require.Equal(t, ids(events[1:6]), ids(month))
+
+	empty, err := s.ListDay(ctx, "user", dayStart.AddDate(1, 0, 0))
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	all, err := s.ListByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, ids(events), ids(all))
+
+	userDay, err := s.ListUserRange(ctx, "user", dayStart, dayStart.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, ids(events[1:3]), ids(userDay))
+	empty, err = s.ListUserRange(ctx, "nobody", dayStart, dayStart.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Empty(t, empty)
+}
+
+func TestStorageSearch(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	standup := newEvent("alice", baseTime, 30*time.Minute)
+	standup.Title = "Daily standup"
+	standup.NotifyBefore = 5 * time.Minute
+	review := newEvent("alice", baseTime.Add(time.Hour), time.Hour)
+	review.Title = "Code review"
+	review.Description = "Review the search API, then stand-up again"
+	invited := newEvent("bob", baseTime.Add(3*time.Hour), time.Hour)
+	invited.Title = "Architecture"
+	invited.Attendees = []storage.Attendee{{UserID: "alice", Status: storage.NeedsAction}}
+	series := newEvent("alice", baseTime.AddDate(0, 0, -7), time.Hour)
+	series.Title = "Weekly planning"
+	series.RRule = "FREQ=WEEKLY"
+	hidden := newEvent("carol", baseTime, time.Hour)
+	hidden.Title = "Daily standup"
+	deleted := newEvent("alice", baseTime.AddDate(0, 0, 1), time.Hour)
+	deleted.Title = "Daily standup"
+	for _, e := range []storage.Event{standup, review, invited, series, hidden, deleted} {
+		require.NoError(t, s.Create(storage.WithOverlap(ctx), e))
+	}
+	require.NoError(t, s.Delete(ctx, deleted.UserID, deleted.ID, storage.AnyVersion))
+
+	ids := func(page storage.SearchPage) []string {
+		res := make([]string, 0, len(page.Events))
+		for _, e := range page.Events {
+			res = append(res, e.ID)
+		}
+		return res
+	}
+	yes, no := true, false
+
+	tests := []struct {
+		name string
+		q    storage.SearchQuery
+		want []string
+	}{
+		{"all visible", storage.SearchQuery{}, []string{series.ID, standup.ID, review.ID, invited.ID}},
+		{"owner", storage.SearchQuery{OwnerID: "bob"}, []string{invited.ID}},
+		{
+			"time range", storage.SearchQuery{From: baseTime.Add(30 * time.Minute), To: baseTime.Add(3 * time.Hour)},
+			[]string{series.ID, review.ID},
+		},
+		{"ended series", storage.SearchQuery{To: baseTime.AddDate(0, 0, -7)}, []string{}},
+		{"with notification", storage.SearchQuery{HasNotification: &yes}, []string{standup.ID}},
+		{"without notification", storage.SearchQuery{HasNotification: &no}, []string{series.ID, review.ID, invited.ID}},
+		{"text in title", storage.SearchQuery{Text: "STANDUP"}, []string{standup.ID}},
+		{"all words", storage.SearchQuery{Text: "review stand"}, []string{review.ID}},
+		{"missing word", storage.SearchQuery{Text: "review standup"}, []string{}},
+		{"start descending", storage.SearchQuery{Sort: storage.SortByStartDesc}, []string{invited.ID, review.ID, standup.ID, series.ID}},
+		{"title", storage.SearchQuery{Sort: storage.SortByTitle}, []string{invited.ID, review.ID, standup.ID, series.ID}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q
+			q.UserID = "alice"
+			q.Limit = 10
+			if q.Sort == "" {
+				q.Sort = storage.SortByStart
+			}
+			page, err := s.Search(ctx, q)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, ids(page))
+			require.Nil(t, page.Next)
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		s := New()
+		for i := 0; i < 5; i++ {
+			e := newEvent("alice", baseTime, time.Hour)
+			e.ID = strconv.Itoa(i)
+			require.NoError(t, s.Create(storage.WithOverlap(ctx), e))
+		}
+
+		q := storage.SearchQuery{UserID: "alice", Sort: storage.SortByStartDesc, Limit: 2}
+		page, err := s.Search(ctx, q)
+		require.NoError(t, err)
+		require.Equal(t, []string{"4", "3"}, ids(page))
+		require.NotNil(t, page.Next)
+
+		// Pages continue after the last event seen, whatever changed before it.
+		require.NoError(t, s.Delete(ctx, "alice", "4", storage.AnyVersion))
+		early := newEvent("alice", baseTime.Add(-time.Hour), time.Hour)
+		early.ID = "early"
+		require.NoError(t, s.Create(storage.WithOverlap(ctx), early))
+
+		cursor, err := storage.ParseCursor(page.Next.Token())
+		require.NoError(t, err)
+		q.After = &cursor
+		page, err = s.Search(ctx, q)
+		require.NoError(t, err)
+		require.Equal(t, []string{"2", "1"}, ids(page))
+
+		q.After = page.Next
+		page, err = s.Search(ctx, q)
+		require.NoError(t, err)
+		require.Equal(t, []string{"0", "early"}, ids(page))
+		require.Nil(t, page.Next)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		cursor := storage.SortByTitle.CursorOf(standup)
+		for _, q := range []storage.SearchQuery{
+			{Sort: storage.SortByStart, Limit: 1},
+			{UserID: "alice", Sort: "end", Limit: 1},
+			{UserID: "alice", Sort: storage.SortByStart},
+			{UserID: "alice", Sort: storage.SortByStart, Limit: 1, From: baseTime, To: baseTime},
+			{UserID: "alice", Sort: storage.SortByStart, Limit: 1, After: &cursor},
+		} {
+			_, err := s.Search(ctx, q)
+			require.ErrorIs(t, err, storage.ErrInvalidSearch)
+		}
+
+		for _, token := range []string{"", "not a token", storage.Cursor{Sort: storage.SortByStart, Key: "now", ID: "1"}.Token()} {
+			_, err := storage.ParseCursor(token)
+			require.ErrorIs(t, err, storage.ErrInvalidPageToken, token)
+		}
+	})
+}
+
+func TestStorageAttendees(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	e := newEvent("alice", baseTime, time.Hour)
+	e.Attendees = []storage.Attendee{
+		{UserID: "bob", Status: storage.NeedsAction},
+		{UserID: "carol", Status: storage.NeedsAction},
+	}
+	require.NoError(t, s.Create(ctx, e))
+
+	invalid := newEvent("alice", baseTime.Add(2*time.Hour), time.Hour)
+	invalid.Attendees = []storage.Attendee{{UserID: "alice", Status: storage.NeedsAction}}
+	require.ErrorIs(t, s.Create(ctx, invalid), storage.ErrInvalidAttendees)
+	invalid.Attendees = []storage.Attendee{{UserID: "bob", Status: "maybe"}}
+	require.ErrorIs(t, s.Create(ctx, invalid), storage.ErrInvalidAttendeeStatus)
+
+	require.NoError(t, s.SetAttendeeStatus(ctx, e.ID, "bob", storage.Accepted))
+	require.ErrorIs(t, s.SetAttendeeStatus(ctx, e.ID, "dave", storage.Accepted), storage.ErrAttendeeNotFound)
+	require.ErrorIs(t, s.SetAttendeeStatus(ctx, "missing", "bob", storage.Accepted), storage.ErrEventNotFound)
+
+	from, to := baseTime.Add(-time.Hour), baseTime.Add(time.Hour)
+	busy, err := s.ListUserRange(ctx, "bob", from, to)
+	require.NoError(t, err)
+	require.Len(t, busy, 1, "accepted")
+	busy, err = s.ListUserRange(ctx, "carol", from, to)
+	require.NoError(t, err)
+	require.Empty(t, busy, "not responded yet")
+	visible, err := s.ListVisibleRange(ctx, "carol", from, to)
+	require.NoError(t, err)
+	require.Len(t, visible, 1, "invited")
+	visible, err = s.ListVisibleRange(ctx, "dave", from, to)
+	require.NoError(t, err)
+	require.Empty(t, visible, "not invited")
+
+	// Invitations do not make the time of attendees busy for their own events.
+	require.NoError(t, s.Create(ctx, newEvent("bob", baseTime, time.Hour)))
+
+	t.Run("update keeps responses", func(t *testing.T) {
+		updated := e
+		updated.Title = "moved"
+		updated.Attendees = []storage.Attendee{
+			{UserID: "bob", Status: storage.NeedsAction},
+			{UserID: "dave", Status: storage.NeedsAction},
+		}
+		require.NoError(t, s.Update(ctx, e.ID, updated, storage.AnyVersion))
+
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, []storage.Attendee{
+			{UserID: "bob", Status: storage.Accepted},
+			{UserID: "dave", Status: storage.NeedsAction},
+		}, got.Attendees)
+		require.Equal(t, storage.Responses{NeedsAction: 1, Accepted: 1}, got.Responses())
+
+		busy, err := s.ListUserRange(ctx, "carol", from, to)
+		require.NoError(t, err)
+		require.Empty(t, busy)
+		require.ErrorIs(t, s.SetAttendeeStatus(ctx, e.ID, "carol", storage.Accepted), storage.ErrAttendeeNotFound)
+	})
+
+	t.Run("occurrences inherit responses", func(t *testing.T) {
+		series := newEvent("alice", baseTime.AddDate(0, 0, 1), time.Hour)
+		series.RRule = "FREQ=DAILY;COUNT=3"
+		series.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.NeedsAction}}
+		require.NoError(t, s.Create(ctx, series))
+		require.NoError(t, s.SetAttendeeStatus(ctx, series.ID, "bob", storage.Tentative))
+
+		recurrenceID := series.StartAt.AddDate(0, 0, 1)
+		moved := newEvent("alice", recurrenceID.Add(time.Hour), time.Hour)
+		moved.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.NeedsAction}}
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, recurrenceID, moved))
+
+		got, err := s.Get(ctx, "bob", storage.OccurrenceID(series.ID, recurrenceID))
+		require.NoError(t, err)
+		require.Equal(t, storage.Tentative, got.Attendees[0].Status)
+	})
+
+	t.Run("delete forgets invitations", func(t *testing.T) {
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion))
+		busy, err := s.ListUserRange(ctx, "bob", from, to)
+		require.NoError(t, err)
+		require.Len(t, busy, 1)
+		require.Equal(t, "bob", busy[0].UserID)
+	})
+}
+
+func TestStorageConcurrency(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	const writers = 50
+	const perWriter = 20
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var busy int
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := "user" + strconv.Itoa(i%5)
+			for j := 0; j < perWriter; j++ {
+				e := newEvent(userID, baseTime.Add(time.Duration(j)*time.Hour), time.Hour)
+				err := s.Create(ctx, e)
+				if errors.Is(err, storage.ErrDateBusy) {
+					mu.Lock()
+					busy++
+					mu.Unlock()
+					continue
+				}
+				require.NoError(t, err)
+
+				e.Title = "updated"
+				require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+				_, err = s.ListDay(ctx, userID, e.StartAt)
+				require.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Five users with twenty non-overlapping hourly slots each.
+	require.Equal(t, writers*perWriter-5*perWriter, busy)
+	for i := 0; i < 5; i++ {
+		month, err := s.ListMonth(ctx, "user"+strconv.Itoa(i), baseTime)
+		require.NoError(t, err)
+		require.Len(t, month, perWriter)
+		for _, e := range month {
+			require.Equal(t, "updated", e.Title)
+		}
+	}
+}
+
+func TestStorageNotifications(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	remind := func(start time.Time, before time.Duration) storage.Event {
+		e := newEvent("user", start, time.Hour)
+		e.NotifyBefore = before
+		require.NoError(t, s.Create(ctx, e))
+		return e
+	}
+	now := baseTime
+
+	due := remind(now.Add(10*time.Minute), 15*time.Minute)
+	remind(now.Add(2*time.Hour), 15*time.Minute)           // not yet
+	remind(now.Add(-50*time.Minute), time.Hour)            // already started
+	remind(now.Add(4*time.Hour), 0)                        // no reminder
+	dueLater := remind(now.AddDate(0, 0, 1), 25*time.Hour) // a day ahead
+
+	ids := func(list []storage.Event) []string {
+		res := make([]string, 0, len(list))
+		for _, e := range list {
+			res = append(res, e.ID)
+		}
+		return res
+	}
+
+	list, err := s.ListToNotify(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{due.ID, dueLater.ID}, ids(list))
+
+	require.NoError(t, s.MarkNotified(ctx, due.ID, due.StartAt))
+	require.ErrorIs(t, s.MarkNotified(ctx, "missing", baseTime), storage.ErrEventNotFound)
+
+	list, err = s.ListToNotify(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{dueLater.ID}, ids(list))
+
+	// Changing the title keeps the mark, moving the event resets it.
+	due.Title = "renamed"
+	require.NoError(t, s.Update(ctx, due.ID, due, storage.AnyVersion))
+	list, err = s.ListToNotify(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{dueLater.ID}, ids(list))
+
+	due.StartAt = due.StartAt.Add(time.Minute)
+	due.EndAt = due.EndAt.Add(time.Minute)
+	require.NoError(t, s.Update(ctx, due.ID, due, storage.AnyVersion))
+	list, err = s.ListToNotify(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, []string{due.ID, dueLater.ID}, ids(list))
+}
+
+func TestStorageDeleteEndedBefore(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	old := newEvent("user", baseTime.AddDate(-1, 0, -1), time.Hour)
+	boundary := newEvent("user", baseTime.AddDate(-1, 0, 0).Add(-time.Hour), time.Hour)
+	recent := newEvent("user", baseTime.AddDate(0, -1, 0), time.Hour)
+	for _, e := range []storage.Event{old, boundary, recent} {
+		require.NoError(t, s.Create(ctx, e))
+	}
+
+	n, err := s.DeleteEndedBefore(ctx, baseTime.AddDate(-1, 0, 0))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	_, err = s.Get(ctx, old.UserID, old.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.Get(ctx, boundary.UserID, boundary.ID)
+	require.NoError(t, err)
+	_, err = s.Get(ctx, recent.UserID, recent.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Delete(ctx, boundary.UserID, boundary.ID, storage.AnyVersion))
+	n, err = s.DeleteEndedBefore(ctx, baseTime)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n, "deleted events are purged too")
+	_, err = s.GetDeleted(ctx, boundary.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	history, err := s.History(ctx, boundary.ID)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func TestStorageSoftDelete(t *testing.T) {
+	ctx := storage.WithActor(context.Background(), "alice")
+
+	t.Run("delete and restore", func(t *testing.T) {
+		s := New()
+		e := newEvent("alice", baseTime, time.Hour)
+		require.NoError(t, s.Create(ctx, e))
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, 1))
+
+		_, err := s.Get(ctx, e.UserID, e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+		day, err := s.ListDay(ctx, "alice", baseTime)
+		require.NoError(t, err)
+		require.Empty(t, day)
+		require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+
+		deleted, err := s.GetDeleted(ctx, e.ID)
+		require.NoError(t, err)
+		require.False(t, deleted.DeletedAt.IsZero())
+		require.Equal(t, int64(2), deleted.Version)
+
+		require.NoError(t, s.Create(ctx, newEvent("alice", baseTime, time.Hour)), "deleted events free their time")
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrDateBusy)
+		require.NoError(t, s.Restore(storage.WithOverlap(ctx), e.ID))
+
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		require.True(t, got.DeletedAt.IsZero())
+		require.Equal(t, int64(3), got.Version)
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrNotDeleted)
+		require.ErrorIs(t, s.Restore(ctx, "missing"), storage.ErrEventNotFound)
+		_, err = s.GetDeleted(ctx, e.ID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+	})
+
+	t.Run("series with occurrences", func(t *testing.T) {
+		s := New()
+		series := newEvent("alice", baseTime, time.Hour)
+		series.RRule = "FREQ=DAILY;COUNT=5"
+		require.NoError(t, s.Create(ctx, series))
+		moved := newEvent("alice", baseTime.AddDate(0, 0, 1).Add(2*time.Hour), time.Hour)
+		cancelled := newEvent("alice", baseTime.AddDate(0, 0, 2).Add(2*time.Hour), time.Hour)
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 1), moved))
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 2), cancelled))
+		movedID := storage.OccurrenceID(series.ID, baseTime.AddDate(0, 0, 1))
+		cancelledID := storage.OccurrenceID(series.ID, baseTime.AddDate(0, 0, 2))
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 2)))
+
+		require.NoError(t, s.Delete(ctx, series.UserID, series.ID, storage.AnyVersion))
+		_, err := s.GetDeleted(ctx, movedID)
+		require.NoError(t, err)
+		require.ErrorIs(t, s.Restore(ctx, movedID), storage.ErrEventNotFound, "the series is deleted")
+
+		require.NoError(t, s.Restore(ctx, series.ID))
+		_, err = s.Get(ctx, "alice", movedID)
+		require.NoError(t, err, "occurrences deleted with the series come back")
+		_, err = s.Get(ctx, "alice", cancelledID)
+		require.ErrorIs(t, err, storage.ErrEventNotFound, "occurrences cancelled before stay deleted")
+
+		require.NoError(t, s.Restore(ctx, cancelledID))
+		_, err = s.Get(ctx, "alice", cancelledID)
+		require.NoError(t, err)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		s := New()
+		e := newEvent("alice", baseTime, time.Hour)
+		e.Attendees = []storage.Attendee{{UserID: "bob", Status: storage.NeedsAction}}
+		require.NoError(t, s.Create(ctx, e))
+		updated := e
+		updated.Title = "retro"
+		updated.EndAt = e.EndAt.Add(30 * time.Minute)
+		require.NoError(t, s.Update(ctx, e.ID, updated, storage.AnyVersion))
+		require.NoError(t, s.SetAttendeeStatus(storage.WithActor(ctx, "bob"), e.ID, "bob", storage.Accepted))
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion))
+		require.NoError(t, s.Restore(ctx, e.ID))
+
+		history, err := s.History(ctx, e.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 5)
+		for i, r := range history {
+			require.Equal(t, e.ID, r.EventID)
+			require.Equal(t, int64(i+1), r.Version)
+			require.False(t, r.At.IsZero())
+		}
+
+		require.Equal(t, storage.RevisionCreated, history[0].Action)
+		require.Equal(t, "alice", history[0].UserID)
+		require.Contains(t, history[0].Changes, storage.FieldChange{Field: "title", New: "meeting"})
+
+		require.Equal(t, storage.RevisionUpdated, history[1].Action)
+		require.Equal(t, []storage.FieldChange{
+			{Field: "title", Old: "meeting", New: "retro"},
+			{Field: "end_at", Old: "2021-06-14T11:00:00Z", New: "2021-06-14T11:30:00Z"},
+		}, history[1].Changes)
+
+		require.Equal(t, "bob", history[2].UserID)
+		require.Equal(t, []storage.FieldChange{
+			{Field: "attendees", Old: "bob:needs-action", New: "bob:accepted"},
+		}, history[2].Changes)
+
+		require.Equal(t, storage.RevisionDeleted, history[3].Action)
+		require.Empty(t, history[3].Changes)
+		require.Equal(t, storage.RevisionRestored, history[4].Action)
+
+		history, err = s.History(ctx, "missing")
+		require.NoError(t, err)
+		require.Empty(t, history)
+	})
+}
+
+func TestStorageRecurrence(t *testing.T) {
+	ctx := context.Background()
+	monday := baseTime // 2021-06-14 10:00, Monday
+	day := func(n int) time.Time { return monday.AddDate(0, 0, n) }
+
+	newSeries := func(s *Storage) storage.Event {
+		e := newEvent("user", monday, 30*time.Minute)
+		e.Title = "standup"
+		e.RRule = "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"
+		require.NoError(t, s.Create(ctx, e))
+		return e
+	}
+	starts := func(list []storage.Event) []time.Time {
+		res := make([]time.Time, 0, len(list))
+		for _, e := range list {
+			res = append(res, e.StartAt)
+		}
+		return res
+	}
+
+	t.Run("lists expand occurrences", func(t *testing.T) {
+		s := New()
+		series := newSeries(s)
+
+		week, err := s.ListWeek(ctx, "user", monday)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{day(0), day(1), day(2), day(3), day(4)}, starts(week))
+		for _, occ := range week {
+			require.Equal(t, series.ID, occ.ID)
+			require.Equal(t, occ.StartAt, occ.RecurrenceID)
+			require.Equal(t, 30*time.Minute, occ.Duration())
+		}
+
+		weekend, err := s.ListDay(ctx, "user", day(5))
+		require.NoError(t, err)
+		require.Empty(t, weekend)
+
+		nextYear, err := s.ListDay(ctx, "user", monday.AddDate(1, 0, 0))
+		require.NoError(t, err)
+		require.Len(t, nextYear, 1)
+	})
+
+	t.Run("cancel and edit single occurrences", func(t *testing.T) {
+		s := New()
+		series := newSeries(s)
+
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(2)))
+
+		moved := newEvent("user", day(3).Add(time.Hour), time.Hour)
+		moved.Title = "planning"
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, day(3), moved))
+
+		week, err := s.ListWeek(ctx, "user", monday)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{day(0), day(1), day(3).Add(time.Hour), day(4)}, starts(week))
+
+		edited := week[2]
+		require.Equal(t, storage.OccurrenceID(series.ID, day(3)), edited.ID)
+		require.Equal(t, series.ID, edited.SeriesID)
+		require.Equal(t, day(3), edited.RecurrenceID)
+		require.Equal(t, "planning", edited.Title)
+
+		// Editing again updates the same replacement.
+		moved.Title = "retro"
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, day(3), moved))
+		got, err := s.Get(ctx, edited.UserID, edited.ID)
+		require.NoError(t, err)
+		require.Equal(t, "retro", got.Title)
+
+		// Updating the series keeps the exceptions.
+		series.Title = "daily"
+		require.NoError(t, s.Update(ctx, series.ID, series, storage.AnyVersion))
+		week, err = s.ListWeek(ctx, "user", monday)
+		require.NoError(t, err)
+		require.Len(t, week, 4)
+		require.Equal(t, "daily", week[0].Title)
+
+		// Cancelling an edited occurrence removes the replacement.
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(3)))
+		week, err = s.ListWeek(ctx, "user", monday)
+		require.NoError(t, err)
+		require.Equal(t, []time.Time{day(0), day(1), day(4)}, starts(week))
+
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, day(4), moved))
+		require.NoError(t, s.Delete(ctx, series.UserID, series.ID, storage.AnyVersion))
+		_, err = s.Get(ctx, series.UserID, storage.OccurrenceID(series.ID, day(4)))
+		require.ErrorIs(t, err, storage.ErrEventNotFound)
+	})
+
+	t.Run("occurrence errors", func(t *testing.T) {
+		s := New()
+		series := newSeries(s)
+		single := newEvent("user", day(-7), time.Hour)
+		require.NoError(t, s.Create(ctx, single))
+
+		require.ErrorIs(t, s.CancelOccurrence(ctx, "missing", day(1)), storage.ErrEventNotFound)
+		require.ErrorIs(t, s.CancelOccurrence(ctx, single.ID, single.StartAt), storage.ErrNotRecurring)
+		require.ErrorIs(t, s.CancelOccurrence(ctx, series.ID, day(5)), storage.ErrNoOccurrence)
+		require.ErrorIs(t, s.CancelOccurrence(ctx, series.ID, day(1).Add(time.Minute)), storage.ErrNoOccurrence)
+
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(1)))
+		require.ErrorIs(t, s.CancelOccurrence(ctx, series.ID, day(1)), storage.ErrNoOccurrence)
+
+		nested := newEvent("user", day(2), time.Hour)
+		nested.RRule = "FREQ=DAILY"
+		require.ErrorIs(t, s.UpdateOccurrence(ctx, series.ID, day(2), nested), storage.ErrNestedRecurrence)
+
+		invalid := newEvent("user", day(8), time.Hour)
+		invalid.RRule = "FREQ=HOURLY"
+		require.ErrorIs(t, s.Create(ctx, invalid), storage.ErrInvalidEvent)
+	})
+
+	t.Run("busy dates account for occurrences", func(t *testing.T) {
+		s := New()
+		series := newSeries(s)
+
+		require.ErrorIs(t, s.Create(ctx, newEvent("user", day(21).Add(15*time.Minute), time.Hour)), storage.ErrDateBusy)
+		require.NoError(t, s.Create(ctx, newEvent("user", day(19).Add(15*time.Minute), time.Hour)))
+
+		weekly := newEvent("user", day(1).Add(-30*time.Minute), time.Hour)
+		weekly.RRule = "FREQ=WEEKLY"
+		require.ErrorIs(t, s.Create(ctx, weekly), storage.ErrDateBusy)
+
+		// A cancelled occurrence frees its slot.
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(2)))
+		require.NoError(t, s.Create(ctx, newEvent("user", day(2), time.Hour)))
+
+		// An edited occurrence cannot be moved onto another one.
+		require.ErrorIs(t,
+			s.UpdateOccurrence(ctx, series.ID, day(3), newEvent("user", day(4), time.Hour)),
+			storage.ErrDateBusy)
+		week, err := s.ListWeek(ctx, "user", monday)
+		require.NoError(t, err)
+		require.Contains(t, starts(week), day(3))
+	})
+
+	t.Run("notifications for every occurrence", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", monday, 30*time.Minute)
+		e.RRule = "FREQ=DAILY;COUNT=3"
+		e.NotifyBefore = time.Hour
+		require.NoError(t, s.Create(ctx, e))
+
+		for i := 0; i < 3; i++ {
+			now := day(i).Add(-30 * time.Minute)
+			due, err := s.ListToNotify(ctx, now)
+			require.NoError(t, err)
+			require.Equal(t, []time.Time{day(i)}, starts(due))
+			require.NoError(t, s.MarkNotified(ctx, e.ID, due[0].StartAt))
+
+			due, err = s.ListToNotify(ctx, now)
+			require.NoError(t, err)
+			require.Empty(t, due)
+		}
+	})
+
+	t.Run("purge keeps endless series", func(t *testing.T) {
+		s := New()
+		endless := newEvent("user", monday.AddDate(-3, 0, 0), time.Hour)
+		endless.RRule = "FREQ=YEARLY"
+		finished := newEvent("user", monday.AddDate(-3, 0, 1), time.Hour)
+		finished.RRule = "FREQ=MONTHLY;COUNT=12"
+		require.NoError(t, s.Create(ctx, endless))
+		require.NoError(t, s.Create(ctx, finished))
+
+		n, err := s.DeleteEndedBefore(ctx, monday.AddDate(-1, 0, 0))
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+		_, err = s.Get(ctx, endless.UserID, endless.ID)
+		require.NoError(t, err)
+	})
+}
+
+func TestStorageTimeZones(t *testing.T) {
+	ctx := context.Background()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		day      time.Time
+		dayHours float64
+	}{
+		{name: "spring forward", day: time.Date(2021, time.March, 28, 0, 0, 0, 0, berlin), dayHours: 23},
+		{name: "fall back", day: time.Date(2021, time.October, 31, 0, 0, 0, 0, berlin), dayHours: 25},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s := New()
+			daily := newEvent("user", tc.day.AddDate(0, 0, -1).Add(9*time.Hour), time.Hour)
+			daily.RRule = "FREQ=DAILY;COUNT=3"
+			daily.TimeZone = "Europe/Berlin"
+			late := newEvent("user", time.Date(2021, tc.day.Month(), tc.day.Day(), 23, 30, 0, 0, berlin), 15*time.Minute)
+			next := newEvent("user", tc.day.AddDate(0, 0, 1).Add(30*time.Minute), 15*time.Minute)
+			for _, e := range []storage.Event{daily, late, next} {
+				require.NoError(t, s.Create(ctx, e))
+			}
+
+			from, to := storage.DayRange(tc.day)
+			require.Equal(t, tc.dayHours, to.Sub(from).Hours())
+
+			list, err := s.ListDay(ctx, "user", tc.day.Add(12*time.Hour))
+			require.NoError(t, err)
+			require.Len(t, list, 2)
+			require.Equal(t, daily.ID, list[0].ID)
+			require.Equal(t, 9, list[0].StartAt.In(berlin).Hour(), "occurrence keeps its local time")
+			require.Equal(t, time.UTC, list[0].StartAt.Location())
+			require.Equal(t, late.ID, list[1].ID)
+		})
+	}
+
+	t.Run("stored in UTC", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", time.Date(2021, time.July, 1, 9, 0, 0, 0, berlin), time.Hour)
+		require.NoError(t, s.Create(ctx, e))
+
+		got, err := s.Get(ctx, e.UserID, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, time.Date(2021, time.July, 1, 7, 0, 0, 0, time.UTC), got.StartAt)
+	})
+
+	t.Run("unknown zone", func(t *testing.T) {
+		s := New()
+		e := newEvent("user", baseTime, time.Hour)
+		e.TimeZone = "Mars/Olympus"
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrInvalidEvent)
+	})
+}
+
+func TestStorageUsers(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	_, err := s.GetUser(ctx, "user")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	u := storage.User{ID: "user", TimeZone: "America/New_York", WeekStart: time.Sunday}
+	require.NoError(t, s.SaveUser(ctx, u))
+	got, err := s.GetUser(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, u, got)
+
+	require.ErrorIs(t, s.SaveUser(ctx, storage.User{}), storage.ErrEmptyUserSettingsID)
+	require.ErrorIs(t, s.SaveUser(ctx, storage.User{ID: "user", TimeZone: "nowhere"}), storage.ErrInvalidUser)
+	require.ErrorIs(t, s.SaveUser(ctx, storage.User{ID: "user", WeekStart: 7}), storage.ErrInvalidUser)
 }
@@ -0,0 +1,34 @@
+package storage
+
+import "time"
+
+// Notification reminds a user about an upcoming event. It is not stored,
+// the scheduler builds it and passes it to the sender through a queue.
+type Notification struct {
+	EventID string    `json:"event_id"`
+	Title   string    `json:"title"`
+	Date    time.Time `json:"date"`
+	UserID  string    `json:"user_id"`
+}
+
+func NewNotification(e Event) Notification {
+	return Notification{
+		EventID: e.ID,
+		Title:   e.Title,
+		Date:    e.StartAt,
+		UserID:  e.UserID,
+	}
+}
+
+// Notifications returns a notification to the owner and to every attendee who accepted the event.
+func Notifications(e Event) []Notification {
+	res := []Notification{NewNotification(e)}
+	for _, a := range e.Attendees {
+		if a.Status == Accepted {
+			n := NewNotification(e)
+			n.UserID = a.UserID
+			res = append(res, n)
+		}
+	}
+	return res
+}
@@ -0,0 +1,21 @@
+package storage
+
+import "context"
+
+type allowOverlapKey struct{}
+
+// WithOverlap returns a context making Create, Update, UpdateOccurrence and
+// Restore store the event even if it overlaps other events of the user.
+// Events stored this way are left out of later busy checks, so they do not
+// block other events of the user. A write without the option which moves
+// such an event checks it again, one which keeps its time keeps the
+// exemption.
+func WithOverlap(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowOverlapKey{}, true)
+}
+
+// OverlapAllowed reports whether ctx comes from WithOverlap.
+func OverlapAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowOverlapKey{}).(bool)
+	return allowed
+}
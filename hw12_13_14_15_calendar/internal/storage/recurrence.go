@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/rrule"
+)
+
+// ConflictHorizon bounds how far ahead occurrences of recurring events are
+// compared when looking for a busy date, endless series are not checked
+// beyond it.
+const ConflictHorizon = 365 * 24 * time.Hour
+
+// Occurrences returns the occurrences of the event overlapping [from, to)
+// ordered by start. A one-off event is its own single occurrence, expanded
+// occurrences keep the series ID and get RecurrenceID set to their start.
+func (e Event) Occurrences(from, to time.Time) []Event {
+	if !e.Recurring() {
+		if e.Overlaps(from, to) {
+			return []Event{e}
+		}
+		return nil
+	}
+
+	var res []Event
+	d := e.Duration()
+	e.iterate(func(start time.Time) bool {
+		if !start.Before(to) {
+			return false
+		}
+		if start.Add(d).After(from) {
+			res = append(res, e.occurrence(start))
+		}
+		return true
+	})
+	return res
+}
+
+// HasOccurrence reports whether a not cancelled occurrence starts at start.
+func (e Event) HasOccurrence(start time.Time) bool {
+	if !e.Recurring() {
+		return e.StartAt.Equal(start)
+	}
+
+	found := false
+	e.iterate(func(t time.Time) bool {
+		found = t.Equal(start)
+		return t.Before(start)
+	})
+	return found
+}
+
+// SeriesEnd returns the end of the last occurrence, ok is false for endless series.
+func (e Event) SeriesEnd() (end time.Time, ok bool) {
+	if !e.Recurring() {
+		return e.EndAt, true
+	}
+	r, err := rrule.Parse(e.RRule)
+	if err != nil {
+		return e.EndAt, true
+	}
+	last, ok := r.Last(e.StartAt.In(e.Location()))
+	if !ok {
+		return time.Time{}, false
+	}
+	return last.Add(e.Duration()).UTC(), true
+}
+
+// iterate calls fn with starts of not cancelled occurrences until it returns
+// false. The occurrences are expanded in the zone of the event and given in UTC.
+func (e Event) iterate(fn func(start time.Time) bool) {
+	r, err := rrule.Parse(e.RRule)
+	if err != nil {
+		fn(e.StartAt)
+		return
+	}
+
+	it := r.Iterator(e.StartAt.In(e.Location()))
+	for {
+		start, ok := it.Next()
+		if !ok {
+			return
+		}
+		start = start.UTC()
+		if e.excluded(start) {
+			continue
+		}
+		if !fn(start) {
+			return
+		}
+	}
+}
+
+func (e Event) excluded(start time.Time) bool {
+	for _, ex := range e.ExDates {
+		if ex.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Event) occurrence(start time.Time) Event {
+	e.RecurrenceID = start
+	e.EndAt = start.Add(e.Duration())
+	e.StartAt = start
+	return e
+}
+
+// Expand replaces recurring events with their occurrences overlapping
+// [from, to) and sorts the result by start.
+func Expand(events []Event, from, to time.Time) []Event {
+	res := make([]Event, 0, len(events))
+	for _, e := range events {
+		res = append(res, e.Occurrences(from, to)...)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].StartAt.Before(res[j].StartAt)
+	})
+	return res
+}
+
+// SameSchedule reports whether a and b belong to the same user and have
+// the same occurrences, an update from a to b needs no busy check then.
+func SameSchedule(a, b Event) bool {
+	if a.UserID != b.UserID || !a.StartAt.Equal(b.StartAt) || !a.EndAt.Equal(b.EndAt) ||
+		a.RRule != b.RRule || a.TimeZone != b.TimeZone || len(a.ExDates) != len(b.ExDates) {
+		return false
+	}
+	for i := range a.ExDates {
+		if !a.ExDates[i].Equal(b.ExDates[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Conflict reports whether any occurrences of the two events overlap.
+func Conflict(a, b Event) bool {
+	if !a.Recurring() && !b.Recurring() {
+		return a.Overlaps(b.StartAt, b.EndAt)
+	}
+
+	from := a.StartAt
+	if b.StartAt.After(from) {
+		from = b.StartAt
+	}
+	to := from.Add(ConflictHorizon)
+	for _, e := range []Event{a, b} {
+		if end, ok := e.SeriesEnd(); ok && end.Before(to) {
+			to = end
+		}
+	}
+	if !from.Before(to) {
+		return false
+	}
+
+	occA, occB := a.Occurrences(from, to), b.Occurrences(from, to)
+	for i, j := 0, 0; i < len(occA) && j < len(occB); {
+		if occA[i].Overlaps(occB[j].StartAt, occB[j].EndAt) {
+			return true
+		}
+		if occA[i].EndAt.Before(occB[j].EndAt) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return false
+}
+
+// OccurrenceID is the ID of the event replacing the occurrence of the series
+// starting at recurrenceID.
+func OccurrenceID(seriesID string, recurrenceID time.Time) string {
+	return seriesID + "_" + recurrenceID.UTC().Format("20060102T150405Z")
+}
+
+// DueOccurrences returns occurrences which start after now and whose
+// reminder time has come, skipping those starting at or before notifiedUntil.
+func DueOccurrences(e Event, now, notifiedUntil time.Time) []Event {
+	if e.NotifyBefore <= 0 {
+		return nil
+	}
+	after := now
+	if notifiedUntil.After(after) {
+		after = notifiedUntil
+	}
+	until := now.Add(e.NotifyBefore)
+
+	var res []Event
+	if !e.Recurring() {
+		if e.StartAt.After(after) && !e.StartAt.After(until) {
+			res = append(res, e)
+		}
+		return res
+	}
+
+	e.iterate(func(start time.Time) bool {
+		if start.After(until) {
+			return false
+		}
+		if start.After(after) {
+			res = append(res, e.occurrence(start))
+		}
+		return true
+	})
+	return res
+}
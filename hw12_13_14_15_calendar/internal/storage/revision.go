@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// RevisionAction tells what a revision did to the event.
+type RevisionAction string
+
+const (
+	RevisionCreated  RevisionAction = "created"
+	RevisionUpdated  RevisionAction = "updated"
+	RevisionDeleted  RevisionAction = "deleted"
+	RevisionRestored RevisionAction = "restored"
+)
+
+// Revision is a recorded change of an event. Storage records one for every
+// change, so the revisions of an event are numbered by its versions.
+type Revision struct {
+	EventID string
+	// Version is the version of the event after the change.
+	Version int64
+	// UserID is the user who made the change, empty for changes made
+	// without WithActor.
+	UserID string
+	Action RevisionAction
+	At     time.Time
+	// Changes are the changed fields, deletes and restores change none.
+	Changes []FieldChange
+}
+
+// FieldChange is the old and the new value of a changed event field in text form.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context making storage record userID as the author of the changes.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// Actor returns the user set by WithActor, empty if there is none.
+func Actor(ctx context.Context) string {
+	userID, _ := ctx.Value(actorKey{}).(string)
+	return userID
+}
+
+// NewRevision returns the revision changing old into e made by the actor of
+// ctx, version is the version of e after the change.
+func NewRevision(ctx context.Context, action RevisionAction, old, e Event, version int64) Revision {
+	return Revision{
+		EventID: e.ID,
+		Version: version,
+		UserID:  Actor(ctx),
+		Action:  action,
+		At:      time.Now().UTC(),
+		Changes: Diff(old, e),
+	}
+}
+
+// Diff returns the fields users edit which differ between old and e, times
+// are compared in UTC. Diff of an empty event lists all fields e has set.
+func Diff(old, e Event) []FieldChange {
+	old, e = old.UTC(), e.UTC()
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"title", old.Title, e.Title},
+		{"start_at", formatTime(old.StartAt), formatTime(e.StartAt)},
+		{"end_at", formatTime(old.EndAt), formatTime(e.EndAt)},
+		{"description", old.Description, e.Description},
+		{"notify_before", formatDuration(old.NotifyBefore), formatDuration(e.NotifyBefore)},
+		{"time_zone", old.TimeZone, e.TimeZone},
+		{"rrule", old.RRule, e.RRule},
+		{"exdates", formatTimes(old.ExDates), formatTimes(e.ExDates)},
+		{"attendees", formatAttendees(old.Attendees), formatAttendees(e.Attendees)},
+	}
+
+	var changes []FieldChange
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return changes
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatTimes(ts []time.Time) string {
+	res := make([]string, 0, len(ts))
+	for _, t := range ts {
+		res = append(res, formatTime(t))
+	}
+	return strings.Join(res, ",")
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// formatAttendees lists attendees as "user:status" separated by commas.
+func formatAttendees(attendees []Attendee) string {
+	res := make([]string, 0, len(attendees))
+	for _, a := range attendees {
+		res = append(res, a.UserID+":"+string(a.Status))
+	}
+	return strings.Join(res, ",")
+}
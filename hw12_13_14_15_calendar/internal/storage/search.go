@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchSort orders search results, events with equal keys are ordered by ID.
+type SearchSort string
+
+const (
+	SortByStart     SearchSort = "start"
+	SortByStartDesc SearchSort = "-start"
+	// SortByTitle orders titles by their bytes, not by a language collation.
+	SortByTitle SearchSort = "title"
+)
+
+func (s SearchSort) Valid() bool {
+	switch s {
+	case SortByStart, SortByStartDesc, SortByTitle:
+		return true
+	default:
+		return false
+	}
+}
+
+// SearchQuery selects a page of events which are not deleted. Recurring
+// events are not expanded, a series matches the time range when the span
+// from its first start to its last end overlaps it.
+type SearchQuery struct {
+	// UserID limits results to events the user owns or is invited to.
+	UserID string
+	// OwnerID limits results to events of the owner when set.
+	OwnerID string
+	// From and To limit results to events overlapping [From, To), a zero
+	// bound is open.
+	From, To time.Time
+	// HasNotification limits results to events with or without NotifyBefore when set.
+	HasNotification *bool
+	// Text limits results to events whose title or description contain all
+	// its words as split by SearchWords.
+	Text string
+	Sort SearchSort
+	// After continues the search after the last event of the previous page.
+	After *Cursor
+	// Limit is the maximal number of events of the page.
+	Limit int
+}
+
+// SearchPage is a page of search results.
+type SearchPage struct {
+	Events []Event
+	// Next continues the search, it is nil on the last page.
+	Next *Cursor
+}
+
+// Cursor is the position of an event in the search order. It does not
+// depend on the events around it, so pages stay consistent while events
+// are added and removed.
+type Cursor struct {
+	Sort SearchSort `json:"s"`
+	// Key is the sort key of the event, the start in RFC 3339 or the title.
+	Key string `json:"k"`
+	ID  string `json:"i"`
+}
+
+func (q SearchQuery) Validate() error {
+	if q.UserID == "" {
+		return ErrEmptySearchUserID
+	}
+	if !q.Sort.Valid() {
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidSearch, q.Sort)
+	}
+	if q.Limit <= 0 {
+		return fmt.Errorf("%w: limit must be positive", ErrInvalidSearch)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		return fmt.Errorf("%w: the time range must end after it starts", ErrInvalidSearch)
+	}
+	if q.After != nil && q.After.Sort != q.Sort {
+		return fmt.Errorf("%w: the page token belongs to another sort", ErrInvalidSearch)
+	}
+	return nil
+}
+
+// Matches reports whether e passes the filters of the query, the cursor
+// is not taken into account.
+func (q SearchQuery) Matches(e Event) bool {
+	if !e.VisibleTo(q.UserID) || (q.OwnerID != "" && e.UserID != q.OwnerID) {
+		return false
+	}
+	if !q.To.IsZero() && !e.StartAt.Before(q.To) {
+		return false
+	}
+	if end, ok := e.SeriesEnd(); ok && !q.From.IsZero() && !end.After(q.From) {
+		return false
+	}
+	if q.HasNotification != nil && (e.NotifyBefore > 0) != *q.HasNotification {
+		return false
+	}
+	return q.Text == "" || containsWords(e.Title+" "+e.Description, q.Text)
+}
+
+// Page sorts the matching events and returns the page after the cursor of
+// the query. It lets storages without indexes implement Search.
+func (q SearchQuery) Page(events []Event) SearchPage {
+	matching := make([]Event, 0)
+	for _, e := range events {
+		if q.Matches(e) && (q.After == nil || q.after(e, *q.After)) {
+			matching = append(matching, e)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return q.after(matching[j], q.Sort.CursorOf(matching[i]))
+	})
+
+	page := SearchPage{Events: matching}
+	if len(matching) > q.Limit {
+		page.Events = matching[:q.Limit]
+		next := q.Sort.CursorOf(page.Events[q.Limit-1])
+		page.Next = &next
+	}
+	return page
+}
+
+// after reports whether e comes after the cursor in the order of the query.
+func (q SearchQuery) after(e Event, c Cursor) bool {
+	var cmp int
+	switch q.Sort {
+	case SortByTitle:
+		cmp = strings.Compare(e.Title, c.Key)
+	default:
+		at, _ := time.Parse(time.RFC3339Nano, c.Key)
+		switch {
+		case e.StartAt.Before(at):
+			cmp = -1
+		case e.StartAt.After(at):
+			cmp = 1
+		}
+		if q.Sort == SortByStartDesc {
+			cmp = -cmp
+		}
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(e.ID, c.ID)
+		if q.Sort == SortByStartDesc {
+			cmp = -cmp
+		}
+	}
+	return cmp > 0
+}
+
+// CursorOf returns the position of e in the order.
+func (s SearchSort) CursorOf(e Event) Cursor {
+	c := Cursor{Sort: s, ID: e.ID}
+	if s == SortByTitle {
+		c.Key = e.Title
+	} else {
+		c.Key = e.StartAt.UTC().Format(time.RFC3339Nano)
+	}
+	return c
+}
+
+// Token encodes the cursor as an opaque string for clients.
+func (c Cursor) Token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a token made by Cursor.Token.
+func ParseCursor(token string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err == nil && c.Sort != SortByTitle {
+		_, err = time.Parse(time.RFC3339Nano, c.Key)
+	}
+	if err != nil || !c.Sort.Valid() || c.ID == "" {
+		return Cursor{}, ErrInvalidPageToken
+	}
+	return c, nil
+}
+
+// containsWords reports whether text contains all words of query, a query
+// without words matches any text.
+func containsWords(text, query string) bool {
+	words := make(map[string]bool)
+	for _, w := range SearchWords(text) {
+		words[w] = true
+	}
+	for _, w := range SearchWords(query) {
+		if !words[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchWords splits text to the words search compares: runs of letters and
+// digits in lower case, each word once. Storages with indexes keep the words
+// of events instead of splitting the text their own way.
+func SearchWords(text string) []string {
+	seen := make(map[string]bool)
+	words := make([]string, 0)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
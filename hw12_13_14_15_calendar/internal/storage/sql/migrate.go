@@ -0,0 +1,266 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/migrations"
+	"github.com/jackc/pgconn"
+)
+
+// migrationsLockID is an arbitrary key of the advisory lock taken while migrating.
+const migrationsLockID = 4_242_001
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrPendingMigration = errors.New("migration is not applied")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+func (m MigrationStatus) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// LoadMigrations reads <version>_<name>.up.sql and <version>_<name>.down.sql
+// pairs from the root of fsys and returns them ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("%w: unexpected file name %q", ErrInvalidMigration, file)
+		}
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad version in %q", ErrInvalidMigration, file)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("%w: version %d has different names", ErrInvalidMigration, version)
+		}
+		if direction == ".up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%w: version %d must have both up and down files", ErrInvalidMigration, m.Version)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
+
+// MigrateUp applies all pending migrations, each in its own transaction.
+func (s *Storage) MigrateUp(ctx context.Context) error {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		m := m
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+				return err
+			}
+
+			var applied bool
+			err := tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.Version,
+			).Scan(&applied)
+			if err != nil || applied {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name,
+			)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the latest applied migration.
+func (s *Storage) MigrateDown(ctx context.Context) error {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+			return err
+		}
+
+		var version int64
+		err := tx.QueryRowContext(ctx, `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).
+			Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, m := range list {
+			if m.Version != version {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version)
+			return err
+		}
+
+		return fmt.Errorf("%w: applied version %d is unknown", ErrInvalidMigration, version)
+	})
+}
+
+// MigrationStatus lists known migrations with the time they were applied.
+func (s *Storage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(list))
+	for _, m := range list {
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			AppliedAt: applied[m.Version],
+		})
+	}
+
+	return statuses, nil
+}
+
+// CheckReady fails when the database is unreachable or a known migration
+// is not applied yet, the storage can not serve requests then. Unlike
+// MigrationStatus it only reads, so probes never touch the schema.
+func (s *Storage) CheckReady(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", err)
+	}
+
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == undefinedTable {
+		return fmt.Errorf("%w: schema_migrations table does not exist", ErrPendingMigration)
+	}
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if _, ok := applied[m.Version]; !ok {
+			return fmt.Errorf("%w: %d_%s", ErrPendingMigration, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the time each applied migration was applied at by version.
+func (s *Storage) appliedMigrations(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (s *Storage) ensureMigrationsTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text        NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`,
+	)
+	return err
+}
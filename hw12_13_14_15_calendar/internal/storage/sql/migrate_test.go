@@ -0,0 +1,158 @@
+package sqlstorage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/migrations"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("embedded", func(t *testing.T) {
+		list, err := LoadMigrations(migrations.FS)
+		require.NoError(t, err)
+		require.NotEmpty(t, list)
+		require.Equal(t, int64(1), list[0].Version)
+		require.Equal(t, "create_events", list[0].Name)
+		require.Contains(t, list[0].Up, "CREATE TABLE events")
+		require.Contains(t, list[0].Down, "DROP TABLE")
+
+		for i := 1; i < len(list); i++ {
+			require.Less(t, list[i-1].Version, list[i].Version)
+		}
+	})
+
+	t.Run("ordered", func(t *testing.T) {
+		list, err := LoadMigrations(fstest.MapFS{
+			"00010_b.up.sql":   {Data: []byte("b up")},
+			"00010_b.down.sql": {Data: []byte("b down")},
+			"00002_a.up.sql":   {Data: []byte("a up")},
+			"00002_a.down.sql": {Data: []byte("a down")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Migration{
+			{Version: 2, Name: "a", Up: "a up", Down: "a down"},
+			{Version: 10, Name: "b", Up: "b up", Down: "b down"},
+		}, list)
+	})
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down":  {"00001_a.up.sql": {Data: []byte("up")}},
+		"bad version":   {"first_a.up.sql": {Data: []byte("up")}, "first_a.down.sql": {Data: []byte("down")}},
+		"bad direction": {"00001_a.sql": {Data: []byte("up")}},
+		"name mismatch": {"00001_a.up.sql": {Data: []byte("up")}, "00001_b.down.sql": {Data: []byte("down")}},
+	} {
+		fsys := fsys
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadMigrations(fsys)
+			require.ErrorIs(t, err, ErrInvalidMigration)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	list, err := LoadMigrations(migrations.FS)
+	require.NoError(t, err)
+
+	t.Run("up applies pending migrations only", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+		for i, m := range list {
+			mock.ExpectBegin()
+			mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM schema_migrations`).
+				WithArgs(m.Version).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(i == 0))
+			if i > 0 {
+				mock.ExpectExec(regexp.QuoteMeta(m.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO schema_migrations`).
+					WithArgs(m.Version, m.Name).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+		}
+
+		require.NoError(t, s.MigrateUp(ctx))
+	})
+
+	t.Run("down rolls back the latest migration", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		last := list[len(list)-1]
+
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(last.Version))
+		mock.ExpectExec(regexp.QuoteMeta(last.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM schema_migrations`).
+			WithArgs(last.Version).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, s.MigrateDown(ctx))
+	})
+
+	t.Run("down without applied migrations", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectCommit()
+
+		require.NoError(t, s.MigrateDown(ctx))
+	})
+
+	t.Run("status", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		appliedAt := time.Date(2021, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(list[0].Version, appliedAt))
+
+		statuses, err := s.MigrationStatus(ctx)
+		require.NoError(t, err)
+		require.Len(t, statuses, len(list))
+		require.True(t, statuses[0].Applied())
+		require.Equal(t, appliedAt, statuses[0].AppliedAt)
+		for _, st := range statuses[1:] {
+			require.False(t, st.Applied())
+		}
+	})
+	t.Run("ready", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		applied := sqlmock.NewRows([]string{"version", "applied_at"})
+		for _, m := range list {
+			applied.AddRow(m.Version, time.Now())
+		}
+
+		mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).WillReturnRows(applied)
+		require.NoError(t, s.CheckReady(ctx))
+
+		last := list[len(list)-1]
+		applied = sqlmock.NewRows([]string{"version", "applied_at"})
+		for _, m := range list[:len(list)-1] {
+			applied.AddRow(m.Version, time.Now())
+		}
+		mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).WillReturnRows(applied)
+		err := s.CheckReady(ctx)
+		require.ErrorIs(t, err, ErrPendingMigration)
+		require.Contains(t, err.Error(), last.Name)
+
+		mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+			WillReturnError(&pgconn.PgError{Code: undefinedTable})
+		require.ErrorIs(t, s.CheckReady(ctx), ErrPendingMigration)
+	})
+}
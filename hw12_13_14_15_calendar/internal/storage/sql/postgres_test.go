@@ -0,0 +1,474 @@
+//go:build integration
+// +build integration
+
+package sqlstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/storagetest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Tests of this file run with "go test -tags integration" against the
+// database of POSTGRES_DSN, make integration-tests starts one in a container.
+// Without POSTGRES_DSN every test starts a throwaway Postgres in a temporary
+// directory, initdb and pg_ctl are looked up in PATH and in the usual install
+// directories. Unlike the sqlmock tests they check what the queries do rather
+// than how they are written.
+
+// postgresBinDirs are where distributions install the server binaries without
+// putting them in PATH.
+var postgresBinDirs = []string{
+	"/usr/lib/postgresql/*/bin",
+	"/usr/pgsql-*/bin",
+	"/usr/local/opt/postgresql*/bin",
+	"/opt/homebrew/opt/postgresql*/bin",
+}
+
+// lookPostgresBin finds the server binary name, the newest installed version
+// wins.
+func lookPostgresBin(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	for _, pattern := range postgresBinDirs {
+		dirs, _ := filepath.Glob(pattern)
+		sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not installed", name)
+}
+
+// startPostgres initializes a cluster in a temporary directory, starts it on
+// a free local port and returns its DSN. The server is stopped and its files
+// removed when the test ends.
+func startPostgres(tb testing.TB) string {
+	tb.Helper()
+
+	initdb, err := lookPostgresBin("initdb")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pgCtl, err := lookPostgresBin("pg_ctl")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	dir := tb.TempDir()
+	data := filepath.Join(dir, "data")
+	run := func(name string, args ...string) {
+		tb.Helper()
+		out, err := exec.Command(name, args...).CombinedOutput()
+		if err != nil {
+			tb.Fatalf("%s: %v\n%s", filepath.Base(name), err, out)
+		}
+	}
+	run(initdb, "-D", data, "-U", "calendar", "-A", "trust", "-E", "UTF8", "--no-sync")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	// The socket goes to the temporary directory, the default one is usually
+	// not writable for the test user. fsync is off, the data is thrown away.
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -F", port, dir)
+	run(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-o", opts, "-w", "start")
+	tb.Cleanup(func() {
+		_ = exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+	})
+
+	return fmt.Sprintf("postgres://calendar@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+// newPostgresStorage connects to POSTGRES_DSN, or to a fresh Postgres when it
+// is not set, and applies migrations.
+func newPostgresStorage(tb testing.TB) *Storage {
+	tb.Helper()
+
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		dsn = startPostgres(tb)
+	}
+	ctx := context.Background()
+	s := New(dsn)
+	require.NoError(tb, s.Connect(ctx))
+	tb.Cleanup(func() { _ = s.Close(ctx) })
+	require.NoError(tb, s.MigrateUp(ctx))
+
+	return s
+}
+
+// newPostgresUser returns a user of its own for the test and removes the
+// events of the user afterwards, Delete only marks them deleted.
+func newPostgresUser(tb testing.TB, s *Storage) string {
+	tb.Helper()
+
+	userID := uuid.NewString()
+	tb.Cleanup(func() {
+		ctx := context.Background()
+		_, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE user_id = $1`, userID)
+		require.NoError(tb, err)
+	})
+	return userID
+}
+
+func TestStoragePostgres(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStorage(t)
+	require.NoError(t, s.CheckReady(ctx))
+
+	e := newEvent(newPostgresUser(t, s), baseTime, time.Hour)
+	require.NoError(t, s.Create(ctx, e))
+
+	require.ErrorIs(t, s.Create(ctx, e), storage.ErrEventExists)
+	require.ErrorIs(t, s.Create(ctx, newEvent(e.UserID, baseTime.Add(time.Minute), time.Hour)), storage.ErrDateBusy)
+
+	got, err := s.Get(ctx, e.UserID, e.ID)
+	require.NoError(t, err)
+	require.True(t, e.StartAt.Equal(got.StartAt))
+	require.Equal(t, e.NotifyBefore, got.NotifyBefore)
+
+	require.Equal(t, int64(1), got.Version)
+
+	e.Title = "retro"
+	require.NoError(t, s.Update(ctx, e.ID, e, 1))
+	require.ErrorIs(t, s.Update(ctx, e.ID, e, 1), storage.ErrVersionConflict)
+	require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, 1), storage.ErrVersionConflict)
+	got, err = s.Get(ctx, e.UserID, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), got.Version)
+
+	day, err := s.ListDay(ctx, e.UserID, baseTime)
+	require.NoError(t, err)
+	require.Contains(t, eventIDs(day), e.ID)
+	otherDay, err := s.ListDay(ctx, "other-"+e.UserID, baseTime)
+	require.NoError(t, err)
+	require.NotContains(t, eventIDs(otherDay), e.ID)
+
+	userDay, err := s.ListUserRange(ctx, e.UserID, baseTime.Add(-time.Hour), baseTime.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []string{e.ID}, eventIDs(userDay))
+
+	attendee := uuid.NewString()
+	e.Attendees = []storage.Attendee{{UserID: attendee, Status: storage.NeedsAction}}
+	require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	invited, err := s.ListUserRange(ctx, attendee, baseTime.Add(-time.Hour), baseTime.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, invited)
+	require.NoError(t, s.SetAttendeeStatus(ctx, e.ID, attendee, storage.Accepted))
+	invited, err = s.ListUserRange(ctx, attendee, baseTime.Add(-time.Hour), baseTime.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []string{e.ID}, eventIDs(invited))
+	require.Equal(t, storage.Accepted, invited[0].Attendees[0].Status)
+
+	due, err := s.ListToNotify(ctx, e.NotifyAt())
+	require.NoError(t, err)
+	require.Contains(t, eventIDs(due), e.ID)
+
+	require.NoError(t, s.MarkNotified(ctx, e.ID, e.StartAt))
+	due, err = s.ListToNotify(ctx, e.NotifyAt())
+	require.NoError(t, err)
+	require.NotContains(t, eventIDs(due), e.ID)
+
+	series := newEvent(e.UserID, baseTime.AddDate(0, 0, 1), time.Hour)
+	series.RRule = "FREQ=DAILY;COUNT=5"
+	require.NoError(t, s.Create(ctx, series))
+	require.ErrorIs(t, s.Create(ctx, newEvent(e.UserID, baseTime.AddDate(0, 0, 3), time.Hour)), storage.ErrDateBusy)
+
+	moved := newEvent(e.UserID, baseTime.AddDate(0, 0, 2).Add(2*time.Hour), time.Hour)
+	require.NoError(t, s.UpdateOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 2), moved))
+	require.NoError(t, s.CancelOccurrence(ctx, series.ID, baseTime.AddDate(0, 0, 3)))
+
+	week, err := s.ListWeek(ctx, e.UserID, baseTime)
+	require.NoError(t, err)
+	ids := eventIDs(week)
+	require.Contains(t, ids, storage.OccurrenceID(series.ID, baseTime.AddDate(0, 0, 2)))
+	require.Len(t, week, 5) // e, three series occurrences and the edited one
+
+	require.NoError(t, s.Delete(storage.WithActor(ctx, e.UserID), series.UserID, series.ID, storage.AnyVersion))
+	_, err = s.Get(ctx, series.UserID, storage.OccurrenceID(series.ID, baseTime.AddDate(0, 0, 2)))
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	deleted, err := s.GetDeleted(ctx, series.ID)
+	require.NoError(t, err)
+	require.False(t, deleted.DeletedAt.IsZero())
+	require.NoError(t, s.Create(ctx, newEvent(e.UserID, baseTime.AddDate(0, 0, 4), time.Hour)))
+	require.ErrorIs(t, s.Restore(ctx, series.ID), storage.ErrDateBusy)
+	require.NoError(t, s.Restore(storage.WithOverlap(ctx), series.ID))
+	_, err = s.Get(ctx, series.UserID, storage.OccurrenceID(series.ID, baseTime.AddDate(0, 0, 2)))
+	require.NoError(t, err)
+	require.ErrorIs(t, s.Restore(ctx, series.ID), storage.ErrNotDeleted)
+
+	history, err := s.History(ctx, series.ID)
+	require.NoError(t, err)
+	actions := make([]storage.RevisionAction, 0, len(history))
+	for _, r := range history {
+		actions = append(actions, r.Action)
+	}
+	require.Equal(t, []storage.RevisionAction{
+		storage.RevisionCreated, storage.RevisionUpdated, storage.RevisionUpdated,
+		storage.RevisionDeleted, storage.RevisionRestored,
+	}, actions)
+	require.Equal(t, e.UserID, history[3].UserID)
+
+	found, err := s.Search(ctx, storage.SearchQuery{
+		UserID: attendee, Text: "RETRO", Sort: storage.SortByStart, Limit: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{e.ID}, eventIDs(found.Events))
+	found, err = s.Search(ctx, storage.SearchQuery{UserID: e.UserID, Sort: storage.SortByStart, Limit: 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{e.ID}, eventIDs(found.Events))
+	found, err = s.Search(ctx, storage.SearchQuery{UserID: e.UserID, Sort: storage.SortByStart, After: found.Next, Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, series.ID, found.Events[0].ID)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	zoned := newEvent(e.UserID, time.Date(2021, time.March, 27, 9, 0, 0, 0, berlin), time.Hour)
+	zoned.RRule = "FREQ=DAILY;COUNT=3"
+	zoned.TimeZone = "Europe/Berlin"
+	require.NoError(t, s.Create(ctx, zoned))
+	got, err = s.Get(ctx, zoned.UserID, zoned.ID)
+	require.NoError(t, err)
+	require.Equal(t, zoned.TimeZone, got.TimeZone)
+	require.Equal(t, time.UTC, got.StartAt.Location())
+
+	overlapping := newEvent(e.UserID, baseTime.Add(30*time.Minute), time.Hour)
+	require.NoError(t, s.Create(storage.WithOverlap(ctx), overlapping))
+	// Events stored with overlaps allowed do not block others, updates
+	// keeping their time keep them exempt.
+	require.NoError(t, s.Create(ctx, newEvent(e.UserID, baseTime.Add(80*time.Minute), time.Hour)))
+	overlapping.Title = "review"
+	require.NoError(t, s.Update(ctx, overlapping.ID, overlapping, storage.AnyVersion))
+	e.Title = "standup"
+	require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	overlapping.StartAt = overlapping.StartAt.Add(time.Minute)
+	require.ErrorIs(t, s.Update(ctx, overlapping.ID, overlapping, storage.AnyVersion), storage.ErrDateBusy)
+	// The constraint rejects overlapping one-off events even without the check.
+	tx, err := s.db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, insertEvent(ctx, tx, newEvent(e.UserID, baseTime, time.Minute), false), storage.ErrDateBusy)
+	require.NoError(t, tx.Rollback())
+
+	u := storage.User{ID: e.UserID, TimeZone: "Europe/Berlin", WeekStart: time.Sunday}
+	require.NoError(t, s.SaveUser(ctx, u))
+	u.WeekStart = time.Monday
+	require.NoError(t, s.SaveUser(ctx, u))
+	gotUser, err := s.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, u, gotUser)
+}
+
+func TestStoragePostgresOverlap(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStorage(t)
+	userID := newPostgresUser(t, s)
+
+	standup := newEvent(userID, baseTime, time.Hour)
+	require.NoError(t, s.Create(ctx, standup))
+	require.ErrorIs(t, s.Create(ctx, newEvent(userID, baseTime.Add(30*time.Minute), time.Hour)), storage.ErrDateBusy)
+	require.ErrorIs(t, s.Create(ctx, newEvent(userID, baseTime.Add(-time.Hour), 2*time.Hour)), storage.ErrDateBusy)
+
+	// Touching events do not overlap, neither do events of other users.
+	retro := newEvent(userID, baseTime.Add(time.Hour), time.Hour)
+	require.NoError(t, s.Create(ctx, retro))
+	require.NoError(t, s.Create(ctx, newEvent(newPostgresUser(t, s), baseTime, time.Hour)))
+
+	moved := retro
+	moved.StartAt = baseTime.Add(30 * time.Minute)
+	require.ErrorIs(t, s.Update(ctx, retro.ID, moved, storage.AnyVersion), storage.ErrDateBusy)
+	got, err := s.Get(ctx, retro.UserID, retro.ID)
+	require.NoError(t, err)
+	require.True(t, retro.StartAt.Equal(got.StartAt))
+	require.Equal(t, int64(1), got.Version)
+
+	// Occurrences of a series are busy too.
+	weekly := newEvent(userID, baseTime.Add(4*time.Hour), time.Hour)
+	weekly.RRule = "FREQ=WEEKLY"
+	require.NoError(t, s.Create(ctx, weekly))
+	nextWeek := baseTime.AddDate(0, 0, 14).Add(4*time.Hour + 30*time.Minute)
+	require.ErrorIs(t, s.Create(ctx, newEvent(userID, nextWeek, time.Hour)), storage.ErrDateBusy)
+
+	// Concurrent writers of the same slot are serialized, one of them wins.
+	const writers = 10
+	slot := baseTime.Add(8 * time.Hour)
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.Create(ctx, newEvent(userID, slot.Add(time.Duration(i)*time.Minute), time.Hour))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		if errors.Is(err, storage.ErrDateBusy) {
+			continue
+		}
+		require.NoError(t, err)
+		created++
+	}
+	require.Equal(t, 1, created)
+}
+
+func TestStoragePostgresSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStorage(t)
+	userID := newPostgresUser(t, s)
+	attendee := uuid.NewString()
+
+	e := newEvent(userID, baseTime, time.Hour)
+	e.Title = "planning"
+	e.Attendees = []storage.Attendee{{UserID: attendee, Status: storage.Accepted}}
+	require.NoError(t, s.Create(ctx, e))
+	require.NoError(t, s.Delete(storage.WithActor(ctx, userID), e.UserID, e.ID, 1))
+
+	_, err := s.Get(ctx, e.UserID, e.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	deleted, err := s.GetDeleted(ctx, e.ID)
+	require.NoError(t, err)
+	require.False(t, deleted.DeletedAt.IsZero())
+	require.Equal(t, int64(2), deleted.Version)
+
+	requireVisible := func(visible bool) {
+		t.Helper()
+		check := require.NotContains
+		if visible {
+			check = require.Contains
+		}
+
+		day, err := s.ListDay(ctx, userID, baseTime)
+		require.NoError(t, err)
+		check(t, eventIDs(day), e.ID)
+		owned, err := s.ListByUser(ctx, userID)
+		require.NoError(t, err)
+		check(t, eventIDs(owned), e.ID)
+		busy, err := s.ListUserRange(ctx, attendee, baseTime, baseTime.Add(time.Hour))
+		require.NoError(t, err)
+		check(t, eventIDs(busy), e.ID)
+		invited, err := s.ListVisibleRange(ctx, attendee, baseTime, baseTime.Add(time.Hour))
+		require.NoError(t, err)
+		check(t, eventIDs(invited), e.ID)
+		found, err := s.Search(ctx, storage.SearchQuery{
+			UserID: userID, Text: "Planning", Sort: storage.SortByStart, Limit: 10,
+		})
+		require.NoError(t, err)
+		check(t, eventIDs(found.Events), e.ID)
+		due, err := s.ListToNotify(ctx, e.NotifyAt())
+		require.NoError(t, err)
+		check(t, eventIDs(due), e.ID)
+	}
+	requireVisible(false)
+
+	require.ErrorIs(t, s.Update(ctx, e.ID, e, storage.AnyVersion), storage.ErrEventNotFound)
+	require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+
+	// The slot of a deleted event is free until the event is restored.
+	other := newEvent(userID, baseTime, time.Hour)
+	require.NoError(t, s.Create(ctx, other))
+	require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrDateBusy)
+	require.NoError(t, s.Delete(ctx, other.UserID, other.ID, storage.AnyVersion))
+	require.NoError(t, s.Restore(ctx, e.ID))
+	requireVisible(true)
+	require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrNotDeleted)
+}
+
+func TestStoragePostgresContract(t *testing.T) {
+	s := newPostgresStorage(t)
+	storagetest.Run(t, func(t *testing.T) (storage.Storage, string) {
+		return s, newPostgresUser(t, s)
+	})
+}
+
+func TestStoragePostgresOwner(t *testing.T) {
+	ctx := context.Background()
+	s := newPostgresStorage(t)
+	userID, other, invitee := newPostgresUser(t, s), newPostgresUser(t, s), uuid.NewString()
+
+	e := newEvent(userID, baseTime, time.Hour)
+	e.Attendees = []storage.Attendee{{UserID: invitee, Status: storage.NeedsAction}}
+	require.NoError(t, s.Create(ctx, e))
+
+	_, err := s.Get(ctx, other, e.ID)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+	_, err = s.Get(ctx, invitee, e.ID)
+	require.NoError(t, err)
+
+	for _, id := range []string{other, invitee} {
+		hijacked := e
+		hijacked.UserID = id
+		hijacked.Attendees = nil
+		require.ErrorIs(t, s.Update(ctx, e.ID, hijacked, storage.AnyVersion), storage.ErrEventNotFound)
+		require.ErrorIs(t, s.Delete(ctx, id, e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+	}
+	got, err := s.Get(ctx, userID, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), got.Version)
+}
+
+func eventIDs(events []storage.Event) []string {
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+// BenchmarkStoragePostgresCreate measures the busy check of a user holding
+// n events.
+func BenchmarkStoragePostgresCreate(b *testing.B) {
+	ctx := context.Background()
+	s := newPostgresStorage(b)
+
+	for _, n := range []int{1000, 10000, 100000, 1000000} {
+		userID := uuid.NewString()
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO events (id, title, start_time, end_time, user_id, until_time)
+			SELECT $1 || i, 'meeting', $2::timestamptz + i * interval '1 hour',
+				$2::timestamptz + i * interval '1 hour' + interval '30 minutes', $1,
+				$2::timestamptz + i * interval '1 hour' + interval '30 minutes'
+			FROM generate_series(0, $3 - 1) AS i`,
+			userID, baseTime, n,
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("busy/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				start := baseTime.Add(time.Duration(i%n)*time.Hour + 15*time.Minute)
+				if err := s.Create(ctx, newEvent(userID, start, 30*time.Minute)); !errors.Is(err, storage.ErrDateBusy) {
+					b.Fatalf("expected ErrDateBusy, got %v", err)
+				}
+			}
+		})
+
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE user_id = $1`, userID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,20 +1,922 @@
 package sqlstorage
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-type Storage struct { // TODO
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	_ "github.com/jackc/pgx/v4/stdlib" // register pgx driver for database/sql
+)
+
+var _ storage.Storage = (*Storage)(nil)
+
+const (
+	uniqueViolation    = "23505"
+	exclusionViolation = "23P01"
+	undefinedTable     = "42P01"
+)
+
+const eventColumns = `id, title, start_time, end_time, description, user_id, notify_before,
+	rrule, exdates, series_id, recurrence_id, time_zone, attendees, version`
+
+type Storage struct {
+	dsn string
+	db  *sql.DB
 }
 
-func New() *Storage {
-	return &Storage{}
+func New(dsn string) *Storage {
+	return &Storage{dsn: dsn}
 }
 
 func (s *Storage) Connect(ctx context.Context) error {
-	// TODO
+	db, err := sql.Open("pgx", s.dsn)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("ping database: %w", err)
+	}
+	s.db = db
+
+	return nil
+}
+
+func (s *Storage) Close(_ context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *Storage) Create(ctx context.Context, e storage.Event) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	overlap := storage.OverlapAllowed(ctx)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUser(ctx, tx, e.UserID); err != nil {
+			return err
+		}
+		if !overlap {
+			if err := checkBusy(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		e.Version = 1
+		if err := insertEvent(ctx, tx, e, overlap); err != nil {
+			return err
+		}
+		return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionCreated, storage.Event{}, e, e.Version))
+	})
+}
+
+// Update replaces the event keeping its exception dates and series link.
+func (s *Storage) Update(ctx context.Context, id string, e storage.Event, version int64) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	e.ID = id
+
+	overlap := storage.OverlapAllowed(ctx)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUser(ctx, tx, e.UserID); err != nil {
+			return err
+		}
+		old, err := getOwnEvent(ctx, tx, e.UserID, id)
+		if err != nil {
+			return err
+		}
+		if err := storage.CheckVersion(old, version); err != nil {
+			return err
+		}
+		if old.SeriesID != "" && e.Recurring() {
+			return storage.ErrNestedRecurrence
+		}
+		e.ExDates = old.ExDates
+		e.SeriesID = old.SeriesID
+		e.RecurrenceID = old.RecurrenceID
+		e.Attendees = storage.KeepResponses(e.Attendees, old.Attendees)
+
+		same := storage.SameSchedule(old, e)
+		if !overlap && !same {
+			if err := checkBusy(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		if err := updateEvent(ctx, tx, e, overlapFlag(overlap, same)); err != nil {
+			return err
+		}
+		return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionUpdated, old, e, old.Version+1))
+	})
+}
+
+// Delete marks the event deleted, edited occurrences of a recurring event go with it.
+func (s *Storage) Delete(ctx context.Context, userID, id string, version int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		e, err := getOwnEvent(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		if err := storage.CheckVersion(e, version); err != nil {
+			return err
+		}
+		_, err = setDeleted(ctx, tx, id, sql.NullTime{}, nullTime(time.Now().UTC()), storage.RevisionDeleted)
+		return err
+	})
+}
+
+// Get matches invitations like ListVisibleRange.
+func (s *Storage) Get(ctx context.Context, userID, id string) (storage.Event, error) {
+	e, err := scanEvent(s.db.QueryRowContext(ctx,
+		`SELECT `+eventColumns+` FROM events
+		WHERE id = $1 AND (user_id = $2 OR attendees @> jsonb_build_array(jsonb_build_object('user_id', $2::text)))
+			AND deleted_at IS NULL`,
+		id, userID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	return e, err
+}
+
+func (s *Storage) GetDeleted(ctx context.Context, id string) (storage.Event, error) {
+	return getDeleted(ctx, s.db, id, false)
+}
+
+func (s *Storage) Restore(ctx context.Context, id string) error {
+	overlap := storage.OverlapAllowed(ctx)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		e, err := getDeleted(ctx, tx, id, false)
+		if errors.Is(err, storage.ErrEventNotFound) {
+			if _, err := getEvent(ctx, tx, id, false); err == nil {
+				return storage.ErrNotDeleted
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// The user is locked before the rows like in other writes.
+		if err := lockUser(ctx, tx, e.UserID); err != nil {
+			return err
+		}
+		if e, err = getDeleted(ctx, tx, id, true); err != nil {
+			return err
+		}
+		if e.SeriesID != "" {
+			_, err := getEvent(ctx, tx, e.SeriesID, false)
+			if errors.Is(err, storage.ErrEventNotFound) {
+				return fmt.Errorf("%w: series %s is deleted", storage.ErrEventNotFound, e.SeriesID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		deletedAt := nullTime(e.DeletedAt)
+		if overlap {
+			_, err = tx.ExecContext(ctx,
+				`UPDATE events SET overlap = true WHERE (id = $1 OR series_id = $1) AND deleted_at = $2`,
+				id, deletedAt,
+			)
+			if err != nil {
+				return err
+			}
+		} else {
+			restored, err := queryEvents(ctx, tx,
+				`SELECT `+eventColumns+` FROM events WHERE (id = $1 OR series_id = $1) AND deleted_at = $2`,
+				id, deletedAt,
+			)
+			if err != nil {
+				return err
+			}
+			for _, r := range restored {
+				if err := checkBusy(ctx, tx, r); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = setDeleted(ctx, tx, id, deletedAt, sql.NullTime{}, storage.RevisionRestored)
+		return writeError(err)
+	})
+}
+
+func (s *Storage) History(ctx context.Context, id string) ([]storage.Revision, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT version, user_id, action, changes, created_at FROM event_revisions
+		WHERE event_id = $1 ORDER BY version`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := make([]storage.Revision, 0)
+	for rows.Next() {
+		var (
+			r       = storage.Revision{EventID: id}
+			action  string
+			changes pgtype.JSONB
+		)
+		if err := rows.Scan(&r.Version, &r.UserID, &action, &changes, &r.At); err != nil {
+			return nil, err
+		}
+		r.Action = storage.RevisionAction(action)
+		r.At = r.At.UTC()
+		if err := changes.AssignTo(&r.Changes); err != nil {
+			return nil, fmt.Errorf("decode revision changes: %w", err)
+		}
+		if len(r.Changes) == 0 {
+			r.Changes = nil
+		}
+		revisions = append(revisions, r)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *Storage) UpdateOccurrence(
+	ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+) error {
+	e.ID = storage.OccurrenceID(seriesID, recurrenceID)
+	e.SeriesID = seriesID
+	e.RecurrenceID = recurrenceID
+	e.ExDates = nil
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	overlap := storage.OverlapAllowed(ctx)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := lockUser(ctx, tx, e.UserID); err != nil {
+			return err
+		}
+		series, err := getSeries(ctx, tx, seriesID)
+		if err != nil {
+			return err
+		}
+		old, err := getEvent(ctx, tx, e.ID, true)
+		edited := err == nil
+		if err != nil && !errors.Is(err, storage.ErrEventNotFound) {
+			return err
+		}
+		if edited {
+			e.Attendees = storage.KeepResponses(e.Attendees, old.Attendees)
+		} else {
+			e.Version = 1
+			if !series.HasOccurrence(recurrenceID) {
+				return storage.ErrNoOccurrence
+			}
+			e.Attendees = storage.KeepResponses(e.Attendees, series.Attendees)
+			if err := addExDate(ctx, tx, series, recurrenceID); err != nil {
+				return err
+			}
+		}
+
+		same := edited && storage.SameSchedule(old, e)
+		if !overlap && !same {
+			if err := checkBusy(ctx, tx, e); err != nil {
+				return err
+			}
+		}
+		if edited {
+			if err := updateEvent(ctx, tx, e, overlapFlag(overlap, same)); err != nil {
+				return err
+			}
+			return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionUpdated, old, e, old.Version+1))
+		}
+		if err := insertEvent(ctx, tx, e, overlap); err != nil {
+			return err
+		}
+		return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionCreated, storage.Event{}, e, e.Version))
+	})
+}
+
+// CancelOccurrence marks an edited occurrence deleted, other occurrences
+// become exception dates of the series.
+func (s *Storage) CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		series, err := getSeries(ctx, tx, seriesID)
+		if err != nil {
+			return err
+		}
+
+		n, err := setDeleted(ctx, tx, storage.OccurrenceID(seriesID, recurrenceID),
+			sql.NullTime{}, nullTime(time.Now().UTC()), storage.RevisionDeleted,
+		)
+		if err != nil || n > 0 {
+			return err
+		}
+
+		if !series.HasOccurrence(recurrenceID) {
+			return storage.ErrNoOccurrence
+		}
+		return addExDate(ctx, tx, series, recurrenceID)
+	})
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, id, userID string, status storage.AttendeeStatus) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		e, err := getEvent(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		attendees, err := storage.WithStatus(e.Attendees, userID, status)
+		if err != nil {
+			return err
+		}
+		value, err := attendeesJSON(attendees)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE events SET attendees = $2, version = version + 1 WHERE id = $1`, id, value,
+		)
+		if err != nil {
+			return err
+		}
+		updated := e
+		updated.Attendees = attendees
+		return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionUpdated, e, updated, e.Version+1))
+	})
+}
+
+func (s *Storage) ListDay(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.DayRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListWeek(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.WeekRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListMonth(ctx context.Context, userID string, date time.Time) ([]storage.Event, error) {
+	from, to := storage.MonthRange(date)
+	return s.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) CountEvents(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM events WHERE user_id = $1 AND deleted_at IS NULL`, userID,
+	).Scan(&n)
+	return n, err
+}
+
+func (s *Storage) ListByUser(ctx context.Context, userID string) ([]storage.Event, error) {
+	return queryEvents(ctx, s.db,
+		`SELECT `+eventColumns+` FROM events WHERE user_id = $1 AND deleted_at IS NULL ORDER BY start_time, id`,
+		userID,
+	)
+}
+
+// ListUserRange selects candidates with events_user_id_span_idx and
+// events_attendees_idx and expands recurring ones in Go.
+func (s *Storage) ListUserRange(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	return s.userRange(ctx,
+		`jsonb_build_array(jsonb_build_object('user_id', $1::text, 'status', 'accepted'))`, userID, from, to)
+}
+
+// ListVisibleRange selects candidates like ListUserRange, invitations
+// match whatever the response.
+func (s *Storage) ListVisibleRange(ctx context.Context, userID string, from, to time.Time) ([]storage.Event, error) {
+	return s.userRange(ctx, `jsonb_build_array(jsonb_build_object('user_id', $1::text))`, userID, from, to)
+}
+
+// userRange expands the events of userID overlapping [from, to) and the
+// events whose attendees contain invited.
+func (s *Storage) userRange(ctx context.Context, invited, userID string, from, to time.Time) ([]storage.Event, error) {
+	events, err := queryEvents(ctx, s.db,
+		`SELECT `+eventColumns+` FROM events
+		WHERE (user_id = $1 OR attendees @> `+invited+`)
+			AND deleted_at IS NULL AND tstzrange(start_time, until_time, '[]') && tstzrange($2::timestamptz, $3::timestamptz, '[]')
+		ORDER BY start_time`,
+		userID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Expand(events, from, to), nil
+}
+
+// Search pages with the row comparison against the cursor, so pages do not
+// shift when events are added or removed. Titles and IDs are compared by
+// bytes like in the memory storage.
+func (s *Storage) Search(ctx context.Context, q storage.SearchQuery) (storage.SearchPage, error) {
+	if err := q.Validate(); err != nil {
+		return storage.SearchPage{}, err
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	user := arg(q.UserID)
+	where := []string{
+		`deleted_at IS NULL`,
+		`(user_id = ` + user + ` OR attendees @> jsonb_build_array(jsonb_build_object('user_id', ` + user + `::text)))`,
+	}
+	if q.OwnerID != "" {
+		where = append(where, `user_id = `+arg(q.OwnerID))
+	}
+	if !q.From.IsZero() {
+		where = append(where, `(until_time IS NULL OR until_time > `+arg(q.From)+`)`)
+	}
+	if !q.To.IsZero() {
+		where = append(where, `start_time < `+arg(q.To))
+	}
+	if q.HasNotification != nil {
+		if *q.HasNotification {
+			where = append(where, `notify_before > 0`)
+		} else {
+			where = append(where, `notify_before = 0`)
+		}
+	}
+	if words := storage.SearchWords(q.Text); len(words) > 0 {
+		arr, err := textArray(words)
+		if err != nil {
+			return storage.SearchPage{}, err
+		}
+		where = append(where, `search_words @> `+arg(arr))
+	}
+
+	key, order, cmp := `start_time`, ``, `>`
+	switch q.Sort {
+	case storage.SortByStartDesc:
+		order, cmp = ` DESC`, `<`
+	case storage.SortByTitle:
+		key = `title COLLATE "C"`
+	}
+	if q.After != nil {
+		var after interface{} = q.After.Key
+		if q.Sort != storage.SortByTitle {
+			after, _ = time.Parse(time.RFC3339Nano, q.After.Key)
+		}
+		where = append(where, `(`+key+`, id COLLATE "C") `+cmp+` (`+arg(after)+`, `+arg(q.After.ID)+`)`)
+	}
+
+	events, err := queryEvents(ctx, s.db,
+		`SELECT `+eventColumns+` FROM events
+		WHERE `+strings.Join(where, ` AND `)+`
+		ORDER BY `+key+order+`, id COLLATE "C"`+order+`
+		LIMIT `+arg(q.Limit+1),
+		args...,
+	)
+	if err != nil {
+		return storage.SearchPage{}, err
+	}
+
+	page := storage.SearchPage{Events: events}
+	if len(events) > q.Limit {
+		page.Events = events[:q.Limit]
+		next := q.Sort.CursorOf(page.Events[q.Limit-1])
+		page.Next = &next
+	}
+	return page, nil
+}
+
+// ListToNotify selects candidates in SQL and expands recurring ones in Go.
+func (s *Storage) ListToNotify(ctx context.Context, now time.Time) ([]storage.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+eventColumns+`, notified_until FROM events
+		WHERE notify_before > 0 AND start_time - notify_before * interval '1 second' <= $1
+			AND (until_time IS NULL OR until_time > $1)
+			AND (rrule <> '' OR notified_until IS NULL) AND deleted_at IS NULL
+		ORDER BY start_time`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]storage.Event, 0)
+	for rows.Next() {
+		var notifiedUntil sql.NullTime
+		e, err := scanEvent(rows, &notifiedUntil)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, storage.DueOccurrences(e, now, notifiedUntil.Time)...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartAt.Before(events[j].StartAt)
+	})
+
+	return events, nil
+}
+
+func (s *Storage) MarkNotified(ctx context.Context, id string, until time.Time) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE events SET notified_until = GREATEST(notified_until, $2) WHERE id = $1 AND deleted_at IS NULL`,
+		id, until,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// DeleteEndedBefore never removes endless recurring events, revisions go
+// with the events.
+func (s *Storage) DeleteEndedBefore(ctx context.Context, t time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM events WHERE until_time < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *Storage) GetUser(ctx context.Context, id string) (storage.User, error) {
+	u := storage.User{ID: id}
+	var weekStart int16
+	err := s.db.QueryRowContext(ctx,
+		`SELECT time_zone, week_start FROM users WHERE id = $1`, id,
+	).Scan(&u.TimeZone, &weekStart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.User{}, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return storage.User{}, err
+	}
+	u.WeekStart = time.Weekday(weekStart)
+
+	return u, nil
+}
+
+func (s *Storage) SaveUser(ctx context.Context, u storage.User) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO users (id, time_zone, week_start) VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET time_zone = excluded.time_zone, week_start = excluded.week_start`,
+		u.ID, u.TimeZone, int16(u.WeekStart),
+	)
+	return err
+}
+
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func queryEvents(ctx context.Context, q querier, query string, args ...interface{}) ([]storage.Event, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]storage.Event, 0)
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// getEvent returns the event unless it is deleted.
+func getEvent(ctx context.Context, q querier, id string, forUpdate bool) (storage.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events WHERE id = $1 AND deleted_at IS NULL`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	e, err := scanEvent(q.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	return e, err
+}
+
+// getOwnEvent locks the event of userID for update.
+func getOwnEvent(ctx context.Context, q querier, userID, id string) (storage.Event, error) {
+	e, err := scanEvent(q.QueryRowContext(ctx,
+		`SELECT `+eventColumns+` FROM events WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+		id, userID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	return e, err
+}
+
+func getDeleted(ctx context.Context, q querier, id string, forUpdate bool) (storage.Event, error) {
+	query := `SELECT ` + eventColumns + `, deleted_at FROM events WHERE id = $1 AND deleted_at IS NOT NULL`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	var deletedAt time.Time
+	e, err := scanEvent(q.QueryRowContext(ctx, query, id), &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Event{}, storage.ErrEventNotFound
+	}
+	e.DeletedAt = deletedAt.UTC()
+	return e, err
+}
+
+func getSeries(ctx context.Context, tx *sql.Tx, id string) (storage.Event, error) {
+	series, err := getEvent(ctx, tx, id, true)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	if !series.Recurring() {
+		return storage.Event{}, storage.ErrNotRecurring
+	}
+	return series, nil
+}
+
+// insertEvent stores the event, overlap exempts it from the events_no_overlap constraint.
+func insertEvent(ctx context.Context, tx *sql.Tx, e storage.Event, overlap bool) error {
+	exdates, err := timestampArray(e.ExDates)
+	if err != nil {
+		return err
+	}
+	attendees, err := attendeesJSON(e.Attendees)
+	if err != nil {
+		return err
+	}
+	words, err := searchWords(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO events (`+eventColumns+`, until_time, overlap, search_words)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(e.NotifyBefore/time.Second),
+		e.RRule, exdates, nullString(e.SeriesID), nullTime(e.RecurrenceID), e.TimeZone, attendees, e.Version,
+		untilTime(e), overlap, words,
+	)
+	return writeError(err)
+}
+
+// updateEvent leaves exception dates and the series link as they are,
+// increases the version and forgets sent notifications when the event moves.
+// A null overlap keeps the overlap column as it is.
+func updateEvent(ctx context.Context, tx *sql.Tx, e storage.Event, overlap sql.NullBool) error {
+	attendees, err := attendeesJSON(e.Attendees)
+	if err != nil {
+		return err
+	}
+	words, err := searchWords(e)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE events
+		SET title = $2, start_time = $3, end_time = $4, description = $5, user_id = $6, notify_before = $7,
+			rrule = $8, until_time = $9, time_zone = $10, overlap = COALESCE($11, overlap), attendees = $12, version = version + 1,
+			notified_until = CASE WHEN start_time = $3 AND notify_before = $7 THEN notified_until END,
+			search_words = $13
+		WHERE id = $1`,
+		e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(e.NotifyBefore/time.Second),
+		e.RRule, untilTime(e), e.TimeZone, overlap, attendees, words,
+	)
+	if err != nil {
+		return writeError(err)
+	}
+	return expectAffected(res)
+}
+
+// overlapFlag returns the overlap column of an updated event: set with the
+// option, cleared once the event passed the busy check and kept when the
+// event did not move, so it was not checked.
+func overlapFlag(overlap, same bool) sql.NullBool {
+	return sql.NullBool{Bool: overlap, Valid: overlap || !same}
+}
+
+// writeError maps constraint violations to storage errors.
+func writeError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case uniqueViolation:
+		return storage.ErrEventExists
+	case exclusionViolation:
+		return storage.ErrDateBusy
+	default:
+		return err
+	}
+}
+
+func addExDate(ctx context.Context, tx *sql.Tx, series storage.Event, exdate time.Time) error {
+	updated := series
+	updated.ExDates = append(append([]time.Time(nil), series.ExDates...), exdate)
+	exdates, err := timestampArray(updated.ExDates)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE events SET exdates = $2, version = version + 1 WHERE id = $1`, series.ID, exdates,
+	)
+	if err != nil {
+		return err
+	}
+	return addRevision(ctx, tx, storage.NewRevision(ctx, storage.RevisionUpdated, series, updated, series.Version+1))
+}
+
+// setDeleted changes deleted_at of the event and its edited occurrences
+// from one value to another, increases their versions and records the
+// revisions. It returns the number of changed events.
+func setDeleted(
+	ctx context.Context, tx *sql.Tx, id string, from, to sql.NullTime, action storage.RevisionAction,
+) (int64, error) {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO event_revisions (event_id, version, user_id, action, created_at)
+		SELECT id, version + 1, $3, $4, $5 FROM events
+		WHERE (id = $1 OR series_id = $1) AND deleted_at IS NOT DISTINCT FROM $2`,
+		id, from, storage.Actor(ctx), string(action), time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE events SET deleted_at = $3, version = version + 1
+		WHERE (id = $1 OR series_id = $1) AND deleted_at IS NOT DISTINCT FROM $2`,
+		id, from, to,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func addRevision(ctx context.Context, tx *sql.Tx, r storage.Revision) error {
+	changes := r.Changes
+	if changes == nil {
+		changes = []storage.FieldChange{}
+	}
+	var value pgtype.JSONB
+	if err := value.Set(changes); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO event_revisions (event_id, version, user_id, action, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		r.EventID, r.Version, r.UserID, string(r.Action), value, r.At,
+	)
+	return err
+}
+
+// lockUser serializes writers of the same user with an advisory lock
+// held until the end of the transaction, so a busy check cannot race an insert.
+func lockUser(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, userID)
+	return err
+}
+
+// checkBusy selects events of the user whose spans overlap the span of e
+// with events_user_id_span_idx and compares their occurrences in Go.
+// Events stored with overlaps allowed do not count, like in the
+// events_no_overlap constraint guarding one-off events.
+// The user must be locked with lockUser.
+func checkBusy(ctx context.Context, tx *sql.Tx, e storage.Event) error {
+	candidates, err := queryEvents(ctx, tx,
+		`SELECT `+eventColumns+` FROM events
+		WHERE user_id = $1 AND id <> $2 AND deleted_at IS NULL AND NOT overlap
+			AND tstzrange(start_time, until_time, '[]') && tstzrange($3::timestamptz, $4::timestamptz, '[]')`,
+		e.UserID, e.ID, e.StartAt, untilTime(e),
+	)
+	if err != nil {
+		return err
+	}
+	for _, other := range candidates {
+		if storage.Conflict(e, other) {
+			return storage.ErrDateBusy
+		}
+	}
+
 	return nil
 }
 
-func (s *Storage) Close(ctx context.Context) error {
-	// TODO
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return storage.ErrEventNotFound
+	}
 	return nil
 }
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row rowScanner, extra ...interface{}) (storage.Event, error) {
+	var (
+		e            storage.Event
+		notifyBefore int64
+		exdates      pgtype.TimestamptzArray
+		seriesID     sql.NullString
+		recurrenceID sql.NullTime
+		attendees    pgtype.JSONB
+	)
+
+	dest := append([]interface{}{
+		&e.ID, &e.Title, &e.StartAt, &e.EndAt, &e.Description, &e.UserID, &notifyBefore,
+		&e.RRule, &exdates, &seriesID, &recurrenceID, &e.TimeZone, &attendees, &e.Version,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return storage.Event{}, err
+	}
+	e.NotifyBefore = time.Duration(notifyBefore) * time.Second
+	for _, ex := range exdates.Elements {
+		e.ExDates = append(e.ExDates, ex.Time)
+	}
+	e.SeriesID = seriesID.String
+	e.RecurrenceID = recurrenceID.Time
+	if err := attendees.AssignTo(&e.Attendees); err != nil {
+		return storage.Event{}, fmt.Errorf("decode attendees: %w", err)
+	}
+	if len(e.Attendees) == 0 {
+		e.Attendees = nil
+	}
+
+	return e.UTC(), nil
+}
+
+// untilTime is the value of the until_time column, NULL for endless series.
+func untilTime(e storage.Event) sql.NullTime {
+	end, ok := e.SeriesEnd()
+	return sql.NullTime{Time: end, Valid: ok}
+}
+
+func timestampArray(ts []time.Time) (pgtype.TimestamptzArray, error) {
+	var arr pgtype.TimestamptzArray
+	err := arr.Set(append([]time.Time{}, ts...))
+	return arr, err
+}
+
+func textArray(s []string) (pgtype.TextArray, error) {
+	var arr pgtype.TextArray
+	err := arr.Set(append([]string{}, s...))
+	return arr, err
+}
+
+// searchWords returns the search_words column of the event, Search matches
+// it against the words of the query, so both are split by storage.SearchWords.
+func searchWords(e storage.Event) (pgtype.TextArray, error) {
+	return textArray(storage.SearchWords(e.Title + " " + e.Description))
+}
+
+// attendeesJSON encodes attendees for the attendees column, no attendees are an empty array.
+func attendeesJSON(attendees []storage.Attendee) (pgtype.JSONB, error) {
+	var res pgtype.JSONB
+	if attendees == nil {
+		attendees = []storage.Attendee{}
+	}
+	err := res.Set(attendees)
+	return res, err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,1062 @@
+package sqlstorage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func newEvent(userID string, start time.Time, d time.Duration) storage.Event {
+	return storage.Event{
+		ID:           uuid.NewString(),
+		Title:        "meeting",
+		StartAt:      start,
+		EndAt:        start.Add(d),
+		Description:  "weekly sync",
+		UserID:       userID,
+		NotifyBefore: 15 * time.Minute,
+		Version:      1,
+	}
+}
+
+// noAttendees is the attendees argument of events nobody is invited to.
+var noAttendees = []byte("[]")
+
+// meetingWords is the search_words argument of events made by newEvent.
+const meetingWords = "{meeting,weekly,sync}"
+
+func newMockStorage(t *testing.T) (*Storage, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, mock.ExpectationsWereMet())
+		_ = db.Close()
+	})
+
+	return &Storage{db: db}, mock
+}
+
+func expectLock(mock sqlmock.Sqlmock, userID string) {
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectBusyCheck(mock sqlmock.Sqlmock, e storage.Event, candidates ...storage.Event) {
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE user_id = \$1 AND id <> \$2 AND deleted_at IS NULL AND NOT overlap\s+AND tstzrange`).
+		WithArgs(e.UserID, e.ID, e.StartAt, untilTime(e)).
+		WillReturnRows(eventRows(candidates...))
+}
+
+func expectGet(mock sqlmock.Sqlmock, id string, events ...storage.Event) {
+	q := mock.ExpectQuery(`SELECT .+ FROM events WHERE id = \$1 AND deleted_at IS NULL FOR UPDATE`).WithArgs(id)
+	if len(events) == 0 {
+		q.WillReturnError(sql.ErrNoRows)
+		return
+	}
+	q.WillReturnRows(eventRows(events...))
+}
+
+// expectGetOwn expects the event id of userID to be locked for update.
+func expectGetOwn(mock sqlmock.Sqlmock, userID, id string, events ...storage.Event) {
+	q := mock.ExpectQuery(`SELECT .+ FROM events WHERE id = \$1 AND user_id = \$2 AND deleted_at IS NULL FOR UPDATE`).
+		WithArgs(id, userID)
+	if len(events) == 0 {
+		q.WillReturnError(sql.ErrNoRows)
+		return
+	}
+	q.WillReturnRows(eventRows(events...))
+}
+
+func expectRevision(mock sqlmock.Sqlmock, id string, version int64, action storage.RevisionAction) {
+	mock.ExpectExec(`INSERT INTO event_revisions \(event_id, version, user_id, action, changes, created_at\)`).
+		WithArgs(id, version, "", string(action), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectSetDeleted expects n events to be deleted or restored with setDeleted.
+func expectSetDeleted(mock sqlmock.Sqlmock, id string, action storage.RevisionAction, n int64) {
+	mock.ExpectExec(`INSERT INTO event_revisions \(event_id, version, user_id, action, created_at\)\s+SELECT id, version \+ 1`).
+		WithArgs(id, sqlmock.AnyArg(), "", string(action), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, n))
+	mock.ExpectExec(`UPDATE events SET deleted_at = \$3, version = version \+ 1\s+WHERE \(id = \$1 OR series_id = \$1\)`).
+		WithArgs(id, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, n))
+}
+
+var eventColumnNames = []string{
+	"id", "title", "start_time", "end_time", "description", "user_id", "notify_before",
+	"rrule", "exdates", "series_id", "recurrence_id", "time_zone", "attendees", "version",
+}
+
+func eventRows(events ...storage.Event) *sqlmock.Rows {
+	rows := sqlmock.NewRows(eventColumnNames)
+	for _, e := range events {
+		rows.AddRow(eventValues(e)...)
+	}
+	return rows
+}
+
+func eventValues(e storage.Event) []driver.Value {
+	exdates, err := timestampArray(e.ExDates)
+	if err != nil {
+		panic(err)
+	}
+	attendees, err := attendeesJSON(e.Attendees)
+	if err != nil {
+		panic(err)
+	}
+	values := make([]driver.Value, 0, 14)
+	for _, v := range []driver.Valuer{exdates, nullString(e.SeriesID), nullTime(e.RecurrenceID)} {
+		value, err := v.Value()
+		if err != nil {
+			panic(err)
+		}
+		values = append(values, value)
+	}
+	values = append([]driver.Value{
+		e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(e.NotifyBefore / time.Second), e.RRule,
+	}, values...)
+	attendeesValue, err := attendees.Value()
+	if err != nil {
+		panic(err)
+	}
+	return append(values, e.TimeZone, attendeesValue, e.Version)
+}
+
+func TestStorageCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectBusyCheck(mock, e, newEvent("user", baseTime.Add(time.Hour), time.Hour))
+		mock.ExpectExec(`INSERT INTO events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900),
+				"", sqlmock.AnyArg(), nil, nil, "", noAttendees, int64(1), e.EndAt, false, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO event_revisions`).
+			WithArgs(e.ID, int64(1), "alice", "created", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Create(storage.WithActor(ctx, "alice"), e))
+	})
+
+	t.Run("endless series", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		e.RRule = "FREQ=WEEKLY"
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectBusyCheck(mock, e)
+		mock.ExpectExec(`INSERT INTO events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900),
+				e.RRule, sqlmock.AnyArg(), nil, nil, "", noAttendees, int64(1), nil, false, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 1, storage.RevisionCreated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Create(ctx, e))
+	})
+
+	t.Run("date busy", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		weekly := newEvent("user", baseTime.AddDate(0, 0, -7).Add(30*time.Minute), time.Hour)
+		weekly.RRule = "FREQ=WEEKLY"
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectBusyCheck(mock, e, weekly)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrDateBusy)
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		mock.ExpectExec(`INSERT INTO events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900),
+				"", sqlmock.AnyArg(), nil, nil, "", noAttendees, int64(1), e.EndAt, true, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 1, storage.RevisionCreated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Create(storage.WithOverlap(ctx), e))
+	})
+
+	t.Run("exclusion constraint", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectBusyCheck(mock, e)
+		mock.ExpectExec(`INSERT INTO events`).
+			WillReturnError(&pgconn.PgError{Code: exclusionViolation})
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrDateBusy)
+	})
+
+	t.Run("duplicate id", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectBusyCheck(mock, e)
+		mock.ExpectExec(`INSERT INTO events`).
+			WillReturnError(&pgconn.PgError{Code: uniqueViolation})
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrEventExists)
+	})
+
+	t.Run("invalid event", func(t *testing.T) {
+		s, _ := newMockStorage(t)
+		e := newEvent("user", baseTime, -time.Hour)
+
+		require.ErrorIs(t, s.Create(ctx, e), storage.ErrInvalidPeriod)
+	})
+}
+
+func TestStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		old := newEvent("user", baseTime, time.Hour)
+		e := old
+		e.StartAt = baseTime.Add(time.Hour)
+		e.EndAt = e.StartAt.Add(time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, old)
+		expectBusyCheck(mock, e)
+		mock.ExpectExec(`UPDATE events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900), "", e.EndAt, "", false, noAttendees, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	})
+
+	t.Run("same time", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		e.Title = "retro"
+
+		// Nothing to check, the event keeps its overlap column.
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, newEvent("user", baseTime, time.Hour))
+		mock.ExpectExec(`UPDATE events\s+SET .+ overlap = COALESCE\(\$11, overlap\)`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900), "", e.EndAt, "", nil, noAttendees,
+				"{retro,weekly,sync}").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		mock.ExpectExec(`UPDATE events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900), "", e.EndAt, "", true, noAttendees, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(storage.WithOverlap(ctx), e.ID, e, storage.AnyVersion))
+	})
+
+	t.Run("keeps exception dates", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		old := newEvent("user", baseTime, time.Hour)
+		old.RRule = "FREQ=DAILY"
+		old.ExDates = []time.Time{baseTime.AddDate(0, 0, 1)}
+		e := old
+		e.ExDates = nil
+		e.EndAt = baseTime.Add(90 * time.Minute)
+		blocker := newEvent("user", baseTime.AddDate(0, 0, 1), time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, old)
+		mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE user_id = \$1`).
+			WillReturnRows(eventRows(blocker))
+		mock.ExpectExec(`UPDATE events`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(ctx, e.ID, e, storage.AnyVersion))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Update(ctx, e.ID, e, storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("other owner", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("other", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, "other", e.ID)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Update(ctx, e.ID, e, storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("expected version", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		old := newEvent("user", baseTime, time.Hour)
+		old.Version = 3
+		e := old
+		e.Title = "retro"
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, old)
+		mock.ExpectExec(`UPDATE events\s+SET .+ version = version \+ 1`).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 4, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(ctx, e.ID, e, 3))
+	})
+
+	t.Run("version conflict", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		old := newEvent("user", baseTime, time.Hour)
+		old.Version = 4
+
+		mock.ExpectBegin()
+		expectLock(mock, old.UserID)
+		expectGetOwn(mock, old.UserID, old.ID, old)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Update(ctx, old.ID, old, 3), storage.ErrVersionConflict)
+	})
+
+	t.Run("recurring occurrence", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		e.SeriesID = "series"
+		e.RecurrenceID = baseTime
+		update := e
+		update.SeriesID = ""
+		update.RRule = "FREQ=DAILY"
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Update(ctx, e.ID, update, storage.AnyVersion), storage.ErrNestedRecurrence)
+	})
+}
+
+func TestStorageDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		expectSetDeleted(mock, e.ID, storage.RevisionDeleted, 1)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, storage.AnyVersion))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetOwn(mock, "user", "missing")
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Delete(ctx, "user", "missing", storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("other owner", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectGetOwn(mock, "other", e.ID)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Delete(ctx, "other", e.ID, storage.AnyVersion), storage.ErrEventNotFound)
+	})
+
+	t.Run("expected version", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		e.Version = 2
+
+		mock.ExpectBegin()
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		expectSetDeleted(mock, e.ID, storage.RevisionDeleted, 1)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Delete(ctx, e.UserID, e.ID, 2))
+	})
+
+	t.Run("version conflict", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		e := newEvent("user", baseTime, time.Hour)
+		e.Version = 2
+
+		mock.ExpectBegin()
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Delete(ctx, e.UserID, e.ID, 1), storage.ErrVersionConflict)
+	})
+}
+
+func TestStorageRestore(t *testing.T) {
+	ctx := context.Background()
+	deletedAt := baseTime.Add(time.Hour)
+	e := newEvent("user", baseTime, time.Hour)
+	e.Version = 2
+
+	expectGetDeleted := func(mock sqlmock.Sqlmock, forUpdate bool, events ...storage.Event) {
+		query := `SELECT .+, deleted_at FROM events WHERE id = \$1 AND deleted_at IS NOT NULL`
+		if forUpdate {
+			query += ` FOR UPDATE`
+		}
+		q := mock.ExpectQuery(query).WithArgs(e.ID)
+		if len(events) == 0 {
+			q.WillReturnError(sql.ErrNoRows)
+			return
+		}
+		rows := sqlmock.NewRows(append(eventColumnNames, "deleted_at"))
+		for _, ev := range events {
+			rows.AddRow(append(eventValues(ev), deletedAt)...)
+		}
+		q.WillReturnRows(rows)
+	}
+	expectRestored := func(mock sqlmock.Sqlmock, events ...storage.Event) {
+		mock.ExpectQuery(`SELECT .+ FROM events WHERE \(id = \$1 OR series_id = \$1\) AND deleted_at = \$2`).
+			WithArgs(e.ID, deletedAt).
+			WillReturnRows(eventRows(events...))
+	}
+
+	t.Run("success", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false, e)
+		expectLock(mock, e.UserID)
+		expectGetDeleted(mock, true, e)
+		expectRestored(mock, e)
+		expectBusyCheck(mock, e)
+		expectSetDeleted(mock, e.ID, storage.RevisionRestored, 1)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Restore(ctx, e.ID))
+	})
+
+	t.Run("get deleted", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		expectGetDeleted(mock, false, e)
+
+		got, err := s.GetDeleted(ctx, e.ID)
+		require.NoError(t, err)
+		require.Equal(t, deletedAt, got.DeletedAt)
+		got.DeletedAt = time.Time{}
+		require.Equal(t, e, got)
+	})
+
+	t.Run("date busy", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false, e)
+		expectLock(mock, e.UserID)
+		expectGetDeleted(mock, true, e)
+		expectRestored(mock, e)
+		expectBusyCheck(mock, e, newEvent("user", baseTime.Add(30*time.Minute), time.Hour))
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrDateBusy)
+	})
+
+	t.Run("overlap allowed", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false, e)
+		expectLock(mock, e.UserID)
+		expectGetDeleted(mock, true, e)
+		mock.ExpectExec(`UPDATE events SET overlap = true WHERE \(id = \$1 OR series_id = \$1\) AND deleted_at = \$2`).
+			WithArgs(e.ID, deletedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectSetDeleted(mock, e.ID, storage.RevisionRestored, 1)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Restore(storage.WithOverlap(ctx), e.ID))
+	})
+
+	t.Run("not deleted", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false)
+		mock.ExpectQuery(`SELECT .+ FROM events WHERE id = \$1 AND deleted_at IS NULL`).
+			WithArgs(e.ID).
+			WillReturnRows(eventRows(e))
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrNotDeleted)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false)
+		mock.ExpectQuery(`SELECT .+ FROM events WHERE id = \$1 AND deleted_at IS NULL`).
+			WithArgs(e.ID).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrEventNotFound)
+	})
+
+	t.Run("occurrence of deleted series", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		occurrence := e
+		occurrence.SeriesID = "series"
+		occurrence.RecurrenceID = baseTime
+
+		mock.ExpectBegin()
+		expectGetDeleted(mock, false, occurrence)
+		expectLock(mock, e.UserID)
+		expectGetDeleted(mock, true, occurrence)
+		mock.ExpectQuery(`SELECT .+ FROM events WHERE id = \$1 AND deleted_at IS NULL`).
+			WithArgs("series").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.Restore(ctx, e.ID), storage.ErrEventNotFound)
+	})
+}
+
+func TestStorageHistory(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	at := baseTime.Add(time.Hour)
+
+	mock.ExpectQuery(`SELECT version, user_id, action, changes, created_at FROM event_revisions\s+WHERE event_id = \$1 ORDER BY version`).
+		WithArgs("id").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "user_id", "action", "changes", "created_at"}).
+			AddRow(int64(1), "alice", "created", []byte(`[{"field":"title","old":"","new":"standup"}]`), at).
+			AddRow(int64(2), "alice", "deleted", []byte(`[]`), at.Add(time.Minute)))
+
+	history, err := s.History(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, []storage.Revision{
+		{
+			EventID: "id", Version: 1, UserID: "alice", Action: storage.RevisionCreated, At: at,
+			Changes: []storage.FieldChange{{Field: "title", New: "standup"}},
+		},
+		{EventID: "id", Version: 2, UserID: "alice", Action: storage.RevisionDeleted, At: at.Add(time.Minute)},
+	}, history)
+}
+
+func TestStorageGet(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	e := newEvent("user", baseTime, time.Hour)
+	series := newEvent("user", baseTime, time.Hour)
+	series.RRule = "FREQ=DAILY"
+	series.ExDates = []time.Time{baseTime.AddDate(0, 0, 1), baseTime.AddDate(0, 0, 2)}
+
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE id = \$1 AND \(user_id = \$2 OR attendees @> `).
+		WithArgs(e.ID, e.UserID).
+		WillReturnRows(eventRows(e))
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE id = \$1 AND \(user_id = \$2 OR attendees @> `).
+		WithArgs(series.ID, series.UserID).
+		WillReturnRows(eventRows(series))
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE id = \$1 AND \(user_id = \$2 OR attendees @> `).
+		WithArgs("missing", "user").
+		WillReturnError(sql.ErrNoRows)
+
+	got, err := s.Get(ctx, e.UserID, e.ID)
+	require.NoError(t, err)
+	require.Equal(t, e, got)
+
+	got, err = s.Get(ctx, series.UserID, series.ID)
+	require.NoError(t, err)
+	require.Equal(t, series.RRule, got.RRule)
+	require.Len(t, got.ExDates, 2)
+	require.True(t, series.ExDates[1].Equal(got.ExDates[1]))
+
+	_, err = s.Get(ctx, "user", "missing")
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+}
+
+func TestStorageList(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	dayStart := time.Date(2021, time.June, 14, 0, 0, 0, 0, time.UTC)
+	events := []storage.Event{
+		newEvent("user", baseTime, time.Hour),
+		newEvent("user", baseTime.Add(2*time.Hour), time.Hour),
+	}
+
+	query := `SELECT .+ FROM events\s+WHERE \(user_id = \$1 OR attendees @> .+\)\s+AND deleted_at IS NULL`
+	mock.ExpectQuery(query).
+		WithArgs("user", dayStart, dayStart.AddDate(0, 0, 1)).
+		WillReturnRows(eventRows(events...))
+	mock.ExpectQuery(query).
+		WithArgs("other", dayStart, dayStart.AddDate(0, 0, 7)).
+		WillReturnRows(eventRows())
+	mock.ExpectQuery(query).
+		WithArgs("user", dayStart, dayStart.AddDate(0, 1, 0)).
+		WillReturnRows(eventRows(events[0]))
+
+	day, err := s.ListDay(ctx, "user", baseTime)
+	require.NoError(t, err)
+	require.Equal(t, events, day)
+
+	week, err := s.ListWeek(ctx, "other", dayStart)
+	require.NoError(t, err)
+	require.Empty(t, week)
+
+	month, err := s.ListMonth(ctx, "user", dayStart)
+	require.NoError(t, err)
+	require.Equal(t, events[:1], month)
+}
+
+func TestStorageCountEvents(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM events WHERE user_id = \$1 AND deleted_at IS NULL`).
+		WithArgs("user").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	n, err := s.CountEvents(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+}
+
+func TestStorageListByUser(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	series := newEvent("user", baseTime, time.Hour)
+	series.RRule = "FREQ=DAILY"
+	events := []storage.Event{series, newEvent("user", baseTime.Add(2*time.Hour), time.Hour)}
+
+	mock.ExpectQuery(`SELECT .+ FROM events WHERE user_id = \$1 AND deleted_at IS NULL ORDER BY start_time`).
+		WithArgs("user").
+		WillReturnRows(eventRows(events...))
+
+	list, err := s.ListByUser(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, events, list)
+}
+
+func TestStorageListUserRange(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	series := newEvent("user", baseTime.AddDate(0, 0, -3), time.Hour)
+	series.RRule = "FREQ=DAILY"
+	single := newEvent("user", baseTime.Add(2*time.Hour), time.Hour)
+	from, to := baseTime, baseTime.AddDate(0, 0, 1)
+
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE \(user_id = \$1\s+OR attendees @> .+\)\s+AND deleted_at IS NULL AND tstzrange\(start_time, until_time, '\[\]'\) && `).
+		WithArgs("user", from, to).
+		WillReturnRows(eventRows(series, single))
+
+	list, err := s.ListUserRange(ctx, "user", from, to)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, series.ID, list[0].ID)
+	require.Equal(t, baseTime, list[0].StartAt)
+	require.Equal(t, baseTime, list[0].RecurrenceID)
+	require.Equal(t, single, list[1])
+}
+
+func TestStorageListVisibleRange(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	invited := newEvent("owner", baseTime, time.Hour)
+	invited.Attendees = []storage.Attendee{{UserID: "user", Status: storage.NeedsAction}}
+	from, to := baseTime, baseTime.AddDate(0, 0, 1)
+
+	mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE \(user_id = \$1 OR attendees @> `+
+		`jsonb_build_array\(jsonb_build_object\('user_id', \$1::text\)\)\)\s+`+
+		`AND deleted_at IS NULL AND tstzrange\(start_time, until_time, '\[\]'\) && `).
+		WithArgs("user", from, to).
+		WillReturnRows(eventRows(invited))
+
+	list, err := s.ListVisibleRange(ctx, "user", from, to)
+	require.NoError(t, err)
+	require.Equal(t, []storage.Event{invited}, list)
+}
+
+func TestStorageSearch(t *testing.T) {
+	ctx := context.Background()
+	first := newEvent("user", baseTime, time.Hour)
+	second := newEvent("user", baseTime.Add(2*time.Hour), time.Hour)
+	third := newEvent("user", baseTime.Add(4*time.Hour), time.Hour)
+	yes := true
+
+	t.Run("filters", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		from, to := baseTime, baseTime.AddDate(0, 0, 1)
+		mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE deleted_at IS NULL AND \(user_id = \$1 OR attendees @> .+\) `+
+			`AND user_id = \$2 AND \(until_time IS NULL OR until_time > \$3\) AND start_time < \$4 AND notify_before > 0 `+
+			`AND search_words @> \$5\s+`+
+			`ORDER BY start_time, id COLLATE "C"\s+LIMIT \$6`).
+			WithArgs("user", "owner", from, to, "{weekly,sync}", 3).
+			WillReturnRows(eventRows(first, second, third))
+
+		page, err := s.Search(ctx, storage.SearchQuery{
+			UserID: "user", OwnerID: "owner", From: from, To: to, HasNotification: &yes,
+			Text: "weekly sync", Sort: storage.SortByStart, Limit: 2,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []storage.Event{first, second}, page.Events)
+		require.Equal(t, &storage.Cursor{Sort: storage.SortByStart, Key: "2021-06-14T12:00:00Z", ID: second.ID}, page.Next)
+	})
+
+	t.Run("after cursor", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		cursor := storage.SortByStartDesc.CursorOf(third)
+		mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE deleted_at IS NULL AND \(user_id = \$1 OR .+\) `+
+			`AND notify_before = 0 AND \(start_time, id COLLATE "C"\) < \(\$2, \$3\)\s+`+
+			`ORDER BY start_time DESC, id COLLATE "C" DESC\s+LIMIT \$4`).
+			WithArgs("user", third.StartAt, third.ID, 3).
+			WillReturnRows(eventRows(second, first))
+
+		no := false
+		page, err := s.Search(ctx, storage.SearchQuery{
+			UserID: "user", HasNotification: &no, Sort: storage.SortByStartDesc, After: &cursor, Limit: 2,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []storage.Event{second, first}, page.Events)
+		require.Nil(t, page.Next)
+	})
+
+	t.Run("title", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		cursor := storage.SortByTitle.CursorOf(first)
+		mock.ExpectQuery(`WHERE deleted_at IS NULL AND \(user_id = \$1 OR .+\) `+
+			`AND \(title COLLATE "C", id COLLATE "C"\) > \(\$2, \$3\)\s+ORDER BY title COLLATE "C", id COLLATE "C"\s+LIMIT \$4`).
+			WithArgs("user", first.Title, first.ID, 11).
+			WillReturnRows(eventRows())
+
+		page, err := s.Search(ctx, storage.SearchQuery{UserID: "user", Sort: storage.SortByTitle, After: &cursor, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, page.Events)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		s, _ := newMockStorage(t)
+		_, err := s.Search(ctx, storage.SearchQuery{UserID: "user", Sort: storage.SortByStart})
+		require.ErrorIs(t, err, storage.ErrInvalidSearch)
+	})
+}
+
+func TestStorageOccurrences(t *testing.T) {
+	ctx := context.Background()
+	series := newEvent("user", baseTime, time.Hour)
+	series.RRule = "FREQ=DAILY"
+	day := func(n int) time.Time { return baseTime.AddDate(0, 0, n) }
+	moved := newEvent("user", day(1).Add(2*time.Hour), time.Hour)
+	override := moved
+	override.ID = storage.OccurrenceID(series.ID, day(1))
+	override.SeriesID = series.ID
+	override.RecurrenceID = day(1)
+
+	t.Run("edit", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectLock(mock, "user")
+		expectGet(mock, series.ID, series)
+		expectGet(mock, override.ID)
+		mock.ExpectExec(`UPDATE events SET exdates = \$2, version = version \+ 1 WHERE id = \$1`).
+			WithArgs(series.ID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, series.ID, 2, storage.RevisionUpdated)
+		expectBusyCheck(mock, override)
+		mock.ExpectExec(`INSERT INTO events`).
+			WithArgs(override.ID, moved.Title, moved.StartAt, moved.EndAt, moved.Description, "user", int64(900),
+				"", sqlmock.AnyArg(), series.ID, day(1), "", noAttendees, int64(1), moved.EndAt, false, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, override.ID, 1, storage.RevisionCreated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, day(1), moved))
+	})
+
+	t.Run("edit again", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		edited := series
+		edited.ExDates = []time.Time{day(1)}
+
+		mock.ExpectBegin()
+		expectLock(mock, "user")
+		expectGet(mock, series.ID, edited)
+		expectGet(mock, override.ID, override)
+		mock.ExpectExec(`UPDATE events`).
+			WithArgs(override.ID, moved.Title, moved.StartAt, moved.EndAt, moved.Description, "user", int64(900),
+				"", moved.EndAt, "", nil, noAttendees, meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, override.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.UpdateOccurrence(ctx, series.ID, day(1), moved))
+	})
+
+	t.Run("edit missing occurrence", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectLock(mock, "user")
+		expectGet(mock, series.ID, series)
+		expectGet(mock, storage.OccurrenceID(series.ID, day(1).Add(time.Minute)))
+		mock.ExpectRollback()
+
+		require.ErrorIs(t,
+			s.UpdateOccurrence(ctx, series.ID, day(1).Add(time.Minute), moved),
+			storage.ErrNoOccurrence)
+	})
+
+	t.Run("edit one-off event", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		single := newEvent("user", baseTime, time.Hour)
+
+		mock.ExpectBegin()
+		expectLock(mock, "user")
+		expectGet(mock, single.ID, single)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.UpdateOccurrence(ctx, single.ID, baseTime, moved), storage.ErrNotRecurring)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGet(mock, series.ID, series)
+		expectSetDeleted(mock, storage.OccurrenceID(series.ID, day(2)), storage.RevisionDeleted, 0)
+		mock.ExpectExec(`UPDATE events SET exdates = \$2, version = version \+ 1 WHERE id = \$1`).
+			WithArgs(series.ID, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, series.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(2)))
+	})
+
+	t.Run("cancel edited", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGet(mock, series.ID, series)
+		expectSetDeleted(mock, override.ID, storage.RevisionDeleted, 1)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.CancelOccurrence(ctx, series.ID, day(1)))
+	})
+
+	t.Run("cancel missing series", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+
+		mock.ExpectBegin()
+		expectGet(mock, "missing")
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.CancelOccurrence(ctx, "missing", day(1)), storage.ErrEventNotFound)
+	})
+}
+
+func TestStorageNotifications(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	e := newEvent("user", baseTime, time.Hour)
+	daily := newEvent("user", baseTime.AddDate(0, 0, -2).Add(5*time.Minute), time.Hour)
+	daily.RRule = "FREQ=DAILY"
+	now := baseTime.Add(-10 * time.Minute)
+
+	rows := sqlmock.NewRows(append(eventColumnNames, "notified_until"))
+	rows.AddRow(append(eventValues(daily), daily.StartAt.AddDate(0, 0, 1))...)
+	rows.AddRow(append(eventValues(e), nil)...)
+
+	mock.ExpectQuery(`SELECT .+, notified_until FROM events\s+WHERE notify_before > 0`).
+		WithArgs(now).
+		WillReturnRows(rows)
+	mock.ExpectExec(`UPDATE events SET notified_until = GREATEST\(notified_until, \$2\) WHERE id = \$1`).
+		WithArgs(e.ID, e.StartAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE events SET notified_until`).
+		WithArgs("missing", e.StartAt).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM events WHERE until_time < \$1`).
+		WithArgs(baseTime).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	list, err := s.ListToNotify(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, e, list[0])
+	require.Equal(t, daily.ID, list[1].ID)
+	require.Equal(t, baseTime.Add(5*time.Minute), list[1].StartAt)
+
+	require.NoError(t, s.MarkNotified(ctx, e.ID, e.StartAt))
+	require.ErrorIs(t, s.MarkNotified(ctx, "missing", e.StartAt), storage.ErrEventNotFound)
+
+	n, err := s.DeleteEndedBefore(ctx, baseTime)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+}
+
+func TestStorageUsers(t *testing.T) {
+	ctx := context.Background()
+	s, mock := newMockStorage(t)
+	u := storage.User{ID: "user", TimeZone: "Europe/Berlin", WeekStart: time.Sunday}
+
+	mock.ExpectExec(`INSERT INTO users \(id, time_zone, week_start\) VALUES \(\$1, \$2, \$3\)\s+ON CONFLICT`).
+		WithArgs(u.ID, u.TimeZone, int16(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT time_zone, week_start FROM users WHERE id = \$1`).
+		WithArgs(u.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"time_zone", "week_start"}).AddRow(u.TimeZone, int16(0)))
+	mock.ExpectQuery(`SELECT time_zone, week_start FROM users`).
+		WithArgs("missing").
+		WillReturnError(sql.ErrNoRows)
+
+	require.NoError(t, s.SaveUser(ctx, u))
+	require.ErrorIs(t, s.SaveUser(ctx, storage.User{ID: "user", TimeZone: "Mars/Olympus"}), storage.ErrInvalidUser)
+
+	got, err := s.GetUser(ctx, u.ID)
+	require.NoError(t, err)
+	require.Equal(t, u, got)
+
+	_, err = s.GetUser(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func TestStorageAttendees(t *testing.T) {
+	ctx := context.Background()
+	e := newEvent("user", baseTime, time.Hour)
+	e.Attendees = []storage.Attendee{
+		{UserID: "bob", Status: storage.Accepted},
+		{UserID: "carol", Status: storage.NeedsAction},
+	}
+
+	t.Run("get", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		mock.ExpectQuery(`SELECT .+ FROM events\s+WHERE id = \$1 AND \(user_id = \$2 OR attendees @> `).
+			WithArgs(e.ID, "carol").
+			WillReturnRows(eventRows(e))
+
+		got, err := s.Get(ctx, "carol", e.ID)
+		require.NoError(t, err)
+		require.Equal(t, e, got)
+	})
+
+	t.Run("respond", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		expectGet(mock, e.ID, e)
+		mock.ExpectExec(`UPDATE events SET attendees = \$2, version = version \+ 1 WHERE id = \$1`).
+			WithArgs(e.ID, []byte(`[{"user_id":"bob","status":"accepted"},{"user_id":"carol","status":"declined"}]`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO event_revisions`).
+			WithArgs(e.ID, int64(2), "carol", "updated",
+				[]byte(`[{"field":"attendees","old":"bob:accepted,carol:needs-action","new":"bob:accepted,carol:declined"}]`),
+				sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, s.SetAttendeeStatus(storage.WithActor(ctx, "carol"), e.ID, "carol", storage.Declined))
+	})
+
+	t.Run("not invited", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		expectGet(mock, e.ID, e)
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.SetAttendeeStatus(ctx, e.ID, "dave", storage.Accepted), storage.ErrAttendeeNotFound)
+	})
+
+	t.Run("missing event", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		expectGet(mock, "missing")
+		mock.ExpectRollback()
+
+		require.ErrorIs(t, s.SetAttendeeStatus(ctx, "missing", "bob", storage.Accepted), storage.ErrEventNotFound)
+	})
+
+	t.Run("update keeps responses", func(t *testing.T) {
+		s, mock := newMockStorage(t)
+		updated := e
+		updated.Attendees = []storage.Attendee{
+			{UserID: "bob", Status: storage.NeedsAction},
+			{UserID: "dave", Status: storage.NeedsAction},
+		}
+
+		mock.ExpectBegin()
+		expectLock(mock, e.UserID)
+		expectGetOwn(mock, e.UserID, e.ID, e)
+		mock.ExpectExec(`UPDATE events`).
+			WithArgs(e.ID, e.Title, e.StartAt, e.EndAt, e.Description, e.UserID, int64(900), "", e.EndAt, "", nil,
+				[]byte(`[{"user_id":"bob","status":"accepted"},{"user_id":"dave","status":"needs-action"}]`), meetingWords).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRevision(mock, e.ID, 2, storage.RevisionUpdated)
+		mock.ExpectCommit()
+
+		require.NoError(t, s.Update(ctx, e.ID, updated, storage.AnyVersion))
+	})
+}
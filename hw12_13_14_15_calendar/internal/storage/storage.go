@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Storage keeps events of all users. Create, Update and UpdateOccurrence
+// fail with ErrDateBusy when the event overlaps another event of the same
+// user unless ctx comes from WithOverlap. Only the owner's events count,
+// accepted invitations do not make the time of an attendee busy for them.
+// Update and UpdateOccurrence keep the statuses of attendees who stay
+// invited, new attendees get the status they are passed with.
+//
+// Every change of an event increases its Version. Update and Delete take the
+// version the caller has seen and fail with ErrVersionConflict if the event
+// has been changed since, AnyVersion skips the check.
+//
+// Update and Delete apply to the events of the owner only, Update takes the
+// owner from e.UserID. Get returns the events the user owns or is invited to.
+// Events of other users are reported as ErrEventNotFound.
+//
+// Every change is recorded as a Revision with the user from WithActor.
+// Delete and CancelOccurrence only mark events deleted, such events may be
+// restored and are removed for good by DeleteEndedBefore only.
+type Storage interface {
+	Create(ctx context.Context, e Event) error
+	Update(ctx context.Context, id string, e Event, version int64) error
+	Delete(ctx context.Context, userID, id string, version int64) error
+	Get(ctx context.Context, userID, id string) (Event, error)
+	// GetDeleted returns a deleted event or ErrEventNotFound if there is no
+	// deleted event with the ID.
+	GetDeleted(ctx context.Context, id string) (Event, error)
+	// Restore brings back a deleted event with the edited occurrences deleted
+	// along with it. It fails with ErrNotDeleted if the event is not deleted,
+	// with ErrEventNotFound if it is an occurrence of a deleted series, and
+	// with ErrDateBusy like Create.
+	Restore(ctx context.Context, id string) error
+	// History returns the revisions of the event ordered by version, none
+	// for unknown events.
+	History(ctx context.Context, id string) ([]Revision, error)
+	// ListDay, ListWeek and ListMonth return occurrences of the events of the
+	// user overlapping DayRange, WeekRange or MonthRange of date like ListUserRange.
+	ListDay(ctx context.Context, userID string, date time.Time) ([]Event, error)
+	ListWeek(ctx context.Context, userID string, date time.Time) ([]Event, error)
+	ListMonth(ctx context.Context, userID string, date time.Time) ([]Event, error)
+	// CountEvents returns the number of events the user owns, edited
+	// occurrences included and deleted events not.
+	CountEvents(ctx context.Context, userID string) (int, error)
+	// ListByUser returns all events of the user ordered by start, recurring
+	// events are not expanded and their edited occurrences come separately.
+	ListByUser(ctx context.Context, userID string) ([]Event, error)
+	// ListUserRange returns occurrences of the events the user owns or has
+	// accepted an invitation to overlapping [from, to) ordered by start.
+	ListUserRange(ctx context.Context, userID string, from, to time.Time) ([]Event, error)
+	// ListVisibleRange returns occurrences of the events the user owns or is
+	// invited to overlapping [from, to) ordered by start, whatever the response.
+	ListVisibleRange(ctx context.Context, userID string, from, to time.Time) ([]Event, error)
+	// Search returns a page of events matching the query, it fails with
+	// ErrInvalidSearch for invalid queries.
+	Search(ctx context.Context, q SearchQuery) (SearchPage, error)
+
+	// UpdateOccurrence replaces a single occurrence of the recurring event
+	// seriesID starting at recurrenceID with e. The replacement is stored
+	// under OccurrenceID and the series gets an exception date.
+	UpdateOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time, e Event) error
+	// CancelOccurrence removes a single occurrence of the recurring event.
+	CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) error
+
+	// SetAttendeeStatus records the response of the invited user to the
+	// event, it fails with ErrAttendeeNotFound if the user is not invited.
+	SetAttendeeStatus(ctx context.Context, id, userID string, status AttendeeStatus) error
+
+	// ListToNotify returns occurrences with NotifyBefore set that start after now,
+	// whose notification time has come and which are not marked notified yet.
+	ListToNotify(ctx context.Context, now time.Time) ([]Event, error)
+	// MarkNotified excludes occurrences of the event starting up to until
+	// from ListToNotify. The mark is reset when the start or NotifyBefore
+	// of the event is changed.
+	MarkNotified(ctx context.Context, id string, until time.Time) error
+	// DeleteEndedBefore removes events that ended before t, deleted or not,
+	// with their history and returns their number.
+	DeleteEndedBefore(ctx context.Context, t time.Time) (int64, error)
+
+	// GetUser returns settings of the user or ErrUserNotFound if they were never saved.
+	GetUser(ctx context.Context, id string) (User, error)
+	// SaveUser creates or replaces settings of the user.
+	SaveUser(ctx context.Context, u User) error
+}
+
+// AnyVersion makes Update and Delete apply to any version of the event.
+const AnyVersion int64 = 0
+
+// CheckVersion fails with ErrVersionConflict unless version is AnyVersion or the version of e.
+func CheckVersion(e Event, version int64) error {
+	if version != AnyVersion && version != e.Version {
+		return fmt.Errorf("%w: expected version %d, event has %d", ErrVersionConflict, version, e.Version)
+	}
+	return nil
+}
+
+// DayRange returns the bounds of the day containing date in date's location.
+func DayRange(date time.Time) (time.Time, time.Time) {
+	from := startOfDay(date)
+	return from, from.AddDate(0, 0, 1)
+}
+
+// WeekRange returns seven days starting from the day containing date.
+func WeekRange(date time.Time) (time.Time, time.Time) {
+	from := startOfDay(date)
+	return from, from.AddDate(0, 0, 7)
+}
+
+// MonthRange returns one calendar month starting from the day containing date.
+func MonthRange(date time.Time) (time.Time, time.Time) {
+	from := startOfDay(date)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// StartOfWeek returns the start of the first day of the week containing date
+// in date's location.
+func StartOfWeek(date time.Time, weekStart time.Weekday) time.Time {
+	days := (int(date.Weekday()) - int(weekStart) + 7) % 7
+	return startOfDay(date).AddDate(0, 0, -days)
+}
+
+// StartOfMonth returns the start of the first day of the month containing date
+// in date's location.
+func StartOfMonth(date time.Time) time.Time {
+	y, m, _ := date.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, date.Location())
+}
+
+func startOfDay(date time.Time) time.Time {
+	y, m, d := date.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+}
@@ -0,0 +1,122 @@
+// Package storagetest checks that storage implementations behave the same way.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns a storage and a user who has no events in it yet.
+type Factory func(t *testing.T) (s storage.Storage, userID string)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+// Run runs the contract tests against the implementation built by newStorage.
+func Run(t *testing.T, newStorage Factory) {
+	t.Helper()
+
+	t.Run("search text", func(t *testing.T) {
+		searchText(t, newStorage)
+	})
+	t.Run("count events", func(t *testing.T) {
+		countEvents(t, newStorage)
+	})
+}
+
+func newEvent(userID, title string, start time.Time) storage.Event {
+	return storage.Event{
+		ID:      uuid.NewString(),
+		Title:   title,
+		StartAt: start,
+		EndAt:   start.Add(time.Hour),
+		UserID:  userID,
+	}
+}
+
+func searchText(t *testing.T, newStorage Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name               string
+		title, description string
+		query              string
+		match              bool
+	}{
+		{name: "case is ignored", title: "Weekly Sync", query: "weekly SYNC", match: true},
+		{name: "words in any order", title: "weekly sync", query: "sync weekly", match: true},
+		{name: "title and description", title: "retro", description: "sprint notes", query: "retro notes", match: true},
+		{name: "all words", title: "weekly sync", query: "sync retro"},
+		{name: "whole words", title: "syncing", query: "sync"},
+		{name: "no stemming", title: "meetings", query: "meeting"},
+		{name: "hyphen splits", title: "e-mail review", query: "mail", match: true},
+		{name: "hyphenated query", title: "e-mail review", query: "e-mail", match: true},
+		{name: "joined words", title: "e-mail review", query: "email"},
+		{name: "address splits", title: "ping bob@example.com", query: "example", match: true},
+		{name: "underscore splits", title: "room_42", query: "42", match: true},
+		{name: "decimal splits", title: "release 3.5", query: "5", match: true},
+		{name: "digits", title: "Q3 planning 2021", query: "2021 q3", match: true},
+		{name: "letters outside ASCII", title: "Über Größe", query: "größe ÜBER", match: true},
+		{name: "query without words", title: "weekly sync", query: "!!", match: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, userID := newStorage(t)
+			e := newEvent(userID, tc.title, baseTime)
+			e.Description = tc.description
+			require.NoError(t, s.Create(ctx, e))
+
+			page, err := s.Search(ctx, storage.SearchQuery{
+				UserID: userID, Text: tc.query, Sort: storage.SortByStart, Limit: 10,
+			})
+			require.NoError(t, err)
+			ids := make([]string, 0, len(page.Events))
+			for _, found := range page.Events {
+				ids = append(ids, found.ID)
+			}
+			if tc.match {
+				require.Equal(t, []string{e.ID}, ids)
+			} else {
+				require.Empty(t, ids)
+			}
+		})
+	}
+}
+
+func countEvents(t *testing.T, newStorage Factory) {
+	t.Helper()
+
+	ctx := context.Background()
+	s, userID := newStorage(t)
+	count := func() int {
+		t.Helper()
+		n, err := s.CountEvents(ctx, userID)
+		require.NoError(t, err)
+		return n
+	}
+	require.Equal(t, 0, count())
+
+	weekly := newEvent(userID, "weekly", baseTime)
+	weekly.RRule = "FREQ=WEEKLY"
+	standup := newEvent(userID, "standup", baseTime.Add(2*time.Hour))
+	require.NoError(t, s.Create(ctx, weekly))
+	require.NoError(t, s.Create(ctx, standup))
+	require.Equal(t, 2, count())
+
+	nextWeek := baseTime.AddDate(0, 0, 7)
+	require.NoError(t, s.UpdateOccurrence(ctx, weekly.ID, nextWeek, newEvent(userID, "weekly", nextWeek.Add(time.Hour))))
+	require.Equal(t, 3, count(), "edited occurrences are counted")
+
+	require.NoError(t, s.Delete(ctx, userID, standup.ID, storage.AnyVersion))
+	require.Equal(t, 2, count(), "deleted events are not counted")
+	require.NoError(t, s.Delete(ctx, userID, weekly.ID, storage.AnyVersion))
+	require.Equal(t, 0, count(), "occurrences go with the series")
+	require.NoError(t, s.Restore(ctx, weekly.ID))
+	require.Equal(t, 2, count())
+}
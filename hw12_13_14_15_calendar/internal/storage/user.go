@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// User holds calendar settings of a user.
+type User struct {
+	ID string
+	// TimeZone is the IANA name of the zone new events of the user get and
+	// in which day, week and month bounds are computed.
+	TimeZone  string
+	WeekStart time.Weekday
+}
+
+func (u User) Validate() error {
+	if u.ID == "" {
+		return ErrEmptyUserSettingsID
+	}
+	if _, err := LoadLocation(u.TimeZone); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUser, err)
+	}
+	if u.WeekStart < time.Sunday || u.WeekStart > time.Saturday {
+		return fmt.Errorf("%w: unknown week start %d", ErrInvalidUser, u.WeekStart)
+	}
+	return nil
+}
+
+// Location returns the zone of the user, UTC when it is not set.
+func (u User) Location() *time.Location {
+	loc, err := LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseWeekday parses an English weekday name like "monday" in any case.
+func ParseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s)
+}
+
+var locations sync.Map
+
+// LoadLocation is time.LoadLocation caching the loaded zones, an empty name is UTC.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier lets propagators read and write message headers.
+type headerCarrier map[string]string
+
+func (c headerCarrier) Get(key string) string {
+	return c[key]
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Publisher records a producer span for every message and passes the trace
+// context to consumers in the message headers.
+type Publisher struct {
+	publisher queue.Publisher
+	queue     string
+}
+
+func NewPublisher(p queue.Publisher, queueName string) *Publisher {
+	return &Publisher{publisher: p, queue: queueName}
+}
+
+func (p *Publisher) Publish(ctx context.Context, msg queue.Message) (err error) {
+	ctx, span := Tracer().Start(ctx, p.queue+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingDestinationKey.String(p.queue),
+			semconv.MessagingDestinationKindQueue,
+		),
+	)
+	defer end(span, &err)
+
+	// The headers may be shared with the caller, e.g. when a message is
+	// moved to the dead-letter queue.
+	headers := make(headerCarrier, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	msg.Headers = headers
+
+	return p.publisher.Publish(ctx, msg)
+}
+
+// Consumer records a consumer span for every handled message, the span
+// continues the trace the message was published in.
+type Consumer struct {
+	consumer queue.Consumer
+	queue    string
+}
+
+func NewConsumer(c queue.Consumer, queueName string) *Consumer {
+	return &Consumer{consumer: c, queue: queueName}
+}
+
+func (c *Consumer) Consume(ctx context.Context, handler queue.Handler) error {
+	return c.consumer.Consume(ctx, func(ctx context.Context, msg queue.Message) (err error) {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Headers))
+		ctx, span := Tracer().Start(ctx, c.queue+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingDestinationKey.String(c.queue),
+				semconv.MessagingDestinationKindQueue,
+				semconv.MessagingOperationProcess,
+			),
+		)
+		defer end(span, &err)
+
+		return handler(ctx, msg)
+	})
+}
@@ -0,0 +1,172 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Storage records a client span for every operation of the wrapped storage.
+type Storage struct {
+	storage storage.Storage
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func NewStorage(s storage.Storage) *Storage {
+	return &Storage{storage: s}
+}
+
+func (s *Storage) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBOperationKey.String(operation)),
+	)
+}
+
+func end(span trace.Span, err *error) {
+	End(span, *err)
+}
+
+func (s *Storage) Create(ctx context.Context, e storage.Event) (err error) {
+	ctx, span := s.start(ctx, "create")
+	defer end(span, &err)
+	return s.storage.Create(ctx, e)
+}
+
+func (s *Storage) Update(ctx context.Context, id string, e storage.Event, version int64) (err error) {
+	ctx, span := s.start(ctx, "update")
+	defer end(span, &err)
+	return s.storage.Update(ctx, id, e, version)
+}
+
+func (s *Storage) Delete(ctx context.Context, userID, id string, version int64) (err error) {
+	ctx, span := s.start(ctx, "delete")
+	defer end(span, &err)
+	return s.storage.Delete(ctx, userID, id, version)
+}
+
+func (s *Storage) Get(ctx context.Context, userID, id string) (_ storage.Event, err error) {
+	ctx, span := s.start(ctx, "get")
+	defer end(span, &err)
+	return s.storage.Get(ctx, userID, id)
+}
+
+func (s *Storage) GetDeleted(ctx context.Context, id string) (_ storage.Event, err error) {
+	ctx, span := s.start(ctx, "get_deleted")
+	defer end(span, &err)
+	return s.storage.GetDeleted(ctx, id)
+}
+
+func (s *Storage) Restore(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "restore")
+	defer end(span, &err)
+	return s.storage.Restore(ctx, id)
+}
+
+func (s *Storage) History(ctx context.Context, id string) (_ []storage.Revision, err error) {
+	ctx, span := s.start(ctx, "history")
+	defer end(span, &err)
+	return s.storage.History(ctx, id)
+}
+
+func (s *Storage) ListDay(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_day")
+	defer end(span, &err)
+	return s.storage.ListDay(ctx, userID, date)
+}
+
+func (s *Storage) ListWeek(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_week")
+	defer end(span, &err)
+	return s.storage.ListWeek(ctx, userID, date)
+}
+
+func (s *Storage) ListMonth(ctx context.Context, userID string, date time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_month")
+	defer end(span, &err)
+	return s.storage.ListMonth(ctx, userID, date)
+}
+
+func (s *Storage) CountEvents(ctx context.Context, userID string) (_ int, err error) {
+	ctx, span := s.start(ctx, "count_events")
+	defer end(span, &err)
+	return s.storage.CountEvents(ctx, userID)
+}
+
+func (s *Storage) ListByUser(ctx context.Context, userID string) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_by_user")
+	defer end(span, &err)
+	return s.storage.ListByUser(ctx, userID)
+}
+
+func (s *Storage) ListUserRange(ctx context.Context, userID string, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_user_range")
+	defer end(span, &err)
+	return s.storage.ListUserRange(ctx, userID, from, to)
+}
+
+func (s *Storage) ListVisibleRange(ctx context.Context, userID string, from, to time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_visible_range")
+	defer end(span, &err)
+	return s.storage.ListVisibleRange(ctx, userID, from, to)
+}
+
+func (s *Storage) Search(ctx context.Context, q storage.SearchQuery) (_ storage.SearchPage, err error) {
+	ctx, span := s.start(ctx, "search")
+	defer end(span, &err)
+	return s.storage.Search(ctx, q)
+}
+
+func (s *Storage) UpdateOccurrence(
+	ctx context.Context, seriesID string, recurrenceID time.Time, e storage.Event,
+) (err error) {
+	ctx, span := s.start(ctx, "update_occurrence")
+	defer end(span, &err)
+	return s.storage.UpdateOccurrence(ctx, seriesID, recurrenceID, e)
+}
+
+func (s *Storage) CancelOccurrence(ctx context.Context, seriesID string, recurrenceID time.Time) (err error) {
+	ctx, span := s.start(ctx, "cancel_occurrence")
+	defer end(span, &err)
+	return s.storage.CancelOccurrence(ctx, seriesID, recurrenceID)
+}
+
+func (s *Storage) SetAttendeeStatus(ctx context.Context, id, userID string, status storage.AttendeeStatus) (err error) {
+	ctx, span := s.start(ctx, "set_attendee_status")
+	defer end(span, &err)
+	return s.storage.SetAttendeeStatus(ctx, id, userID, status)
+}
+
+func (s *Storage) ListToNotify(ctx context.Context, now time.Time) (_ []storage.Event, err error) {
+	ctx, span := s.start(ctx, "list_to_notify")
+	defer end(span, &err)
+	return s.storage.ListToNotify(ctx, now)
+}
+
+func (s *Storage) MarkNotified(ctx context.Context, id string, until time.Time) (err error) {
+	ctx, span := s.start(ctx, "mark_notified")
+	defer end(span, &err)
+	return s.storage.MarkNotified(ctx, id, until)
+}
+
+func (s *Storage) DeleteEndedBefore(ctx context.Context, t time.Time) (_ int64, err error) {
+	ctx, span := s.start(ctx, "delete_ended_before")
+	defer end(span, &err)
+	return s.storage.DeleteEndedBefore(ctx, t)
+}
+
+func (s *Storage) GetUser(ctx context.Context, id string) (_ storage.User, err error) {
+	ctx, span := s.start(ctx, "get_user")
+	defer end(span, &err)
+	return s.storage.GetUser(ctx, id)
+}
+
+func (s *Storage) SaveUser(ctx context.Context, u storage.User) (err error) {
+	ctx, span := s.start(ctx, "save_user")
+	defer end(span, &err)
+	return s.storage.SaveUser(ctx, u)
+}
@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer of the calendar services.
+const InstrumentationName = "github.com/fixme_my_friend/hw12_13_14_15_calendar"
+
+// Exporters spans can be sent with.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+var (
+	ErrUnknownExporter = errors.New("unknown exporter")
+	ErrInvalidOptions  = errors.New("invalid tracing options")
+)
+
+type Options struct {
+	// Exporter is one of the Exporter constants, spans are not recorded
+	// with ExporterNone or an empty one.
+	Exporter string
+	// Endpoint is the host:port of the OTLP gRPC collector.
+	Endpoint string
+	// Insecure turns off TLS towards the collector.
+	Insecure bool
+	// File is where ExporterFile appends spans as JSON.
+	File string
+	// SampleRatio is the fraction of new traces recorded, traces started
+	// by a caller follow its decision.
+	SampleRatio float64
+}
+
+func (o Options) Validate() error {
+	switch o.Exporter {
+	case "", ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if o.Endpoint == "" {
+			return fmt.Errorf("%w: endpoint is required by the %s exporter", ErrInvalidOptions, ExporterOTLP)
+		}
+	case ExporterFile:
+		if o.File == "" {
+			return fmt.Errorf("%w: file is required by the %s exporter", ErrInvalidOptions, ExporterFile)
+		}
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownExporter, o.Exporter)
+	}
+	if o.SampleRatio < 0 || o.SampleRatio > 1 {
+		return fmt.Errorf("%w: sample ratio %v is not in [0, 1]", ErrInvalidOptions, o.SampleRatio)
+	}
+	return nil
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes buffered spans and must be
+// called before the process exits.
+func Setup(ctx context.Context, service string, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	exporter, closeExporter, err := newExporter(ctx, opts)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeExporter(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, func() error, error) {
+	nopClose := func() error { return nil }
+
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return nil, nopClose, nil
+	case ExporterOTLP:
+		clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("otlp exporter: %w", err)
+		}
+		return exporter, nopClose, nil
+	case ExporterStdout:
+		exporter, err := newWriterExporter(os.Stdout)
+		return exporter, nopClose, err
+	case ExporterFile:
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exporter, err := newWriterExporter(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return exporter, f.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownExporter, opts.Exporter)
+	}
+}
+
+func newWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, fmt.Errorf("stdout exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// Tracer returns the tracer of the calendar services from the global
+// provider, so spans follow Setup even if it is called later.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// End records err on span unless it is nil and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Attributes tying spans to calendar entities.
+var (
+	EventIDKey = attribute.Key("calendar.event_id")
+	UserIDKey  = attribute.Key("calendar.user_id")
+)
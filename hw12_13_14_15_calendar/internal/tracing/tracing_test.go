@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue"
+	memoryqueue "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/queue/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage"
+	memorystorage "github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/storage/memory"
+	"github.com/fixme_my_friend/hw12_13_14_15_calendar/internal/tracing/tracingtest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var baseTime = time.Date(2021, time.June, 14, 10, 0, 0, 0, time.UTC)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		err  error
+	}{
+		{name: "off", opts: Options{}},
+		{name: "none", opts: Options{Exporter: ExporterNone, SampleRatio: 1}},
+		{name: "stdout", opts: Options{Exporter: ExporterStdout, SampleRatio: 0.5}},
+		{name: "otlp", opts: Options{Exporter: ExporterOTLP, Endpoint: "localhost:4317", SampleRatio: 1}},
+		{name: "otlp without endpoint", opts: Options{Exporter: ExporterOTLP}, err: ErrInvalidOptions},
+		{name: "file", opts: Options{Exporter: ExporterFile, File: "/tmp/spans.json", SampleRatio: 1}},
+		{name: "file without path", opts: Options{Exporter: ExporterFile}, err: ErrInvalidOptions},
+		{name: "unknown exporter", opts: Options{Exporter: "jaeger"}, err: ErrUnknownExporter},
+		{name: "negative ratio", opts: Options{SampleRatio: -0.1}, err: ErrInvalidOptions},
+		{name: "ratio above one", opts: Options{SampleRatio: 1.5}, err: ErrInvalidOptions},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.Validate()
+			if tc.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	tracingtest.Record(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "spans.json")
+
+	shutdown, err := Setup(ctx, "calendar", Options{Exporter: ExporterFile, File: path, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := Tracer().Start(ctx, "standup")
+	span.End()
+	require.NoError(t, shutdown(ctx))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"Name":"standup"`)
+	require.Contains(t, string(data), `"Value":"calendar"`)
+
+	_, err = Setup(ctx, "calendar", Options{Exporter: "jaeger"})
+	require.ErrorIs(t, err, ErrUnknownExporter)
+
+	shutdown, err = Setup(ctx, "calendar", Options{Exporter: ExporterNone})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(ctx))
+}
+
+func TestStorage(t *testing.T) {
+	recorder := tracingtest.Record(t)
+	ctx := context.Background()
+	s := NewStorage(memorystorage.New())
+
+	e := storage.Event{ID: "1", Title: "standup", StartAt: baseTime, EndAt: baseTime.Add(time.Hour), UserID: "alice"}
+	require.NoError(t, s.Create(ctx, e))
+	_, err := s.Get(ctx, "alice", "missing")
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+
+	created := tracingtest.Find(t, recorder, "storage.create")
+	require.Equal(t, trace.SpanKindClient, created.SpanKind())
+	require.Contains(t, created.Attributes(), semconv.DBOperationKey.String("create"))
+	require.Equal(t, codes.Unset, created.Status().Code)
+
+	get := tracingtest.Find(t, recorder, "storage.get")
+	require.Equal(t, codes.Error, get.Status().Code)
+	require.Len(t, get.Events(), 1)
+}
+
+func TestQueuePropagation(t *testing.T) {
+	recorder := tracingtest.Record(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q := memoryqueue.NewBroker().Queue("notifications")
+	pub := NewPublisher(q, "notifications")
+	cons := NewConsumer(q, "notifications")
+
+	ctx, parent := Tracer().Start(ctx, "scheduler.notify_event")
+	headers := map[string]string{"content-type": "application/json"}
+	require.NoError(t, pub.Publish(ctx, queue.Message{Body: []byte("{}"), Headers: headers}))
+	parent.End()
+	require.Equal(t, map[string]string{"content-type": "application/json"}, headers)
+
+	consumeCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	type delivery struct {
+		msg  queue.Message
+		span trace.SpanContext
+	}
+	handled := make(chan delivery, 1)
+	go func() {
+		_ = cons.Consume(consumeCtx, func(ctx context.Context, msg queue.Message) error {
+			handled <- delivery{msg: msg, span: trace.SpanContextFromContext(ctx)}
+			stop()
+			return errors.New("sender is down")
+		})
+	}()
+
+	var d delivery
+	select {
+	case d = <-handled:
+	case <-ctx.Done():
+		t.Fatal("message is not consumed")
+	}
+	require.Equal(t, "application/json", d.msg.Headers["content-type"])
+	require.NotEmpty(t, d.msg.Headers["traceparent"])
+	require.Eventually(t, func() bool { return len(recorder.Ended()) == 3 }, time.Second, 10*time.Millisecond)
+
+	send := tracingtest.Find(t, recorder, "notifications send")
+	require.Equal(t, trace.SpanKindProducer, send.SpanKind())
+	require.Equal(t, parent.SpanContext().SpanID(), send.Parent().SpanID())
+
+	process := tracingtest.Find(t, recorder, "notifications process")
+	require.Equal(t, trace.SpanKindConsumer, process.SpanKind())
+	require.Equal(t, parent.SpanContext().TraceID(), process.SpanContext().TraceID())
+	require.Equal(t, send.SpanContext().SpanID(), process.Parent().SpanID())
+	require.Equal(t, process.SpanContext().SpanID(), d.span.SpanID())
+	require.Equal(t, codes.Error, process.Status().Code)
+}
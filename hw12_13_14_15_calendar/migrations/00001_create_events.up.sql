@@ -0,0 +1,16 @@
+CREATE TABLE events (
+    id            text PRIMARY KEY,
+    title         text        NOT NULL,
+    start_time    timestamptz NOT NULL,
+    end_time      timestamptz NOT NULL,
+    description   text        NOT NULL DEFAULT '',
+    user_id       text        NOT NULL,
+    notify_before bigint      NOT NULL DEFAULT 0,
+    CONSTRAINT events_period_check CHECK (end_time > start_time),
+    CONSTRAINT events_notify_before_check CHECK (notify_before >= 0)
+);
+
+COMMENT ON COLUMN events.notify_before IS 'seconds before start_time to send a notification, 0 means never';
+
+CREATE INDEX events_user_id_start_time_idx ON events (user_id, start_time);
+CREATE INDEX events_start_time_end_time_idx ON events (start_time, end_time);
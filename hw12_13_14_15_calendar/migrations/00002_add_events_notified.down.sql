@@ -0,0 +1,4 @@
+DROP INDEX events_end_time_idx;
+DROP INDEX events_pending_notification_idx;
+
+ALTER TABLE events DROP COLUMN notified;
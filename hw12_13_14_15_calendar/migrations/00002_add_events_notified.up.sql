@@ -0,0 +1,7 @@
+ALTER TABLE events ADD COLUMN notified boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN events.notified IS 'notification has been sent, reset when start_time or notify_before changes';
+
+CREATE INDEX events_pending_notification_idx ON events (start_time)
+    WHERE notify_before > 0 AND NOT notified;
+CREATE INDEX events_end_time_idx ON events (end_time);
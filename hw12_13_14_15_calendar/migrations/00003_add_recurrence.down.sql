@@ -0,0 +1,24 @@
+DELETE FROM events WHERE series_id IS NOT NULL;
+
+DROP INDEX events_series_id_recurrence_id_idx;
+DROP INDEX events_until_time_idx;
+DROP INDEX events_pending_notification_idx;
+
+ALTER TABLE events ADD COLUMN notified boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN events.notified IS 'notification has been sent, reset when start_time or notify_before changes';
+
+UPDATE events SET notified = notified_until IS NOT NULL AND notified_until >= start_time;
+
+ALTER TABLE events
+    DROP CONSTRAINT events_series_check,
+    DROP COLUMN notified_until,
+    DROP COLUMN until_time,
+    DROP COLUMN recurrence_id,
+    DROP COLUMN series_id,
+    DROP COLUMN exdates,
+    DROP COLUMN rrule;
+
+CREATE INDEX events_pending_notification_idx ON events (start_time)
+    WHERE notify_before > 0 AND NOT notified;
+CREATE INDEX events_end_time_idx ON events (end_time);
@@ -0,0 +1,25 @@
+ALTER TABLE events
+    ADD COLUMN rrule          text          NOT NULL DEFAULT '',
+    ADD COLUMN exdates        timestamptz[] NOT NULL DEFAULT '{}',
+    ADD COLUMN series_id      text REFERENCES events (id) ON DELETE CASCADE,
+    ADD COLUMN recurrence_id  timestamptz,
+    ADD COLUMN until_time     timestamptz,
+    ADD COLUMN notified_until timestamptz,
+    ADD CONSTRAINT events_series_check CHECK ((series_id IS NULL) = (recurrence_id IS NULL));
+
+COMMENT ON COLUMN events.rrule IS 'RFC 5545 recurrence rule, start_time and end_time describe the first occurrence';
+COMMENT ON COLUMN events.exdates IS 'original starts of cancelled or edited occurrences';
+COMMENT ON COLUMN events.series_id IS 'recurring event the edited occurrence belongs to';
+COMMENT ON COLUMN events.until_time IS 'end of the last occurrence, NULL for endless recurring events';
+COMMENT ON COLUMN events.notified_until IS 'start of the last occurrence a notification has been sent for';
+
+UPDATE events SET until_time = end_time;
+UPDATE events SET notified_until = start_time WHERE notified;
+
+DROP INDEX events_pending_notification_idx;
+DROP INDEX events_end_time_idx;
+ALTER TABLE events DROP COLUMN notified;
+
+CREATE INDEX events_pending_notification_idx ON events (start_time) WHERE notify_before > 0;
+CREATE INDEX events_until_time_idx ON events (until_time);
+CREATE UNIQUE INDEX events_series_id_recurrence_id_idx ON events (series_id, recurrence_id);
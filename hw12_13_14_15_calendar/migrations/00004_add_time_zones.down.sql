@@ -0,0 +1,3 @@
+DROP TABLE users;
+
+ALTER TABLE events DROP COLUMN time_zone;
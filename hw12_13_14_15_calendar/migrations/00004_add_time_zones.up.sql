@@ -0,0 +1,13 @@
+ALTER TABLE events ADD COLUMN time_zone text NOT NULL DEFAULT 'UTC';
+
+COMMENT ON COLUMN events.time_zone IS 'IANA zone the event is planned in, recurring events are expanded in it';
+
+CREATE TABLE users
+(
+    id         text PRIMARY KEY,
+    time_zone  text     NOT NULL DEFAULT 'UTC',
+    week_start smallint NOT NULL DEFAULT 1 CHECK (week_start BETWEEN 0 AND 6)
+);
+
+COMMENT ON TABLE users IS 'calendar settings of users, users without a row get the defaults';
+COMMENT ON COLUMN users.week_start IS 'first day of the week, 0 is Sunday';
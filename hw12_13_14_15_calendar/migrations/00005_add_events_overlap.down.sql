@@ -0,0 +1,5 @@
+ALTER TABLE events DROP CONSTRAINT events_no_overlap;
+
+DROP INDEX events_user_id_span_idx;
+
+ALTER TABLE events DROP COLUMN overlap;
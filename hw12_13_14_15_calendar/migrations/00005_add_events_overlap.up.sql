@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE events ADD COLUMN overlap boolean NOT NULL DEFAULT false;
+
+COMMENT ON COLUMN events.overlap IS 'stored with overlaps allowed, such events are not covered by events_no_overlap';
+
+-- Spans from the start to the end of the last occurrence, unbounded for endless series.
+CREATE INDEX events_user_id_span_idx ON events USING gist (user_id, tstzrange(start_time, until_time, '[]'));
+
+-- Recurring events are checked by the application only.
+ALTER TABLE events ADD CONSTRAINT events_no_overlap
+    EXCLUDE USING gist (user_id WITH =, tstzrange(start_time, end_time) WITH &&)
+    WHERE (rrule = '' AND NOT overlap);
@@ -0,0 +1,3 @@
+DROP INDEX events_attendees_idx;
+
+ALTER TABLE events DROP COLUMN attendees;
@@ -0,0 +1,6 @@
+ALTER TABLE events ADD COLUMN attendees jsonb NOT NULL DEFAULT '[]';
+
+COMMENT ON COLUMN events.attendees IS 'invited users as [{"user_id": "...", "status": "accepted"}]';
+
+-- Serves containment queries like attendees @> '[{"user_id": "..."}]'.
+CREATE INDEX events_attendees_idx ON events USING gin (attendees jsonb_path_ops);
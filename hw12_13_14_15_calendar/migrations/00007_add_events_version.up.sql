@@ -0,0 +1,3 @@
+ALTER TABLE events ADD COLUMN version bigint NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN events.version IS 'increased by every change of the event, checked by conditional updates and deletes';
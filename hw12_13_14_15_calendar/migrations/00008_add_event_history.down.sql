@@ -0,0 +1,10 @@
+DROP TABLE event_revisions;
+
+DELETE FROM events WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE events DROP CONSTRAINT events_no_overlap;
+ALTER TABLE events ADD CONSTRAINT events_no_overlap
+    EXCLUDE USING gist (user_id WITH =, tstzrange(start_time, end_time) WITH &&)
+    WHERE (rrule = '' AND NOT overlap);
+
+ALTER TABLE events DROP COLUMN deleted_at;
@@ -0,0 +1,22 @@
+ALTER TABLE events ADD COLUMN deleted_at timestamptz;
+
+COMMENT ON COLUMN events.deleted_at IS 'set when the event is deleted, such events are kept for restoring until purged';
+
+-- Deleted events do not occupy time.
+ALTER TABLE events DROP CONSTRAINT events_no_overlap;
+ALTER TABLE events ADD CONSTRAINT events_no_overlap
+    EXCLUDE USING gist (user_id WITH =, tstzrange(start_time, end_time) WITH &&)
+    WHERE (rrule = '' AND NOT overlap AND deleted_at IS NULL);
+
+CREATE TABLE event_revisions (
+    event_id   text        NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+    version    bigint      NOT NULL,
+    user_id    text        NOT NULL DEFAULT '',
+    action     text        NOT NULL,
+    changes    jsonb       NOT NULL DEFAULT '[]',
+    created_at timestamptz NOT NULL,
+    PRIMARY KEY (event_id, version)
+);
+
+COMMENT ON TABLE event_revisions IS 'changes of events, one per event version';
+COMMENT ON COLUMN event_revisions.changes IS 'changed fields as [{"field": "title", "old": "...", "new": "..."}]';
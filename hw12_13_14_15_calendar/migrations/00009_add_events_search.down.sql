@@ -0,0 +1 @@
+DROP INDEX events_search_idx;
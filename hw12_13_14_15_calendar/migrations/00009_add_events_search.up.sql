@@ -0,0 +1,2 @@
+-- Serves text search, the expression must match searchVector of the SQL storage.
+CREATE INDEX events_search_idx ON events USING gin (to_tsvector('simple', title || ' ' || description));
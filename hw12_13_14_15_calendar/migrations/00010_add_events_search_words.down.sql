@@ -0,0 +1,5 @@
+DROP INDEX events_search_words_idx;
+
+ALTER TABLE events DROP COLUMN search_words;
+
+CREATE INDEX events_search_idx ON events USING gin (to_tsvector('simple', title || ' ' || description));
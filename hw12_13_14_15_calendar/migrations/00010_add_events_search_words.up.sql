@@ -0,0 +1,13 @@
+DROP INDEX events_search_idx;
+
+ALTER TABLE events ADD COLUMN search_words text[] NOT NULL DEFAULT '{}';
+
+COMMENT ON COLUMN events.search_words IS 'words of the title and the description split by storage.SearchWords';
+
+-- Rows written before are split by Postgres, which agrees with SearchWords on
+-- ASCII text. They are split by the storage from their next update on.
+UPDATE events SET search_words = array_remove(
+    regexp_split_to_array(lower(title || ' ' || description), '[^[:alnum:]]+'), '');
+
+-- Serves containment queries like search_words @> '{"sync"}'.
+CREATE INDEX events_search_words_idx ON events USING gin (search_words);
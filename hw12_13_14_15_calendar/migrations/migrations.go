@@ -0,0 +1,10 @@
+// Package migrations embeds the versioned SQL schema of the calendar.
+//
+// Every migration is a pair of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS